@@ -42,13 +42,14 @@ func declareKeysQueryLocks(
 
 // QueryLocks uses the concurrency manager to query the state of locks
 // currently tracked by the in-memory lock table across a specified range of
-// keys. The results are paginated according to the MaxSpanRequestKeys and
+// keys. If requested, the replicated locks in the range's lock table keyspace
+// that are not tracked in memory are included as well. The results are paginated according to the MaxSpanRequestKeys and
 // TargetBytes specified in the request Header, setting the ResponseHeader's
 // ResumeSpan and ResumeReason as necessary. Note that at a minimum, the
 // response will include one result if at least one lock is found, ensuring
 // that we do not allow empty responses due to byte limits.
 func QueryLocks(
-	ctx context.Context, _ storage.Reader, cArgs CommandArgs, resp kvpb.Response,
+	ctx context.Context, reader storage.Reader, cArgs CommandArgs, resp kvpb.Response,
 ) (result.Result, error) {
 	args := cArgs.Args.(*kvpb.QueryLocksRequest)
 	h := cArgs.Header
@@ -59,11 +60,17 @@ func QueryLocks(
 		MaxLocks:           h.MaxSpanRequestKeys,
 		TargetBytes:        h.TargetBytes,
 		IncludeUncontended: args.IncludeUncontended,
+
+		IncludeReplicatedUncontended: args.IncludeReplicatedUncontended,
+		Reader:                       reader,
 	}
 
 	// Collect all LockStateInfo objects from the requested key span, up to the
 	// target byte and max key limits specified in the request header.
-	lockInfos, resumeState := concurrencyManager.QueryLockTableState(ctx, args.Span(), opts)
+	lockInfos, resumeState, err := concurrencyManager.QueryLockTableState(ctx, args.Span(), opts)
+	if err != nil {
+		return result.Result{}, err
+	}
 
 	// Set the results along with any resume reason/span for the client to
 	// continue where this request met its limits.
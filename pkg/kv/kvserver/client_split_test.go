@@ -508,7 +508,7 @@ func TestQueryLocksAcrossRanges(t *testing.T) {
 	require.Equal(t, kvpb.RESUME_KEY_LIMIT, res.ResumeReason,
 		"observed locks on %v and %v", res.Locks[0].Key, res.Locks[1].Key,
 	)
-	require.Equal(t, roachpb.Key("x"), res.ResumeSpan.Key)
+	require.Equal(t, roachpb.Key("p").Next(), res.ResumeSpan.Key)
 	require.Equal(t, roachpb.Key("z"), res.ResumeSpan.EndKey)
 
 	require.Equal(t, roachpb.Key("c"), res.Locks[0].Key)
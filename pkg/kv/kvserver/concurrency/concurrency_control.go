@@ -24,8 +24,10 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/spanset"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/txnwait"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage"
 	"github.com/cockroachdb/cockroach/pkg/storage/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
 	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 )
 
@@ -206,6 +208,18 @@ type RequestSequencer interface {
 	// requests that are blocked on this one to proceed. The guard should not
 	// be used after being released.
 	FinishReq(*Guard)
+
+	// DropLatchesAndLockWaitQueues releases the request's latches and removes it
+	// from any lock wait-queues, like FinishReq, but retains the request guard.
+	// It is used by requests that handle a concurrency retry error that requires
+	// them to do so, and are then sequenced again, with the same latch and lock
+	// spans, by passing the guard to SequenceReq. Doing so reuses the request's
+	// spans and its lock table guard (including the guard's snapshot of the lock
+	// table, if no lock has been added to or removed from the lock table since
+	// it was taken), instead of allocating new ones for each sequencing attempt.
+	//
+	// The guard must still be released by passing it to FinishReq eventually.
+	DropLatchesAndLockWaitQueues(*Guard)
 }
 
 // ContentionHandler is concerned with handling contention-related errors. This
@@ -257,16 +271,23 @@ type ContentionHandler interface {
 type LockManager interface {
 	// OnLockAcquired informs the concurrency manager that a transaction has
 	// acquired a new lock or re-acquired an existing lock that it already held.
-	OnLockAcquired(context.Context, *roachpb.LockAcquisition)
+	// It returns a retryable error if the lock table refused to track the lock
+	// because its transaction holds locks on too many keys in the range. See
+	// MaxLocksPerTransaction.
+	OnLockAcquired(context.Context, *roachpb.LockAcquisition) error
 
 	// OnLockUpdated informs the concurrency manager that a transaction has
 	// updated or released a lock or range of locks that it previously held.
 	// The Durability field of the lock update struct is ignored.
 	OnLockUpdated(context.Context, *roachpb.LockUpdate)
 
+	// OnMaxKeysLockedUpdated informs the concurrency manager that the
+	// kv.lock_table.maximum_keys_locked cluster setting has changed.
+	OnMaxKeysLockedUpdated()
+
 	// QueryLockTableState gathers detailed metadata on locks tracked in the lock
 	// table that are part of the provided span and key scope, up to provided limits.
-	QueryLockTableState(ctx context.Context, span roachpb.Span, opts QueryLockTableOptions) ([]roachpb.LockStateInfo, QueryLockTableResumeState)
+	QueryLockTableState(ctx context.Context, span roachpb.Span, opts QueryLockTableOptions) ([]roachpb.LockStateInfo, QueryLockTableResumeState, error)
 }
 
 // TransactionManager is concerned with tracking transactions that have their
@@ -276,6 +297,13 @@ type TransactionManager interface {
 	// status was updated.
 	OnTransactionUpdated(context.Context, *roachpb.Transaction)
 
+	// OnTransactionsUpdated is like OnTransactionUpdated, but informs the
+	// concurrency manager of a batch of transactions whose statuses were updated
+	// by the same command. The finalized transactions among them are also passed
+	// to the lock table as a batch, so that requests that run into their locks
+	// don't need to push them.
+	OnTransactionsUpdated(context.Context, []*roachpb.Transaction)
+
 	// GetDependents returns a set of transactions waiting on the specified
 	// transaction either directly or indirectly. The method is used to perform
 	// deadlock detection. See txnWaitQueue for more.
@@ -295,13 +323,20 @@ type RangeStateListener interface {
 	OnRangeLeaseUpdated(_ roachpb.LeaseSequence, isLeaseholder bool)
 
 	// OnRangeSplit informs the concurrency manager that its range has split off
-	// a new range to its RHS.
-	OnRangeSplit()
+	// a new range to its RHS, starting at the supplied key. The locks on keys in
+	// the RHS are returned, to be handed to the RHS range's concurrency manager
+	// through OnLocksTransferred.
+	OnRangeSplit(rhsStartKey roachpb.RKey) TransferredLocks
 
 	// OnRangeMerge informs the concurrency manager that its range has merged
 	// into its LHS neighbor. This is not called on the LHS range being merged
-	// into.
-	OnRangeMerge()
+	// into. The range's locks are returned, to be handed to the LHS range's
+	// concurrency manager through OnLocksTransferred.
+	OnRangeMerge() TransferredLocks
+
+	// OnLocksTransferred informs the concurrency manager of locks on keys that
+	// its range took over from another range through a split or a merge.
+	OnLocksTransferred(TransferredLocks)
 
 	// OnReplicaSnapshotApplied informs the concurrency manager that its replica
 	// has received a snapshot from another replica in its range.
@@ -397,6 +432,15 @@ type Request struct {
 	// existing lock in order to perform a non-locking read on a key.
 	LockTimeout time.Duration
 
+	// The maximum amount of time that the request is willing to wait on any
+	// single lock. Unlike LockTimeout, which is enforced by pushing the
+	// conflicting transaction, this is enforced by the lock table itself: once
+	// the request has been waiting on a lock for longer than this duration, it
+	// is rejected with a LockConflictError without first pushing. The duration
+	// is measured per lock, starting over when the request moves on to wait on
+	// a different key. Zero means no maximum.
+	MaxLockWaitDuration time.Duration
+
 	// The maximum length of a lock wait-queue that the request is willing
 	// to enter and wait in. Used to provide a release valve and ensure some
 	// level of quality-of-service under severe per-key contention. If set
@@ -405,6 +449,29 @@ type Request struct {
 	// with a LockConflictError instead of entering the queue and waiting.
 	MaxLockWaitQueueLength int
 
+	// NonTxnClaimTxn, if set on a non-transactional request, is a stable,
+	// transaction-like identity under which the request's writes may claim
+	// locks, like a transactional locking request does, instead of racing with
+	// the requests queued behind them. Requests waiting on such a claim are told
+	// to wait for, and push, this identity, so it must be pushable for deadlock
+	// detection to work: it must either reference a transaction record that
+	// reflects the request's liveness, or the requests that may conflict with
+	// the claim must have deadlock detection disabled. Ignored for
+	// transactional requests.
+	NonTxnClaimTxn *enginepb.TxnMeta
+
+	// IgnoredLockHolderTxns, if set, is a set of transactions whose locks the
+	// request does not conflict with, e.g. because they belong to a cooperating
+	// sibling of the request's own transaction. The lock table treats locks held
+	// by these transactions as non-conflicting, though unlike locks held by
+	// finalized transactions, the locks are not resolved. A replicated lock that
+	// blocks the request's read is still discovered during evaluation, after
+	// which the request waits on it like on any other lock. Only supported for
+	// non-locking reads, as a locking request that ignored a conflicting lock
+	// would go on to acquire an incompatible lock on the same key; the request is
+	// rejected if it declares any locking spans.
+	IgnoredLockHolderTxns []uuid.UUID
+
 	// AdmissionHeader is the header in the request's BatchRequest. It is plumbed
 	// through for intent resolution admission control.
 	AdmissionHeader kvpb.AdmissionHeader
@@ -458,11 +525,42 @@ type QueryLockTableOptions struct {
 	MaxLocks           int64
 	TargetBytes        int64
 	IncludeUncontended bool
+	// TxnID, if set, restricts the query to the locks held by the transaction
+	// with this ID, including those it holds alongside other transactions. The
+	// MaxLocks and TargetBytes limits only apply to the locks that match.
+	TxnID uuid.UUID
+	// IncludeReplicatedUncontended, if set, additionally scans the replicated
+	// lock table keyspace using Reader to surface the replicated locks that are
+	// not tracked by the in-memory lock table. Uncontended replicated locks are
+	// not tracked in memory (see AcquireLock), so they are otherwise invisible
+	// to the query. At keys that are also tracked in memory, the replicated
+	// locks are returned in place of the keys' in-memory state. MaxLocks and
+	// TargetBytes apply to the merged results, and the scan stops once they are
+	// reached, though this remains more expensive than querying the in-memory
+	// lock table alone.
+	IncludeReplicatedUncontended bool
+	// Reader is used to scan the replicated lock table keyspace. It must be set
+	// if IncludeReplicatedUncontended is set.
+	Reader storage.Reader
+}
+
+// TransferredLocks are the locks detached from a range's lock table when the
+// range is split or merged, to be installed in the lock table of the range that
+// takes over their keys. Only lock holders are transferred; requests waiting on
+// the locks are released from the detached lock table and re-sequence on the
+// range that now owns the keys. The zero value contains no locks.
+type TransferredLocks struct {
+	locks []transferredLock
 }
 
 // QueryLockTableResumeState bundles the return metadata on the pagination of
 // results from the QueryLockTableState function.
 type QueryLockTableResumeState struct {
+	// ResumeSpan, if set, is the span that should be queried to continue
+	// paging through the lock table. Locks are returned in key order, and the
+	// ResumeSpan starts immediately after the last returned key, so a client
+	// that pages using it will neither skip nor duplicate keys, even if locks
+	// are acquired or released between pages.
 	ResumeSpan   *roachpb.Span
 	ResumeReason kvpb.ResumeReason
 
@@ -477,6 +575,12 @@ type QueryLockTableResumeState struct {
 	// the remaining quota of bytes (from TargetBytes) that can be used in
 	// querying other ranges served by the same request.
 	TotalBytes int64
+
+	// Timestamp is the HLC timestamp at which the lock table was snapshotted to
+	// serve the query. The returned locks reflect the lock table's state as of
+	// this timestamp, which allows them to be correlated with the MVCC state at
+	// the same timestamp. It is empty if the lock table is disabled.
+	Timestamp hlc.Timestamp
 }
 
 ///////////////////////////////////
@@ -610,7 +714,21 @@ type lockTable interface {
 	// the (a) lockTable calls that use a lockTableGuard parameter, or (b) a
 	// lockTableGuard call, returned an error. The method allows but does not
 	// require latches to be held.
-	Dequeue(lockTableGuard)
+	//
+	// Returns whether the request's lock spans were donated to other requests
+	// from the same transaction, in which case they are shared read-only with
+	// those requests and must not be released for reuse.
+	Dequeue(lockTableGuard) (spansDonated bool)
+
+	// LeaveWaitQueues removes the guard's request from any lock wait-queues it
+	// is part of, like Dequeue, but does not release the guard. The guard can be
+	// passed to the request's next call to ScanAndEnqueue, which reuses it, and
+	// its snapshot of the lockTable if no lock has been added to or removed from
+	// the lockTable since the snapshot was taken. Reuse is only valid for the
+	// same request, i.e. the same transaction, lock spans, and wait policy,
+	// which ScanAndEnqueue requires of its guard argument anyway. The guard must
+	// still be dequeued eventually.
+	LeaveWaitQueues(lockTableGuard)
 
 	// AddDiscoveredLock informs the lockTable of a lock which is wasn't
 	// previously tracking that was discovered during evaluation under the
@@ -621,10 +739,10 @@ type lockTable interface {
 	// evaluation of this request. It adds the lock and enqueues this requester
 	// in its wait-queue. It is required that request evaluation discover such
 	// locks before acquiring its own locks, since the request needs to repeat
-	// ScanAndEnqueue. When consultTxnStatusCache=true, and the transaction
-	// holding the lock is known to be pushed or finalized, the lock is not added
-	// to the lock table and instead tracked in the list of locks to resolve in
-	// the lockTableGuard.
+	// ScanAndEnqueue. When the transaction holding the lock is known to be
+	// finalized, or when consultTxnStatusCache=true and the transaction is known
+	// to be pushed, the lock is not added to the lock table and instead tracked
+	// in the list of locks to resolve in the lockTableGuard.
 	//
 	// The lease sequence is used to detect lease changes between the when
 	// request that found the lock started evaluating and when the discovered
@@ -645,6 +763,16 @@ type lockTable interface {
 		consultTxnStatusCache bool, guard lockTableGuard,
 	) (bool, error)
 
+	// AddDiscoveredLocks is like AddDiscoveredLock, but for a batch of locks
+	// discovered by the same request, which it adds to the lockTable while
+	// acquiring the lockTable's internal locks only once. It returns the keys
+	// of the locks that were ignored, i.e. those for which AddDiscoveredLock
+	// would have returned false.
+	AddDiscoveredLocks(
+		foundLocks []roachpb.Lock, seq roachpb.LeaseSequence,
+		consultTxnStatusCache bool, guard lockTableGuard,
+	) (ignored []roachpb.Key, _ error)
+
 	// AcquireLock informs the lockTable that a new lock was acquired or an
 	// existing lock was updated.
 	//
@@ -727,6 +855,13 @@ type lockTable interface {
 	//     txn.WriteTimestamp.
 	UpdateLocks(*roachpb.LockUpdate) error
 
+	// UpdateLocksBatch is like UpdateLocks, but applies each of the supplied
+	// updates, in order. It is more efficient than calling UpdateLocks for each
+	// update (e.g. when resolving many disjoint intents of a transaction), as
+	// the lockTable's tree is latched once for the whole batch and locks that
+	// become empty are garbage collected once at the end.
+	UpdateLocksBatch([]roachpb.LockUpdate) error
+
 	// PushedTransactionUpdated informs the lock table that a transaction has been
 	// pushed and is either finalized or has been moved to a higher timestamp.
 	// This is used by the lock table in a best-effort manner to avoid waiting on
@@ -734,14 +869,106 @@ type lockTable interface {
 	// lockTableGuard.ResolveBeforeScanning to resolve a batch of intents.
 	PushedTransactionUpdated(*roachpb.Transaction)
 
+	// PushedTransactionsUpdated is like PushedTransactionUpdated, but informs the
+	// lock table of a batch of pushed transactions at once. It is more efficient
+	// than calling PushedTransactionUpdated for each transaction, as each
+	// unsharded partition of the lock table's txnStatusCache is latched once for
+	// the whole batch. See TransactionManager.OnTransactionsUpdated.
+	PushedTransactionsUpdated([]*roachpb.Transaction)
+
+	// SplitAt detaches the locks on keys addressed at or after the supplied key
+	// from the lockTable and returns them, so that they can be installed in
+	// another lockTable using Merge. Locks on range-local keys are partitioned
+	// by the address of their key (see keys.Addr). Wait-queues on keys
+	// addressed before the supplied key are unaffected, so their claimants and
+	// distinguished waiters are preserved. Requests waiting on the detached
+	// locks, or queued on the keys, are told that they are done waiting instead
+	// of being transferred: they were sequenced by this lockTable's range, and
+	// must re-sequence on the range that now contains the keys.
+	//
+	// Nothing is returned if the lockTable is disabled.
+	SplitAt(roachpb.RKey) TransferredLocks
+
+	// Merge installs locks previously detached from another lockTable using
+	// SplitAt. If a transferred lock's key is already tracked by the lockTable,
+	// the transferred holders are merged into the tracked lock, and the
+	// requests waiting on the key continue to wait in its wait-queue. The locks
+	// are dropped if the lockTable is disabled.
+	Merge(TransferredLocks)
+
 	// QueryLockTableState returns detailed metadata on locks managed by the lockTable.
-	QueryLockTableState(span roachpb.Span, opts QueryLockTableOptions) ([]roachpb.LockStateInfo, QueryLockTableResumeState)
+	QueryLockTableState(ctx context.Context, span roachpb.Span, opts QueryLockTableOptions) ([]roachpb.LockStateInfo, QueryLockTableResumeState, error)
 
 	// Metrics returns information about the state of the lockTable.
 	Metrics() LockTableMetrics
 
+	// ContentionByKeyRange returns the contention on the locks in the lockTable,
+	// aggregated into numBuckets buckets of equal-width key spans, separately
+	// for local and global keys.
+	ContentionByKeyRange(numBuckets int) LockContentionByKeyRange
+
+	// TopKeysByMemory returns the n keys (up to MaxTopKeysByMemory) whose state
+	// in the lockTable has the largest estimated memory footprint, in
+	// decreasing order of footprint. See LockMemoryEstimate.
+	TopKeysByMemory(n int) []LockMemoryEstimate
+
+	// TopTxnsByContention returns the n transactions (up to
+	// MaxTopTxnsByContention) whose locks have caused the most waiting, as
+	// measured by the total wait duration of the requests actively waiting on
+	// them, in decreasing order of wait duration. See TxnContention.
+	TopTxnsByContention(n int) []TxnContention
+
+	// HotKeys returns the state of the n keys (up to MaxHotKeys) with the most
+	// active waiters, in decreasing order of active waiters. Keys with the same
+	// number of active waiters are ordered by the total duration their waiters
+	// have been waiting, longest first. Keys without active waiters are omitted.
+	HotKeys(n int) []roachpb.LockStateInfo
+
+	// PushLongHeldLocks returns the locks that have been held for longer than
+	// the supplied threshold, along with the transactions holding them, in key
+	// order, so that the caller can push the holders. Holders that are already
+	// known to have been finalized or pushed are omitted. See LongHeldLock.
+	PushLongHeldLocks(threshold time.Duration) []LongHeldLock
+
+	// OnMaxKeysLockedUpdated recomputes the soft maximum on the number of keys
+	// locked from the MaxKeysLocked cluster setting. If the lockTable is left
+	// tracking more keys than the new maximum allows, it clears locks right away
+	// instead of waiting for a later lock acquisition to do so.
+	OnMaxKeysLockedUpdated()
+
+	// QueueHeadCompatibility returns, for each key that isn't locked but has
+	// transactional locking requests queued, the lock strength of the request
+	// at the head of the queue and the number of requests that follow it and
+	// are compatible with it, in key order. See LockQueueHeadCompatibility.
+	QueueHeadCompatibility() []LockQueueHeadCompatibility
+
+	// ClaimantChangeEvents returns the most recent claimant change events
+	// recorded by the lockTable, from oldest to newest. Events are only recorded
+	// if ClaimantChangeEventBufferSize is set.
+	ClaimantChangeEvents() []ClaimantChangeEvent
+
+	// RecordWaiterPush records that a request waiting in the lockTable pushed
+	// a conflicting transaction.
+	RecordWaiterPush()
+
+	// RecordWaitPolicyErrorRejection records that a request using
+	// WaitPolicy_Error was rejected by the lockTableWaiter because of a
+	// conflicting lock.
+	RecordWaitPolicyErrorRejection()
+
 	// String returns a debug string representing the state of the lockTable.
 	String() string
+
+	// DescribeKey returns a debug string representing the state of the locks
+	// and wait-queues on a single key, including the requests, if any, that
+	// have pinned the key's lock as not removable. Returns false if the key is
+	// not tracked by the lockTable.
+	DescribeKey(key roachpb.Key) (string, bool)
+
+	// ExplainConflict returns a debug string explaining, for each lock holder
+	// and queued locking request on the supplied key, whether a request
+	// accessing the key with the supplied lock mode conflicts with it.
+	ExplainConflict(key roachpb.Key, mode lock.Mode) string
 }
 
 // lockTableGuard is a handle to a request as it waits on conflicting locks in a
@@ -762,6 +989,21 @@ type lockTableGuard interface {
 	// CurState returns the latest waiting state.
 	CurState() (waitingState, error)
 
+	// WatchDoneWaiting is a convenience for select-based code, which returns a
+	// watcher whose Done channel is closed once the request's waiting state
+	// transitions to doneWaiting, meaning the request is free to proceed. The
+	// watch runs in an async task on the supplied stopper. The channel is also
+	// closed if the request transitions to a state that requires the caller to
+	// take action (waitElsewhere, waitQueueMaxLengthExceeded,
+	// waitDeadlineExceeded or waitThrottled), if computing the waiting state fails, or if the
+	// context is canceled or the stopper quiesces; the watcher's State and Err
+	// distinguish these cases. An error is returned if the task could not be
+	// started.
+	//
+	// The watcher takes over the use of the guard, so the caller must not use
+	// the guard until the Done channel is closed.
+	WatchDoneWaiting(context.Context, *stop.Stopper) (*doneWaitingWatcher, error)
+
 	// ResolveBeforeScanning lists the locks to resolve before scanning again.
 	// This must be called after:
 	// - the waiting state has transitioned to doneWaiting.
@@ -793,6 +1035,22 @@ type lockTableGuard interface {
 	// from starving out regular locking requests. In such cases, true is
 	// returned, but so is nil.
 	IsKeyLockedByConflictingTxn(roachpb.Key, lock.Strength) (bool, *enginepb.TxnMeta, error)
+
+	// WaitPositionEstimate returns an estimate of the number of requests that
+	// the lockTableGuard is waiting behind, summed across all keys in the lock
+	// table at which it is currently waiting. A request is counted as being
+	// ahead of the guard if it is ordered before the guard in the wait-queues,
+	// i.e. if it sequenced (has a lower sequence number) before the guard or,
+	// when PriorityOrderedWaitQueues is set, if its transaction has a higher
+	// priority. The estimate is useful for surfacing a request's
+	// position in line to clients; it is not used for correctness.
+	//
+	// The method is not cheap: it visits the wait-queues of every key that the
+	// guard is waiting at, acquiring each key's mutex in turn. It is linear in
+	// the total length of those wait-queues, so it should not be called on hot
+	// paths. The returned value is a point-in-time estimate, as the queues may
+	// change while they are being visited.
+	WaitPositionEstimate() int
 }
 
 // lockTableWaiter is concerned with waiting in lock wait-queues for locks held
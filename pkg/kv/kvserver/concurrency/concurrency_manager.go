@@ -92,7 +92,9 @@ var MaxLockWaitQueueLength = settings.RegisterIntSetting(
 // 10,000 lock capacity of the lock table, 200 is small enough to not matter
 // much against the capacity, which is desirable. We have seen examples with
 // discoveredCount > 100,000, caused by stats collection, where we definitely
-// want to avoid adding these locks to the lock table, if possible.
+// want to avoid adding these locks to the lock table, if possible. Locks held
+// by transactions known to be finalized are never added to the lock table,
+// regardless of this threshold.
 var DiscoveredLocksThresholdToConsultTxnStatusCache = settings.RegisterIntSetting(
 	settings.SystemOnly,
 	// NOTE: the name of this setting mentions "finalized" for historical reasons.
@@ -117,6 +119,332 @@ var BatchPushedLockResolution = settings.RegisterBoolSetting(
 	true,
 )
 
+// ResolvePushedLocksInline controls how non-locking readers resolve replicated
+// locks held by transactions known to have been pushed above their read
+// timestamp, when BatchPushedLockResolution is enabled. By default, such locks
+// are accumulated as the reader scans the lock table and are resolved in a
+// single batch at the end of the scan, which is optimized for large scans like
+// the Export requests issued by backup. If set, the reader instead stops its
+// scan at the first such lock and resolves it before proceeding, which can
+// reduce latency for point reads.
+var ResolvePushedLocksInline = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.lock_table.resolve_pushed_locks_inline.enabled",
+	"whether non-locking readers should resolve each replicated lock held by a transaction that "+
+		"has been pushed above the reader's timestamp as soon as it is encountered, instead of "+
+		"deferring and batching their resolution until the end of the reader's lock table scan",
+	false,
+)
+
+// ConsolidateAdjacentLockResolution controls whether requests that scan the
+// lock table process a contiguous run of locked keys that all conflict with the
+// same transaction as a whole, instead of one key at a time. This benefits
+// scans over densely locked key ranges (e.g. every row locked by the same
+// transaction), which would otherwise wait on, push, and resolve one lock per
+// key. Specifically:
+//
+//  1. a request that starts waiting at a lock held by a transaction waits on
+//     the entire run of the lock's successors that are locked only by the same
+//     transaction using a single waitingState. Once the transaction has been
+//     pushed, the waiter resolves the run using a single ranged lock update.
+//  2. the resolution of a contiguous run of replicated locks held by the same
+//     finalized transaction, which requests accumulate as they scan, is
+//     consolidated into a single ranged lock update.
+//
+// In both cases, the ranged lock update spans from the first to the last lock
+// in the run, so it also updates any of the transaction's locks on keys between
+// the locks in the run. This is safe, as the update is the result of a push
+// that the transaction is subject to regardless of which of its locks the
+// request conflicts with.
+var ConsolidateAdjacentLockResolution = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.lock_table.consolidate_adjacent_lock_resolution.enabled",
+	"whether requests scanning the lock table should wait on and resolve a contiguous run of "+
+		"locks held by the same transaction as a whole, using a single ranged lock update",
+	false,
+)
+
+// MaxKeysLocked, if non-zero, overrides the soft maximum on the number of keys
+// on which each range's lock table tracks locks (see
+// lockTableImpl.maxKeysLocked), which is otherwise fixed when the lock table is
+// constructed. Changes to the setting are applied to existing lock tables,
+// which immediately clear locks if they're left tracking more keys than the new
+// maximum allows.
+var MaxKeysLocked = settings.RegisterIntSetting(
+	settings.SystemOnly,
+	"kv.lock_table.maximum_keys_locked",
+	"the soft maximum number of keys on which a range's lock table tracks locks, above which "+
+		"the lock table clears the locks it does not need to track. Set to 0 to use the default.",
+	0,
+	settings.NonNegativeInt,
+)
+
+// ReleaseLocksOfFinalizedTxns controls whether the lock table releases the
+// locks held by a transaction as soon as it learns that the transaction has
+// been finalized, through a push by one of the requests waiting on it. Without
+// this, requests waiting on the transaction's other locks only notice that it
+// has been finalized once they push it themselves, which they do after a
+// delay, or once they resume their scan of the lock table. The lock table only
+// indexes the keys a transaction locks while the setting is enabled, up to a
+// bounded number of keys per transaction (see maxIndexedKeysLockedPerTxn); the
+// requests waiting on the locks on other keys notice as before.
+var ReleaseLocksOfFinalizedTxns = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.lock_table.release_locks_of_finalized_txns.enabled",
+	"whether the lock table should release the locks held by a transaction, and the requests "+
+		"waiting on them, as soon as it learns that the transaction has been finalized",
+	false,
+)
+
+// MaxLocksPerTransaction places a cap on the number of keys that a single
+// transaction can hold locks on in a range's lock table. Once a transaction
+// holds locks on this many keys, the lock table refuses to track its locks on
+// any other key: acquisitions are rejected with a retryable error, and
+// discovered locks are left for the waiting request to rediscover. This
+// protects the lock table's budget (see
+// kv.lock_table.maximum_lock_wait_queue_length for the analogous guardrail on
+// wait-queues) from a single misbehaving transaction.
+var MaxLocksPerTransaction = settings.RegisterIntSetting(
+	settings.SystemOnly,
+	"kv.lock_table.max_locks_per_transaction",
+	"the maximum number of keys on which a single transaction can hold locks in a range's lock "+
+		"table, above which the transaction's lock acquisitions are rejected with a retryable "+
+		"error. Set to 0 to disable.",
+	0,
+	settings.NonNegativeInt,
+)
+
+// EagerQueueing controls whether transactional locking requests enter the
+// wait-queues of all the held locks in their locking spans as soon as they
+// start waiting, instead of lazily entering each wait-queue when their scan of
+// the lock table reaches it. Eager queueing establishes a request's position in
+// the wait-queues it will pass through up front, which eliminates the anomalies
+// caused by scanning a stale snapshot of the lock table (see
+// lockTableGuardImpl.tableSnapshot), at a potential cost in throughput since
+// requests queue on locks further ahead of when they need them. Requests don't
+// eagerly enter the wait-queues of unheld locks, as they would become the
+// locks' claimants, and have their transactions pushed, before reaching them.
+var EagerQueueing = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.lock_table.eager_queueing.enabled",
+	"whether locking requests that need to wait in the lock table should enter the wait-queues "+
+		"of all locks they conflict with up front, instead of one at a time as they make progress",
+	false,
+)
+
+// SameTxnScanDonation controls whether a lock acquisition that releases
+// requests from the acquiring transaction waiting on the key also hands them
+// the lock spans of a request from that transaction that has finished scanning
+// the lock table and proceeded to evaluation (typically, the request that
+// acquired the lock). When a released request resumes its scan, it skips the
+// keys covered by those spans at a lock strength at least as strong as its
+// own, as the donor found them to be free of conflicting locks for the
+// transaction, instead of re-verifying them. The donation only applies to the
+// scans a request performs while waiting, outside of latches, which merely
+// determine where to wait next; once the request is done waiting, it
+// re-acquires latches and scans its spans from scratch without the donation.
+// That latched scan is what isolates the request's evaluation, so a lock
+// acquired by a different transaction in the donated spans in the meantime is
+// discovered before the request evaluates.
+var SameTxnScanDonation = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.lock_table.same_txn_scan_donation.enabled",
+	"whether requests released from a lock wait-queue by their own transaction's lock acquisition "+
+		"should skip re-verifying keys that another request from the transaction has already scanned",
+	false,
+)
+
+// PriorityOrderedWaitQueues controls whether the wait-queues of locks order
+// locking requests by the priority of their transactions, and only then by
+// their sequence numbers, instead of by sequence number alone. With this
+// setting enabled, a high-priority transaction's request is inserted ahead of
+// the requests of lower-priority transactions waiting on the same lock, so
+// that it does not wait behind bulk low-priority work.
+//
+// Ordering wait-queues consistently by sequence number guarantees that no two
+// requests are ordered differently in the wait-queues of two locks, so waiters
+// can't deadlock on each other's claims. The ordering by (priority, sequence
+// number) preserves this guarantee, as a request's transaction priority is
+// fixed for the lifetime of the request, so it is also a total order that is
+// consistent across all wait-queues. Deadlocks between lock holders are, as
+// before, detected by the txnWaitQueue.
+//
+// The setting trades off the first-come first-served fairness of wait-queues:
+// a steady stream of high-priority requests can starve lower-priority ones.
+// Non-transactional requests are ordered as if they had the lowest priority.
+// Toggling the setting does not reorder requests that are already queued.
+var PriorityOrderedWaitQueues = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.lock_table.priority_ordered_wait_queues.enabled",
+	"whether locking requests of higher-priority transactions should be ordered ahead of those of "+
+		"lower-priority transactions in lock wait-queues, instead of in arrival order",
+	false,
+)
+
+// TrackOperationsWhileDisabled controls whether the lock table should count,
+// and log the first few of, the lock acquisitions, discovered locks, and lock
+// updates it receives while disabled. A disabled lock table ignores these
+// operations, which is expected when a replica loses its lease, but a steady
+// stream of them can point to a lease sequencing bug.
+var TrackOperationsWhileDisabled = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.lock_table.track_operations_while_disabled.enabled",
+	"whether the lock table should count and log lock acquisitions, discovered locks, and lock "+
+		"updates that it receives and ignores while it is disabled",
+	false,
+)
+
+// PerKeyLockAcquisitionRateLimit, if non-zero, limits the rate at which locks
+// can be acquired on any single key tracked by the lock table, in acquisitions
+// per second, with a burst of as many acquisitions. A hot key churning through
+// lock acquisitions and releases can otherwise dominate the lock table's CPU
+// usage. The limit is enforced when transactional locking requests are
+// sequenced: a request that would join the key's wait-queue above the limit
+// backs off until the key's rate allows another acquisition and is then
+// sequenced again, before it evaluates, so a lock it goes on to acquire is
+// always tracked by the lock table. Only keys that remain tracked by
+// the lock table between acquisitions, e.g. because requests are waiting on
+// them, are rate limited.
+var PerKeyLockAcquisitionRateLimit = settings.RegisterFloatSetting(
+	settings.SystemOnly,
+	"kv.lock_table.per_key_acquisition_rate_limit",
+	"the maximum rate, in acquisitions per second, at which locks can be acquired on a single key "+
+		"tracked by a range's lock table, above which locking requests back off "+
+		"when sequenced. Set to 0 to disable.",
+	0,
+	settings.NonNegativeFloat,
+)
+
+// LockRediscoveryLoopThreshold controls the detection of lock rediscovery
+// loops. A request discovers a lock during evaluation when the lock is not
+// tracked by the lock table, and adds it to the lock table so that it, and
+// later requests, wait on it there. If the lock table's view of a lock were to
+// diverge from the replicated keyspace (e.g. with a lock timestamp that is
+// higher than that of the intent), requests would instead repeatedly discover
+// the same lock without ever waiting on it, spinning on the CPU. The lock
+// table counts the discoveries of each lock (by key and holder) within a
+// window of lockRediscoveryLoopWindow, and logs an error and increments a
+// metric if they exceed this threshold.
+var LockRediscoveryLoopThreshold = settings.RegisterIntSetting(
+	settings.SystemOnly,
+	"kv.lock_table.rediscovery_loop_detection.threshold",
+	"the number of times a lock held by a transaction on a key can be discovered by requests "+
+		"within 10 seconds before the lock table reports a lock rediscovery loop. Set to 0 to disable.",
+	100,
+	settings.NonNegativeInt,
+)
+
+// DistinguishedWaitersEnabled controls whether the lock table designates a
+// distinguished waiter for each lock with waiters. The distinguished waiter
+// pushes the lock's holder after the short LockTableLivenessPushDelay to detect
+// coordinator failures, while the other waiters only push after the longer
+// LockTableDeadlockDetectionPushDelay to detect deadlocks. If disabled, no
+// waiter is designated, and all waiters instead push after the liveness push
+// delay. This is intended for experimentation; the number of pushes performed
+// in each mode can be compared using LockTableMetrics.WaiterPushes.
+var DistinguishedWaitersEnabled = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.lock_table.distinguished_waiters.enabled",
+	"whether the lock table designates a distinguished waiter to push the holder of each lock "+
+		"with waiters after the liveness push delay; if disabled, all waiters push after the liveness "+
+		"push delay",
+	true,
+)
+
+// ClaimantChangeEventBufferSize controls the number of claimant change events
+// retained by each lock table. The claimant of a key is the transaction that
+// the requests waiting on the key push; an event is recorded each time the
+// claimant that the lock table informs these waiters of changes. The events
+// are intended for debugging waiters that push the wrong transaction, and can
+// be retrieved using the lock table's ClaimantChangeEvents method. Recording
+// is disabled if set to 0.
+var ClaimantChangeEventBufferSize = settings.RegisterIntSetting(
+	settings.SystemOnly,
+	"kv.lock_table.claimant_change_events.buffer_size",
+	"the number of claimant change events, recorded for debugging, retained by each lock table; "+
+		"set to 0 to disable recording",
+	0,
+	settings.NonNegativeInt,
+)
+
+// EpochRegressionPolicy is the handling of an unreplicated lock acquisition
+// made by a transaction at an epoch prior to the one it already holds the lock
+// at. See EpochRegressionAcquisitionPolicy.
+type EpochRegressionPolicy int64
+
+const (
+	// EpochRegressionError rejects the acquisition with an error.
+	EpochRegressionError EpochRegressionPolicy = iota
+	// EpochRegressionIgnore logs the acquisition and ignores it, leaving the
+	// lock as it was.
+	EpochRegressionIgnore
+	// EpochRegressionApply logs the acquisition and applies it to the lock as if
+	// it had been made at the start of the lock's epoch. Sequence numbers from
+	// the two epochs are not comparable, so those tracked for the lock are reset.
+	EpochRegressionApply
+)
+
+// EpochRegressionAcquisitionPolicy controls how the lock table handles an
+// unreplicated lock acquisition made by a transaction at an epoch prior to the
+// one that it already holds the lock at. Such acquisitions are not expected
+// from a well-behaved transaction coordinator, and are rejected by default,
+// mirroring how intent writes at a prior epoch are rejected. Operators may
+// relax this while investigating a suspected coordinator bug. Acquisitions of
+// replicated locks at a prior epoch are not governed by this setting: they
+// must always be applied, as the lock table's view of replicated locks may
+// not diverge from the replicated keyspace.
+var EpochRegressionAcquisitionPolicy = settings.RegisterEnumSetting(
+	settings.SystemOnly,
+	"kv.lock_table.epoch_regression_acquisition_policy",
+	"the handling of an unreplicated lock acquisition made by a transaction at an epoch prior to the "+
+		"one it already holds the lock at: `error` rejects the acquisition, `ignore` logs and ignores "+
+		"it, and `apply` logs and applies it as if it had been made at the lock's epoch",
+	"error",
+	map[int64]string{
+		int64(EpochRegressionError):  "error",
+		int64(EpochRegressionIgnore): "ignore",
+		int64(EpochRegressionApply):  "apply",
+	},
+)
+
+// DiscoveredLockHighWatermark, if non-zero, is the fraction of the lock table's
+// maximum number of locked keys above which the lock table stops tracking the
+// locks discovered by requests on keys that it doesn't already track. Without
+// it, a flood of discovered locks on a lock table close to its limit causes
+// the lock table to repeatedly fill up and clear most of its locks. Each
+// request still has the first lock it discovers tracked, which it waits on to
+// ensure that it makes progress, and it rediscovers the other locks on its
+// next evaluation attempt, once the lock table has drained.
+var DiscoveredLockHighWatermark = settings.RegisterFloatSetting(
+	settings.SystemOnly,
+	"kv.lock_table.discovered_lock_high_watermark",
+	"the fraction of a lock table's maximum number of locked keys above which locks discovered by "+
+		"requests are not tracked, unless they are the first lock discovered by the request or are on "+
+		"keys that are already tracked; set to 0 to always track discovered locks",
+	0,
+	settings.Fraction,
+)
+
+// ClearedLockWaitersDoneWaiting controls how the waiters of a lock that is
+// cleared from the lock table to relieve memory pressure are transitioned when
+// the lock is held as a replicated lock. By default, they are told to wait
+// elsewhere: they push the lock's holder immediately, waiting in its
+// txnWaitQueue, and proceed once the holder is finalized. If enabled, they are
+// instead told that they are done waiting, so they re-evaluate immediately.
+// This avoids waiting on a push that may be slow to resolve (e.g. when the
+// lease is moving), at the cost of each waiter rediscovering the replicated
+// lock during evaluation and adding it back to the lock table, which itself
+// adds to the memory pressure that caused the lock to be cleared. Waiters of
+// locks cleared when the lock table is disabled are always told that they are
+// done waiting.
+var ClearedLockWaitersDoneWaiting = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.lock_table.cleared_lock_waiters_done_waiting.enabled",
+	"whether the waiters of a replicated lock cleared from the lock table to relieve memory "+
+		"pressure should re-evaluate immediately, rather than push the lock's holder",
+	false,
+)
+
 // managerImpl implements the Manager interface.
 type managerImpl struct {
 	st *cluster.Settings
@@ -141,9 +469,17 @@ type Config struct {
 	Clock          *hlc.Clock
 	Stopper        *stop.Stopper
 	IntentResolver IntentResolver
+	// TxnStatusCache, if set, is shared with the Managers of the other Ranges on
+	// the Store.
+	TxnStatusCache *SharedTxnStatusCache
 	// Metrics.
 	TxnWaitMetrics *txnwait.Metrics
 	SlowLatchGauge *metric.Gauge
+	// LockQueuedBeforeAcquireLatency, if set, records how long requests spent
+	// in a lock's wait-queue before their transaction acquired the lock.
+	// Unlike the time spent waiting in wait-queues, it excludes the time spent
+	// by requests that stopped waiting without acquiring the lock.
+	LockQueuedBeforeAcquireLatency metric.IHistogram
 	// Configs + Knobs.
 	MaxLockTableSize  int64
 	DisableTxnPushing bool
@@ -160,7 +496,14 @@ func (c *Config) initDefaults() {
 func NewManager(cfg Config) Manager {
 	cfg.initDefaults()
 	m := new(managerImpl)
-	lt := newLockTable(cfg.MaxLockTableSize, cfg.RangeDesc.RangeID, cfg.Clock, cfg.Settings)
+	var statusCache *txnStatusCache
+	if cfg.TxnStatusCache != nil {
+		statusCache = &cfg.TxnStatusCache.c
+	}
+	lt := newLockTable(
+		cfg.MaxLockTableSize, cfg.RangeDesc.RangeID, cfg.Clock, cfg.Settings, statusCache,
+	)
+	lt.counters.queuedBeforeAcquire = cfg.LockQueuedBeforeAcquireLatency
 	*m = managerImpl{
 		st: cfg.Settings,
 		// TODO(nvanbenschoten): move pkg/storage/spanlatch to a new
@@ -327,6 +670,9 @@ func (m *managerImpl) sequenceReqWithGuard(
 			if g.ltg != nil {
 				panic("Optimistic locking should not have a non-nil lockTableGuard")
 			}
+			if err := checkIgnoredLockHolderTxns(g.Req); err != nil {
+				return nil, kvpb.NewError(err)
+			}
 			log.Event(ctx, "optimistically scanning lock table for conflicting locks")
 			g.ltg = m.lt.ScanOptimistic(g.Req)
 		} else {
@@ -448,11 +794,26 @@ func (m *managerImpl) FinishReq(g *Guard) {
 		m.lm.Release(lg)
 	}
 	if ltg := g.moveLockTableGuard(); ltg != nil {
-		m.lt.Dequeue(ltg)
+		if spansDonated := m.lt.Dequeue(ltg); spansDonated {
+			// Leave the lock spans to the garbage collector.
+			g.Req.LockSpans = nil
+		}
 	}
 	releaseGuard(g)
 }
 
+// DropLatchesAndLockWaitQueues implements the RequestSequencer interface.
+func (m *managerImpl) DropLatchesAndLockWaitQueues(g *Guard) {
+	// NOTE: latches are released before exiting lock wait-queues for the same
+	// reason as in FinishReq.
+	if lg := g.moveLatchGuard(); lg != nil {
+		m.lm.Release(lg)
+	}
+	if g.ltg != nil {
+		m.lt.LeaveWaitQueues(g.ltg)
+	}
+}
+
 // HandleLockConflictError implements the ContentionHandler interface.
 func (m *managerImpl) HandleLockConflictError(
 	ctx context.Context, g *Guard, seq roachpb.LeaseSequence, t *kvpb.LockConflictError,
@@ -482,19 +843,21 @@ func (m *managerImpl) HandleLockConflictError(
 	//
 	// Either way, there is no possibility of the request entering an infinite
 	// loop without making progress.
+	//
+	// Similarly, if the lock-table is above its high watermark, some of the
+	// intents may be ignored (see DiscoveredLockHighWatermark). The first intent
+	// added is never ignored, so the request waits on it and makes progress, and
+	// it rediscovers the others on its next evaluation attempt.
 	consultTxnStatusCache :=
 		int64(len(t.Locks)) > DiscoveredLocksThresholdToConsultTxnStatusCache.Get(&m.st.SV)
-	for i := range t.Locks {
-		foundLock := &t.Locks[i]
-		added, err := m.lt.AddDiscoveredLock(foundLock, seq, consultTxnStatusCache, g.ltg)
-		if err != nil {
-			log.Fatalf(ctx, "%v", err)
-		}
-		if !added {
-			log.VEventf(ctx, 2,
-				"intent on %s discovered but not added to disabled lock table",
-				foundLock.Key.String())
-		}
+	ignored, err := m.lt.AddDiscoveredLocks(t.Locks, seq, consultTxnStatusCache, g.ltg)
+	if err != nil {
+		log.Fatalf(ctx, "%v", err)
+	}
+	for _, key := range ignored {
+		log.VEventf(ctx, 2,
+			"intent on %s discovered but not added to disabled or full lock table",
+			key.String())
 	}
 
 	// Release the Guard's latches but continue to remain in lock wait-queues by
@@ -531,11 +894,16 @@ func (m *managerImpl) HandleTransactionPushError(
 }
 
 // OnLockAcquired implements the LockManager interface.
-func (m *managerImpl) OnLockAcquired(ctx context.Context, acq *roachpb.LockAcquisition) {
+func (m *managerImpl) OnLockAcquired(ctx context.Context, acq *roachpb.LockAcquisition) error {
 	if err := m.lt.AcquireLock(acq); err != nil {
 		if errors.IsAssertionFailure(err) {
 			log.Fatalf(ctx, "%v", err)
 		}
+		if errors.HasType(err, (*kvpb.TransactionRetryError)(nil)) {
+			// The transaction holds locks on as many keys as
+			// MaxLocksPerTransaction permits.
+			return err
+		}
 		// It's reasonable to expect benign errors here that the layer above
 		// (command evaluation) isn't equipped to deal with. As long as we're not
 		// violating any assertions, we simply log and move on. One benign case is
@@ -543,6 +911,7 @@ func (m *managerImpl) OnLockAcquired(ctx context.Context, acq *roachpb.LockAcqui
 		// epoch.
 		log.Errorf(ctx, "%v", err)
 	}
+	return nil
 }
 
 // OnLockUpdated implements the LockManager interface.
@@ -552,11 +921,16 @@ func (m *managerImpl) OnLockUpdated(ctx context.Context, up *roachpb.LockUpdate)
 	}
 }
 
+// OnMaxKeysLockedUpdated implements the LockManager interface.
+func (m *managerImpl) OnMaxKeysLockedUpdated() {
+	m.lt.OnMaxKeysLockedUpdated()
+}
+
 // QueryLockTableState implements the LockManager interface.
 func (m *managerImpl) QueryLockTableState(
 	ctx context.Context, span roachpb.Span, opts QueryLockTableOptions,
-) ([]roachpb.LockStateInfo, QueryLockTableResumeState) {
-	return m.lt.QueryLockTableState(span, opts)
+) ([]roachpb.LockStateInfo, QueryLockTableResumeState, error) {
+	return m.lt.QueryLockTableState(ctx, span, opts)
 }
 
 // OnTransactionUpdated implements the TransactionManager interface.
@@ -564,6 +938,24 @@ func (m *managerImpl) OnTransactionUpdated(ctx context.Context, txn *roachpb.Tra
 	m.twq.UpdateTxn(ctx, txn)
 }
 
+// OnTransactionsUpdated implements the TransactionManager interface.
+func (m *managerImpl) OnTransactionsUpdated(ctx context.Context, txns []*roachpb.Transaction) {
+	var finalized []*roachpb.Transaction
+	for _, txn := range txns {
+		m.OnTransactionUpdated(ctx, txn)
+		if txn.Status.IsFinalized() {
+			finalized = append(finalized, txn)
+		}
+	}
+	// Only finalized transactions are passed to the lock table. The record of a
+	// transaction that isn't finalized can be updated without the transaction
+	// having been pushed, e.g. when it is staged by a parallel commit, in which
+	// case its locks must not be moved to its new timestamp.
+	if len(finalized) > 0 {
+		m.lt.PushedTransactionsUpdated(finalized)
+	}
+}
+
 // GetDependents implements the TransactionManager interface.
 func (m *managerImpl) GetDependents(txnID uuid.UUID) []uuid.UUID {
 	return m.twq.GetDependents(txnID)
@@ -589,23 +981,34 @@ func (m *managerImpl) OnRangeLeaseUpdated(seq roachpb.LeaseSequence, isLeasehold
 }
 
 // OnRangeSplit implements the RangeStateListener interface.
-func (m *managerImpl) OnRangeSplit() {
-	// TODO(nvanbenschoten): it only essential that we clear the half of the
-	// lockTable which contains locks in the key range that is being split off
-	// from the current range. For now though, we clear it all.
+func (m *managerImpl) OnRangeSplit(rhsStartKey roachpb.RKey) TransferredLocks {
+	// Only the half of the lockTable which contains locks in the key range that
+	// is being split off from the current range is removed. Its locks are
+	// handed to the RHS so that they don't need to be re-discovered, and the
+	// requests waiting on them are redirected to the RHS, if appropriate. Locks
+	// on range-local keys are handed to the RHS if they're addressed to it.
+	locks := m.lt.SplitAt(rhsStartKey)
 	const disable = false
-	m.lt.Clear(disable)
 	m.twq.Clear(disable)
+	return locks
 }
 
 // OnRangeMerge implements the RangeStateListener interface.
-func (m *managerImpl) OnRangeMerge() {
+func (m *managerImpl) OnRangeMerge() TransferredLocks {
+	// Detach all locks so that they can be handed to the LHS neighbor.
+	locks := m.lt.SplitAt(roachpb.RKeyMin)
 	// Disable all queues - the range is being merged into its LHS neighbor.
 	// It will no longer be informed about all state transitions to locks and
 	// transactions.
 	const disable = true
 	m.lt.Clear(disable)
 	m.twq.Clear(disable)
+	return locks
+}
+
+// OnLocksTransferred implements the RangeStateListener interface.
+func (m *managerImpl) OnLocksTransferred(locks TransferredLocks) {
+	m.lt.Merge(locks)
 }
 
 // OnReplicaSnapshotApplied implements the RangeStateListener interface.
@@ -686,16 +1089,6 @@ func (g *Guard) LatchSpans() *spanset.SpanSet {
 	return g.Req.LatchSpans
 }
 
-// TakeSpanSets transfers ownership of the Guard's LatchSpans and LockSpans
-// SpanSets to the caller, ensuring that the SpanSets are not destroyed with the
-// Guard. The method is only safe if called immediately before passing the Guard
-// to FinishReq.
-func (g *Guard) TakeSpanSets() (*spanset.SpanSet, *lockspanset.LockSpanSet) {
-	la, lo := g.Req.LatchSpans, g.Req.LockSpans
-	g.Req.LatchSpans, g.Req.LockSpans = nil, nil
-	return la, lo
-}
-
 // HoldingLatches returned whether the guard is holding latches or not.
 func (g *Guard) HoldingLatches() bool {
 	return g != nil && g.lg != nil
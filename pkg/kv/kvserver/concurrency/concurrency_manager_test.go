@@ -81,7 +81,7 @@ import (
 // on-txn-updated    txn=<txn-name> status=[committed|aborted|pending] [ts=<int>[,<int>]]
 //
 // on-lease-updated  leaseholder=<bool> lease-seq=<seq>
-// on-split
+// on-split          [key=<key>]
 // on-merge
 // on-snapshot-applied
 //
@@ -451,7 +451,9 @@ func TestConcurrencyManagerBasic(t *testing.T) {
 				mon.runSync("acquire lock", func(ctx context.Context) {
 					log.Eventf(ctx, "txn %s @ %s", txn.Short(), key)
 					acq := roachpb.MakeLockAcquisition(txnAcquire, roachpb.Key(key), dur, str)
-					m.OnLockAcquired(ctx, &acq)
+					if err := m.OnLockAcquired(ctx, &acq); err != nil {
+						log.Eventf(ctx, "%v", err)
+					}
 				})
 				return c.waitAndCollect(t, mon)
 
@@ -546,9 +548,16 @@ func TestConcurrencyManagerBasic(t *testing.T) {
 				return c.waitAndCollect(t, mon)
 
 			case "on-split":
+				// By default, the entire keyspace is split off to the RHS.
+				splitKey := roachpb.RKeyMin
+				if d.HasArg("key") {
+					var key string
+					d.ScanArgs(t, "key", &key)
+					splitKey = roachpb.RKey(key)
+				}
 				mon.runSync("split range", func(ctx context.Context) {
 					log.Event(ctx, "complete")
-					m.OnRangeSplit()
+					m.OnRangeSplit(splitKey)
 				})
 				return c.waitAndCollect(t, mon)
 
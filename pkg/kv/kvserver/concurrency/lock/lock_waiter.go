@@ -27,4 +27,7 @@ func (lw Waiter) SafeFormat(w redact.SafePrinter, _ rune) {
 		}
 	}
 	w.Printf("waiting_txn:%s active_waiter:%t strength:%s wait_duration:%s", txnIDRedactableString, lw.ActiveWaiter, lw.Strength, lw.WaitDuration)
+	if lw.Distinguished {
+		w.SafeString(" distinguished:true")
+	}
 }
@@ -76,4 +76,19 @@ func TestWaiterSafeFormat(t *testing.T) {
 	require.EqualValues(t,
 		"waiting_txn:<nil> active_waiter:false strength:None wait_duration:17ms",
 		redact.Sprintf("%+v", nonTxnWaiter).Redact())
+
+	distinguishedWaiter := &lock.Waiter{
+		WaitingTxn:    txnMeta,
+		ActiveWaiter:  true,
+		Strength:      lock.Exclusive,
+		WaitDuration:  135 * time.Second,
+		Distinguished: true,
+	}
+
+	require.EqualValues(t,
+		"waiting_txn:6ba7b810 active_waiter:true strength:Exclusive wait_duration:2m15s distinguished:true",
+		redact.Sprint(distinguishedWaiter).StripMarkers())
+	require.EqualValues(t,
+		"waiting_txn:‹×› active_waiter:true strength:Exclusive wait_duration:2m15s distinguished:true",
+		redact.Sprintf("%+v", distinguishedWaiter).Redact())
 }
@@ -11,22 +11,31 @@
 package concurrency
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"math/bits"
 	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvpb"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/concurrency/isolation"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/concurrency/lock"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/lockspanset"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/storage"
 	"github.com/cockroachdb/cockroach/pkg/storage/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/util/buildutil"
 	"github.com/cockroachdb/cockroach/pkg/util/container/list"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 	"github.com/cockroachdb/errors"
@@ -80,6 +89,18 @@ const (
 	// result, the request was rejected.
 	waitQueueMaxLengthExceeded
 
+	// waitDeadlineExceeded indicates that the request has been waiting on its
+	// current lock for longer than its configured maximum lock wait duration.
+	// As a result, the request was rejected.
+	waitDeadlineExceeded
+
+	// waitThrottled indicates that the request attempted to enter a lock
+	// wait-queue as a locking request while PerKeyLockAcquisitionRateLimit was
+	// exceeded on the key. The request did not enter the wait-queue; it should
+	// back off for the duration provided in the waitingState and then make
+	// another call to ScanAndEnqueue.
+	waitThrottled
+
 	// doneWaiting indicates that the request is done waiting on this pass
 	// through the lockTable and should make another call to ScanAndEnqueue.
 	doneWaiting
@@ -102,10 +123,48 @@ type waitingState struct {
 	queuedLockingRequests int               // how many locking requests are waiting?
 	queuedReaders         int               // how many readers are waiting?
 
+	// Represents the end of the contiguous run of keys, starting at key, that
+	// the request conflicts with because they're all locked by txn (and by no
+	// other transaction), if ConsolidateAdjacentLockResolution is set and the
+	// run spans more than one key. A single waitingState represents the entire
+	// run, so that once txn has been pushed, the waiter can resolve all of the
+	// run's locks using a single ranged lock update instead of discovering and
+	// resolving them one at a time. Nil otherwise.
+	endKey roachpb.Key
+
+	// Represents whether the conflict is a claim that has yet to be acquired.
+	// This is the case if the lock isn't held and the claimant is an inactive
+	// waiter at the head of the key's wait-queue. It doesn't change how the
+	// request waits -- the claimant is pushed all the same -- but lets debug
+	// tools tell such a wait apart from one on a held lock.
+	unacquiredClaim bool
+
+	// Represents how long the conflicting lock had been held by the claimant
+	// transaction, as tracked by the lock table, when the waiting state was
+	// computed. Zero if the conflict is not a held lock. Waiters on very
+	// long-held locks are prime deadlock or abandonment candidates.
+	lockHeldDuration time.Duration
+
+	// Represents the priority of the conflicting transaction, which waiters can
+	// use to decide whether to push it or to abort themselves without first
+	// paying for a round trip. The priority is only known if the conflict is a
+	// held lock, in which case it's the priority recorded in the lock holder's
+	// TxnMeta. A running request that has yet to acquire the lock it's claiming
+	// has no meaningful priority yet, as its transaction's priority may still be
+	// ratcheted by a push before it does, so txnPriorityKnown is false and
+	// txnPriority is left unset.
+	txnPriority      enginepb.TxnPriority
+	txnPriorityKnown bool
+
 	// Represents the lock strength of the action that the request was trying to
 	// perform when it hit the conflict. E.g. was it trying to perform a (possibly
 	// locking) read or write an Intent?
 	guardStrength lock.Strength
+
+	// Represents how long a request in the waitThrottled state should back off
+	// before scanning the lockTable again, i.e. until the key's acquisition
+	// token bucket has a token available.
+	retryAfter time.Duration
 }
 
 // String implements the fmt.Stringer interface.
@@ -122,11 +181,16 @@ func (s waitingState) SafeFormat(w redact.SafePrinter, _ rune) {
 			distinguished = " (distinguished)"
 		}
 		target := redact.SafeString("holding lock")
-		if !s.held {
+		if s.unacquiredClaim {
+			target = "holding unacquired claim"
+		} else if !s.held {
 			target = "running request"
 		}
 		w.Printf("wait for%s txn %s %s @ key %s (queuedLockingRequests: %d, queuedReaders: %d)",
 			distinguished, s.txn.Short(), target, s.key, s.queuedLockingRequests, s.queuedReaders)
+		if s.endKey != nil {
+			w.Printf(" and the run of locks up to key %s", s.endKey)
+		}
 	case waitSelf:
 		w.Printf("wait self @ key %s", s.key)
 	case waitElsewhere:
@@ -137,6 +201,10 @@ func (s waitingState) SafeFormat(w redact.SafePrinter, _ rune) {
 	case waitQueueMaxLengthExceeded:
 		w.Printf("wait-queue maximum length exceeded @ key %s with length %d",
 			s.key, s.queuedLockingRequests)
+	case waitDeadlineExceeded:
+		w.Printf("lock wait deadline exceeded waiting for txn %s @ key %s", s.txn.Short(), s.key)
+	case waitThrottled:
+		w.Printf("lock acquisition throttled @ key %s, retry after %s", s.key, s.retryAfter)
 	case doneWaiting:
 		w.SafeString("done waiting")
 	default:
@@ -144,6 +212,37 @@ func (s waitingState) SafeFormat(w redact.SafePrinter, _ rune) {
 	}
 }
 
+// scanProgress describes the progress of a request's scan of the lockTable. A
+// watchdog can sample it periodically to distinguish a request that is stuck
+// scanning (e.g. over a span containing a very large number of locks) from
+// one that is waiting on a conflicting lock: the former is scanning, but its
+// steps don't advance.
+type scanProgress struct {
+	// scanning is true if the request is scanning the lockTable.
+	scanning bool
+	// steps is the number of locks visited by all of the request's scans so far.
+	// It never decreases.
+	steps uint64
+	// The request's scan position: key is contained in the span at index in the
+	// request's spans of strength str. The position is updated as the scan
+	// moves from one span to the next and when the scan stops, but not at every
+	// lock visited.
+	key   roachpb.Key
+	str   lock.Strength
+	index int
+}
+
+// SafeFormat implements the redact.SafeFormatter interface.
+func (p scanProgress) SafeFormat(w redact.SafePrinter, _ rune) {
+	w.Printf("scanning: %t, steps: %d, str: %s, index: %d, key: %s",
+		p.scanning, p.steps, p.str, p.index, p.key)
+}
+
+// String implements the fmt.Stringer interface.
+func (p scanProgress) String() string {
+	return redact.StringWithoutMarkers(p)
+}
+
 // Implementation
 // TODO(sbhola):
 // - metrics about lockTable state to export to observability debug pages:
@@ -173,9 +272,22 @@ type treeMu struct {
 	// doing better memory accounting than this.
 	numKeysLocked atomic.Int64
 
+	// estimatedBytes tracks the estimated memory footprint of the keyLocks
+	// structs in the b-tree, as computed by keyLocks.memoryEstimate. It is
+	// maintained incrementally as keys are added to and removed from the
+	// b-tree, and as their lock holders and wait-queues change.
+	estimatedBytes atomic.Int64
+
 	// For dampening the frequency with which we enforce
 	// lockTableImpl.maxKeysLocked.
 	lockAddMaxLocksCheckInterval uint64
+
+	// generation is incremented whenever a keyLocks struct is added to or
+	// removed from the btree. A snapshot of the btree taken at a given
+	// generation is identical to one taken later at the same generation, which
+	// allows guards to keep their snapshot across scans (see
+	// lockTableImpl.doSnapshotForGuard).
+	generation uint64
 }
 
 // lockTableImpl is an implementation of lockTable.
@@ -261,50 +373,536 @@ type lockTableImpl struct {
 	// lockAddMaxLocksCheckInterval, locks will be cleared.
 	//
 	// [1] Simply put, the number of keyLocks objects in the lockTable btree.
-	maxKeysLocked int64
+	//
+	// The maximum can be changed at runtime through the MaxKeysLocked cluster
+	// setting, so it is accessed atomically.
+	maxKeysLocked atomic.Int64
 	// When maxKeysLocked is exceeded, will attempt to clear down to minKeysLocked,
 	// instead of clearing everything.
-	minKeysLocked int64
+	minKeysLocked atomic.Int64
+	// configuredMaxKeysLocked is the maxKeysLocked that the lockTable was
+	// constructed with. It is used when the MaxKeysLocked cluster setting is 0.
+	configuredMaxKeysLocked int64
 
 	// txnStatusCache is a small LRU cache that tracks the status of
-	// transactions that have been successfully pushed.
-	//
-	// NOTE: it probably makes sense to maintain a single txnStatusCache
-	// across all Ranges on a Store instead of an individual cache per
-	// Range. For now, we don't do this because we don't share any state
-	// between separate concurrency.Manager instances.
-	txnStatusCache txnStatusCache
+	// transactions that have been successfully pushed. It is typically shared
+	// across all Ranges on a Store, in which case sharedTxnStatusCache is set.
+	// Otherwise, the cache is individual to this Range.
+	txnStatusCache       *txnStatusCache
+	sharedTxnStatusCache bool
 
 	// clock is used to track the lock hold and lock wait start times.
 	clock *hlc.Clock
 
 	// settings provides a handle to cluster settings.
 	settings *cluster.Settings
+
+	// counters tracks cumulative statistics about the lockTable's operation
+	// over its lifetime. They are exported through Metrics().
+	counters lockTableCounters
+
+	// heldLocks tracks the number of keys on which each transaction holds locks
+	// in the lockTable, and indexes these keys. It is used to enforce
+	// MaxLocksPerTransaction, and to release the locks of transactions that are
+	// found to be finalized. See ReleaseLocksOfFinalizedTxns.
+	heldLocks txnHeldLocks
+
+	// maxLocksPerTxnLogEvery rate limits logging of locks rejected because their
+	// transaction exceeded MaxLocksPerTransaction.
+	maxLocksPerTxnLogEvery log.EveryN
+
+	// rediscoveries tracks recent discoveries of locks, to detect lock
+	// rediscovery loops. See LockRediscoveryLoopThreshold.
+	rediscoveries lockRediscoveryTracker
+
+	// claimantChanges retains the most recent claimant change events. See
+	// ClaimantChangeEventBufferSize.
+	claimantChanges claimantChangeBuffer
+
+	// optimisticGuards is the number of guards created by ScanOptimistic that
+	// have neither been dequeued nor passed to ScanAndEnqueue.
+	optimisticGuards atomic.Int64
+}
+
+// ClaimantChangeReason is the state transition that caused the claimant of a
+// key to change.
+type ClaimantChangeReason int
+
+const (
+	// ClaimantChangeLockAcquired indicates that a lock was acquired on the key.
+	ClaimantChangeLockAcquired ClaimantChangeReason = iota
+	// ClaimantChangeLockDiscovered indicates that a lock was discovered on the
+	// key.
+	ClaimantChangeLockDiscovered
+	// ClaimantChangeLockReleased indicates that the key transitioned from locked
+	// to unlocked, and the requests at the head of its wait-queue established a
+	// claim. It's also used when one of multiple lock holders releases its lock,
+	// leaving the remaining holder as the claimant.
+	ClaimantChangeLockReleased
+	// ClaimantChangeClaimBroken indicates that a request that had claimed the
+	// unlocked key left its wait-queue, and the requests that were queued
+	// behind it established a claim.
+	ClaimantChangeClaimBroken
+	// ClaimantChangeClaimed indicates that a request scanning the lock table
+	// claimed the unlocked key before proceeding to evaluation.
+	ClaimantChangeClaimed
+	// ClaimantChangeRequestQueued indicates that a request scanning the lock
+	// table slotted into the key's wait-queue ahead of the requests actively
+	// waiting there.
+	ClaimantChangeRequestQueued
+)
+
+func (r ClaimantChangeReason) String() string {
+	switch r {
+	case ClaimantChangeLockAcquired:
+		return "lock acquired"
+	case ClaimantChangeLockDiscovered:
+		return "lock discovered"
+	case ClaimantChangeLockReleased:
+		return "lock released"
+	case ClaimantChangeClaimBroken:
+		return "claim broken"
+	case ClaimantChangeClaimed:
+		return "claimed"
+	case ClaimantChangeRequestQueued:
+		return "request queued"
+	default:
+		panic(fmt.Sprintf("unknown ClaimantChangeReason: %d", r))
+	}
+}
+
+// ClaimantChangeEvent records a change of the transaction that claims a key in
+// the lock table, i.e. of the transaction that the requests waiting on the key
+// are informed to push. See keyLocks.claimantTxn.
+type ClaimantChangeEvent struct {
+	// Time is the time at which the claimant changed.
+	Time time.Time
+	// Key is the key whose claimant changed.
+	Key roachpb.Key
+	// OldClaimant and NewClaimant are the IDs of the transaction that claimed
+	// the key before and after the change. They are zero if there was no
+	// claimant, or if the claimant was a non-transactional request without a
+	// claim identity (see Request.NonTxnClaimTxn).
+	OldClaimant uuid.UUID
+	NewClaimant uuid.UUID
+	// Held is true if the new claimant holds a lock on the key, as opposed to
+	// being a request that was sequenced through the lock table ahead of the
+	// waiters.
+	Held bool
+	// Reason is the state transition that caused the claimant to change.
+	Reason ClaimantChangeReason
+}
+
+// claimantChangeBuffer is a ring buffer retaining the most recent claimant
+// change events recorded by a lockTable.
+type claimantChangeBuffer struct {
+	mu     syncutil.Mutex
+	events []ClaimantChangeEvent
+	// next is the index in events at which the next event is recorded, once
+	// events has reached its capacity.
+	next int
+}
+
+// record records the supplied event, retaining at most size events.
+func (b *claimantChangeBuffer) record(ev ClaimantChangeEvent, size int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if cap(b.events) != size {
+		// The size was changed; retain the most recent events that fit.
+		events := b.snapshotLocked()
+		if len(events) > size {
+			events = events[len(events)-size:]
+		}
+		b.events = append(make([]ClaimantChangeEvent, 0, size), events...)
+		b.next = 0
+	}
+	if len(b.events) < size {
+		b.events = append(b.events, ev)
+		return
+	}
+	b.events[b.next] = ev
+	b.next = (b.next + 1) % size
+}
+
+// snapshot returns the retained events, from oldest to newest.
+func (b *claimantChangeBuffer) snapshot() []ClaimantChangeEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.snapshotLocked()
+}
+
+// REQUIRES: b.mu is locked.
+func (b *claimantChangeBuffer) snapshotLocked() []ClaimantChangeEvent {
+	events := make([]ClaimantChangeEvent, 0, len(b.events))
+	events = append(events, b.events[b.next:]...)
+	return append(events, b.events[:b.next]...)
+}
+
+// lockRediscoveryLoopWindow is the window over which the discoveries of a lock
+// are counted to detect lock rediscovery loops.
+const lockRediscoveryLoopWindow = 10 * time.Second
+
+// maxTrackedLockRediscoveries bounds the number of keys tracked by a
+// lockRediscoveryTracker.
+const maxTrackedLockRediscoveries = 1024
+
+// lockRediscoveryTrackerShards is the number of shards of a
+// lockRediscoveryTracker. Discoveries on keys in different shards don't
+// contend with each other.
+const lockRediscoveryTrackerShards = 16
+
+// lockRediscoveryTracker tracks the number of times the lock on each key was
+// recently discovered by requests, to detect lock rediscovery loops. Keys are
+// sharded by their hash, and each shard tracks at most its share of
+// maxTrackedLockRediscoveries keys. Once a shard is full, the key whose window
+// started the longest ago is evicted to make room for a new key.
+type lockRediscoveryTracker struct {
+	shards [lockRediscoveryTrackerShards]lockRediscoveryShard
+}
+
+// lockRediscoveryShard is a shard of a lockRediscoveryTracker.
+type lockRediscoveryShard struct {
+	mu      syncutil.Mutex
+	entries map[string]*list.Element[*lockRediscoveries]
+	// byWindowStart orders the entries by the start of their window, oldest
+	// first, so that the entry to evict is found in constant time.
+	byWindowStart list.List[*lockRediscoveries]
+}
+
+// lockRediscoveries tracks the discoveries of the lock held by a transaction
+// on a key within a window.
+type lockRediscoveries struct {
+	key         string
+	txnID       uuid.UUID
+	windowStart time.Time
+	count       int64
+	// reported is set once a loop has been reported for the window.
+	reported bool
+}
+
+// shard returns the shard that tracks the supplied key.
+func (r *lockRediscoveryTracker) shard(key roachpb.Key) *lockRediscoveryShard {
+	// FNV-1a.
+	h := uint32(2166136261)
+	for _, b := range key {
+		h ^= uint32(b)
+		h *= 16777619
+	}
+	return &r.shards[h%lockRediscoveryTrackerShards]
+}
+
+// record records that the lock held by the supplied transaction on the
+// supplied key was discovered at time now. It returns the number of times the
+// lock was discovered in the current window, and whether that number just
+// exceeded the supplied threshold, in which case a loop should be reported.
+func (r *lockRediscoveryTracker) record(
+	key roachpb.Key, txnID uuid.UUID, now time.Time, threshold int64,
+) (count int64, loop bool) {
+	sh := r.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	elem, ok := sh.entries[string(key)]
+	if !ok {
+		if sh.entries == nil {
+			sh.entries = make(map[string]*list.Element[*lockRediscoveries])
+		}
+		if len(sh.entries) >= maxTrackedLockRediscoveries/lockRediscoveryTrackerShards {
+			oldest := sh.byWindowStart.Front()
+			sh.byWindowStart.Remove(oldest)
+			delete(sh.entries, oldest.Value.key)
+		}
+		elem = sh.byWindowStart.PushBack(&lockRediscoveries{key: string(key)})
+		sh.entries[string(key)] = elem
+	}
+	e := elem.Value
+	if e.txnID != txnID || now.Sub(e.windowStart) >= lockRediscoveryLoopWindow {
+		*e = lockRediscoveries{key: e.key, txnID: txnID, windowStart: now}
+		sh.byWindowStart.MoveToBack(elem)
+	}
+	e.count++
+	if e.count > threshold && !e.reported {
+		e.reported = true
+		return e.count, true
+	}
+	return e.count, false
+}
+
+// maxIndexedKeysLockedPerTxn bounds the number of keys that txnHeldLocks
+// indexes for each transaction holding locks, which bounds the memory used by
+// the index for a transaction that holds locks on many keys. Keys locked by a
+// transaction beyond the bound are counted, but not indexed, and the requests
+// waiting on them notice that the transaction has been finalized as they would
+// without ReleaseLocksOfFinalizedTxns.
+const maxIndexedKeysLockedPerTxn = 1024
+
+// txnHeldLocks tracks the number of keys on which each transaction holds locks,
+// and, while ReleaseLocksOfFinalizedTxns is enabled, indexes (up to
+// maxIndexedKeysLockedPerTxn of) the keyLocks of these keys. It is shared by
+// all keyLocks in a lockTable, which update it as transactions start and stop
+// holding locks on their key.
+//
+// mu is a leaf mutex; it is acquired with keyLocks.mu held.
+type txnHeldLocks struct {
+	settings *cluster.Settings
+	mu       syncutil.Mutex
+	txns     map[uuid.UUID]txnHeldLocksEntry
+}
+
+// txnHeldLocksEntry is the state tracked by txnHeldLocks for a transaction.
+type txnHeldLocksEntry struct {
+	count int64
+	keys  map[*keyLocks]struct{}
+}
+
+// inc records that the supplied transaction started holding locks on the key
+// of the supplied keyLocks.
+func (c *txnHeldLocks) inc(txnID uuid.UUID, kl *keyLocks) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.txns == nil {
+		c.txns = make(map[uuid.UUID]txnHeldLocksEntry)
+	}
+	e := c.txns[txnID]
+	e.count++
+	if ReleaseLocksOfFinalizedTxns.Get(&c.settings.SV) && len(e.keys) < maxIndexedKeysLockedPerTxn {
+		if e.keys == nil {
+			e.keys = make(map[*keyLocks]struct{})
+		}
+		e.keys[kl] = struct{}{}
+	}
+	c.txns[txnID] = e
+}
+
+// dec records that the supplied transaction stopped holding locks on the key
+// of the supplied keyLocks. It is a no-op if the transaction is not known to
+// hold locks on any key.
+func (c *txnHeldLocks) dec(txnID uuid.UUID, kl *keyLocks) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.txns[txnID]
+	if !ok {
+		if buildutil.CrdbTestBuild {
+			panic(fmt.Sprintf("negative held lock count for txn %s", txnID))
+		}
+		return
+	}
+	e.count--
+	if e.count <= 0 {
+		delete(c.txns, txnID)
+		return
+	}
+	delete(e.keys, kl)
+	c.txns[txnID] = e
+}
+
+// get returns the number of keys on which the supplied transaction holds
+// locks.
+func (c *txnHeldLocks) get(txnID uuid.UUID) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.txns[txnID].count
+}
+
+// indexedKeys returns the keyLocks of the keys on which the supplied
+// transaction holds locks, as indexed by the receiver. The keyLocks may have
+// been removed from the lockTable, or released by the transaction, by the time
+// the caller gets to them.
+func (c *txnHeldLocks) indexedKeys(txnID uuid.UUID) []*keyLocks {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := c.txns[txnID].keys
+	if len(keys) == 0 {
+		return nil
+	}
+	res := make([]*keyLocks, 0, len(keys))
+	for kl := range keys {
+		res = append(res, kl)
+	}
+	return res
+}
+
+// lockTableCounters holds cumulative counters maintained by a lockTableImpl.
+// Unlike most of LockTableMetrics, which is a point-in-time view computed by
+// iterating over the locks in the lock table, these counters are updated as
+// events happen and are never reset.
+type lockTableCounters struct {
+	// queuedBeforeAcquire, if set, records how long requests spent in a lock's
+	// wait-queue before their transaction acquired the lock. It is shared by
+	// the lock tables of all ranges on a store, so it's not part of
+	// LockTableMetrics.
+	queuedBeforeAcquire metric.IHistogram
+	// maxLocksPerTxnRejections is the number of lock acquisitions rejected, and
+	// discovered locks not tracked, because their transaction held locks on as
+	// many keys as MaxLocksPerTransaction permits.
+	maxLocksPerTxnRejections atomic.Int64
+	// acquisitionsThrottled is the number of times locking requests were
+	// throttled, either when sequencing or when queueing eagerly, because they
+	// exceeded PerKeyLockAcquisitionRateLimit on a key.
+	acquisitionsThrottled atomic.Int64
+	// waitPolicyErrorRejections is the number of requests using
+	// WaitPolicy_Error that the lock table waiter rejected because of a
+	// conflicting lock. See RecordWaitPolicyErrorRejection.
+	waitPolicyErrorRejections atomic.Int64
+	// locksGCed is the number of keyLocks removed from the lock table's tree,
+	// whether because they became empty or because they were cleared.
+	locksGCed atomic.Int64
+	// locksClearedOnMemoryPressure is the number of keyLocks cleared by
+	// checkMaxKeysLockedAndTryClear, and waitersToldToWaitElsewhere is the
+	// number of their waiters that were transitioned to waitElsewhere.
+	locksClearedOnMemoryPressure atomic.Int64
+	waitersToldToWaitElsewhere   atomic.Int64
+	// locksFreedOnReplicatedAcquire is the number of uncontended unreplicated
+	// locks that were dropped from the lock table when their holder acquired
+	// them with the Replicated durability, and readersReleasedOnReplicatedAcquire
+	// is the number of waiting readers that were released as a result. See
+	// tryFreeLockOnReplicatedAcquire.
+	locksFreedOnReplicatedAcquire      atomic.Int64
+	readersReleasedOnReplicatedAcquire atomic.Int64
+	// pushedLocksResolvedInline and pushedLocksResolvedDeferred are the number
+	// of replicated locks held by pushed transactions that non-locking readers
+	// resolved inline and deferred, respectively. See ResolvePushedLocksInline.
+	pushedLocksResolvedInline   atomic.Int64
+	pushedLocksResolvedDeferred atomic.Int64
+	// resolutionsDeduped and resolutionsPassedThrough are the number of
+	// replicated lock updates accumulated by requests scanning the lock table
+	// that were dropped because they were no-ops, and that were kept for the
+	// request to resolve, respectively. See the end of resumeScan.
+	resolutionsDeduped       atomic.Int64
+	resolutionsPassedThrough atomic.Int64
+	// discoveredLocksRejected is the number of discovered locks that were not
+	// tracked because the lock table was above its high watermark. See
+	// DiscoveredLockHighWatermark.
+	discoveredLocksRejected atomic.Int64
+	// discoveredLocksOfFinalizedTxns is the number of discovered locks that
+	// were not added to the lock table because their holder was known to be
+	// finalized, and were instead handed back to the discoverer to resolve.
+	discoveredLocksOfFinalizedTxns atomic.Int64
+	// heldLockFastPathHits is the number of times a request scanning the lock
+	// table was allowed to proceed past a lock because its transaction already
+	// held the lock with a sufficient strength.
+	heldLockFastPathHits atomic.Int64
+	// rediscoveryLoopsDetected is the number of lock rediscovery loops that
+	// were detected. See LockRediscoveryLoopThreshold.
+	rediscoveryLoopsDetected atomic.Int64
+	// waiterPushes is the number of pushes of conflicting transactions
+	// performed by requests waiting in the lock table.
+	waiterPushes atomic.Int64
+	// epochRegressionAcquisitions is the number of unreplicated lock
+	// acquisitions made by a transaction at an epoch prior to the one it held
+	// the lock at. See EpochRegressionAcquisitionPolicy.
+	epochRegressionAcquisitions atomic.Int64
+	// optimisticEvals is the number of guards created by ScanOptimistic.
+	optimisticEvals atomic.Int64
+	// optimisticEvalFallbacks is the number of guards created by ScanOptimistic
+	// that were subsequently passed to ScanAndEnqueue, i.e. whose requests fell
+	// back to pessimistic evaluation.
+	optimisticEvalFallbacks atomic.Int64
+	// opsWhileDisabled counts, by operation type, the operations received while
+	// the lockTable was disabled. Only maintained if
+	// TrackOperationsWhileDisabled is set.
+	opsWhileDisabled [numDisabledOps]atomic.Int64
+}
+
+// disabledOp enumerates the operations that a disabled lockTable ignores, but
+// may track if TrackOperationsWhileDisabled is set.
+type disabledOp int
+
+const (
+	disabledOpAcquireLock disabledOp = iota
+	disabledOpAddDiscoveredLock
+	disabledOpUpdateLocks
+	numDisabledOps
+)
+
+func (op disabledOp) String() string {
+	switch op {
+	case disabledOpAcquireLock:
+		return "lock acquisition"
+	case disabledOpAddDiscoveredLock:
+		return "discovered lock"
+	case disabledOpUpdateLocks:
+		return "lock update"
+	default:
+		panic(fmt.Sprintf("unknown disabledOp: %d", op))
+	}
+}
+
+// maxLoggedOpsWhileDisabled is the number of operations of each type received
+// while the lockTable is disabled that are logged, if
+// TrackOperationsWhileDisabled is set.
+const maxLoggedOpsWhileDisabled = 10
+
+// recordAcquisitionAfterQueueing records that a lock was acquired by a
+// transaction that had a request queued in the lock's wait-queue for the
+// supplied duration.
+func (c *lockTableCounters) recordAcquisitionAfterQueueing(queued time.Duration) {
+	if c.queuedBeforeAcquire != nil {
+		c.queuedBeforeAcquire.RecordValue(queued.Nanoseconds())
+	}
 }
 
 var _ lockTable = &lockTableImpl{}
 
+// newLockTable constructs a lockTable. The supplied statusCache is shared with
+// the lockTables of other Ranges; if nil, the lockTable maintains its own
+// txnStatusCache.
 func newLockTable(
-	maxLocks int64, rangeID roachpb.RangeID, clock *hlc.Clock, settings *cluster.Settings,
+	maxLocks int64,
+	rangeID roachpb.RangeID,
+	clock *hlc.Clock,
+	settings *cluster.Settings,
+	statusCache *txnStatusCache,
 ) *lockTableImpl {
 	lt := &lockTableImpl{
-		rID:      rangeID,
-		clock:    clock,
-		settings: settings,
-	}
-	lt.setMaxKeysLocked(maxLocks)
+		rID:                    rangeID,
+		clock:                  clock,
+		settings:               settings,
+		maxLocksPerTxnLogEvery: log.Every(10 * time.Second),
+		txnStatusCache:         statusCache,
+		sharedTxnStatusCache:   statusCache != nil,
+	}
+	if lt.txnStatusCache == nil {
+		lt.txnStatusCache = &txnStatusCache{}
+	}
+	lt.heldLocks.settings = settings
+	lt.configuredMaxKeysLocked = maxLocks
+	lt.setMaxKeysLocked(lt.maxKeysLockedFromSettings())
 	return lt
 }
 
+// maxKeysLockedFromSettings returns the soft maximum on the number of keys
+// locked dictated by the MaxKeysLocked cluster setting, or the maximum that the
+// lockTable was constructed with if the setting is 0.
+func (t *lockTableImpl) maxKeysLockedFromSettings() int64 {
+	if maxKeysLocked := MaxKeysLocked.Get(&t.settings.SV); maxKeysLocked > 0 {
+		return maxKeysLocked
+	}
+	return t.configuredMaxKeysLocked
+}
+
 func (t *lockTableImpl) setMaxKeysLocked(maxKeysLocked int64) {
 	// Check at 5% intervals of the max count.
 	lockAddMaxLocksCheckInterval := maxKeysLocked / int64(20)
 	if lockAddMaxLocksCheckInterval == 0 {
 		lockAddMaxLocksCheckInterval = 1
 	}
-	t.maxKeysLocked = maxKeysLocked
-	t.minKeysLocked = maxKeysLocked / 2
+	t.maxKeysLocked.Store(maxKeysLocked)
+	t.minKeysLocked.Store(maxKeysLocked / 2)
+	t.locks.mu.Lock()
 	t.locks.lockAddMaxLocksCheckInterval = uint64(lockAddMaxLocksCheckInterval)
+	t.locks.mu.Unlock()
+}
+
+// OnMaxKeysLockedUpdated implements the lockTable interface.
+func (t *lockTableImpl) OnMaxKeysLockedUpdated() {
+	maxKeysLocked := t.maxKeysLockedFromSettings()
+	if maxKeysLocked == t.maxKeysLocked.Load() {
+		return
+	}
+	t.setMaxKeysLocked(maxKeysLocked)
+	// If the maximum was lowered below the number of keys currently locked,
+	// clear locks now, instead of waiting for a later lock acquisition to notice.
+	t.checkMaxKeysLockedAndTryClear()
 }
 
 // lockTableGuardImpl is an implementation of lockTableGuard.
@@ -374,6 +972,16 @@ func (t *lockTableImpl) setMaxKeysLocked(maxKeysLocked int64) {
 //     request and found that the queue's length was already equal to or
 //     exceeding the request's configured maximum.
 //
+//   - The waitDeadlineExceeded state is used to indicate that the request was
+//     rejected because it had been in a waitFor* state on the same lock for
+//     longer than the request's configured maximum lock wait duration. It is
+//     only ever returned by CurState().
+//
+//   - The waitThrottled state is used to indicate that the request exceeded
+//     PerKeyLockAcquisitionRateLimit when attempting to enter a lock wait-queue
+//     as a locking request. The request should back off and then make another
+//     call to ScanAndEnqueue().
+//
 //   - The doneWaiting state is used to indicate that the request should make
 //     another call to ScanAndEnqueue() (that next call is more likely to return a
 //     lockTableGuard that returns false from StartWaiting()).
@@ -382,11 +990,24 @@ type lockTableGuardImpl struct {
 	lt     *lockTableImpl
 
 	// Information about this request.
-	txn                *roachpb.Transaction
-	ts                 hlc.Timestamp
-	spans              *lockspanset.LockSpanSet
-	waitPolicy         lock.WaitPolicy
-	maxWaitQueueLength int
+	txn                 *roachpb.Transaction
+	ts                  hlc.Timestamp
+	spans               *lockspanset.LockSpanSet
+	waitPolicy          lock.WaitPolicy
+	maxWaitQueueLength  int
+	maxLockWaitDuration time.Duration
+	// nonTxnClaimTxn is the identity under which a non-transactional writer
+	// claims locks, if it opted in to doing so. See Request.NonTxnClaimTxn.
+	nonTxnClaimTxn *enginepb.TxnMeta
+	// ignoredLockHolderTxns are the transactions whose locks the request, a
+	// non-locking read, does not conflict with. See
+	// Request.IgnoredLockHolderTxns.
+	ignoredLockHolderTxns []uuid.UUID
+	// surfacedLockKeys are the keys of the locks held by ignoredLockHolderTxns
+	// that the request discovered during evaluation. The request conflicts with
+	// the locks on these keys like with any other lock. Only accessed by the
+	// request's goroutine.
+	surfacedLockKeys []roachpb.Key
 
 	// Snapshot of the tree for which this request has some spans. Note that
 	// the lockStates in this snapshot may have been removed from
@@ -401,14 +1022,35 @@ type lockTableGuardImpl struct {
 	//   This is not a correctness issue (the whole system is not deadlocked) and we
 	//   expect will not be a real performance issue.
 	//
+	// These anomalies are a consequence of the lazy queueing used by default,
+	// where a request only enters the wait-queue of a lock once its scan
+	// reaches it. EagerQueueing, which enters the wait-queues of all the held
+	// locks in the request's locking spans as soon as it starts waiting,
+	// eliminates them at a potential cost in throughput.
+	//
 	// TODO(sbhola): experimentally evaluate the lazy queueing of the current
-	// implementation, in comparison with eager queueing. If eager queueing
-	// is comparable in system throughput, one can eliminate the above anomalies.
+	// implementation, in comparison with eager queueing (BenchmarkLockTable
+	// runs with and without EagerQueueing). If eager queueing is comparable in
+	// system throughput, it can be made the default to eliminate the above
+	// anomalies.
 	//
 	// TODO(nvanbenschoten): should we be Reset-ing these btree snapshot when we
 	// Dequeue a lockTableGuardImpl? In releaseLockTableGuardImpl?
 	//
 	tableSnapshot btree
+	// snapshotTaken is set once tableSnapshot has been populated, and
+	// snapshotGen is the treeMu.generation at which it was taken. The snapshot
+	// is only retaken if the generation has moved on since.
+	snapshotTaken bool
+	snapshotGen   uint64
+	// snapshotEmpty is set if tableSnapshot contained no locks when it was
+	// taken. It allows IsKeyLockedByConflictingTxn to skip the btree seek in the
+	// common case of a range with no locks.
+	snapshotEmpty bool
+	// optimistic is set if the guard was created by ScanOptimistic, and is
+	// cleared once it is dequeued or passed to ScanAndEnqueue. Such guards are
+	// tracked by lockTableImpl.optimisticGuards.
+	optimistic bool
 
 	// notRemovableLock points to the lock for which this guard has incremented
 	// keyLocks.notRemovable. It will be set to nil when this guard has decremented
@@ -439,6 +1081,20 @@ type lockTableGuardImpl struct {
 	str   lock.Strength // Iterates from strongest to weakest lock strength
 	index int
 
+	// scanning is set while the request is scanning the lock table, and
+	// scanSteps counts the locks visited by the request's scans. They can be read
+	// concurrently with a scan, by ScanProgress. Unlike key, str, and index, which
+	// are only accessed by the scanning goroutine, the scan position is published
+	// for ScanProgress in mu.scanPos.
+	scanning  atomic.Bool
+	scanSteps atomic.Uint64
+
+	// spansDonated is set once the request's lock spans have been donated to
+	// requests from the same transaction (see SameTxnScanDonation). They are
+	// shared read-only with those requests, so they must not be released for
+	// reuse when the request finishes.
+	spansDonated atomic.Bool
+
 	mu struct {
 		syncutil.Mutex
 		startWait bool
@@ -484,6 +1140,22 @@ type lockTableGuardImpl struct {
 		// waiting state. As such, a call to CurState() can simply return the state
 		// without doing any extra work.
 		mustComputeWaitingState bool
+
+		// scanPos is a copy of the request's scan position (key, str, and index),
+		// published as the scan steps between spans and when it stops.
+		scanPos struct {
+			key   roachpb.Key
+			str   lock.Strength
+			index int
+		}
+
+		// donatedSpans, if set, are the lock spans of a request from the same
+		// transaction that had finished scanning the lock table when a lock
+		// acquisition by the transaction released this request from a
+		// wait-queue. The request's scans skip the keys they cover until it is
+		// next sequenced. See SameTxnScanDonation. The spans are shared with the
+		// donor and must not be modified.
+		donatedSpans *lockspanset.LockSpanSet
 	}
 	// Locks to resolve before scanning again. Doesn't need to be protected by
 	// mu since should only be read after the caller has already synced with mu
@@ -506,6 +1178,12 @@ type lockTableGuardImpl struct {
 	// on locks belonging to finalized transactions, we wouldn't need to bother
 	// scanning requests.
 	toResolveUnreplicated []roachpb.LockUpdate
+
+	// mustResolveBeforeProceeding is set if the request's scan encountered a
+	// lock that it must resolve before its scan proceeds (see
+	// ResolvePushedLocksInline). Like toResolve, it is only accessed by the
+	// scanning goroutine.
+	mustResolveBeforeProceeding bool
 }
 
 var _ lockTableGuard = &lockTableGuardImpl{}
@@ -562,6 +1240,40 @@ func (g *lockTableGuardImpl) ResolveBeforeScanning() []roachpb.LockUpdate {
 	return g.toResolve
 }
 
+// ScanProgress returns the progress of the request's scan of the lockTable.
+// Unlike the guard's other methods, it may be called concurrently with the
+// request's use of the guard.
+func (g *lockTableGuardImpl) ScanProgress() scanProgress {
+	sp := scanProgress{
+		scanning: g.scanning.Load(),
+		steps:    g.scanSteps.Load(),
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	sp.key = g.mu.scanPos.key
+	sp.str = g.mu.scanPos.str
+	sp.index = g.mu.scanPos.index
+	return sp
+}
+
+// publishScanPosition publishes the request's current scan position, for use
+// by ScanProgress.
+//
+// ACQUIRES: g.mu.
+func (g *lockTableGuardImpl) publishScanPosition() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.publishScanPositionLocked()
+}
+
+// publishScanPositionLocked is like publishScanPosition, but requires g.mu to
+// be locked.
+func (g *lockTableGuardImpl) publishScanPositionLocked() {
+	g.mu.scanPos.key = g.key
+	g.mu.scanPos.str = g.str
+	g.mu.scanPos.index = g.index
+}
+
 func (g *lockTableGuardImpl) NewStateChan() chan struct{} {
 	g.mu.Lock()
 	defer g.mu.Unlock()
@@ -571,21 +1283,128 @@ func (g *lockTableGuardImpl) NewStateChan() chan struct{} {
 func (g *lockTableGuardImpl) CurState() (waitingState, error) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	if !g.mu.mustComputeWaitingState {
-		return g.mu.state, nil
-	}
-	// Not actively waiting anywhere so no one else can set
-	// mustComputeWaitingState to true while this method executes.
-	g.mu.mustComputeWaitingState = false
-	g.mu.Unlock()
-	err := g.resumeScan(false /* notify */)
-	g.mu.Lock() // Unlock deferred
-	if err != nil {
-		return waitingState{}, err
+	if g.mu.mustComputeWaitingState {
+		// Not actively waiting anywhere so no one else can set
+		// mustComputeWaitingState to true while this method executes.
+		g.mu.mustComputeWaitingState = false
+		g.mu.Unlock()
+		err := g.resumeScan(false /* notify */)
+		g.mu.Lock() // Unlock deferred
+		if err != nil {
+			return waitingState{}, err
+		}
 	}
+	g.maybeExceedLockWaitDeadlineLocked()
 	return g.mu.state, nil
 }
 
+// maybeExceedLockWaitDeadlineLocked transitions the request's waiting state to
+// waitDeadlineExceeded if the request has been waiting on its current lock for
+// longer than its maximum lock wait duration. The wait is measured from
+// mu.curLockWaitStart, so it starts over whenever the request starts waiting
+// on a different key.
+//
+// REQUIRES: g.mu to be locked.
+func (g *lockTableGuardImpl) maybeExceedLockWaitDeadlineLocked() {
+	if g.maxLockWaitDuration <= 0 {
+		return
+	}
+	if kind := g.mu.state.kind; kind != waitFor && kind != waitForDistinguished {
+		return
+	}
+	if g.lt.clock.PhysicalTime().Sub(g.mu.curLockWaitStart) < g.maxLockWaitDuration {
+		return
+	}
+	g.mu.state.kind = waitDeadlineExceeded
+}
+
+// doneWaitingWatcher watches a lockTableGuard on behalf of select-based code,
+// signaling when the request is done waiting in the lock table. See
+// lockTableGuard.WatchDoneWaiting.
+type doneWaitingWatcher struct {
+	done chan struct{}
+	// The fields below are written before done is closed, and must only be read
+	// after.
+	state waitingState
+	err   error
+}
+
+// WatchDoneWaiting implements the lockTableGuard interface.
+func (g *lockTableGuardImpl) WatchDoneWaiting(
+	ctx context.Context, stopper *stop.Stopper,
+) (*doneWaitingWatcher, error) {
+	return watchDoneWaiting(ctx, stopper, g)
+}
+
+// watchDoneWaiting implements lockTableGuard.WatchDoneWaiting for the supplied
+// guard. It wraps the loop that waits on the guard's NewStateChan and checks
+// its CurState, which is run in an async task on the supplied stopper. Calling
+// CurState on each notification, rather than only inspecting the last known
+// state, ensures that states whose computation was deferred (see
+// lockTableGuardImpl.mu.mustComputeWaitingState) are computed, so that no
+// transition is missed.
+func watchDoneWaiting(
+	ctx context.Context, stopper *stop.Stopper, g lockTableGuard,
+) (*doneWaitingWatcher, error) {
+	w := &doneWaitingWatcher{done: make(chan struct{})}
+	if !g.ShouldWait() {
+		w.state = waitingState{kind: doneWaiting}
+		close(w.done)
+		return w, nil
+	}
+	newStateC := g.NewStateChan()
+	if err := stopper.RunAsyncTask(ctx, "lock-table-watch-done-waiting", func(ctx context.Context) {
+		defer close(w.done)
+		for {
+			select {
+			case <-newStateC:
+			case <-ctx.Done():
+				w.err = ctx.Err()
+				return
+			case <-stopper.ShouldQuiesce():
+				w.err = stop.ErrUnavailable
+				return
+			}
+			state, err := g.CurState()
+			if err != nil {
+				w.err = err
+				return
+			}
+			w.state = state
+			switch state.kind {
+			case waitFor, waitForDistinguished, waitSelf:
+				// The request is still waiting.
+			default:
+				// The request is done waiting, or it is in a state that requires the
+				// caller to take action: waitElsewhere, waitQueueMaxLengthExceeded,
+				// waitDeadlineExceeded or waitThrottled.
+				return
+			}
+		}
+	}); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Done returns a channel that is closed once the watch has ended.
+func (w *doneWaitingWatcher) Done() <-chan struct{} {
+	return w.done
+}
+
+// State returns the last waiting state observed by the watcher. Its kind is
+// doneWaiting if the request is free to proceed. Must only be called after
+// the Done channel is closed.
+func (w *doneWaitingWatcher) State() waitingState {
+	return w.state
+}
+
+// Err returns the error that ended the watch, if any. Must only be called after
+// the Done channel is closed.
+func (w *doneWaitingWatcher) Err() error {
+	return w.err
+}
+
 // updateStateToDoneWaitingLocked updates the request's waiting state to
 // indicate that it is done waiting.
 // REQUIRES: g.mu to be locked.
@@ -638,9 +1457,25 @@ func (g *lockTableGuardImpl) updateWaitingStateLocked(newState waitingState) {
 		panic(errors.AssertionFailedf("unexpected waiting state kind: %d", newState.kind))
 	}
 	newState.guardStrength = g.curStrength() // copy over the strength which caused the conflict
+	newState.txnPriority, newState.txnPriorityKnown = newState.conflictingTxnPriority()
+	if newState.endKey == nil && newState.held && g.mu.state.held &&
+		g.mu.state.txn == newState.txn && g.mu.state.key.Equal(newState.key) {
+		// The request is still waiting on the same lock; keep waiting on the rest
+		// of the run, if any, as well.
+		newState.endKey = g.mu.state.endKey
+	}
 	g.mu.state = newState
 }
 
+// conflictingTxnPriority returns the priority of the transaction the waiting
+// state is waiting on, and whether it is known. See waitingState.txnPriority.
+func (s waitingState) conflictingTxnPriority() (enginepb.TxnPriority, bool) {
+	if !s.held || s.txn == nil {
+		return 0, false
+	}
+	return s.txn.Priority, true
+}
+
 // canElideWaitingStateUpdate returns true if updating the guard's waiting state
 // to the supplied waitingState would not cause the waiter to take a different
 // action, such as proceeding with its scan or pushing a different transaction.
@@ -648,8 +1483,11 @@ func (g *lockTableGuardImpl) updateWaitingStateLocked(newState waitingState) {
 //
 // REQUIRES: g.mu to be locked.
 func (g *lockTableGuardImpl) canElideWaitingStateUpdate(newState waitingState) bool {
-	// Note that we don't need to check newState.guardStrength as it's
-	// automatically assigned when updating the state.
+	// Note that we don't need to check newState.guardStrength or
+	// newState.txnPriority as they're automatically assigned when updating the
+	// state; the latter is derived from newState.txn and newState.held. Nor do
+	// we need to check newState.unacquiredClaim, which only serves observability
+	// and, for a given claimant, follows from newState.held.
 	return g.mu.state.kind == newState.kind && g.mu.state.txn == newState.txn &&
 		g.mu.state.key.Equal(newState.key) && g.mu.state.held == newState.held
 }
@@ -689,6 +1527,12 @@ func (g *lockTableGuardImpl) CheckOptimisticNoConflicts(
 func (g *lockTableGuardImpl) IsKeyLockedByConflictingTxn(
 	key roachpb.Key, str lock.Strength,
 ) (bool, *enginepb.TxnMeta, error) {
+	if g.snapshotEmpty {
+		// Fast path: there were no locks on the range when the snapshot was
+		// taken. The snapshot may be stale by now, but that is no different
+		// from the case where it's non-empty.
+		return false, nil, nil
+	}
 	iter := g.tableSnapshot.MakeIter()
 	iter.SeekGE(&keyLocks{key: key})
 	if !iter.Valid() || !iter.Cur().key.Equal(key) {
@@ -738,15 +1582,24 @@ func (g *lockTableGuardImpl) IsKeyLockedByConflictingTxn(
 		return false, nil, nil
 	}
 
+	byPriority := g.lt.priorityOrderedWaitQueues()
+	promoting := l.isPromotingRequest(g)
 	for e := l.queuedLockingRequests.Front(); e != nil; e = e.Next() {
 		qqg := e.Value
-		if qqg.guard.seqNum > g.seqNum {
-			// We only need to check for conflicts with requests that came before us
-			// (read: have lower sequence numbers than us). Note that the list of
-			// queuedLockingRequests is sorted in increasing order of sequence number.
+		if qqgPromoting := l.isPromotingRequest(qqg.guard); qqgPromoting != promoting {
+			// Requests trying to promote a lock held by their transaction are ordered
+			// before requests from transactions that don't hold locks on the key.
+			if promoting {
+				break
+			}
+		} else if g.queuedAheadOf(qqg.guard, byPriority) {
+			// We only need to check for conflicts with requests that are ordered
+			// before us (read: have lower sequence numbers than us, or higher
+			// priorities if PriorityOrderedWaitQueues is set). Note that the list of
+			// queuedLockingRequests is sorted in this order.
 			break
 		}
-		if g.isSameTxn(qqg.guard.txnMeta()) {
+		if g.isSameTxn(qqg.guard.claimTxnMeta()) {
 			return false, nil, errors.AssertionFailedf(
 				"SKIP LOCKED request should not find another waiting request from the same transaction",
 			)
@@ -758,6 +1611,27 @@ func (g *lockTableGuardImpl) IsKeyLockedByConflictingTxn(
 	return false, nil, nil // no conflict
 }
 
+// WaitPositionEstimate implements the lockTableGuard interface.
+func (g *lockTableGuardImpl) WaitPositionEstimate() int {
+	// Copy the set of keys out from under g.mu before visiting them, as the
+	// lock ordering requires keyLocks.mu to be acquired before g.mu.
+	g.mu.Lock()
+	kls := make([]*keyLocks, 0, len(g.mu.locks))
+	for kl := range g.mu.locks {
+		kls = append(kls, kl)
+	}
+	g.mu.Unlock()
+
+	byPriority := g.lt.priorityOrderedWaitQueues()
+	n := 0
+	for _, kl := range kls {
+		kl.mu.Lock()
+		n += kl.numRequestsAheadOf(g, byPriority)
+		kl.mu.Unlock()
+	}
+	return n
+}
+
 func (g *lockTableGuardImpl) notify() {
 	select {
 	case g.mu.signal <- struct{}{}:
@@ -783,12 +1657,91 @@ func (g *lockTableGuardImpl) txnMeta() *enginepb.TxnMeta {
 	return &g.txn.TxnMeta
 }
 
+// claimTxnMeta returns the identity under which the request claims locks: the
+// TxnMeta of its transaction or, for a non-transactional writer that opted in
+// to claiming locks, its Request.NonTxnClaimTxn. Returns nil if the request
+// cannot claim locks.
+func (g *lockTableGuardImpl) claimTxnMeta() *enginepb.TxnMeta {
+	if g.txn == nil {
+		return g.nonTxnClaimTxn
+	}
+	return &g.txn.TxnMeta
+}
+
+// canClaim returns whether the request can claim locks by marking itself as an
+// inactive waiter in their wait-queues.
+func (g *lockTableGuardImpl) canClaim() bool {
+	return g.claimTxnMeta() != nil
+}
+
+// txnPriority returns the priority of the request's transaction. Non-
+// transactional requests have the lowest priority.
+func (g *lockTableGuardImpl) txnPriority() enginepb.TxnPriority {
+	if g.txn == nil {
+		return enginepb.MinTxnPriority
+	}
+	return g.txn.Priority
+}
+
+// queuedAheadOf returns whether the request is ordered before the supplied
+// request in lock wait-queues. Requests are ordered by sequence number, unless
+// byPriority is set, in which case they are first ordered by decreasing
+// transaction priority. See PriorityOrderedWaitQueues.
+func (g *lockTableGuardImpl) queuedAheadOf(other *lockTableGuardImpl, byPriority bool) bool {
+	if byPriority {
+		if p, otherP := g.txnPriority(), other.txnPriority(); p != otherP {
+			return p > otherP
+		}
+	}
+	return g.seqNum < other.seqNum
+}
+
 func (g *lockTableGuardImpl) hasUncertaintyInterval() bool {
 	return g.txn != nil && g.txn.ReadTimestamp.Less(g.txn.GlobalUncertaintyLimit)
 }
 
+// isSameTxn returns whether the supplied transaction is the identity under
+// which the request claims locks (see claimTxnMeta). A non-transactional
+// writer is the same transaction as its claim identity, if it supplied one,
+// and so as any other request that shares it. Non-transactional requests
+// without a claim identity are never the same transaction as anyone else.
 func (g *lockTableGuardImpl) isSameTxn(txn *enginepb.TxnMeta) bool {
-	return g.txn != nil && g.txn.ID == txn.ID
+	if txn == nil {
+		return false
+	}
+	if g.txn == nil {
+		return g.nonTxnClaimTxn != nil && g.nonTxnClaimTxn.ID == txn.ID
+	}
+	return g.txn.ID == txn.ID
+}
+
+// ignoresLocksFromTxn returns whether the request has been told to ignore the
+// locks of the supplied transaction. See Request.IgnoredLockHolderTxns.
+func (g *lockTableGuardImpl) ignoresLocksFromTxn(txn *enginepb.TxnMeta) bool {
+	if txn == nil {
+		return false
+	}
+	for _, id := range g.ignoredLockHolderTxns {
+		if id == txn.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoresLock returns whether the request ignores the lock held by the supplied
+// transaction on the supplied key: the request has been told to ignore the
+// transaction's locks, and hasn't discovered the lock during evaluation.
+func (g *lockTableGuardImpl) ignoresLock(key roachpb.Key, txn *enginepb.TxnMeta) bool {
+	if !g.ignoresLocksFromTxn(txn) {
+		return false
+	}
+	for _, k := range g.surfacedLockKeys {
+		if k.Equal(key) {
+			return false
+		}
+	}
+	return true
 }
 
 // curStrength returns the lock strength of the current lock span being scanned
@@ -817,6 +1770,8 @@ func makeLockMode(str lock.Strength, txn *enginepb.TxnMeta, ts hlc.Timestamp) lo
 		return lock.MakeModeNone(ts, iso)
 	case lock.Shared:
 		return lock.MakeModeShared()
+	case lock.Update:
+		return lock.MakeModeUpdate()
 	case lock.Exclusive:
 		return lock.MakeModeExclusive(ts, iso)
 	case lock.Intent:
@@ -867,6 +1822,8 @@ func (g *lockTableGuardImpl) takeToResolveUnreplicated() []roachpb.LockUpdate {
 //
 // ACQUIRES: g.mu.
 func (g *lockTableGuardImpl) resumeScan(notify bool) error {
+	g.scanning.Store(true)
+	defer g.scanning.Store(false)
 	spans := g.spans.GetSpans(g.curStrength())
 	var span *roachpb.Span
 	resumingInSameSpan := false
@@ -876,6 +1833,7 @@ func (g *lockTableGuardImpl) resumeScan(notify bool) error {
 		span = &spans[g.index]
 		resumingInSameSpan = true
 	}
+	g.publishScanPosition()
 	defer func() {
 		// Eagerly update any unreplicated locks that are known to belong to
 		// finalized transactions. We do so regardless of whether this request can
@@ -891,12 +1849,20 @@ func (g *lockTableGuardImpl) resumeScan(notify bool) error {
 		}
 	}()
 
+	consolidate := g.lt.consolidateAdjacentLockResolution()
+	g.mu.Lock()
+	donated := g.mu.donatedSpans
+	g.mu.Unlock()
 	for span != nil {
 		startKey := span.Key
 		if resumingInSameSpan {
 			startKey = g.key
 		}
 		iter := g.tableSnapshot.MakeIter()
+		// inRun is set if the last lock scanned in this span added a single
+		// lock update for a finalized transaction to the end of g.toResolve,
+		// which the next lock's update can be consolidated into.
+		inRun := false
 
 		// From here on, the use of resumingInSameSpan is just a performance
 		// optimization to deal with the interface limitation of btree that
@@ -906,6 +1872,7 @@ func (g *lockTableGuardImpl) resumeScan(notify bool) error {
 		ltRange := &keyLocks{key: startKey, endKey: span.EndKey}
 		for iter.FirstOverlap(ltRange); iter.Valid(); iter.NextOverlap(ltRange) {
 			l := iter.Cur()
+			g.scanSteps.Add(1)
 			if resumingInSameSpan {
 				resumingInSameSpan = false
 				if l.key.Equal(startKey) {
@@ -915,16 +1882,45 @@ func (g *lockTableGuardImpl) resumeScan(notify bool) error {
 				// Else, past the lock where it stopped waiting. We may not
 				// encounter that lock since it may have been garbage collected.
 			}
+			if donated != nil && g.isDonatedKey(donated, l.key) {
+				// A request from the same transaction already found this key to be
+				// free of conflicting locks. This scan is being performed outside of
+				// latches, so skipping the key is safe; it is verified again by the
+				// request's next (latched) scan.
+				continue
+			}
+			numToResolve := len(g.toResolve)
 			conflicts, err := l.scanAndMaybeEnqueue(g, notify)
 			if err != nil {
 				return err
 			}
+			if consolidate {
+				inRun = g.maybeConsolidateToResolve(numToResolve, inRun)
+			}
 			if conflicts {
+				if consolidate {
+					g.maybeConsolidateWaitingState(iter, ltRange)
+				}
+				if g.lt.eagerQueueing() {
+					iter.NextOverlap(ltRange)
+					g.enqueueRemainingEagerly(iter, ltRange)
+				}
+				g.publishScanPosition()
 				return nil
 			}
+			if g.mustResolveBeforeProceeding {
+				break
+			}
+		}
+		if g.mustResolveBeforeProceeding {
+			// Stop scanning; the request will resolve the locks it has accumulated
+			// in toResolve and then scan again.
+			g.mustResolveBeforeProceeding = false
+			break
 		}
 		resumingInSameSpan = false
 		span = stepToNextSpan(g)
+		g.publishScanPosition()
 	}
 
 	if len(g.toResolve) > 0 {
@@ -951,12 +1947,16 @@ func (g *lockTableGuardImpl) resumeScan(notify bool) error {
 			if doResolve {
 				g.toResolve[j] = g.toResolve[i]
 				j++
+				g.lt.counters.resolutionsPassedThrough.Add(1)
+			} else {
+				g.lt.counters.resolutionsDeduped.Add(1)
 			}
 		}
 		g.toResolve = g.toResolve[:j]
 	}
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	g.publishScanPositionLocked()
 	g.updateStateToDoneWaitingLocked()
 	if notify {
 		g.notify()
@@ -964,6 +1964,102 @@ func (g *lockTableGuardImpl) resumeScan(notify bool) error {
 	return nil
 }
 
+// maybeConsolidateToResolve is called after a lock is scanned with the length
+// of g.toResolve before the lock was scanned. If the lock added a single lock
+// update for a finalized transaction, and the previously scanned lock in the
+// span did the same for the same transaction (as indicated by inRun), the two
+// are consolidated into a single ranged lock update spanning both locks. It
+// returns whether the lock's update can be consolidated with the next lock's.
+func (g *lockTableGuardImpl) maybeConsolidateToResolve(numToResolve int, inRun bool) bool {
+	if len(g.toResolve) != numToResolve+1 {
+		// The lock added no lock updates, or one for each of multiple holders.
+		return false
+	}
+	up := &g.toResolve[numToResolve]
+	if !up.Status.IsFinalized() {
+		return false
+	}
+	if inRun {
+		prev := &g.toResolve[numToResolve-1]
+		if prev.Txn.ID == up.Txn.ID {
+			prev.EndKey = up.Key.Next()
+			g.toResolve = g.toResolve[:numToResolve]
+		}
+	}
+	return true
+}
+
+// maybeConsolidateWaitingState is called by a request that has started waiting
+// at the lock at the supplied iterator's position. If the request is waiting
+// on a held lock, the lock's successors in the current span that are locked
+// only by the same transaction, and that the request conflicts with, form a
+// contiguous run with the lock. The run is recorded in the request's waiting
+// state (see waitingState.endKey), so that the request waits on the entire run
+// at once. The request doesn't enter the wait-queues of the run's other locks,
+// and its scan position is left unchanged; once it's done waiting, it scans
+// the rest of the run again.
+func (g *lockTableGuardImpl) maybeConsolidateWaitingState(iter iterator, ltRange *keyLocks) {
+	g.mu.Lock()
+	ws := g.mu.state
+	g.mu.Unlock()
+	if (ws.kind != waitFor && ws.kind != waitForDistinguished) || !ws.held {
+		return
+	}
+	var endKey roachpb.Key
+	for iter.NextOverlap(ltRange); iter.Valid(); iter.NextOverlap(ltRange) {
+		l := iter.Cur()
+		if !l.conflictsOnlyWithHolder(g, ws.txn.ID) {
+			break
+		}
+		endKey = l.key.Next()
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// The request may have been told to stop waiting at the lock, or to wait on
+	// a different transaction, since the scan released the lock's mutex.
+	if g.mu.state.kind == ws.kind && g.mu.state.txn == ws.txn && g.mu.state.key.Equal(ws.key) {
+		g.mu.state.endKey = endKey
+	}
+}
+
+// enqueueRemainingEagerly is used when EagerQueueing is enabled by a request
+// that has started waiting at a lock. It enters the request, as an inactive
+// waiter, into the wait-queues of the remaining held locks in its locking
+// spans, starting at the supplied iterator's position in the current span. The
+// request's scan position is left unchanged, so that it resumes scanning at
+// the lock it is waiting at.
+//
+// Only transactional locking requests are enqueued eagerly; non-locking
+// requests and non-transactional writers cannot wait inactively.
+func (g *lockTableGuardImpl) enqueueRemainingEagerly(iter iterator, ltRange *keyLocks) {
+	if g.txn == nil || g.curStrength() == lock.None {
+		return
+	}
+	g.mu.Lock()
+	kind := g.mu.state.kind
+	g.mu.Unlock()
+	if kind == waitQueueMaxLengthExceeded || kind == waitThrottled {
+		// The request will be rejected, or will back off and scan again.
+		return
+	}
+	key, str, index := g.key, g.str, g.index
+	defer func() {
+		g.key, g.str, g.index = key, str, index
+	}()
+	for {
+		for ; iter.Valid(); iter.NextOverlap(ltRange) {
+			iter.Cur().enqueueInactiveLockingRequest(g)
+		}
+		span := stepToNextSpan(g)
+		if span == nil || g.curStrength() == lock.None {
+			return
+		}
+		iter = g.tableSnapshot.MakeIter()
+		ltRange = &keyLocks{key: span.Key, endKey: span.EndKey}
+		iter.FirstOverlap(ltRange)
+	}
+}
+
 // queuedGuard is used to wrap waiting locking requests in the keyLocks struct.
 // Waiting requests typically wait in an active state, i.e., the
 // lockTableGuardImpl.key refers to the same key inside this keyLock struct.
@@ -980,12 +2076,17 @@ func (g *lockTableGuardImpl) resumeScan(notify bool) error {
 //     waiter.
 //
 // The first two cases above (claiming an unheld lock) only occur for
-// (transactional) locking requests, but the other cases can happen for
-// both locking requests and non-transactional writers.
+// transactional locking requests and for non-transactional writers that opted
+// in to claiming locks (see Request.NonTxnClaimTxn), but the other cases can
+// happen for both locking requests and non-transactional writers.
 type queuedGuard struct {
 	guard  *lockTableGuardImpl
 	mode   lock.Mode // protected by keyLocks.mu
 	active bool      // protected by keyLocks.mu
+	// enqueueTime is the time at which the request entered the wait-queue. It
+	// is not updated if the request transitions between active and inactive
+	// waiting.
+	enqueueTime time.Time
 }
 
 // Information about a lock holder for unreplicated locks.
@@ -996,7 +2097,8 @@ type unreplicatedLockHolderInfo struct {
 	// a sentinel value (-1) is stored.
 	//
 	// NB: Intents cannot be held/acquired in unreplicated fashion; thus the
-	// highest lock strength for unreplicated locks is Exclusive.
+	// highest lock strength for unreplicated locks is Exclusive. Conversely,
+	// Update locks can only be held in unreplicated fashion.
 	strengths [len(unreplicatedHolderStrengths)]enginepb.TxnSeq
 
 	// The timestamp at which the unreplicated lock is held. Must not regress.
@@ -1006,7 +2108,9 @@ type unreplicatedLockHolderInfo struct {
 // Fixed length slice for all supported lock strengths for unreplicated locks.
 // May be used to iterate supported lock strengths in strength order (strongest
 // to weakest).
-var unreplicatedHolderStrengths = [...]lock.Strength{lock.Exclusive, lock.Shared}
+//
+// NB: Update locks can only be held in unreplicated fashion.
+var unreplicatedHolderStrengths = [...]lock.Strength{lock.Exclusive, lock.Update, lock.Shared}
 
 // unreplicatedLockHolderStrengthToIndexMap returns a mapping between
 // (strength, index) pairs that can be used to index into the
@@ -1046,6 +2150,18 @@ func (ulh *unreplicatedLockHolderInfo) epochBumped() {
 	ulh.resetStrengths()
 }
 
+// epochRegressed is called when a lock acquisition made by the transaction at a
+// prior epoch is applied to the lock. Sequence numbers from different epochs are
+// not comparable, so those tracked for the strengths the lock is held with are
+// reset, as if the lock had been acquired with them at the start of its epoch.
+func (ulh *unreplicatedLockHolderInfo) epochRegressed() {
+	for strIdx, minSeqNumber := range ulh.strengths {
+		if minSeqNumber != -1 {
+			ulh.strengths[strIdx] = 0
+		}
+	}
+}
+
 func (ulh *unreplicatedLockHolderInfo) resetStrengths() {
 	for strIdx := range ulh.strengths {
 		ulh.strengths[strIdx] = -1
@@ -1283,30 +2399,219 @@ type keyLocks struct {
 	// Information about the requests waiting on the lock.
 	lockWaitQueue
 
-	// notRemovable is temporarily incremented when a lock is added using
-	// AddDiscoveredLock. This is to ensure liveness by not allowing the lock to
-	// be removed until the requester has called ScanAndEnqueue. The *keyLocks
-	// is also remembered in lockTableGuardImpl.notRemovableLock. notRemovable
-	// behaves like a reference count since multiple requests may want to mark
-	// the same lock as not removable.
-	notRemovable int
+	// notRemovable temporarily records the seqNum of a request when it adds a
+	// lock using AddDiscoveredLock. This is to ensure liveness by not allowing
+	// the lock to be removed until the requester has called ScanAndEnqueue. The
+	// *keyLocks is also remembered in lockTableGuardImpl.notRemovableLock.
+	// notRemovable behaves like a reference count since multiple requests may
+	// want to mark the same lock as not removable; the seqNums are tracked,
+	// rather than just the count, so that the requests pinning the lock can be
+	// identified when diagnosing liveness issues.
+	notRemovable []uint64
+
+	// heldLocks, if set, is informed as transactions start and stop holding
+	// locks on this key. This state is never mutated.
+	heldLocks *txnHeldLocks
+
+	// estimatedBytes, if set, is informed as the estimated memory footprint of
+	// the key's lock holders and wait-queues changes. This state is never
+	// mutated.
+	estimatedBytes *atomic.Int64
+
+	// acquisitionTokens is a token bucket used to rate limit the locking
+	// requests admitted into this key's wait-queue, refilled as of
+	// acquisitionTokensUpdated. Only maintained if
+	// PerKeyLockAcquisitionRateLimit is set.
+	acquisitionTokens        float64
+	acquisitionTokensUpdated time.Time
+
+	// claimant is the ID of the transaction that claimed the key as of the last
+	// call to informActiveWaiters, or zero if there was none (or if it was a
+	// non-transactional request without a claim identity). It is used to detect
+	// claimant changes. See ClaimantChangeEventBufferSize.
+	claimant uuid.UUID
 }
 
-// txnLock tracks information about locks held by a specific transaction on a
-// single key.
-type txnLock struct {
-	// The TxnMeta of the transaction that holds the lock. For a given
-	// transaction, the lock may be acquired/updated using a series of different
-	// TxnMetas. While doing so, we provide a few invariants:
-	//
-	// 1. The epoch of the TxnMeta stored here must be monotonically increasing.
-	// 2. The tracking of sequence numbers in unreplicatedLockInfo corresponds
-	// to the epoch of the TxnMeta stored below. This allows us to account for
-	// savepoint rollbacks within a particular epoch.
-	//
-	// As a result, the TxnMeta stored here may not correspond to the latest
-	// call to acquire/update the lock (if the call was made using a TxnMeta
-	// with an older epoch).
+// baseEstimatedBytes returns the estimated memory footprint of the key's state
+// when it has no lock holders and its wait-queues are empty.
+func (kl *keyLocks) baseEstimatedBytes() int64 {
+	return keyLocksEstimatedBytes + int64(len(kl.key))
+}
+
+// holderEstimatedBytes returns the estimated memory footprint of a lock holder.
+func holderEstimatedBytes(tl *txnLock) int64 {
+	return lockHolderEstimatedBytes + int64(len(tl.txn.Key))
+}
+
+// adjustEstimatedBytes informs estimatedBytes, if set, of a change in the
+// estimated memory footprint of the key's state.
+func (kl *keyLocks) adjustEstimatedBytes(delta int64) {
+	if kl.estimatedBytes != nil {
+		kl.estimatedBytes.Add(delta)
+	}
+}
+
+// memoryEstimate returns the estimated memory footprint of the key's state.
+//
+// REQUIRES: kl.mu is locked.
+func (kl *keyLocks) memoryEstimate() LockMemoryEstimate {
+	est := LockMemoryEstimate{
+		Key:                   kl.key,
+		Holders:               int64(kl.holders.Len()),
+		WaitingReaders:        int64(kl.waitingReaders.Len()),
+		QueuedLockingRequests: int64(kl.queuedLockingRequests.Len()),
+	}
+	est.Bytes = kl.baseEstimatedBytes() +
+		(est.WaitingReaders+est.QueuedLockingRequests)*queuedRequestEstimatedBytes
+	for e := kl.holders.Front(); e != nil; e = e.Next() {
+		est.Bytes += holderEstimatedBytes(e.Value)
+	}
+	return est
+}
+
+// appendLongHeldLocks appends a LongHeldLock for each holder of the lock on the
+// receiver's key to the supplied slice, if the lock has been held for longer
+// than the supplied threshold. Holders that are known to have been finalized or
+// pushed, as per the supplied txnStatusCache, are skipped; pushing them again
+// would be redundant.
+//
+// REQUIRES: kl.mu to be locked.
+func (kl *keyLocks) appendLongHeldLocks(
+	res []LongHeldLock, now time.Time, threshold time.Duration, txnStatusCache *txnStatusCache,
+) []LongHeldLock {
+	heldDuration := kl.lockHeldDuration(now)
+	if !kl.isLocked() || heldDuration <= threshold {
+		return res
+	}
+	for e := kl.holders.Front(); e != nil; e = e.Next() {
+		txn := e.Value.getLockHolderTxn()
+		if _, ok := txnStatusCache.finalizedTxns.get(txn.ID); ok {
+			continue
+		}
+		if _, ok := txnStatusCache.pendingTxns.get(txn.ID); ok {
+			continue
+		}
+		res = append(res, LongHeldLock{Key: kl.key, Txn: txn, HeldDuration: heldDuration})
+	}
+	return res
+}
+
+// contention returns the contention caused by the key's lock, attributed to
+// the transaction that has claimed it. It returns false if the lock isn't held
+// or has no active waiters.
+//
+// REQUIRES: kl.mu is locked.
+func (kl *keyLocks) contention(now time.Time) (TxnContention, bool) {
+	if !kl.isLocked() {
+		return TxnContention{}, false
+	}
+	waiters := int64(kl.waitingReaders.Len())
+	for e := kl.queuedLockingRequests.Front(); e != nil; e = e.Next() {
+		if e.Value.active {
+			waiters++
+		}
+	}
+	if waiters == 0 {
+		return TxnContention{}, false
+	}
+	claimant, _ := kl.claimantTxn()
+	totalWaitDuration, _ := kl.totalAndMaxWaitDuration(now)
+	return TxnContention{
+		TxnID:             claimant.ID,
+		Locks:             1,
+		Waiters:           waiters,
+		WaitDurationNanos: totalWaitDuration.Nanoseconds(),
+	}, true
+}
+
+// numActiveWaiters returns the number of requests actively waiting on the key:
+// the waiting readers and the active queued locking requests.
+//
+// REQUIRES: kl.mu is locked.
+func (kl *keyLocks) numActiveWaiters() int {
+	waiters := kl.waitingReaders.Len()
+	for e := kl.queuedLockingRequests.Front(); e != nil; e = e.Next() {
+		if e.Value.active {
+			waiters++
+		}
+	}
+	return waiters
+}
+
+// numRequestsAheadOf returns the number of requests waiting at the key that
+// are ordered before the supplied guard, as determined by queuedAheadOf. Both
+// non-locking readers and locking requests are counted, regardless of whether
+// they are actively waiting.
+//
+// REQUIRES: kl.mu is locked.
+func (kl *keyLocks) numRequestsAheadOf(g *lockTableGuardImpl, byPriority bool) int {
+	n := 0
+	for e := kl.waitingReaders.Front(); e != nil; e = e.Next() {
+		if e.Value != g && e.Value.queuedAheadOf(g, byPriority) {
+			n++
+		}
+	}
+	for e := kl.queuedLockingRequests.Front(); e != nil; e = e.Next() {
+		if qg := e.Value; qg.guard != g && qg.guard.queuedAheadOf(g, byPriority) {
+			n++
+		}
+	}
+	return n
+}
+
+// queueHeadCompatibility returns the compatibility of the head of the key's
+// queue of locking requests with the requests that follow it, mirroring the
+// logic of maybeReleaseCompatibleLockingRequests without modifying the queue.
+// It returns false if the key is locked or has no transactional locking
+// requests queued.
+//
+// REQUIRES: kl.mu is locked.
+func (kl *keyLocks) queueHeadCompatibility(
+	st *cluster.Settings,
+) (LockQueueHeadCompatibility, bool) {
+	if kl.isLocked() {
+		return LockQueueHeadCompatibility{}, false
+	}
+	// Non-transactional writers at the head of the queue are released
+	// regardless of the strength of the requests that follow them, so the head
+	// is the first request that can claim the lock.
+	e := kl.queuedLockingRequests.Front()
+	for e != nil && !e.Value.guard.canClaim() {
+		e = e.Next()
+	}
+	if e == nil {
+		return LockQueueHeadCompatibility{}, false
+	}
+	head := e.Value.mode
+	c := LockQueueHeadCompatibility{
+		Key:                   kl.key,
+		HeadStrength:          head.Strength,
+		QueuedLockingRequests: int64(kl.queuedLockingRequests.Len()),
+	}
+	for e = e.Next(); e != nil; e = e.Next() {
+		if lock.Conflicts(head, e.Value.mode, &st.SV) {
+			break
+		}
+		c.CompatibleFollowers++
+	}
+	return c, true
+}
+
+// txnLock tracks information about locks held by a specific transaction on a
+// single key.
+type txnLock struct {
+	// The TxnMeta of the transaction that holds the lock. For a given
+	// transaction, the lock may be acquired/updated using a series of different
+	// TxnMetas. While doing so, we provide a few invariants:
+	//
+	// 1. The epoch of the TxnMeta stored here must be monotonically increasing.
+	// 2. The tracking of sequence numbers in unreplicatedLockInfo corresponds
+	// to the epoch of the TxnMeta stored below. This allows us to account for
+	// savepoint rollbacks within a particular epoch.
+	//
+	// As a result, the TxnMeta stored here may not correspond to the latest
+	// call to acquire/update the lock (if the call was made using a TxnMeta
+	// with an older epoch).
 	//
 	// TODO(arul): Now that we expect this to always be set, let's store the
 	// entire txnMeta here instead of storing it by reference.
@@ -1407,10 +2712,12 @@ func (tl *txnLock) getLockMode() lock.Mode {
 	if tl.replicatedInfo.held(lock.Intent) {
 		return lock.MakeModeIntent(ts)
 	}
-	// Other than lock.Intent, which we've already handled above,
+	// Other than lock.Intent, which we've already handled above, and
+	// lock.Update, which can only be held unreplicated,
 	// replicatedHolderStrengths == unreplicatedHolderStrengths.
 	for _, str := range unreplicatedHolderStrengths {
-		if !tl.unreplicatedInfo.held(str) && !tl.replicatedInfo.held(str) {
+		if !tl.unreplicatedInfo.held(str) &&
+			(str == lock.Update || !tl.replicatedInfo.held(str)) {
 			continue
 		}
 		switch str {
@@ -1421,6 +2728,8 @@ func (tl *txnLock) getLockMode() lock.Mode {
 			// Using hlc.MaxTimestamp as the timestamp for the exclusive lock ensures
 			// that non-locking reads do not conflict with replicated exclusive locks.
 			return lock.MakeModeExclusive(hlc.MaxTimestamp, lockHolderTxn.IsoLevel)
+		case lock.Update:
+			return lock.MakeModeUpdate()
 		case lock.Shared:
 			return lock.MakeModeShared()
 		default:
@@ -1473,7 +2782,12 @@ func (tl *txnLock) isIdempotentLockAcquisition(acq *roachpb.LockAcquisition) boo
 // the supplied lock acquisition.
 //
 // REQUIRES: kl.mu to be locked.
-func (tl *txnLock) reacquireLock(acq *roachpb.LockAcquisition) error {
+func (tl *txnLock) reacquireLock(
+	acq *roachpb.LockAcquisition, st *cluster.Settings, counters *lockTableCounters,
+) error {
+	// epochRegressed is set if an unreplicated lock held at a newer epoch is
+	// being re-acquired at a prior epoch, and EpochRegressionApply permitted it.
+	epochRegressed := false
 	// An unreplicated lock is being re-acquired...
 	if acq.Durability == lock.Unreplicated && tl.isHeldUnreplicated() {
 		switch {
@@ -1489,12 +2803,29 @@ func (tl *txnLock) reacquireLock(acq *roachpb.LockAcquisition) error {
 			// for them.
 			tl.unreplicatedInfo.rollbackIgnoredSeqNumbers(acq.IgnoredSeqNums)
 		case tl.txn.Epoch > acq.Txn.Epoch: // at a prior epoch
-			// Reject the request; the logic here parallels how mvccPutInternal
-			// handles this case for intents.
-			return errors.Errorf(
-				"locking request with epoch %d came after lock(unreplicated) had already been acquired at epoch %d in txn %s",
-				acq.Txn.Epoch, tl.txn.Epoch, acq.Txn.ID,
-			)
+			counters.epochRegressionAcquisitions.Add(1)
+			switch EpochRegressionPolicy(EpochRegressionAcquisitionPolicy.Get(&st.SV)) {
+			case EpochRegressionIgnore:
+				log.Warningf(context.Background(),
+					"ignoring locking request with epoch %d that came after lock(unreplicated) had "+
+						"already been acquired at epoch %d in txn %s",
+					acq.Txn.Epoch, tl.txn.Epoch, acq.Txn.ID)
+				return nil
+			case EpochRegressionApply:
+				log.Warningf(context.Background(),
+					"applying locking request with epoch %d that came after lock(unreplicated) had "+
+						"already been acquired at epoch %d in txn %s",
+					acq.Txn.Epoch, tl.txn.Epoch, acq.Txn.ID)
+				tl.unreplicatedInfo.epochRegressed()
+				epochRegressed = true
+			default:
+				// Reject the request; the logic here parallels how mvccPutInternal
+				// handles this case for intents.
+				return errors.Errorf(
+					"locking request with epoch %d came after lock(unreplicated) had already been acquired at epoch %d in txn %s",
+					acq.Txn.Epoch, tl.txn.Epoch, acq.Txn.ID,
+				)
+			}
 		default:
 			panic("unreachable")
 		}
@@ -1542,7 +2873,13 @@ func (tl *txnLock) reacquireLock(acq *roachpb.LockAcquisition) error {
 	switch acq.Durability {
 	case lock.Unreplicated:
 		tl.unreplicatedInfo.ts.Forward(acq.Txn.WriteTimestamp)
-		if err := tl.unreplicatedInfo.acquire(acq.Strength, acq.Txn.Sequence); err != nil {
+		seqNum := acq.Txn.Sequence
+		if epochRegressed {
+			// The acquisition's sequence number belongs to a prior epoch, so it must
+			// not be tracked alongside those of the lock's epoch.
+			seqNum = 0
+		}
+		if err := tl.unreplicatedInfo.acquire(acq.Strength, seqNum); err != nil {
 			return err
 		}
 	case lock.Replicated:
@@ -1560,7 +2897,9 @@ func (tl *txnLock) reacquireLock(acq *roachpb.LockAcquisition) error {
 		// NB: We can get here if the lock acquisition here corresponds to an
 		// operation from a prior epoch. We've already handled the case for
 		// unreplicated lock acquisition above, so this can only happen if the
-		// lock acquisition corresponds to a replicated lock.
+		// lock acquisition corresponds to a replicated lock (or if
+		// EpochRegressionApply let an unreplicated one through, in which case it
+		// was applied as if it had been made at the lock's epoch).
 		//
 		// If mvccPutInternal is aware of the newer epoch, it'll simply reject
 		// this operation and we'll never get here. However, it's not guaranteed
@@ -1570,7 +2909,8 @@ func (tl *txnLock) reacquireLock(acq *roachpb.LockAcquisition) error {
 		// So if we were to blindly update the TxnMeta here, we'd be regressing
 		// the epoch, which messes with our sequence number tracking inside of
 		// unreplicatedLockInfo.
-		assert(acq.Durability == lock.Replicated, "the unreplicated case should have been handled above")
+		assert(acq.Durability == lock.Replicated || epochRegressed,
+			"the unreplicated case should have been handled above")
 	case tl.txn.Epoch == acq.Txn.Epoch: // lock is being acquired at the same epoch
 		tl.txn = &acq.Txn
 	case tl.txn.Epoch < acq.Txn.Epoch: // lock is being acquired at a newer epoch
@@ -1856,7 +3196,7 @@ func (kl *keyLocks) safeFormat(sb *redact.StringBuilder, txnStatusCache *txnStat
 // it was filtered out due to being an empty lock or an uncontended lock (if
 // includeUncontended is false).
 func (kl *keyLocks) collectLockStateInfo(
-	includeUncontended bool, now time.Time,
+	includeUncontended bool, txnID uuid.UUID, now time.Time,
 ) (bool, roachpb.LockStateInfo) {
 	kl.mu.Lock()
 	defer kl.mu.Unlock()
@@ -1867,6 +3207,11 @@ func (kl *keyLocks) collectLockStateInfo(
 		return false, roachpb.LockStateInfo{}
 	}
 
+	// Filter out locks not held by the supplied transaction, if any.
+	if txnID != (uuid.UUID{}) && !kl.isLockedBy(txnID) {
+		return false, roachpb.LockStateInfo{}
+	}
+
 	// Filter out locks without waiting readers/locking requests unless explicitly
 	// requested.
 	//
@@ -1887,16 +3232,32 @@ func (kl *keyLocks) collectLockStateInfo(
 // REQUIRES: kl.mu is locked.
 func (kl *keyLocks) lockStateInfo(now time.Time) roachpb.LockStateInfo {
 	var txnHolder *enginepb.TxnMeta
+	var additionalHolders []roachpb.LockHolderInfo
 
 	durability := lock.Unreplicated
+	strength := lock.None
 	if kl.isLocked() {
-		// This doesn't work with multiple lock holders. See
-		// https://github.com/cockroachdb/cockroach/issues/109081.
+		// The first lock holder is reported as the lock holder, as it is the
+		// transaction that waiters push (see claimantTxn). Any other holders are
+		// reported separately.
 		tl := kl.holders.Front().Value
 		txnHolder = tl.txn
 		if tl.isHeldReplicated() {
 			durability = lock.Replicated
 		}
+		strength = tl.getLockMode().Strength
+		for e := kl.holders.Front().Next(); e != nil; e = e.Next() {
+			tl := e.Value
+			h := roachpb.LockHolderInfo{
+				Txn:        *tl.txn,
+				Durability: lock.Unreplicated,
+				Strength:   tl.getLockMode().Strength,
+			}
+			if tl.isHeldReplicated() {
+				h.Durability = lock.Replicated
+			}
+			additionalHolders = append(additionalHolders, h)
+		}
 	}
 
 	waiterCount := kl.waitingReaders.Len() + kl.queuedLockingRequests.Len()
@@ -1907,10 +3268,11 @@ func (kl *keyLocks) lockStateInfo(now time.Time) roachpb.LockStateInfo {
 		readerGuard := e.Value
 		readerGuard.mu.Lock()
 		lockWaiters = append(lockWaiters, lock.Waiter{
-			WaitingTxn:   readerGuard.txnMeta(),
-			ActiveWaiter: true, // readers always actively wait at a lock
-			Strength:     lock.None,
-			WaitDuration: now.Sub(readerGuard.mu.curLockWaitStart),
+			WaitingTxn:    readerGuard.txnMeta(),
+			ActiveWaiter:  true, // readers always actively wait at a lock
+			Strength:      lock.None,
+			WaitDuration:  now.Sub(readerGuard.mu.curLockWaitStart),
+			Distinguished: kl.distinguishedWaiter == readerGuard,
 		})
 		readerGuard.mu.Unlock()
 	}
@@ -1921,20 +3283,23 @@ func (kl *keyLocks) lockStateInfo(now time.Time) roachpb.LockStateInfo {
 		g := qg.guard
 		g.mu.Lock()
 		lockWaiters = append(lockWaiters, lock.Waiter{
-			WaitingTxn:   g.txnMeta(),
-			ActiveWaiter: qg.active,
-			Strength:     lock.Exclusive,
-			WaitDuration: now.Sub(g.mu.curLockWaitStart),
+			WaitingTxn:    g.txnMeta(),
+			ActiveWaiter:  qg.active,
+			Strength:      qg.mode.Strength,
+			WaitDuration:  now.Sub(g.mu.curLockWaitStart),
+			Distinguished: kl.distinguishedWaiter == g,
 		})
 		g.mu.Unlock()
 	}
 
 	return roachpb.LockStateInfo{
-		Key:          kl.key,
-		LockHolder:   txnHolder,
-		Durability:   durability,
-		HoldDuration: kl.lockHeldDuration(now),
-		Waiters:      lockWaiters,
+		Key:               kl.key,
+		LockHolder:        txnHolder,
+		Durability:        durability,
+		HoldDuration:      kl.lockHeldDuration(now),
+		Waiters:           lockWaiters,
+		Strength:          strength,
+		AdditionalHolders: additionalHolders,
 	}
 }
 
@@ -1945,6 +3310,38 @@ func (kl *keyLocks) addToMetrics(m *LockTableMetrics, now time.Time) {
 	if kl.isEmptyLock() {
 		return
 	}
+	lm := kl.lockMetrics(now)
+	m.addLockMetrics(lm)
+	for e := kl.holders.Front(); e != nil; e = e.Next() {
+		switch e.Value.getLockMode().Strength {
+		case lock.Shared:
+			m.SharedLocksHeld++
+		case lock.Exclusive:
+			m.ExclusiveLocksHeld++
+		case lock.Intent:
+			m.IntentsHeld++
+		}
+	}
+	for e := kl.queuedLockingRequests.Front(); e != nil; e = e.Next() {
+		if e.Value.guard.txn == nil {
+			m.NonTxnWaitingWriters++
+		}
+	}
+	if lm.WaitingReaders > 0 && lm.Held {
+		if kl.isIntentHeld() {
+			m.LocksWithReadersBlockedByIntent++
+		} else {
+			// Non-locking readers only block on intents and unreplicated
+			// exclusive locks.
+			m.LocksWithReadersBlockedByUnreplicatedLock++
+		}
+	}
+}
+
+// lockMetrics returns the LockMetrics of the lock.
+//
+// REQUIRES: kl.mu is locked.
+func (kl *keyLocks) lockMetrics(now time.Time) LockMetrics {
 	totalWaitDuration, maxWaitDuration := kl.totalAndMaxWaitDuration(now)
 	lm := LockMetrics{
 		Key:                  kl.key,
@@ -1955,19 +3352,47 @@ func (kl *keyLocks) addToMetrics(m *LockTableMetrics, now time.Time) {
 		WaitDurationNanos:    totalWaitDuration.Nanoseconds(),
 		MaxWaitDurationNanos: maxWaitDuration.Nanoseconds(),
 	}
+	for e := kl.queuedLockingRequests.Front(); e != nil; e = e.Next() {
+		if e.Value.active {
+			lm.WaitingWritersActive++
+		} else {
+			lm.WaitingWritersInactive++
+		}
+	}
 	lm.Waiters = lm.WaitingReaders + lm.WaitingWriters
-	m.addLockMetrics(lm)
+	return lm
+}
+
+// isIntentHeld returns whether any of the lock's holders holds it as an intent.
+//
+// REQUIRES: kl.mu is locked.
+func (kl *keyLocks) isIntentHeld() bool {
+	for e := kl.holders.Front(); e != nil; e = e.Next() {
+		tl := e.Value
+		if tl.isHeldReplicated() && tl.replicatedInfo.held(lock.Intent) {
+			return true
+		}
+	}
+	return false
 }
 
 // informActiveWaiters informs active waiters about the transaction that has
 // claimed the lock. The claimant transaction may have changed, so there may be
 // inconsistencies with waitSelf and waitForDistinguished states that need
-// changing.
+// changing. The supplied reason is the state transition that prompted the
+// call, and is recorded if the claimant changed.
 //
 // REQUIRES: kl.mu is locked.
-func (kl *keyLocks) informActiveWaiters() {
+func (kl *keyLocks) informActiveWaiters(reason ClaimantChangeReason) {
 	if kl.waitingReaders.Len() == 0 && kl.queuedLockingRequests.Len() == 0 {
-		return // no active waiters to speak of; early return
+		// No active waiters to speak of; early return. There is no one to record
+		// a claimant change for either, but the claimant is still tracked so that
+		// a later change is reported against the right transaction.
+		kl.claimant = uuid.UUID{}
+		if kl.isLocked() {
+			kl.claimant = kl.holders.Front().Value.txn.ID
+		}
+		return
 	}
 	waitForState := waitingState{
 		kind:                  waitFor,
@@ -1983,6 +3408,8 @@ func (kl *keyLocks) informActiveWaiters() {
 	// either sit tight (because its waiting for itself) or, worse yet, push a
 	// transaction it's actually compatible with!
 	waitForState.txn, waitForState.held = kl.claimantTxn()
+	waitForState.unacquiredClaim = kl.hasUnacquiredClaim()
+	kl.maybeRecordClaimantChange(waitForState.txn, waitForState.held, reason)
 	findDistinguished := false
 	// We need to find a (possibly new) distinguished waiter if either:
 	//   There isn't one for this lock.
@@ -1994,14 +3421,15 @@ func (kl *keyLocks) informActiveWaiters() {
 		// NB: Note that if the distinguishedWaiter belongs to the same transaction
 		// that waiters in the lock wait queue are waiting on, then the lock cannot
 		// be held by it. This is because if it were, this request would no longer
-		// be waiting in lock wait queues (via a call to releaseLockingRequestsFromTxn).
-		// This is asserted below.
+		// be waiting in lock wait queues (via a call to releaseLockingRequestsFromTxn),
+		// unless it's trying to promote the lock. This is asserted below.
 		kl.distinguishedWaiter.isSameTxn(waitForState.txn) {
 		// Ensure that if we're trying to find a new distinguished waiter because
 		// all waiters on the lock are waiting on the (old) distinguished waiter,
-		// the lock is not held.
+		// the lock is not held (or the distinguished waiter is promoting it).
 		assert(
-			kl.distinguishedWaiter == nil || !kl.isLocked(), fmt.Sprintf(
+			kl.distinguishedWaiter == nil || !kl.isLocked() ||
+				kl.isPromotingRequest(kl.distinguishedWaiter), fmt.Sprintf(
 				"distinguished waiter waiting from txn %s waiting on itself with un-held lock",
 				waitForState.txn,
 			))
@@ -2018,13 +3446,14 @@ func (kl *keyLocks) informActiveWaiters() {
 		// locking requests.
 		assert(state.held, "waiting readers should be empty if the lock isn't held")
 		g := e.Value
-		if findDistinguished {
+		if findDistinguished && g.lt.distinguishedWaitersEnabled() {
 			kl.distinguishedWaiter = g
 			findDistinguished = false
 		}
 		if kl.distinguishedWaiter == g {
 			state.kind = waitForDistinguished
 		}
+		state.lockHeldDuration = kl.claimantLockHeldDuration(g.lt.clock.PhysicalTime())
 		g.mu.Lock()
 		// NB: The waiter is actively waiting on this lock, so it's likely taking
 		// some action based on the previous state (e.g. it may be pushing someone).
@@ -2041,12 +3470,16 @@ func (kl *keyLocks) informActiveWaiters() {
 		g := qg.guard
 		state := waitForState
 		if g.isSameTxn(waitForState.txn) {
-			if waitForState.held {
-				panic("request from the lock holder txn should not be waiting in a wait queue")
+			// A request from the lock holder txn can only be waiting in the wait
+			// queue if it's trying to promote its transaction's lock; it pushes one
+			// of the other lock holders.
+			if blocker := kl.promotionBlockerTxn(g); waitForState.held && blocker != nil {
+				state.txn = blocker
+			} else {
+				state.kind = waitSelf
 			}
-			state.kind = waitSelf
 		} else {
-			if findDistinguished {
+			if findDistinguished && g.lt.distinguishedWaitersEnabled() {
 				kl.distinguishedWaiter = g
 				findDistinguished = false
 			}
@@ -2054,6 +3487,7 @@ func (kl *keyLocks) informActiveWaiters() {
 				state.kind = waitForDistinguished
 			}
 		}
+		state.lockHeldDuration = kl.claimantLockHeldDuration(g.lt.clock.PhysicalTime())
 		g.mu.Lock()
 		// NB: The waiter is actively waiting on this lock, so it's likely taking
 		// some action based on the previous state (e.g. it may be pushing someone).
@@ -2064,6 +3498,46 @@ func (kl *keyLocks) informActiveWaiters() {
 	}
 }
 
+// maybeRecordClaimantChange tracks the supplied transaction as the claimant of
+// the key and, if it differs from the previous claimant, records a claimant
+// change event with the lockTable if ClaimantChangeEventBufferSize is set.
+//
+// REQUIRES: kl.mu is locked.
+// REQUIRES: there are requests waiting on the key.
+func (kl *keyLocks) maybeRecordClaimantChange(
+	claimant *enginepb.TxnMeta, held bool, reason ClaimantChangeReason,
+) {
+	var id uuid.UUID
+	if claimant != nil {
+		id = claimant.ID
+	}
+	old := kl.claimant
+	kl.claimant = id
+	if old == id {
+		return
+	}
+	// keyLocks do not reference their lockTable, so reach it through one of the
+	// waiters.
+	var lt *lockTableImpl
+	if kl.waitingReaders.Len() > 0 {
+		lt = kl.waitingReaders.Front().Value.lt
+	} else {
+		lt = kl.queuedLockingRequests.Front().Value.guard.lt
+	}
+	size := ClaimantChangeEventBufferSize.Get(&lt.settings.SV)
+	if size == 0 {
+		return
+	}
+	lt.claimantChanges.record(ClaimantChangeEvent{
+		Time:        lt.clock.PhysicalTime(),
+		Key:         kl.key,
+		OldClaimant: old,
+		NewClaimant: id,
+		Held:        held,
+		Reason:      reason,
+	}, int(size))
+}
+
 // claimantTxn returns the transaction that the lock table deems as having
 // claimed the key. Every lock stored in the lock table must have one and only
 // one transaction associated with it that claims the key. All actively waiting
@@ -2099,23 +3573,123 @@ func (kl *keyLocks) claimantTxn() (_ *enginepb.TxnMeta, held bool) {
 		panic("no queued locking request or lock holder; no one should be waiting on the lock")
 	}
 	qg := kl.queuedLockingRequests.Front().Value
-	return qg.guard.txnMeta(), false
+	return qg.guard.claimTxnMeta(), false
+}
+
+// hasUnacquiredClaim returns whether the key's claimant is a request that has
+// claimed the key, by virtue of being an inactive waiter at the head of the
+// wait-queue, but has yet to acquire a lock on it.
+//
+// REQUIRES: kl.mu to be locked.
+func (kl *keyLocks) hasUnacquiredClaim() bool {
+	if kl.isLocked() || kl.queuedLockingRequests.Len() == 0 {
+		return false
+	}
+	return !kl.queuedLockingRequests.Front().Value.active
 }
 
 // releaseLockingRequestsFromTxn removes all locking requests waiting on the
 // key, referenced in the receiver, that are part of the specified transaction.
 //
+// If SameTxnScanDonation is enabled, the requests that were actively waiting
+// are handed the lock spans of an inactive request from the transaction that
+// is done scanning, if there is one, before being released.
+//
 // REQUIRES: kl.mu is locked.
 func (kl *keyLocks) releaseLockingRequestsFromTxn(txn *enginepb.TxnMeta) {
+	// The donor is itself released below, so its spans must be found before any
+	// requests are removed from the queue.
+	var donated *lockspanset.LockSpanSet
+	for e := kl.queuedLockingRequests.Front(); e != nil; e = e.Next() {
+		qg := e.Value
+		if qg.active && qg.guard.isSameTxn(txn) && qg.guard.lt.sameTxnScanDonation() {
+			donated = kl.findScanDonorSpans(txn)
+			break
+		}
+	}
 	for e := kl.queuedLockingRequests.Front(); e != nil; {
 		qg := e.Value
 		curr := e
 		e = e.Next()
 		g := qg.guard
-		if g.isSameTxn(txn) {
-			kl.removeLockingRequest(curr)
+		if !g.isSameTxn(txn) {
+			continue
+		}
+		if qg.active && donated != nil {
+			g.mu.Lock()
+			g.mu.donatedSpans = donated
+			g.mu.Unlock()
+		}
+		kl.removeLockingRequest(curr)
+	}
+}
+
+// findScanDonorSpans returns the lock spans of an inactive request
+// from the specified transaction, queued at the key referenced in the
+// receiver, that is neither scanning the lock table nor waiting in it. Such a
+// request holds a claim on the key and has proceeded to evaluation, having
+// found no conflicting locks in its spans. Returns nil if there is no such
+// request.
+//
+// The spans are not copied. The donor is marked as having donated them, which
+// keeps them from being released for reuse when it finishes, so they can be
+// shared read-only with the requests they are donated to.
+//
+// REQUIRES: kl.mu is locked.
+func (kl *keyLocks) findScanDonorSpans(txn *enginepb.TxnMeta) *lockspanset.LockSpanSet {
+	for e := kl.queuedLockingRequests.Front(); e != nil; e = e.Next() {
+		qg := e.Value
+		g := qg.guard
+		if qg.active || !g.isSameTxn(txn) || g.scanning.Load() {
+			continue
+		}
+		g.mu.Lock()
+		waiting := g.mu.startWait
+		g.mu.Unlock()
+		if !waiting {
+			g.spansDonated.Store(true)
+			return g.spans
+		}
+	}
+	return nil
+}
+
+// isDonatedKey returns whether the supplied key is covered by the donated
+// spans at a lock strength at least as strong as the one the request is
+// currently scanning with.
+func (g *lockTableGuardImpl) isDonatedKey(donated *lockspanset.LockSpanSet, key roachpb.Key) bool {
+	for str := g.curStrength(); str <= lock.MaxStrength; str++ {
+		for _, sp := range donated.GetSpans(str) {
+			if sp.Overlaps(roachpb.Span{Key: key}) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// longestQueuedDurationForTxn returns the longest duration that any request
+// from the supplied transaction has spent in the receiver's
+// queuedLockingRequests wait queue, as of now. The boolean return value is
+// false if no request from the transaction is in the wait queue.
+//
+// REQUIRES: kl.mu is locked.
+func (kl *keyLocks) longestQueuedDurationForTxn(
+	txn *enginepb.TxnMeta, now time.Time,
+) (time.Duration, bool) {
+	var longest time.Duration
+	found := false
+	for e := kl.queuedLockingRequests.Front(); e != nil; e = e.Next() {
+		qg := e.Value
+		if !qg.guard.isSameTxn(txn) {
+			continue
 		}
+		if d := now.Sub(qg.enqueueTime); !found || d > longest {
+			longest = d
+		}
+		found = true
 	}
+	return longest, found
 }
 
 // When the active waiters have shrunk and the distinguished waiter has gone,
@@ -2145,7 +3719,7 @@ func (kl *keyLocks) tryMakeNewDistinguished() {
 			}
 		}
 	}
-	if g != nil {
+	if g != nil && g.lt.distinguishedWaitersEnabled() {
 		kl.distinguishedWaiter = g
 		g.mu.Lock()
 		assert(
@@ -2234,6 +3808,18 @@ func (kl *keyLocks) lockHeldDuration(now time.Time) time.Duration {
 	return now.Sub(minStartTS)
 }
 
+// claimantLockHeldDuration returns the duration of time the lock has been
+// tracked as held in the lock table by the claimant transaction (see
+// claimantTxn). Zero is returned if the lock isn't held.
+//
+// REQUIRES: kl.mu is locked.
+func (kl *keyLocks) claimantLockHeldDuration(now time.Time) time.Duration {
+	if !kl.isLocked() {
+		return time.Duration(0)
+	}
+	return now.Sub(kl.holders.Front().Value.startTime)
+}
+
 // Returns the total amount of time all active waiters in the queues of
 // readers and locking requests have been waiting on the key referenced in the
 // receiver.
@@ -2280,6 +3866,13 @@ func (kl *keyLocks) isLockedBy(id uuid.UUID) bool {
 	return false
 }
 
+// isLockedByTxn is like isLockedBy, but acquires kl.mu.
+func (kl *keyLocks) isLockedByTxn(id uuid.UUID) bool {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	return kl.isLockedBy(id)
+}
+
 // isLocked returns true if key is locked. If locked, the key be locked by one
 // or more transactions. Each transaction's locks may be held durably,
 // non-durably, or both.
@@ -2289,6 +3882,50 @@ func (kl *keyLocks) isLocked() bool {
 	return kl.holders.Len() != 0
 }
 
+// lockHolders returns the locks held on the receiver's key, in the order in
+// which they're tracked.
+func (kl *keyLocks) lockHolders() []*txnLock {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if !kl.isLocked() {
+		return nil
+	}
+	holders := make([]*txnLock, 0, kl.holders.Len())
+	for e := kl.holders.Front(); e != nil; e = e.Next() {
+		holders = append(holders, e.Value)
+	}
+	return holders
+}
+
+// mergeTransferredHolders merges the lock holders transferred from another
+// lockTable into the receiver, which already tracks the key. A transaction
+// that holds the lock in both keeps the receiver's lock, as its state reflects
+// the updates made since the receiver started tracking it. The key's
+// wait-queues are left in place, so its claimant and distinguished waiter are
+// preserved. As with a discovered lock, requests from the transactions of the
+// merged holders stop waiting, and the active waiters are told about the
+// key's new holders, so that they push the right transaction.
+//
+// Acquires kl.mu.
+func (kl *keyLocks) mergeTransferredHolders(transferred []*txnLock) {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	merged := false
+	for _, tl := range transferred {
+		if kl.isLockedBy(tl.txn.ID) {
+			continue
+		}
+		kl.lockAcquiredOrDiscovered(tl)
+		// If there are waiting requests from the same txn, they no longer need
+		// to wait.
+		kl.releaseLockingRequestsFromTxn(tl.txn)
+		merged = true
+	}
+	if merged {
+		kl.informActiveWaiters(ClaimantChangeLockDiscovered)
+	}
+}
+
 // clearLockHeldBy removes the lock, if held, by the transaction referenced by
 // the supplied ID. It is a no-op if the lock isn't held by the transaction.
 //
@@ -2300,9 +3937,21 @@ func (kl *keyLocks) clearLockHeldBy(ID uuid.UUID) {
 	}
 	kl.holders.Remove(e)
 	delete(kl.heldBy, ID)
+	kl.adjustEstimatedBytes(-holderEstimatedBytes(e.Value))
+	if kl.heldLocks != nil {
+		kl.heldLocks.dec(ID, kl)
+	}
 }
 
 func (kl *keyLocks) clearAllLockHolders() {
+	var holderBytes int64
+	for e := kl.holders.Front(); e != nil; e = e.Next() {
+		holderBytes += holderEstimatedBytes(e.Value)
+		if kl.heldLocks != nil {
+			kl.heldLocks.dec(e.Value.txn.ID, kl)
+		}
+	}
+	kl.adjustEstimatedBytes(-holderBytes)
 	kl.holders.Init()
 	kl.heldBy = nil
 }
@@ -2316,6 +3965,10 @@ func (kl *keyLocks) lockAcquiredOrDiscovered(tl *txnLock) {
 	_, found := kl.heldBy[tl.txn.ID]
 	assert(!found, "lock was already being tracked for this key")
 	kl.heldBy[tl.txn.ID] = kl.holders.PushBack(tl)
+	kl.adjustEstimatedBytes(holderEstimatedBytes(tl))
+	if kl.heldLocks != nil {
+		kl.heldLocks.inc(tl.txn.ID, kl)
+	}
 }
 
 // scanAndMaybeEnqueue scans all locks held on the receiver's key and performs
@@ -2355,6 +4008,7 @@ func (kl *keyLocks) scanAndMaybeEnqueue(g *lockTableGuardImpl, notify bool) (wai
 		return false, err
 	}
 	if isAllowedToProceed {
+		g.lt.counters.heldLockFastPathHits.Add(1)
 		return false /* wait */, nil
 	}
 
@@ -2370,10 +4024,22 @@ func (kl *keyLocks) scanAndMaybeEnqueue(g *lockTableGuardImpl, notify bool) (wai
 
 	// We're purely dealing with locking requests from here on out.
 
-	maxQueueLengthExceeded, err := kl.enqueueLockingRequest(g)
-	if err != nil {
-		return false, err
+	if ok, retryAfter := kl.maybeTakeAcquisitionToken(g); !ok {
+		// NB: Like requests that exceed the maximum wait-queue length, throttled
+		// requests don't enter the wait-queue. The lock table waiter backs off
+		// based on the waiting state we'll construct here, and then the request
+		// scans again.
+		ws := waitingState{
+			kind:          waitThrottled,
+			key:           kl.key,
+			guardStrength: g.curStrength(),
+			retryAfter:    retryAfter,
+		}
+		g.startWaitingWithWaitingState(ws, notify)
+		return true /* wait */, nil
 	}
+
+	maxQueueLengthExceeded := kl.enqueueLockingRequest(g)
 	if maxQueueLengthExceeded {
 		// NB: Requests that encounter a lock wait-queue that is longer than
 		// what they're willing to wait for are rejected by the lock table
@@ -2389,9 +4055,9 @@ func (kl *keyLocks) scanAndMaybeEnqueue(g *lockTableGuardImpl, notify bool) (wai
 	if kl.shouldRequestActivelyWait(g) {
 		ws := kl.constructWaitingState(g)
 		g.startWaitingWithWaitingState(ws, notify)
-		// TODO(arul): In the future, when we extend the lock table to consider
-		// UPDATE locks as well, we'll need to add a call to informActiveWaiters
-		// here. Consider the following construction:
+		// With UPDATE locks in the mix, the request may change what the requests
+		// queued behind it should be waiting on. Consider the following
+		// construction:
 		//
 		// keyA: [SHARED, UPDATE]
 		// waitQueue: [{r1: UPDATE(seq=10)}]
@@ -2399,21 +4065,43 @@ func (kl *keyLocks) scanAndMaybeEnqueue(g *lockTableGuardImpl, notify bool) (wai
 		//
 		// Previously, the r1 was waiting on the UPDATE lock that is held. However,
 		// once r2 slots in front of it, r2 is waiting on the SHARED lock. To
-		// prevent cases where different waiters are pushing different transactions,
-		// we'll need to notify r1 to push the SHARED lock instead. To do so, we
-		// need to call informActiveWaiters. Note that informActiveWaiters elides
-		// updates if they're not meaningful, so we can get away with being less
-		// precise in handling the more general case at this level.
+		// prevent cases where different waiters are pushing different
+		// transactions, we notify r1 to push the SHARED lock instead. Note that
+		// informActiveWaiters elides updates if they're not meaningful, so we can
+		// get away with being less precise in handling the more general case at
+		// this level. Without UPDATE locks, a request that waits can't change
+		// what the other waiters are waiting on, so we skip the call.
+		if kl.involvesUpdateStrength() {
+			kl.informActiveWaiters(ClaimantChangeRequestQueued)
+		}
 		return true /* wait */, nil
 	}
 
 	kl.claimBeforeProceeding(g)
 	// Inform any active waiters that (may) need to be made aware that this
 	// request acquired a claim.
-	kl.informActiveWaiters()
+	kl.informActiveWaiters(ClaimantChangeClaimed)
 	return false /* wait */, nil
 }
 
+// involvesUpdateStrength returns whether the key is locked with, or has
+// locking requests queued with, lock strength Update.
+//
+// REQUIRES: kl.mu to be locked.
+func (kl *keyLocks) involvesUpdateStrength() bool {
+	for e := kl.holders.Front(); e != nil; e = e.Next() {
+		if e.Value.unreplicatedInfo.held(lock.Update) {
+			return true
+		}
+	}
+	for e := kl.queuedLockingRequests.Front(); e != nil; e = e.Next() {
+		if e.Value.mode.Strength == lock.Update {
+			return true
+		}
+	}
+	return false
+}
+
 // constructWaitingState constructs the waiting state the supplied request
 // should use to wait in the receiver's lock wait-queues.
 //
@@ -2427,8 +4115,18 @@ func (kl *keyLocks) constructWaitingState(g *lockTableGuardImpl) waitingState {
 		held:                  true,
 	}
 	txn, held := kl.claimantTxn()
+	if held && g.isSameTxn(txn) {
+		// The request is trying to promote the lock held by its transaction, so
+		// it's waiting on the other lock holders. Push one of them instead of
+		// waiting on itself.
+		if blocker := kl.promotionBlockerTxn(g); blocker != nil {
+			txn = blocker
+		}
+	}
 	waitForState.held = held
+	waitForState.unacquiredClaim = kl.hasUnacquiredClaim()
 	waitForState.txn = txn
+	waitForState.lockHeldDuration = kl.claimantLockHeldDuration(g.lt.clock.PhysicalTime())
 	if g.isSameTxn(waitForState.txn) {
 		waitForState.kind = waitSelf
 	} else if kl.distinguishedWaiter == g {
@@ -2440,7 +4138,10 @@ func (kl *keyLocks) constructWaitingState(g *lockTableGuardImpl) waitingState {
 // alreadyHoldsLockAndIsAllowedToProceed returns true if the request, referenced
 // by the supplied lock table guard, is allowed to proceed because its
 // transaction already holds the lock with an equal or higher lock strength
-// compared to the one supplied. Otherwise, false is returned.
+// compared to the one supplied. A request trying to promote a Shared lock held
+// by its transaction is also allowed to proceed, as long as no other
+// transaction holds a lock on the key. Otherwise, false is returned. An error
+// is returned if the promotion deadlocks with that of another lock holder.
 //
 // REQUIRES: kl.mu to be locked.
 func (kl *keyLocks) alreadyHoldsLockAndIsAllowedToProceed(
@@ -2458,49 +4159,113 @@ func (kl *keyLocks) alreadyHoldsLockAndIsAllowedToProceed(
 	}
 	tl := e.Value
 	heldMode := tl.getLockMode()
-	err := kl.maybeDisallowLockPromotion(heldMode.Strength, str)
-	if err != nil {
-		return false, err
+	if isLockPromotion(heldMode.Strength, str) {
+		// The request is trying to promote a Shared lock held by its transaction.
+		// If another lock holder is waiting to promote its lock as well, neither
+		// promotion can ever succeed.
+		if err := kl.detectLockPromotionDeadlock(g, str); err != nil {
+			return false, err
+		}
+		// If no other transaction holds a lock on the key, the request is free to
+		// promote the lock. It jumps ahead of any waiters in doing so, as they're
+		// all waiting on its transaction's lock anyway. Otherwise, it must wait
+		// for the other (Shared) lock holders to release their locks; it'll be
+		// queued ahead of any requests from transactions that don't hold locks on
+		// the key.
+		return kl.holders.Len() == 1, nil
 	}
 	// Check if the lock is already held by the guard's transaction with an equal
-	// or higher lock strength. If it is, we're good to go. Otherwise, the request
-	// is trying to promote a lock it previously acquired. In such cases, the
-	// existence of a lock with weaker strength doesn't do much for this request.
-	// It's no different from the case where it's trying to acquire a fresh lock.
+	// or higher lock strength. If it is, we're good to go. Requests that are
+	// writing to keys that they hold exclusive locks on are also allowed to
+	// "jump ahead" of any potential waiters, as doing so prevents deadlocks.
 	return str <= heldMode.Strength ||
-		// TODO(arul): We want to allow requests that are writing to keys that they
-		// hold exclusive locks on to "jump ahead" of any potential waiters. This
-		// prevents deadlocks. The logic here is a band-aid until we implement a
-		// solution for the general case of arbitrary lock upgrades (e.g. shared ->
-		// exclusive, etc.). We'll do so by prioritizing requests from transaction's
-		// that hold locks over transactions that don't when storing them in the
-		// list of queuedLockingRequests. Instead of sorting the list of
-		// queuedLockingRequests just based on sequence numbers alone, we'll instead
-		// use (belongsToALockHolderTxn, sequence number) to construct the sort
-		// order.
 		(str == lock.Intent && heldMode.Strength == lock.Exclusive), nil
 }
 
-// maybeDisallowLockPromotion checks if a lock is being promoted from
-// lock.Shared to lock.Intent/lock.Exclusive, and returns an error if that's the
-// case. See: https://github.com/cockroachdb/cockroach/issues/110435.
+// isLockPromotion returns true if a lock held with the supplied strength is
+// being promoted from lock.Shared to lock.Intent/lock.Exclusive when re-acquired
+// with the supplied strength.
+func isLockPromotion(held lock.Strength, reAcquisitionStr lock.Strength) bool {
+	return held == lock.Shared && reAcquisitionStr > held
+}
+
+// detectLockPromotionDeadlock returns an error if the supplied request, which
+// is trying to promote the Shared lock held by its transaction to the supplied
+// strength, deadlocks with a request from another lock holder that is waiting
+// to promote its own Shared lock. Each promotion waits for the other
+// transaction's lock to be released, which will never happen.
 //
 // REQUIRES: kl.mu to be locked.
-//
-// TODO(arul): Once we handle lock promotion correctly, and this function goes
-// away, a lot of the error paths where this error is bubbled up to can go away.
-func (kl *keyLocks) maybeDisallowLockPromotion(
-	held lock.Strength, reAcquisitionStr lock.Strength,
+func (kl *keyLocks) detectLockPromotionDeadlock(
+	g *lockTableGuardImpl, reAcquisitionStr lock.Strength,
 ) error {
-	if held == lock.Shared && reAcquisitionStr > held {
-		return MarkLockPromotionError(errors.UnimplementedErrorf(
-			errors.IssueLink{IssueURL: "https://github.com/cockroachdb/cockroach/issues/110435"},
-			"lock promotion from %s to %s is not allowed", held, reAcquisitionStr,
-		))
-	}
+	for e := kl.queuedLockingRequests.Front(); e != nil; e = e.Next() {
+		qqg := e.Value
+		if qqg.guard.txn == nil || qqg.guard.isSameTxn(g.txnMeta()) {
+			continue
+		}
+		if kl.isPromotingRequest(qqg.guard) {
+			return MarkLockPromotionError(errors.Newf(
+				"lock promotion from %s to %s deadlocks with a promotion to %s by txn %s",
+				lock.Shared, reAcquisitionStr, qqg.mode.Strength, qqg.guard.txn.Short(),
+			))
+		}
+	}
+	return nil
+}
+
+// isPromotingRequest returns true if the supplied request belongs to a
+// transaction that holds a lock on the receiver's key. Such requests can only
+// be waiting in the receiver's wait queue if they're trying to promote their
+// transaction's lock.
+//
+// REQUIRES: kl.mu to be locked.
+func (kl *keyLocks) isPromotingRequest(g *lockTableGuardImpl) bool {
+	return g.txn != nil && kl.isLockedBy(g.txn.ID)
+}
+
+// promotionBlockerTxn returns the transaction that the supplied request, which
+// is trying to promote the lock held by its own transaction, should push. This
+// is the first lock holder that belongs to a different transaction. Nil is
+// returned if the request's transaction is the only lock holder.
+//
+// REQUIRES: kl.mu to be locked.
+func (kl *keyLocks) promotionBlockerTxn(g *lockTableGuardImpl) *enginepb.TxnMeta {
+	for e := kl.holders.Front(); e != nil; e = e.Next() {
+		if txn := e.Value.getLockHolderTxn(); !g.isSameTxn(txn) {
+			return txn
+		}
+	}
 	return nil
 }
 
+// maybeReleasePromotingRequests releases any requests waiting to promote the
+// lock held by their transaction once that transaction is the only lock holder
+// left on the receiver's key. The released requests resume their scan, at which
+// point they're free to promote the lock.
+//
+// REQUIRES: kl.mu to be locked.
+func (kl *keyLocks) maybeReleasePromotingRequests() {
+	if kl.holders.Len() != 1 {
+		return
+	}
+	txn := kl.holders.Front().Value.getLockHolderTxn()
+	released := false
+	for e := kl.queuedLockingRequests.Front(); e != nil; {
+		curr := e
+		e = e.Next()
+		if curr.Value.guard.isSameTxn(txn) {
+			kl.removeLockingRequest(curr)
+			released = true
+		}
+	}
+	if released {
+		// The remaining lock holder is the claimant now, which the active waiters
+		// may not know about yet.
+		kl.informActiveWaiters(ClaimantChangeLockReleased)
+	}
+}
+
 // conflictsWithLockHolders returns true if the request, referenced by the
 // supplied lockTableGuardImpl, conflicts with any of the locks held on this
 // key. Non-conflicting requests are allowed to proceed; conflicting requests
@@ -2512,7 +4277,7 @@ func (kl *keyLocks) maybeDisallowLockPromotion(
 //
 // REQUIRES: kl.mu is locked.
 // REQUIRES: the transaction, to which the request belongs, should not be a lock
-// holder.
+// holder, unless the request is trying to promote its transaction's lock.
 func (kl *keyLocks) conflictsWithLockHolders(g *lockTableGuardImpl) bool {
 	if !kl.isLocked() {
 		return false // the lock isn't held; no conflict to speak of
@@ -2556,6 +4321,22 @@ func (kl *keyLocks) conflictsWithLockHolders(g *lockTableGuardImpl) bool {
 			!g.isSameTxn(lockHolderTxn) || g.curStrength() > tl.getLockMode().Strength,
 			"lock already held by the request's transaction with sufficient strength",
 		)
+		if g.isSameTxn(lockHolderTxn) {
+			// The request is trying to promote its transaction's lock. The lock
+			// doesn't conflict with the request; the other lock holders may.
+			continue
+		}
+
+		if g.ignoresLock(kl.key, lockHolderTxn) {
+			// The request has been told to ignore locks held by this transaction.
+			// Much like a lock held by a finalized transaction, there's no conflict;
+			// unlike one, the lock must not be resolved, as its holder is live.
+			//
+			// If the lock is replicated and blocks the request's read, evaluation
+			// still runs into it and hands it back to the lock table, after which
+			// the request no longer ignores it; see surfacedLockKeys.
+			continue // check next lock
+		}
 
 		finalizedTxn, ok := g.lt.txnStatusCache.finalizedTxns.get(lockHolderTxn.ID)
 		if ok {
@@ -2602,6 +4383,12 @@ func (kl *keyLocks) conflictsWithLockHolders(g *lockTableGuardImpl) bool {
 					} else {
 						// Resolve to push the replicated intent.
 						g.toResolve = append(g.toResolve, up)
+						if g.lt.resolvePushedLocksInline() {
+							g.lt.counters.pushedLocksResolvedInline.Add(1)
+							g.mustResolveBeforeProceeding = true
+						} else {
+							g.lt.counters.pushedLocksResolvedDeferred.Add(1)
+						}
 					}
 					continue // check next lock
 				}
@@ -2618,6 +4405,31 @@ func (kl *keyLocks) conflictsWithLockHolders(g *lockTableGuardImpl) bool {
 	return false
 }
 
+// conflictsOnlyWithHolder returns whether the receiver is locked only by the
+// supplied transaction, and the request, referenced by the supplied
+// lockTableGuardImpl, conflicts with its lock. Unlike conflictsWithLockHolders,
+// it has no side effects; locks that the request doesn't need to wait on, e.g.
+// because they belong to a finalized transaction, are not considered
+// conflicting.
+//
+// REQUIRES: kl.mu to be unlocked.
+func (kl *keyLocks) conflictsOnlyWithHolder(g *lockTableGuardImpl, txnID uuid.UUID) bool {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if !kl.isLocked() || kl.holders.Len() != 1 {
+		return false
+	}
+	tl := kl.holders.Front().Value
+	lockHolderTxn := tl.getLockHolderTxn()
+	if lockHolderTxn.ID != txnID {
+		return false
+	}
+	if g.ignoresLock(kl.key, lockHolderTxn) {
+		return false
+	}
+	return lock.Conflicts(tl.getLockMode(), g.curLockMode(), &g.lt.settings.SV)
+}
+
 // maybeEnqueueNonLockingReadRequest enqueues a read request in the receiver's
 // wait queue if the reader conflicts with the lock; otherwise, it's a no-op.
 // A boolean is returned indicating whether the read request conflicted with
@@ -2630,6 +4442,7 @@ func (kl *keyLocks) maybeEnqueueNonLockingReadRequest(g *lockTableGuardImpl) (co
 		return false // no conflict, no need to enqueue
 	}
 	kl.waitingReaders.PushFront(g)
+	kl.adjustEstimatedBytes(queuedRequestEstimatedBytes)
 	// This request may be a candidate to become a distinguished waiter if one
 	// doesn't exist yet; try making it such.
 	kl.maybeMakeDistinguishedWaiter(g)
@@ -2651,9 +4464,7 @@ func (kl *keyLocks) maybeEnqueueNonLockingReadRequest(g *lockTableGuardImpl) (co
 // this case is returned to the caller.
 //
 // REQUIRES: kl.mu to be locked.
-func (kl *keyLocks) enqueueLockingRequest(
-	g *lockTableGuardImpl,
-) (maxQueueLengthExceeded bool, _ error) {
+func (kl *keyLocks) enqueueLockingRequest(g *lockTableGuardImpl) (maxQueueLengthExceeded bool) {
 	assert(g.curStrength() != lock.None, "should only be called with a locking request")
 	g.mu.Lock()
 	defer g.mu.Unlock()
@@ -2671,7 +4482,7 @@ func (kl *keyLocks) enqueueLockingRequest(
 				// it may be a candidate for becoming the distinguished waiter (if one
 				// doesn't exist already).
 				kl.maybeMakeDistinguishedWaiter(g)
-				return false /* maxQueueLengthExceeded */, nil
+				return false /* maxQueueLengthExceeded */
 			}
 		}
 		panic("lock table bug")
@@ -2685,29 +4496,33 @@ func (kl *keyLocks) enqueueLockingRequest(
 		// queue and rejecting the tail of the queue above the max length. That
 		// would be more fair, but more complicated, and we expect that the
 		// common case is that this waiter will be at the end of the queue.
-		return true /* maxQueueLengthExceeded */, nil
+		return true /* maxQueueLengthExceeded */
 	}
 	qg := &queuedGuard{
-		guard:  g,
-		mode:   g.curLockMode(),
-		active: true,
+		guard:       g,
+		mode:        g.curLockMode(),
+		active:      true,
+		enqueueTime: g.lt.clock.PhysicalTime(),
 	}
 	// The request isn't in the queue. Add it in the correct position, based on
-	// its sequence number.
+	// its sequence number (and its priority, if PriorityOrderedWaitQueues is
+	// set). Requests trying to promote a lock held by their transaction are
+	// ordered ahead of requests from transactions that don't hold locks on the
+	// key; otherwise, the promotion could deadlock with requests waiting on the
+	// promoting transaction's lock.
+	byPriority := g.lt.priorityOrderedWaitQueues()
+	promoting := kl.isPromotingRequest(g)
 	var e *list.Element[*queuedGuard]
 	for e = kl.queuedLockingRequests.Front(); e != nil; e = e.Next() {
 		qqg := e.Value
-		if qqg.guard.seqNum > qg.guard.seqNum {
-			break
-		}
-		if qg.guard.txn != nil && qqg.guard.isSameTxn(qg.guard.txnMeta()) {
-			// There's another request, from our transaction, that's waiting to acquire
-			// a lock on this key before us. As per its sequence number, it'll get a
-			// chance to do so before we do -- assuming it'll succeed, check if we've
-			// got ourselves into a lock promotion case that's not allowed.
-			if err := kl.maybeDisallowLockPromotion(qqg.mode.Strength, qg.mode.Strength); err != nil {
-				return false, err
+		if qqgPromoting := kl.isPromotingRequest(qqg.guard); qqgPromoting != promoting {
+			if promoting {
+				break
 			}
+			continue
+		}
+		if g.queuedAheadOf(qqg.guard, byPriority) {
+			break
 		}
 	}
 	if e == nil {
@@ -2715,11 +4530,65 @@ func (kl *keyLocks) enqueueLockingRequest(
 	} else {
 		kl.queuedLockingRequests.InsertBefore(qg, e)
 	}
+	kl.adjustEstimatedBytes(queuedRequestEstimatedBytes)
 	// This request may be a candidate to become a distinguished waiter if one
 	// doesn't exist yet; try making it such.
 	kl.maybeMakeDistinguishedWaiter(g)
 	g.maybeAddToLocksMap(kl, g.curStrength())
-	return false /* maxQueueLengthExceeded */, nil
+	return false /* maxQueueLengthExceeded */
+}
+
+// enqueueInactiveLockingRequest enqueues the supplied transactional locking
+// request as an inactive waiter in the receiver's lock wait queue, on behalf of
+// a request that is eagerly queueing while it waits elsewhere. It is a no-op
+// if the lock isn't held, if the request is already in the wait queue, or if
+// its transaction already holds the lock. Any reason to reject the request (e.g. the wait queue being too
+// long, or PerKeyLockAcquisitionRateLimit being exceeded) is ignored; it is
+// detected when the request's scan reaches the receiver.
+//
+// REQUIRES: kl.mu to be unlocked.
+func (kl *keyLocks) enqueueInactiveLockingRequest(g *lockTableGuardImpl) {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if !kl.isLocked() {
+		// Entering the wait-queue of an unheld lock ahead of its claimant would
+		// make the request the lock's claimant, so the requests actively waiting
+		// on the lock would push the request's transaction before the request
+		// has even reached the lock. The request enters the wait-queue once its
+		// scan reaches the lock instead.
+		return
+	}
+	g.mu.Lock()
+	_, inQueue := g.mu.locks[kl]
+	g.mu.Unlock()
+	if inQueue {
+		return
+	}
+	if isAllowedToProceed, err := kl.alreadyHoldsLockAndIsAllowedToProceed(
+		g, g.curStrength(),
+	); err != nil || isAllowedToProceed {
+		return
+	}
+	if ok, _ := kl.maybeTakeAcquisitionToken(g); !ok {
+		return
+	}
+	if maxQueueLengthExceeded := kl.enqueueLockingRequest(g); maxQueueLengthExceeded {
+		return
+	}
+	for e := kl.queuedLockingRequests.Front(); e != nil; e = e.Next() {
+		if qqg := e.Value; qqg.guard == g {
+			qqg.active = false
+			break
+		}
+	}
+	// Inactive waiters cannot be distinguished waiters. The request only became
+	// the distinguished waiter if there was none before it was enqueued.
+	if kl.distinguishedWaiter == g {
+		kl.distinguishedWaiter = nil
+	}
+	// Let the active waiters know, so that a new distinguished waiter is picked
+	// if the request was briefly made one above.
+	kl.informActiveWaiters(ClaimantChangeRequestQueued)
 }
 
 // maybeMakeDistinguishedWaiter designates the supplied request as the
@@ -2732,7 +4601,7 @@ func (kl *keyLocks) enqueueLockingRequest(
 //
 // REQUIRES: kl.mu to be locked.
 func (kl *keyLocks) maybeMakeDistinguishedWaiter(g *lockTableGuardImpl) {
-	if kl.distinguishedWaiter != nil {
+	if kl.distinguishedWaiter != nil || !g.lt.distinguishedWaitersEnabled() {
 		return
 	}
 	claimantTxn, _ := kl.claimantTxn()
@@ -2768,10 +4637,9 @@ func (kl *keyLocks) shouldRequestActivelyWait(g *lockTableGuardImpl) bool {
 	// happen if there are UPDATE strengths in the mix; this is because
 	// constructions using just SHARED, EXCLUSIVE, and INTENT lock strengths would
 	// result in there either being a conflict, or the head of the queue must
-	// entirely be comprised of inactive waiters. The lock table currenlty does
-	// not support UPDATE locks. Even if it did, there would be no correctness
-	// issue with what we're doing here, as long as the queue is maintained in
-	// sequence number order.
+	// entirely be comprised of inactive waiters. There is no correctness issue
+	// with what we're doing here, as long as the queue is maintained in sequence
+	// number order.
 	for e := kl.queuedLockingRequests.Front(); e != nil; e = e.Next() {
 		qqg := e.Value
 		if qqg.guard == g {
@@ -2798,7 +4666,8 @@ func (kl *keyLocks) shouldRequestActivelyWait(g *lockTableGuardImpl) bool {
 // is done using a call to informActiveWaiters.
 //
 // [1] Only transactional, locking requests can establish claims.
-// Non-transactional writers cannot.
+// Non-transactional writers cannot, unless they opted in to doing so by
+// supplying a Request.NonTxnClaimTxn.
 // [2] While non-transactional writers cannot establish claims, they do need to
 // be removed from the receiver's wait queue before proceeding. We do that here.
 //
@@ -2820,7 +4689,8 @@ func (kl *keyLocks) claimBeforeProceeding(g *lockTableGuardImpl) {
 	// because doing so could result in undetectable deadlocks, as our distributed
 	// deadlock detection algorithm relies on {Push,Query}Txn requests.
 	// Non-transactional writers, by definition, have no associated transaction a
-	// waiter can push.
+	// waiter can push. Those that supply a Request.NonTxnClaimTxn do, so they
+	// are handled like transactional locking requests.
 
 	// Find the request; iterate from the front, as requests proceeding are more
 	// likely to be closer to the front than the back.
@@ -2834,14 +4704,16 @@ func (kl *keyLocks) claimBeforeProceeding(g *lockTableGuardImpl) {
 			if g == kl.distinguishedWaiter {
 				kl.distinguishedWaiter = nil
 			}
-			if g.txn == nil {
+			if !g.canClaim() {
 				// Non-transactional writer.
 				g.mu.Lock()
 				delete(g.mu.locks, kl)
 				g.mu.Unlock()
 				kl.queuedLockingRequests.Remove(e)
+				kl.adjustEstimatedBytes(-queuedRequestEstimatedBytes)
 			} else {
-				// Transactional locking request.
+				// Transactional locking request, or non-transactional writer with a
+				// claim identity.
 				qqg.active = false // claim the lock
 			}
 			return
@@ -2916,12 +4788,72 @@ func (kl *keyLocks) isNonConflictingLock(g *lockTableGuardImpl) bool {
 	return true // non-conflicting
 }
 
+// maybeTakeAcquisitionToken admits the supplied locking request into the
+// receiver's wait-queue if PerKeyLockAcquisitionRateLimit is set, by taking a
+// token from the key's acquisition token bucket. Requests that are already
+// part of the wait-queue, e.g. because they waited in it before scanning again,
+// were admitted earlier and don't take another token. Non-transactional
+// requests don't acquire locks, so they aren't rate limited either. Returns
+// false, along with how long the request should back off for, if the request
+// must be throttled; every such throttle is counted.
+//
+// REQUIRES: kl.mu to be locked.
+func (kl *keyLocks) maybeTakeAcquisitionToken(
+	g *lockTableGuardImpl,
+) (ok bool, retryAfter time.Duration) {
+	if g.txn == nil {
+		return true, 0
+	}
+	rate := PerKeyLockAcquisitionRateLimit.Get(&g.lt.settings.SV)
+	if rate == 0 {
+		return true, 0
+	}
+	g.mu.Lock()
+	_, inQueue := g.mu.locks[kl]
+	g.mu.Unlock()
+	if inQueue {
+		return true, 0
+	}
+	ok, retryAfter = kl.tryTakeAcquisitionToken(g.lt.clock.PhysicalTime(), rate)
+	if !ok {
+		g.lt.counters.acquisitionsThrottled.Add(1)
+	}
+	return ok, retryAfter
+}
+
+// tryTakeAcquisitionToken takes a token from the key's acquisition token
+// bucket, which is refilled at the supplied rate per second up to a burst of as
+// many tokens (and at least one). It returns false if no token is available, in
+// which case the request must be throttled, along with how long it will take
+// for the bucket to refill a token.
+//
+// REQUIRES: kl.mu is locked.
+func (kl *keyLocks) tryTakeAcquisitionToken(
+	now time.Time, rate float64,
+) (ok bool, retryAfter time.Duration) {
+	burst := math.Max(rate, 1)
+	if kl.acquisitionTokensUpdated.IsZero() {
+		kl.acquisitionTokens = burst
+	} else if elapsed := now.Sub(kl.acquisitionTokensUpdated); elapsed > 0 {
+		kl.acquisitionTokens = math.Min(burst, kl.acquisitionTokens+elapsed.Seconds()*rate)
+	}
+	kl.acquisitionTokensUpdated = now
+	if kl.acquisitionTokens < 1 {
+		return false, time.Duration((1 - kl.acquisitionTokens) / rate * float64(time.Second))
+	}
+	kl.acquisitionTokens--
+	return true, 0
+}
+
 // Acquires this lock. Any requests that are waiting in the lock's wait queues
 // from the transaction acquiring the lock are also released.
 //
 // Acquires l.mu.
 func (kl *keyLocks) acquireLock(
-	acq *roachpb.LockAcquisition, clock *hlc.Clock, st *cluster.Settings,
+	acq *roachpb.LockAcquisition,
+	clock *hlc.Clock,
+	st *cluster.Settings,
+	counters *lockTableCounters,
 ) error {
 	kl.mu.Lock()
 	defer kl.mu.Unlock()
@@ -2931,7 +4863,7 @@ func (kl *keyLocks) acquireLock(
 		assert(found, "expected to find lock held by the transaction")
 		tl := e.Value
 		beforeTs := tl.writeTS()
-		err := tl.reacquireLock(acq)
+		err := tl.reacquireLock(acq, st, counters)
 		if err != nil {
 			return err
 		}
@@ -2971,6 +4903,9 @@ func (kl *keyLocks) acquireLock(
 	// break claims of requests that hold latches without holding latches
 	// themselves.
 
+	if queued, ok := kl.longestQueuedDurationForTxn(&acq.Txn, clock.PhysicalTime()); ok {
+		counters.recordAcquisitionAfterQueueing(queued)
+	}
 	kl.releaseLockingRequestsFromTxn(&acq.Txn)
 
 	// Sanity check that there aren't any waiting readers on this lock. There
@@ -3005,7 +4940,7 @@ func (kl *keyLocks) acquireLock(
 	// Update the tracking to include this transaction's lock.
 	kl.lockAcquiredOrDiscovered(tl)
 	// Inform active waiters since lock has transitioned to held.
-	kl.informActiveWaiters()
+	kl.informActiveWaiters(ClaimantChangeLockAcquired)
 	return nil
 }
 
@@ -3024,7 +4959,7 @@ func (kl *keyLocks) discoveredLock(
 	defer kl.mu.Unlock()
 
 	if notRemovable {
-		kl.notRemovable++
+		kl.notRemovable = append(kl.notRemovable, g.seqNum)
 	}
 
 	var tl *txnLock
@@ -3076,15 +5011,17 @@ func (kl *keyLocks) discoveredLock(
 			// add the request to the list of queuedLockingRequests as an inactive
 			// waiter.
 			qg := &queuedGuard{
-				guard:  g,
-				mode:   makeLockMode(accessStrength, g.txnMeta(), g.ts),
-				active: false,
+				guard:       g,
+				mode:        makeLockMode(accessStrength, g.txnMeta(), g.ts),
+				active:      false,
+				enqueueTime: g.lt.clock.PhysicalTime(),
 			}
 			// g is not necessarily first in the queue in the (rare) case (a) above.
+			byPriority := g.lt.priorityOrderedWaitQueues()
 			var e *list.Element[*queuedGuard]
 			for e = kl.queuedLockingRequests.Front(); e != nil; e = e.Next() {
 				qqg := e.Value
-				if qqg.guard.seqNum > g.seqNum {
+				if g.queuedAheadOf(qqg.guard, byPriority) {
 					break
 				}
 			}
@@ -3093,6 +5030,7 @@ func (kl *keyLocks) discoveredLock(
 			} else {
 				kl.queuedLockingRequests.InsertBefore(qg, e)
 			}
+			kl.adjustEstimatedBytes(queuedRequestEstimatedBytes)
 		}
 	}
 
@@ -3100,32 +5038,46 @@ func (kl *keyLocks) discoveredLock(
 	kl.releaseLockingRequestsFromTxn(&foundLock.Txn)
 
 	// Active waiters need to be told about who they are waiting for.
-	kl.informActiveWaiters()
+	kl.informActiveWaiters(ClaimantChangeLockDiscovered)
 	return nil
 }
 
-func (kl *keyLocks) decrementNotRemovable() {
+// decrementNotRemovable removes the notRemovable reference held by the
+// request with the supplied seqNum.
+//
+// Acquires kl.mu.
+func (kl *keyLocks) decrementNotRemovable(seqNum uint64) {
 	kl.mu.Lock()
 	defer kl.mu.Unlock()
-	kl.notRemovable--
-	if kl.notRemovable < 0 {
-		panic(fmt.Sprintf("keyLocks.notRemovable is negative: %d", kl.notRemovable))
+	for i, s := range kl.notRemovable {
+		if s == seqNum {
+			kl.notRemovable = append(kl.notRemovable[:i], kl.notRemovable[i+1:]...)
+			return
+		}
 	}
+	panic(fmt.Sprintf("keyLocks.notRemovable does not contain req: %d", seqNum))
 }
 
+// tryClearLock clears the lock and transitions its waiters, unless the lock is
+// notRemovable and force is false. Waiters are told to wait elsewhere, on the
+// holder of the replicated lock, if one is held and neither force nor
+// doneWaiting is set; otherwise, they are told that they are done waiting.
+// Returns whether the lock was cleared, and the number of waiters told to wait
+// elsewhere.
+//
 // Acquires l.mu.
-func (kl *keyLocks) tryClearLock(force bool) bool {
+func (kl *keyLocks) tryClearLock(force, doneWaiting bool) (cleared bool, waitersElsewhere int) {
 	kl.mu.Lock()
 	defer kl.mu.Unlock()
-	if kl.notRemovable > 0 && !force {
-		return false
+	if len(kl.notRemovable) > 0 && !force {
+		return false, 0
 	}
 
 	// Clear lock holder. While doing so, construct the closure used to transition
 	// waiters.
 	replicatedHeld, replicatedLockHolderTxn := kl.isAnyLockHeldReplicated()
 	transitionWaiter := func(g *lockTableGuardImpl) {
-		if replicatedHeld && !force {
+		if replicatedHeld && !force && !doneWaiting {
 			// Note that none of the current waiters can be requests from
 			// lockHolderTxn, so they will never be told to waitElsewhere on
 			// themselves.
@@ -3136,9 +5088,11 @@ func (kl *keyLocks) tryClearLock(force bool) bool {
 				held: true,
 			}
 			g.updateWaitingStateLocked(waitState)
+			waitersElsewhere++
 		} else {
-			// !replicatedHeld || force. Both are handled as doneWaiting since the
-			// system is no longer tracking the lock that was possibly held.
+			// !replicatedHeld || force || doneWaiting. All are handled as
+			// doneWaiting since the system is no longer tracking the lock that was
+			// possibly held.
 			g.updateStateToDoneWaitingLocked()
 		}
 	}
@@ -3150,6 +5104,7 @@ func (kl *keyLocks) tryClearLock(force bool) bool {
 		curr := e
 		e = e.Next()
 		kl.waitingReaders.Remove(curr)
+		kl.adjustEstimatedBytes(-queuedRequestEstimatedBytes)
 
 		g.mu.Lock()
 		transitionWaiter(g)
@@ -3164,6 +5119,7 @@ func (kl *keyLocks) tryClearLock(force bool) bool {
 		curr := e
 		e = e.Next()
 		kl.queuedLockingRequests.Remove(curr)
+		kl.adjustEstimatedBytes(-queuedRequestEstimatedBytes)
 
 		g := qg.guard
 		g.mu.Lock()
@@ -3180,7 +5136,7 @@ func (kl *keyLocks) tryClearLock(force bool) bool {
 
 	// The keyLocks struct must now be empty.
 	kl.assertEmptyLock()
-	return true
+	return true, waitersElsewhere
 }
 
 // Tries to update the lock: noop if this lock is held by a different
@@ -3209,6 +5165,8 @@ func (kl *keyLocks) tryUpdateLockLocked(up roachpb.LockUpdate) (heldByTxn, gc bo
 			// The lock transitioned from held to unheld as a result of this lock
 			// update.
 			gc = kl.releaseWaitersOnKeyUnlocked()
+		} else {
+			kl.maybeReleasePromotingRequests()
 		}
 		return true, gc
 	}
@@ -3291,6 +5249,8 @@ func (kl *keyLocks) tryUpdateLockLocked(up roachpb.LockUpdate) (heldByTxn, gc bo
 		kl.clearLockHeldBy(txn.ID)
 		if !kl.isLocked() {
 			gc = kl.releaseWaitersOnKeyUnlocked()
+		} else {
+			kl.maybeReleasePromotingRequests()
 		}
 		return true, gc
 	}
@@ -3341,6 +5301,7 @@ func (kl *keyLocks) removeLockingRequest(e *list.Element[*queuedGuard]) bool {
 	qg := e.Value
 	g := qg.guard
 	kl.queuedLockingRequests.Remove(e)
+	kl.adjustEstimatedBytes(-queuedRequestEstimatedBytes)
 	g.mu.Lock()
 	defer g.mu.Unlock()
 	delete(g.mu.locks, kl)
@@ -3361,6 +5322,7 @@ func (kl *keyLocks) removeLockingRequest(e *list.Element[*queuedGuard]) bool {
 func (kl *keyLocks) removeReader(e *list.Element[*lockTableGuardImpl]) bool {
 	g := e.Value
 	kl.waitingReaders.Remove(e)
+	kl.adjustEstimatedBytes(-queuedRequestEstimatedBytes)
 	g.mu.Lock()
 	delete(g.mu.locks, kl)
 	g.doneActivelyWaitingAtLock()
@@ -3398,6 +5360,7 @@ func (kl *keyLocks) requestDone(g *lockTableGuardImpl) (gc bool) {
 		qg := e.Value
 		if qg.guard == g {
 			kl.queuedLockingRequests.Remove(e)
+			kl.adjustEstimatedBytes(-queuedRequestEstimatedBytes)
 			if qg.guard == kl.distinguishedWaiter {
 				distinguishedRemoved = true
 				kl.distinguishedWaiter = nil
@@ -3413,7 +5376,7 @@ func (kl *keyLocks) requestDone(g *lockTableGuardImpl) (gc bool) {
 		// no longer be true if the guy we removed above was serving this purpose;
 		// the call to maybeReleaseCompatibleLockingRequests should fix that. And if
 		// it wasn't serving that purpose, it'll be a no-op.
-		kl.maybeReleaseCompatibleLockingRequests()
+		kl.maybeReleaseCompatibleLockingRequests(ClaimantChangeClaimBroken)
 	}
 
 	if !doneRemoval {
@@ -3421,6 +5384,7 @@ func (kl *keyLocks) requestDone(g *lockTableGuardImpl) (gc bool) {
 			gg := e.Value
 			if gg == g {
 				kl.waitingReaders.Remove(e)
+				kl.adjustEstimatedBytes(-queuedRequestEstimatedBytes)
 				if g == kl.distinguishedWaiter {
 					distinguishedRemoved = true
 					kl.distinguishedWaiter = nil
@@ -3455,7 +5419,7 @@ func (kl *keyLocks) requestDone(g *lockTableGuardImpl) (gc bool) {
 // concurrency discussed in #49973.
 //
 // Acquires l.mu.
-func (kl *keyLocks) tryFreeLockOnReplicatedAcquire() bool {
+func (kl *keyLocks) tryFreeLockOnReplicatedAcquire(counters *lockTableCounters) bool {
 	kl.mu.Lock()
 	defer kl.mu.Unlock()
 
@@ -3475,11 +5439,14 @@ func (kl *keyLocks) tryFreeLockOnReplicatedAcquire() bool {
 	// TODO(arul): Once we support replicated shared locks, we only want to clear
 	// the lock holder that's promoting its durability from unreplicated to
 	// replicated -- not all lock holders.
+	readersReleased := kl.waitingReaders.Len()
 	kl.clearAllLockHolders()
 	gc := kl.releaseWaitersOnKeyUnlocked()
 	if !gc {
 		panic("expected lockIsFree to return true")
 	}
+	counters.locksFreedOnReplicatedAcquire.Add(1)
+	counters.readersReleasedOnReplicatedAcquire.Add(int64(readersReleased))
 	return true
 }
 
@@ -3501,7 +5468,7 @@ func (kl *keyLocks) releaseWaitersOnKeyUnlocked() (gc bool) {
 		kl.removeReader(curr)
 	}
 
-	kl.maybeReleaseCompatibleLockingRequests()
+	kl.maybeReleaseCompatibleLockingRequests(ClaimantChangeLockReleased)
 
 	// We've already cleared waiting readers above. The lock can be released if
 	// there are no waiting locking requests, active or otherwise.
@@ -3519,15 +5486,19 @@ func (kl *keyLocks) releaseWaitersOnKeyUnlocked() (gc bool) {
 // notify(). The released request(s) are said to have established a (possibly
 // joint) claim.
 //
-// Any non-transactional writers at the head of the queue are also released.
+// Any non-transactional writers at the head of the queue that cannot claim the
+// lock are also released.
 //
 // [1] If the request is not actively waiting in the lock wait queue, it's a
 // noop for the request.
 //
+// The supplied reason is the state transition that prompted the call; see
+// informActiveWaiters.
+//
 // REQUIRES: kl.mu is locked.
 // REQUIRES: the (receiver) lock must not be held.
 // REQUIRES: there should not be any waitingReaders in the lock's wait queues.
-func (kl *keyLocks) maybeReleaseCompatibleLockingRequests() {
+func (kl *keyLocks) maybeReleaseCompatibleLockingRequests(reason ClaimantChangeReason) {
 	if kl.isLocked() {
 		panic("maybeReleaseCompatibleLockingRequests called when lock is held")
 	}
@@ -3540,11 +5511,13 @@ func (kl *keyLocks) maybeReleaseCompatibleLockingRequests() {
 	// be incompatible with any (possibly joint) claim that transactional
 	// request(s) will establish by the time we're done with this method. This
 	// means we only need special case handling for non-transactional requests
-	// just once -- for the ones that are at the head of the queue.
+	// just once -- for the ones that are at the head of the queue. A
+	// non-transactional writer with a claim identity is instead handled like a
+	// transactional locking request below, and claims the lock on its own.
 	for e := kl.queuedLockingRequests.Front(); e != nil; {
 		qg := e.Value
 		g := qg.guard
-		if g.txn != nil { // (transactional) locking request
+		if g.canClaim() { // (transactional) locking request
 			break
 		}
 		curr := e
@@ -3572,13 +5545,18 @@ func (kl *keyLocks) maybeReleaseCompatibleLockingRequests() {
 			if lock.Conflicts(mode, qg.mode, &qg.guard.lt.settings.SV) {
 				break
 			}
-			// NB: Once we add support for UPDATE locking strength, this logic
-			// will need to accumulate the strongest lock mode seen so far. For
-			// example, consider the following:
+			// Accumulate the strongest lock mode seen so far, as the requests that
+			// follow must be compatible with all requests being released, not just
+			// the one at the head of the queue. For example, consider the
+			// following:
 			// waitQueue: [Shared, Update, Shared, Update, Exclusive]
 			//
 			// We want to release the first 3 requests (as they're compatible with
-			// each other), not the first 4.
+			// each other), not the first 4. Compatibility is monotonic in lock
+			// strength, so comparing against the strongest mode suffices.
+			if qg.mode.Strength > mode.Strength {
+				mode = qg.mode
+			}
 		}
 
 		if qg.active {
@@ -3596,7 +5574,7 @@ func (kl *keyLocks) maybeReleaseCompatibleLockingRequests() {
 	}
 
 	// Tell the active waiters who they are waiting for.
-	kl.informActiveWaiters()
+	kl.informActiveWaiters(reason)
 }
 
 // testingAssertCompatibleLockMode ensures the supplied lock mode is compatible
@@ -3635,6 +5613,13 @@ func (kl *keyLocks) testingAssertCompatibleLockMode(
 	return nil
 }
 
+// Set adds the specified lock to the tree.
+// REQUIRES: t.mu is locked.
+func (t *treeMu) Set(l *keyLocks) {
+	t.btree.Set(l)
+	t.generation++
+}
+
 // Delete removes the specified lock from the tree.
 // REQUIRES: t.mu is locked.
 func (t *treeMu) Delete(l *keyLocks) {
@@ -3642,6 +5627,7 @@ func (t *treeMu) Delete(l *keyLocks) {
 		l.assertEmptyLockUnlocked()
 	}
 	t.btree.Delete(l)
+	t.generation++
 }
 
 // Reset removes all locks from the tree.
@@ -3654,6 +5640,7 @@ func (t *treeMu) Reset() {
 		}
 	}
 	t.btree.Reset()
+	t.generation++
 }
 
 func (t *treeMu) nextLockSeqNum() (seqNum uint64, checkMaxLocks bool) {
@@ -3665,9 +5652,27 @@ func (t *treeMu) nextLockSeqNum() (seqNum uint64, checkMaxLocks bool) {
 func (t *lockTableImpl) ScanOptimistic(req Request) lockTableGuard {
 	g := t.newGuardForReq(req)
 	t.doSnapshotForGuard(g)
+	g.optimistic = true
+	t.optimisticGuards.Add(1)
+	t.counters.optimisticEvals.Add(1)
 	return g
 }
 
+// finishOptimisticEval records that the supplied guard, if it was created by
+// ScanOptimistic, is no longer used for optimistic evaluation. fellBack
+// indicates whether this is because the request is being re-sequenced
+// pessimistically.
+func (t *lockTableImpl) finishOptimisticEval(g *lockTableGuardImpl, fellBack bool) {
+	if !g.optimistic {
+		return
+	}
+	g.optimistic = false
+	t.optimisticGuards.Add(-1)
+	if fellBack {
+		t.counters.optimisticEvalFallbacks.Add(1)
+	}
+}
+
 // ScanAndEnqueue implements the lockTable interface.
 func (t *lockTableImpl) ScanAndEnqueue(req Request, guard lockTableGuard) (lockTableGuard, *Error) {
 	// NOTE: there is no need to synchronize with enabledMu here. ScanAndEnqueue
@@ -3678,9 +5683,15 @@ func (t *lockTableImpl) ScanAndEnqueue(req Request, guard lockTableGuard) (lockT
 
 	var g *lockTableGuardImpl
 	if guard == nil {
+		if err := checkIgnoredLockHolderTxns(req); err != nil {
+			return nil, kvpb.NewError(err)
+		}
 		g = t.newGuardForReq(req)
 	} else {
 		g = guard.(*lockTableGuardImpl)
+		// A request whose optimistic evaluation failed is re-sequenced with the
+		// guard created by ScanOptimistic.
+		t.finishOptimisticEval(g, true /* fellBack */)
 		g.key = nil
 		g.str = lock.MaxStrength
 		g.index = -1
@@ -3688,6 +5699,9 @@ func (t *lockTableImpl) ScanAndEnqueue(req Request, guard lockTableGuard) (lockT
 		g.mu.startWait = false
 		g.mu.state = waitingState{}
 		g.mu.mustComputeWaitingState = false
+		// The scan below is performed while holding latches, so it must not
+		// rely on spans donated while the request was waiting.
+		g.mu.donatedSpans = nil
 		g.mu.Unlock()
 		g.toResolve = g.toResolve[:0]
 	}
@@ -3708,12 +5722,71 @@ func (t *lockTableImpl) ScanAndEnqueue(req Request, guard lockTableGuard) (lockT
 	if g.notRemovableLock != nil {
 		// Either waiting at the notRemovableLock, or elsewhere. Either way we are
 		// making forward progress, which ensures liveness.
-		g.notRemovableLock.decrementNotRemovable()
+		g.notRemovableLock.decrementNotRemovable(g.seqNum)
 		g.notRemovableLock = nil
 	}
 	return g, nil
 }
 
+// checkMaxLocksPerTxn returns a retryable error if the supplied transaction,
+// which is about to start holding a lock on a key on which it holds no locks
+// yet, already holds locks on as many keys as MaxLocksPerTransaction permits.
+// Each rejection is counted, and logged along with the transaction's ID.
+//
+// REQUIRES: locks.mu is locked.
+func (t *lockTableImpl) checkMaxLocksPerTxn(txn *enginepb.TxnMeta) error {
+	maxLocks := MaxLocksPerTransaction.Get(&t.settings.SV)
+	if maxLocks == 0 {
+		return nil
+	}
+	held := t.heldLocks.get(txn.ID)
+	if held < maxLocks {
+		return nil
+	}
+	t.counters.maxLocksPerTxnRejections.Add(1)
+	if t.maxLocksPerTxnLogEvery.ShouldLog() {
+		log.Warningf(context.Background(),
+			"r%d: rejecting lock by txn %s holding locks on %d keys; limit is %d",
+			t.rID, txn.ID, held, maxLocks)
+	}
+	return kvpb.NewTransactionRetryError(kvpb.RETRY_REASON_UNKNOWN, redact.Sprintf(
+		"txn %s holds locks on %d keys in r%d, reaching the limit of %d set by %s",
+		txn.Short(), held, t.rID, maxLocks, redact.SafeString(MaxLocksPerTransaction.Name()),
+	))
+}
+
+// checkIgnoredLockHolderTxns returns an error if the supplied request sets
+// IgnoredLockHolderTxns but is not a non-locking read. Ignoring the locks of
+// other transactions is only safe for requests that don't acquire locks of
+// their own: a locking request that skipped over a conflicting lock would go on
+// to acquire an incompatible lock on the same key, which the lock table cannot
+// represent, as two transactions would hold incompatible locks on it. For the
+// same reason, claims on a key by locking requests from ignored transactions,
+// which only locking requests wait on (see shouldRequestActivelyWait), are not
+// ignored either.
+func checkIgnoredLockHolderTxns(req Request) error {
+	if len(req.IgnoredLockHolderTxns) == 0 || !isLockingRequest(req.LockSpans) {
+		return nil
+	}
+	return errors.Newf(
+		"IgnoredLockHolderTxns is only supported for non-locking reads; request has lock spans %s",
+		req.LockSpans)
+}
+
+// isLockingRequest returns whether the supplied lock spans include any locking
+// (i.e. non lock.None) accesses.
+func isLockingRequest(spans *lockspanset.LockSpanSet) bool {
+	if spans == nil {
+		return false
+	}
+	for str := lock.MaxStrength; str > lock.None; str-- {
+		if len(spans.GetSpans(str)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *lockTableImpl) newGuardForReq(req Request) *lockTableGuardImpl {
 	g := newLockTableGuardImpl()
 	g.seqNum = t.seqNum.Add(1)
@@ -3723,6 +5796,11 @@ func (t *lockTableImpl) newGuardForReq(req Request) *lockTableGuardImpl {
 	g.spans = req.LockSpans
 	g.waitPolicy = req.WaitPolicy
 	g.maxWaitQueueLength = req.MaxLockWaitQueueLength
+	g.maxLockWaitDuration = req.MaxLockWaitDuration
+	if req.Txn == nil {
+		g.nonTxnClaimTxn = req.NonTxnClaimTxn
+	}
+	g.ignoredLockHolderTxns = req.IgnoredLockHolderTxns
 	g.str = lock.MaxStrength
 	g.index = -1
 	return g
@@ -3735,21 +5813,46 @@ func (t *lockTableImpl) doSnapshotForGuard(g *lockTableGuardImpl) {
 		return
 	}
 	t.locks.mu.RLock()
+	defer t.locks.mu.RUnlock()
+	if g.snapshotTaken && g.snapshotGen == t.locks.generation {
+		// No keyLocks struct has been added to or removed from the btree since
+		// the guard's snapshot was taken, so the snapshot is still current.
+		return
+	}
 	g.tableSnapshot.Reset()
 	g.tableSnapshot = t.locks.Clone()
-	t.locks.mu.RUnlock()
+	g.snapshotTaken = true
+	g.snapshotGen = t.locks.generation
+	g.snapshotEmpty = g.tableSnapshot.Len() == 0
 }
 
 // Dequeue implements the lockTable interface.
-func (t *lockTableImpl) Dequeue(guard lockTableGuard) {
+func (t *lockTableImpl) Dequeue(guard lockTableGuard) (spansDonated bool) {
 	// NOTE: there is no need to synchronize with enabledMu here. Dequeue only
 	// accesses state already held by the guard and does not add anything to the
 	// lockTable.
 
 	g := guard.(*lockTableGuardImpl)
 	defer releaseLockTableGuardImpl(g)
+	t.finishOptimisticEval(g, false /* fellBack */)
+	t.leaveWaitQueues(g)
+	// The request is no longer in any wait-queue, so its spans can no longer
+	// be donated.
+	return g.spansDonated.Load()
+}
+
+// LeaveWaitQueues implements the lockTable interface.
+func (t *lockTableImpl) LeaveWaitQueues(guard lockTableGuard) {
+	g := guard.(*lockTableGuardImpl)
+	t.finishOptimisticEval(g, false /* fellBack */)
+	t.leaveWaitQueues(g)
+}
+
+// leaveWaitQueues removes the guard's request from the lock wait-queues it is
+// part of, garbage collecting any locks that become empty as a result.
+func (t *lockTableImpl) leaveWaitQueues(g *lockTableGuardImpl) {
 	if g.notRemovableLock != nil {
-		g.notRemovableLock.decrementNotRemovable()
+		g.notRemovableLock.decrementNotRemovable(g.seqNum)
 		g.notRemovableLock = nil
 	}
 	var candidateLocks []*keyLocks
@@ -3790,7 +5893,11 @@ func (t *lockTableImpl) Dequeue(guard lockTableGuard) {
 // For now we adopt the following heuristic: the caller calls DiscoveredLocks
 // with the count of locks discovered, prior to calling AddDiscoveredLock for
 // each of the locks. At that point a decision is made whether to consult the
-// txnStatusCache eagerly when adding discovered locks.
+// txnStatusCache eagerly when adding discovered locks. This decision only
+// governs locks held by pushed transactions: a lock held by a transaction
+// that is known to be finalized is never added to the lock table, since
+// tracking it would be pure waste -- any request that waited on it would
+// immediately be told to resolve it.
 func (t *lockTableImpl) AddDiscoveredLock(
 	foundLock *roachpb.Lock,
 	seq roachpb.LeaseSequence,
@@ -3801,8 +5908,104 @@ func (t *lockTableImpl) AddDiscoveredLock(
 	defer t.enabledMu.RUnlock()
 	if !t.enabled {
 		// If not enabled, don't track any locks.
+		t.maybeTrackOpWhileDisabled(disabledOpAddDiscoveredLock, foundLock.Key, &foundLock.Txn)
 		return false, nil
 	}
+	if ok, err := t.checkDiscoveredLockLeaseSeq(seq); !ok || err != nil {
+		return false, err
+	}
+	g := guard.(*lockTableGuardImpl)
+	str, handled, err := t.maybeHandleDiscoveredLockWithoutTracking(foundLock, consultTxnStatusCache, g)
+	if err != nil || handled {
+		return handled, err
+	}
+	t.locks.mu.Lock()
+	added, checkMaxLocks, err := t.trackDiscoveredLockLocked(foundLock, str, g)
+	t.locks.mu.Unlock()
+	if checkMaxLocks {
+		t.checkMaxKeysLockedAndTryClear()
+	}
+	return added, err
+}
+
+// AddDiscoveredLocks implements the lockTable interface.
+//
+// It is equivalent to calling AddDiscoveredLock for each of the supplied
+// locks, but acquires enabledMu and locks.mu once for the whole batch, and
+// only checks whether the lock table needs to clear locks to stay within its
+// limit once all the locks have been added.
+func (t *lockTableImpl) AddDiscoveredLocks(
+	foundLocks []roachpb.Lock,
+	seq roachpb.LeaseSequence,
+	consultTxnStatusCache bool,
+	guard lockTableGuard,
+) (ignored []roachpb.Key, _ error) {
+	t.enabledMu.RLock()
+	defer t.enabledMu.RUnlock()
+	ignoreAll := func() []roachpb.Key {
+		ignored := make([]roachpb.Key, len(foundLocks))
+		for i := range foundLocks {
+			ignored[i] = foundLocks[i].Key
+		}
+		return ignored
+	}
+	if !t.enabled {
+		// If not enabled, don't track any locks.
+		for i := range foundLocks {
+			t.maybeTrackOpWhileDisabled(disabledOpAddDiscoveredLock, foundLocks[i].Key, &foundLocks[i].Txn)
+		}
+		return ignoreAll(), nil
+	}
+	if ok, err := t.checkDiscoveredLockLeaseSeq(seq); !ok || err != nil {
+		return ignoreAll(), err
+	}
+	g := guard.(*lockTableGuardImpl)
+	// Handle the locks that don't need to be tracked before grabbing locks.mu,
+	// so that it's only held while the remaining locks are added to the tree.
+	type lockToTrack struct {
+		foundLock *roachpb.Lock
+		str       lock.Strength
+	}
+	var toTrack []lockToTrack
+	for i := range foundLocks {
+		str, handled, err := t.maybeHandleDiscoveredLockWithoutTracking(
+			&foundLocks[i], consultTxnStatusCache, g)
+		if err != nil {
+			return ignored, err
+		}
+		if !handled {
+			toTrack = append(toTrack, lockToTrack{foundLock: &foundLocks[i], str: str})
+		}
+	}
+	if len(toTrack) == 0 {
+		return nil, nil
+	}
+	checkMaxLocks := false
+	var err error
+	t.locks.mu.Lock()
+	for _, l := range toTrack {
+		added, check, lockErr := t.trackDiscoveredLockLocked(l.foundLock, l.str, g)
+		if !added {
+			ignored = append(ignored, l.foundLock.Key)
+		}
+		checkMaxLocks = checkMaxLocks || check
+		if lockErr != nil {
+			err = lockErr
+			break
+		}
+	}
+	t.locks.mu.Unlock()
+	if checkMaxLocks {
+		t.checkMaxKeysLockedAndTryClear()
+	}
+	return ignored, err
+}
+
+// checkDiscoveredLockLeaseSeq returns whether locks discovered under the
+// supplied lease sequence should be added to the lock table.
+//
+// REQUIRES: enabledMu is RLocked and the lock table is enabled.
+func (t *lockTableImpl) checkDiscoveredLockLeaseSeq(seq roachpb.LeaseSequence) (bool, error) {
 	if seq < t.enabledSeq {
 		// If the lease sequence is too low, this discovered lock may no longer
 		// be accurate, so we ignore it.
@@ -3813,21 +6016,39 @@ func (t *lockTableImpl) AddDiscoveredLock(
 		// higher lease sequence than the current value of enabledSeq.
 		return false, errors.AssertionFailedf("unexpected lease sequence: %d > %d", seq, t.enabledSeq)
 	}
-	g := guard.(*lockTableGuardImpl)
+	return true, nil
+}
+
+// maybeHandleDiscoveredLockWithoutTracking handles a discovered lock that
+// doesn't need to be tracked in the lock table because its holder is known to
+// be finalized or, if consultTxnStatusCache is set, pushed above the
+// discoverer's timestamp, by adding it to the locks the guard must resolve. If
+// the lock wasn't handled, the strength with which the guard accesses its key
+// is returned, for use with trackDiscoveredLockLocked.
+//
+// REQUIRES: enabledMu is RLocked and the lock table is enabled.
+func (t *lockTableImpl) maybeHandleDiscoveredLockWithoutTracking(
+	foundLock *roachpb.Lock, consultTxnStatusCache bool, g *lockTableGuardImpl,
+) (_ lock.Strength, handled bool, _ error) {
 	key := foundLock.Key
+	t.maybeDetectRediscoveryLoop(foundLock)
+	if g.ignoresLocksFromTxn(&foundLock.Txn) {
+		// The request ignored the lock when scanning the lock table, but it
+		// blocked evaluation, so the request must stop ignoring it.
+		g.surfacedLockKeys = append(g.surfacedLockKeys, key)
+	}
 	str, err := findHighestLockStrengthInSpans(key, g.spans)
 	if err != nil {
-		return false, err
+		return 0, false, err
+	}
+	if finalizedTxn, ok := t.txnStatusCache.finalizedTxns.get(foundLock.Txn.ID); ok {
+		g.toResolve = append(
+			g.toResolve, roachpb.MakeLockUpdate(finalizedTxn, roachpb.Span{Key: key}))
+		t.counters.discoveredLocksOfFinalizedTxns.Add(1)
+		return 0, true, nil
 	}
 	if consultTxnStatusCache {
-		finalizedTxn, ok := t.txnStatusCache.finalizedTxns.get(foundLock.Txn.ID)
-		if ok {
-			g.toResolve = append(
-				g.toResolve, roachpb.MakeLockUpdate(finalizedTxn, roachpb.Span{Key: key}))
-			return true, nil
-		}
-
-		// If the discoverer is a non-locking read, also check whether the lock's
+		// If the discoverer is a non-locking read, check whether the lock's
 		// holder is known to have been pushed above the reader's timestamp. See the
 		// comment in scanAndMaybeEnqueue for more details, including why we include
 		// the hasUncertaintyInterval condition.
@@ -3836,25 +6057,61 @@ func (t *lockTableImpl) AddDiscoveredLock(
 			if ok && g.ts.Less(pushedTxn.WriteTimestamp) {
 				g.toResolve = append(
 					g.toResolve, roachpb.MakeLockUpdate(pushedTxn, roachpb.Span{Key: key}))
-				return true, nil
+				return 0, true, nil
 			}
 		}
 	}
+	return str, false, nil
+}
+
+// trackDiscoveredLockLocked adds the discovered lock to the lock table, which
+// the guard accesses with the supplied strength, and enqueues the guard in its
+// wait-queue. checkMaxLocks is returned true if the caller must call
+// checkMaxKeysLockedAndTryClear once it has released locks.mu.
+//
+// REQUIRES: enabledMu is RLocked and the lock table is enabled.
+// REQUIRES: locks.mu is locked.
+func (t *lockTableImpl) trackDiscoveredLockLocked(
+	foundLock *roachpb.Lock, str lock.Strength, g *lockTableGuardImpl,
+) (added, checkMaxLocks bool, _ error) {
+	key := foundLock.Key
 	var l *keyLocks
-	t.locks.mu.Lock()
 	iter := t.locks.MakeIter()
 	iter.FirstOverlap(&keyLocks{key: key})
-	checkMaxLocks := false
+	if g.notRemovableLock != nil && (!iter.Valid() || !iter.Cur().isLockedByTxn(foundLock.Txn.ID)) &&
+		t.checkMaxLocksPerTxn(&foundLock.Txn) != nil {
+		// The lock's holder already holds locks on as many keys as
+		// MaxLocksPerTransaction permits. As with the high watermark below, let
+		// the request rediscover the lock on its next evaluation attempt instead
+		// of tracking it. The request already has a lock marked notRemovable to
+		// wait on, so it still makes progress.
+		return false, false, nil
+	}
 	if !iter.Valid() {
+		if g.notRemovableLock != nil && t.aboveDiscoveredLockHighWatermark() {
+			// The lock table is close to its limit. Instead of tracking the lock,
+			// which could cause the lock table to clear its locks, let the request
+			// rediscover it on its next evaluation attempt. The request already
+			// has a lock marked notRemovable to wait on, so it still makes
+			// progress.
+			t.counters.discoveredLocksRejected.Add(1)
+			return false, false, nil
+		}
 		var lockSeqNum uint64
 		lockSeqNum, checkMaxLocks = t.locks.nextLockSeqNum()
-		l = &keyLocks{id: lockSeqNum, key: key}
+		l = &keyLocks{
+			id:             lockSeqNum,
+			key:            key,
+			heldLocks:      &t.heldLocks,
+			estimatedBytes: &t.locks.estimatedBytes,
+		}
 		l.queuedLockingRequests.Init()
 		l.waitingReaders.Init()
 		l.holders.Init()
 		l.heldBy = make(map[uuid.UUID]*list.Element[*txnLock])
 		t.locks.Set(l)
 		t.locks.numKeysLocked.Add(1)
+		t.locks.estimatedBytes.Add(l.baseEstimatedBytes())
 	} else {
 		l = iter.Cur()
 	}
@@ -3867,14 +6124,10 @@ func (t *lockTableImpl) AddDiscoveredLock(
 		g.notRemovableLock = l
 		notRemovableLock = true
 	}
-	err = l.discoveredLock(foundLock, g, str, notRemovableLock, g.lt.clock)
 	// Can't release tree.mu until call l.discoveredLock() since someone may
 	// find an empty lock and remove it from the tree.
-	t.locks.mu.Unlock()
-	if checkMaxLocks {
-		t.checkMaxKeysLockedAndTryClear()
-	}
-	return true, err
+	err := l.discoveredLock(foundLock, g, str, notRemovableLock, g.lt.clock)
+	return true, checkMaxLocks, err
 }
 
 // AcquireLock implements the lockTable interface.
@@ -3883,6 +6136,7 @@ func (t *lockTableImpl) AcquireLock(acq *roachpb.LockAcquisition) error {
 	defer t.enabledMu.RUnlock()
 	if !t.enabled {
 		// If not enabled, don't track any locks.
+		t.maybeTrackOpWhileDisabled(disabledOpAcquireLock, acq.Key, &acq.Txn)
 		return nil
 	}
 	switch acq.Strength {
@@ -3891,6 +6145,10 @@ func (t *lockTableImpl) AcquireLock(acq *roachpb.LockAcquisition) error {
 	case lock.Exclusive, lock.Shared:
 		// Both shared and exclusive locks can have either replicated or
 		// unreplicated durability.
+	case lock.Update:
+		if acq.Durability != lock.Unreplicated {
+			return errors.AssertionFailedf("update locks can only be acquired unreplicated")
+		}
 	default:
 		return errors.AssertionFailedf("unsupported lock strength %s", acq.Strength)
 	}
@@ -3914,18 +6172,28 @@ func (t *lockTableImpl) AcquireLock(acq *roachpb.LockAcquisition) error {
 			t.locks.mu.Unlock()
 			return nil
 		}
+		if err := t.checkMaxLocksPerTxn(&acq.Txn); err != nil {
+			t.locks.mu.Unlock()
+			return err
+		}
 		var lockSeqNum uint64
 		lockSeqNum, checkMaxLocks = t.locks.nextLockSeqNum()
-		l = &keyLocks{id: lockSeqNum, key: acq.Key}
+		l = &keyLocks{
+			id:             lockSeqNum,
+			key:            acq.Key,
+			heldLocks:      &t.heldLocks,
+			estimatedBytes: &t.locks.estimatedBytes,
+		}
 		l.queuedLockingRequests.Init()
 		l.waitingReaders.Init()
 		l.holders.Init()
 		l.heldBy = make(map[uuid.UUID]*list.Element[*txnLock])
 		t.locks.Set(l)
 		t.locks.numKeysLocked.Add(1)
+		t.locks.estimatedBytes.Add(l.baseEstimatedBytes())
 	} else {
 		l = iter.Cur()
-		if acq.Durability == lock.Replicated && l.tryFreeLockOnReplicatedAcquire() {
+		if acq.Durability == lock.Replicated && l.tryFreeLockOnReplicatedAcquire(&t.counters) {
 			// Don't remember uncontended replicated locks. Just like in the
 			// case where the lock is initially added as replicated, we drop
 			// replicated locks from the lockTable when being upgraded from
@@ -3936,10 +6204,18 @@ func (t *lockTableImpl) AcquireLock(acq *roachpb.LockAcquisition) error {
 			t.locks.Delete(l)
 			t.locks.mu.Unlock()
 			t.locks.numKeysLocked.Add(-1)
+			t.locks.estimatedBytes.Add(-l.baseEstimatedBytes())
+			t.counters.locksGCed.Add(1)
 			return nil
 		}
+		if !l.isLockedByTxn(acq.Txn.ID) {
+			if err := t.checkMaxLocksPerTxn(&acq.Txn); err != nil {
+				t.locks.mu.Unlock()
+				return err
+			}
+		}
 	}
-	err := l.acquireLock(acq, t.clock, t.settings)
+	err := l.acquireLock(acq, t.clock, t.settings, &t.counters)
 	t.locks.mu.Unlock()
 
 	if checkMaxLocks {
@@ -3948,15 +6224,28 @@ func (t *lockTableImpl) AcquireLock(acq *roachpb.LockAcquisition) error {
 	return err
 }
 
+// aboveDiscoveredLockHighWatermark returns whether the number of keys locked
+// is at or above the high watermark past which discovered locks are no longer
+// tracked. See DiscoveredLockHighWatermark.
+func (t *lockTableImpl) aboveDiscoveredLockHighWatermark() bool {
+	frac := DiscoveredLockHighWatermark.Get(&t.settings.SV)
+	if frac == 0 {
+		return false
+	}
+	return float64(t.locks.numKeysLocked.Load()) >= frac*float64(t.maxKeysLocked.Load())
+}
+
 // checkMaxKeysLockedAndTryClear checks if the request is tracking more lock
 // information on keys in its lock table snapshot than it should. If it is, this
 // method relieves memory pressure by clearing as much per-key tracking as it
 // can to bring things under budget.
 func (t *lockTableImpl) checkMaxKeysLockedAndTryClear() {
 	totalLocks := t.locks.numKeysLocked.Load()
-	if totalLocks > t.maxKeysLocked {
-		numToClear := totalLocks - t.minKeysLocked
-		t.tryClearLocks(false /* force */, int(numToClear))
+	if totalLocks > t.maxKeysLocked.Load() {
+		numToClear := totalLocks - t.minKeysLocked.Load()
+		cleared, waitersElsewhere := t.tryClearLocks(false /* force */, int(numToClear))
+		t.counters.locksClearedOnMemoryPressure.Add(int64(cleared))
+		t.counters.waitersToldToWaitElsewhere.Add(int64(waitersElsewhere))
 	}
 }
 
@@ -3970,16 +6259,24 @@ func (t *lockTableImpl) lockCountForTesting() int64 {
 //   - force=true: removes all locks.
 //
 // Waiters of removed locks are told to wait elsewhere or that they are done
-// waiting.
-func (t *lockTableImpl) tryClearLocks(force bool, numToClear int) {
+// waiting. See ClearedLockWaitersDoneWaiting. Returns the number of locks
+// removed and the number of waiters told to wait elsewhere.
+func (t *lockTableImpl) tryClearLocks(force bool, numToClear int) (cleared, waitersElsewhere int) {
+	doneWaiting := t.clearedLockWaitersDoneWaiting()
 	clearCount := 0
 	t.locks.mu.Lock()
 	var locksToClear []*keyLocks
+	// The cleared locks' holders and wait-queues have already been accounted
+	// for by tryClearLock, so only their base footprint remains to subtract.
+	var clearedBytes int64
 	iter := t.locks.MakeIter()
 	for iter.First(); iter.Valid(); iter.Next() {
 		l := iter.Cur()
-		if l.tryClearLock(force) {
+		ok, elsewhere := l.tryClearLock(force, doneWaiting)
+		waitersElsewhere += elsewhere
+		if ok {
 			locksToClear = append(locksToClear, l)
+			clearedBytes += l.baseEstimatedBytes()
 			clearCount++
 			if !force && clearCount >= numToClear {
 				break
@@ -3987,6 +6284,10 @@ func (t *lockTableImpl) tryClearLocks(force bool, numToClear int) {
 		}
 	}
 	t.locks.numKeysLocked.Add(int64(-len(locksToClear)))
+	t.locks.estimatedBytes.Add(-clearedBytes)
+	// NB: counted once here, regardless of whether the locks are removed
+	// individually or through the fast-path Reset below.
+	t.counters.locksGCed.Add(int64(len(locksToClear)))
 	if t.locks.Len() == len(locksToClear) {
 		// Fast-path full clear.
 		t.locks.Reset()
@@ -3996,6 +6297,7 @@ func (t *lockTableImpl) tryClearLocks(force bool, numToClear int) {
 		}
 	}
 	t.locks.mu.Unlock()
+	return len(locksToClear), waitersElsewhere
 }
 
 // findHighestLockStrengthInSpans returns the highest lock strength specified
@@ -4042,57 +6344,112 @@ func (t *lockTableImpl) tryGCLocks(tree *treeMu, locks []*keyLocks) {
 		if empty {
 			tree.Delete(l)
 			tree.numKeysLocked.Add(-1)
+			tree.estimatedBytes.Add(-l.baseEstimatedBytes())
+			t.counters.locksGCed.Add(1)
 		}
 	}
 }
 
 // UpdateLocks implements the lockTable interface.
 func (t *lockTableImpl) UpdateLocks(up *roachpb.LockUpdate) error {
+	if t.trackOpsWhileDisabled() {
+		t.enabledMu.RLock()
+		enabled := t.enabled
+		t.enabledMu.RUnlock()
+		if !enabled {
+			t.maybeTrackOpWhileDisabled(disabledOpUpdateLocks, up.Key, &up.Txn)
+		}
+	}
 	_ = t.updateLockInternal(up)
 	return nil
 }
 
-// updateLockInternal is where the work for UpdateLocks is done. It
-// returns whether there was a lock held by this txn.
-func (t *lockTableImpl) updateLockInternal(up *roachpb.LockUpdate) (heldByTxn bool) {
-	// NOTE: there is no need to synchronize with enabledMu here. Update only
-	// accesses locks already in the lockTable, but a disabled lockTable will be
-	// empty. If the lock-table scan below races with a concurrent call to clear
-	// then it might update a few locks, but they will quickly be cleared.
-
-	span := up.Span
-	var locksToGC []*keyLocks
-	heldByTxn = false
-	changeFunc := func(l *keyLocks) {
-		held, gc := l.tryUpdateLock(up)
-		heldByTxn = heldByTxn || held
-		if gc {
-			locksToGC = append(locksToGC, l)
+// UpdateLocksBatch implements the lockTable interface.
+func (t *lockTableImpl) UpdateLocksBatch(ups []roachpb.LockUpdate) error {
+	if len(ups) == 0 {
+		return nil
+	}
+	if t.trackOpsWhileDisabled() {
+		t.enabledMu.RLock()
+		enabled := t.enabled
+		t.enabledMu.RUnlock()
+		if !enabled {
+			for i := range ups {
+				t.maybeTrackOpWhileDisabled(disabledOpUpdateLocks, ups[i].Key, &ups[i].Txn)
+			}
 		}
 	}
+	// NOTE: see the comment in updateLockInternal about why there is no need to
+	// synchronize with enabledMu here.
+	var locksToGC []*keyLocks
 	t.locks.mu.RLock()
 	iter := t.locks.MakeIter()
-	ltRange := &keyLocks{key: span.Key, endKey: span.EndKey}
-	for iter.FirstOverlap(ltRange); iter.Valid(); iter.NextOverlap(ltRange) {
-		changeFunc(iter.Cur())
-		// Optimization to avoid a second key comparison (not for correctness).
-		if len(span.EndKey) == 0 {
-			break
-		}
+	for i := range ups {
+		_, locksToGC = updateLocksInTree(&iter, &ups[i], locksToGC)
 	}
 	t.locks.mu.RUnlock()
 
 	t.tryGCLocks(&t.locks, locksToGC)
-	return heldByTxn
+	return nil
 }
 
-// Iteration helper for resumeScan. Returns the next span to search over, or nil
+// updateLockInternal is where the work for UpdateLocks is done. It
+// returns whether there was a lock held by this txn.
+func (t *lockTableImpl) updateLockInternal(up *roachpb.LockUpdate) (heldByTxn bool) {
+	// NOTE: there is no need to synchronize with enabledMu here. Update only
+	// accesses locks already in the lockTable, but a disabled lockTable will be
+	// empty. If the lock-table scan below races with a concurrent call to clear
+	// then it might update a few locks, but they will quickly be cleared.
+	var locksToGC []*keyLocks
+	t.locks.mu.RLock()
+	iter := t.locks.MakeIter()
+	heldByTxn, locksToGC = updateLocksInTree(&iter, up, locksToGC)
+	t.locks.mu.RUnlock()
+
+	t.tryGCLocks(&t.locks, locksToGC)
+	return heldByTxn
+}
+
+// updateLocksInTree applies the supplied update to the locks in the update's
+// span, using the supplied iterator over the lock table's tree. It returns
+// whether there was a lock held by the update's txn, and appends the locks that
+// became empty, and should be GC-ed, to locksToGC.
+//
+// REQUIRES: the tree's mu is locked (for reading, at least).
+func updateLocksInTree(
+	iter *iterator, up *roachpb.LockUpdate, locksToGC []*keyLocks,
+) (heldByTxn bool, _ []*keyLocks) {
+	span := up.Span
+	ltRange := &keyLocks{key: span.Key, endKey: span.EndKey}
+	for iter.FirstOverlap(ltRange); iter.Valid(); iter.NextOverlap(ltRange) {
+		held, gc := iter.Cur().tryUpdateLock(up)
+		heldByTxn = heldByTxn || held
+		if gc {
+			locksToGC = append(locksToGC, iter.Cur())
+		}
+		// Optimization to avoid a second key comparison (not for correctness).
+		if len(span.EndKey) == 0 {
+			break
+		}
+	}
+	return heldByTxn, locksToGC
+}
+
+// Iteration helper for resumeScan. Returns the next span to search over, or nil
 // if the iteration is done.
 //
 // REQUIRES: g.mu is locked.
 func stepToNextSpan(g *lockTableGuardImpl) *roachpb.Span {
 	g.index++
-	for ; g.str >= 0; g.str-- {
+	nonEmpty := g.spans.NonEmptyStrengths()
+	for g.str >= 0 {
+		// Skip directly to the strongest strength at or below g.str that has
+		// spans, instead of visiting every empty strength in between.
+		remaining := nonEmpty & (1<<(g.str+1) - 1)
+		if remaining == 0 {
+			break
+		}
+		g.str = lock.Strength(bits.Len32(remaining) - 1)
 		spans := g.spans.GetSpans(g.str)
 		if g.index < len(spans) {
 			span := &spans[g.index]
@@ -4100,6 +6457,7 @@ func stepToNextSpan(g *lockTableGuardImpl) *roachpb.Span {
 			return span
 		}
 		g.index = 0
+		g.str--
 	}
 	g.str = lock.MaxStrength
 	return nil
@@ -4112,14 +6470,145 @@ func (t *lockTableImpl) batchPushedLockResolution() bool {
 	return BatchPushedLockResolution.Get(&t.settings.SV)
 }
 
+// resolvePushedLocksInline returns whether non-locking readers should resolve
+// replicated locks held by pushed transactions as soon as they encounter them,
+// instead of deferring their resolution to the end of their scan.
+func (t *lockTableImpl) resolvePushedLocksInline() bool {
+	return ResolvePushedLocksInline.Get(&t.settings.SV)
+}
+
+// consolidateAdjacentLockResolution returns whether requests should consolidate
+// the resolution of contiguous runs of replicated locks held by the same
+// finalized transaction into ranged lock updates.
+func (t *lockTableImpl) consolidateAdjacentLockResolution() bool {
+	return ConsolidateAdjacentLockResolution.Get(&t.settings.SV)
+}
+
+// distinguishedWaitersEnabled returns whether a distinguished waiter should be
+// designated for each lock with waiters.
+func (t *lockTableImpl) distinguishedWaitersEnabled() bool {
+	return DistinguishedWaitersEnabled.Get(&t.settings.SV)
+}
+
+// clearedLockWaitersDoneWaiting returns whether the waiters of locks cleared
+// from the lockTable should be told that they are done waiting, even if a
+// replicated lock is held.
+func (t *lockTableImpl) clearedLockWaitersDoneWaiting() bool {
+	return ClearedLockWaitersDoneWaiting.Get(&t.settings.SV)
+}
+
+// sameTxnScanDonation returns whether requests released by their own
+// transaction's lock acquisition should be handed a donor's lock spans.
+func (t *lockTableImpl) sameTxnScanDonation() bool {
+	return SameTxnScanDonation.Get(&t.settings.SV)
+}
+
+// eagerQueueing returns whether locking requests that start waiting should
+// eagerly enter the wait-queues of the remaining locks in their locking spans.
+func (t *lockTableImpl) eagerQueueing() bool {
+	return EagerQueueing.Get(&t.settings.SV)
+}
+
+// priorityOrderedWaitQueues returns whether lock wait-queues should order
+// locking requests by transaction priority before sequence number.
+func (t *lockTableImpl) priorityOrderedWaitQueues() bool {
+	return PriorityOrderedWaitQueues.Get(&t.settings.SV)
+}
+
+// trackOpsWhileDisabled returns whether operations received while the lockTable
+// is disabled should be counted and logged.
+func (t *lockTableImpl) trackOpsWhileDisabled() bool {
+	return TrackOperationsWhileDisabled.Get(&t.settings.SV)
+}
+
+// maybeTrackOpWhileDisabled counts an operation received while the lockTable
+// is disabled, and logs it if it is one of the first few of its type, if
+// TrackOperationsWhileDisabled is set.
+func (t *lockTableImpl) maybeTrackOpWhileDisabled(
+	op disabledOp, key roachpb.Key, txn *enginepb.TxnMeta,
+) {
+	if !t.trackOpsWhileDisabled() {
+		return
+	}
+	if n := t.counters.opsWhileDisabled[op].Add(1); n <= maxLoggedOpsWhileDisabled {
+		log.Warningf(context.Background(),
+			"r%d: lock table received %s for key %s by txn %s while disabled (%d/%d logged)",
+			t.rID, redact.SafeString(op.String()), key, txn.Short(), n, maxLoggedOpsWhileDisabled)
+	}
+}
+
+// maybeDetectRediscoveryLoop records the discovery of the supplied lock and
+// reports a lock rediscovery loop if the lock has been discovered too many
+// times recently. See LockRediscoveryLoopThreshold.
+func (t *lockTableImpl) maybeDetectRediscoveryLoop(foundLock *roachpb.Lock) {
+	threshold := LockRediscoveryLoopThreshold.Get(&t.settings.SV)
+	if threshold == 0 {
+		return
+	}
+	count, loop := t.rediscoveries.record(
+		foundLock.Key, foundLock.Txn.ID, t.clock.PhysicalTime(), threshold)
+	if !loop {
+		return
+	}
+	t.counters.rediscoveryLoopsDetected.Add(1)
+	log.Errorf(context.Background(),
+		"r%d: lock rediscovery loop detected: lock on key %s held by txn %s with strength %s at "+
+			"ts %s discovered %d times within %s, above the threshold of %d; the lock table may "+
+			"have diverged from the replicated keyspace",
+		t.rID, foundLock.Key, foundLock.Txn.Short(), foundLock.Strength,
+		foundLock.Txn.WriteTimestamp, count, lockRediscoveryLoopWindow, threshold)
+}
+
 // PushedTransactionUpdated implements the lockTable interface.
 func (t *lockTableImpl) PushedTransactionUpdated(txn *roachpb.Transaction) {
-	// TODO(sumeer): We don't take any action for requests that are already
-	// waiting on locks held by txn. They need to take some action, like
-	// pushing, and resume their scan, to notice the change to this txn. We
-	// could be more proactive if we knew which locks in lockTableImpl were held
-	// by txn.
+	// TODO(sumeer): Unless the txn is finalized and ReleaseLocksOfFinalizedTxns
+	// is set, we don't take any action for requests that are already waiting on
+	// locks held by txn. They need to take some action, like pushing, and resume
+	// their scan, to notice the change to this txn.
 	t.txnStatusCache.add(txn)
+	if txn.Status.IsFinalized() && ReleaseLocksOfFinalizedTxns.Get(&t.settings.SV) {
+		t.releaseLocksOfFinalizedTxn(txn)
+	}
+}
+
+// releaseLocksOfFinalizedTxn releases the locks held by the supplied finalized
+// transaction on the keys indexed by heldLocks, which releases the requests
+// waiting on them without waiting for the requests to notice that the
+// transaction is finalized.
+//
+// Replicated locks are released ahead of their resolution, just like a request
+// that finds a lock held by a finalized transaction when scanning the lock
+// table releases it ahead of resolving it (see lockTableGuardImpl.toResolve).
+// A request that runs into the replicated lock during evaluation discovers it,
+// finds the transaction in the txnStatusCache, and resolves the lock instead of
+// adding it back to the lockTable.
+func (t *lockTableImpl) releaseLocksOfFinalizedTxn(txn *roachpb.Transaction) {
+	keys := t.heldLocks.indexedKeys(txn.ID)
+	if len(keys) == 0 {
+		return
+	}
+	var locksToGC []*keyLocks
+	t.locks.mu.RLock()
+	for _, kl := range keys {
+		up := roachpb.MakeLockUpdate(txn, roachpb.Span{Key: kl.key})
+		if _, gc := kl.tryUpdateLock(&up); gc {
+			locksToGC = append(locksToGC, kl)
+		}
+	}
+	t.locks.mu.RUnlock()
+	t.tryGCLocks(&t.locks, locksToGC)
+}
+
+// PushedTransactionsUpdated implements the lockTable interface.
+func (t *lockTableImpl) PushedTransactionsUpdated(txns []*roachpb.Transaction) {
+	t.txnStatusCache.addBatch(txns)
+	if ReleaseLocksOfFinalizedTxns.Get(&t.settings.SV) {
+		for _, txn := range txns {
+			if txn.Status.IsFinalized() {
+				t.releaseLocksOfFinalizedTxn(txn)
+			}
+		}
+	}
 }
 
 // Enable implements the lockTable interface.
@@ -4151,72 +6640,401 @@ func (t *lockTableImpl) Clear(disable bool) {
 	// The numToClear=0 is arbitrary since it is unused when force=true.
 	t.tryClearLocks(true /* force */, 0)
 	// Also clear the txn status cache, since it won't be needed any time
-	// soon and consumes memory.
-	t.txnStatusCache.clear()
+	// soon and consumes memory. A cache shared with other Ranges is still
+	// needed by them, so it's left alone.
+	if !t.sharedTxnStatusCache {
+		t.txnStatusCache.clear()
+	}
+}
+
+// transferredLock is a key's lock holders, detached from a lockTable by
+// SplitAt.
+type transferredLock struct {
+	key     roachpb.Key
+	holders []*txnLock
+}
+
+// SplitAt implements the lockTable interface.
+func (t *lockTableImpl) SplitAt(key roachpb.RKey) TransferredLocks {
+	// Lock the entire table to prevent concurrent lock acquisitions from adding
+	// state to the detached keys while they are being removed.
+	t.enabledMu.Lock()
+	defer t.enabledMu.Unlock()
+	if !t.enabled {
+		return TransferredLocks{}
+	}
+	t.locks.mu.Lock()
+	defer t.locks.mu.Unlock()
+
+	// NB: locks on range-local keys sort before all global keys, but belong to
+	// the range containing their address, so every lock is considered, and the
+	// locks are partitioned by address rather than by key.
+	var detached []*keyLocks
+	var transferred TransferredLocks
+	iter := t.locks.MakeIter()
+	for iter.First(); iter.Valid(); iter.Next() {
+		l := iter.Cur()
+		addr, err := keys.Addr(l.key)
+		if err == nil && addr.Less(key) {
+			continue
+		}
+		detached = append(detached, l)
+		if err != nil {
+			// The lock can't be attributed to either side of the split, so it's
+			// dropped. It's rediscovered if it's still held.
+			continue
+		}
+		if holders := l.lockHolders(); len(holders) > 0 {
+			transferred.locks = append(transferred.locks, transferredLock{key: l.key, holders: holders})
+		}
+	}
+	for _, l := range detached {
+		// The locks are tracked by the receiving lockTable from here on, so
+		// waiters are released rather than told to wait elsewhere.
+		l.tryClearLock(true /* force */, true /* doneWaiting */)
+		t.locks.Delete(l)
+		t.locks.estimatedBytes.Add(-l.baseEstimatedBytes())
+	}
+	t.locks.numKeysLocked.Add(int64(-len(detached)))
+	return transferred
+}
+
+// Merge implements the lockTable interface.
+func (t *lockTableImpl) Merge(transferred TransferredLocks) {
+	t.enabledMu.RLock()
+	defer t.enabledMu.RUnlock()
+	if !t.enabled {
+		// If not enabled, don't track any locks.
+		return
+	}
+	checkMaxLocks := false
+	t.locks.mu.Lock()
+	for _, tl := range transferred.locks {
+		iter := t.locks.MakeIter()
+		iter.FirstOverlap(&keyLocks{key: tl.key})
+		if iter.Valid() {
+			iter.Cur().mergeTransferredHolders(tl.holders)
+			continue
+		}
+		lockSeqNum, check := t.locks.nextLockSeqNum()
+		checkMaxLocks = checkMaxLocks || check
+		l := &keyLocks{
+			id:             lockSeqNum,
+			key:            tl.key,
+			heldLocks:      &t.heldLocks,
+			estimatedBytes: &t.locks.estimatedBytes,
+		}
+		l.queuedLockingRequests.Init()
+		l.waitingReaders.Init()
+		l.holders.Init()
+		l.heldBy = make(map[uuid.UUID]*list.Element[*txnLock])
+		for _, holder := range tl.holders {
+			l.lockAcquiredOrDiscovered(holder)
+		}
+		t.locks.Set(l)
+		t.locks.numKeysLocked.Add(1)
+		t.locks.estimatedBytes.Add(l.baseEstimatedBytes())
+	}
+	t.locks.mu.Unlock()
+
+	if checkMaxLocks {
+		t.checkMaxKeysLockedAndTryClear()
+	}
 }
 
 // QueryLockTableState implements the lockTable interface.
+//
+// Locks are returned in key order. When the results are limited, the resume
+// span starts immediately after the last returned key rather than at the key
+// of the first lock that was not returned. The lock table is iterated over a
+// snapshot, so locks may be acquired or released between pages; resuming after
+// the last returned key ensures that a client paging through the lock table
+// never sees the same key twice and never skips over a key that was locked in
+// between the last returned key and the next page.
+//
+// If opts.IncludeReplicatedUncontended is set, the replicated locks found in
+// the span by scanning opts.Reader are merged into the results. At keys that
+// are also tracked by the lock table, the replicated locks are returned in
+// place of the in-memory state. The scan of the replicated lock table keyspace
+// is advanced alongside the in-memory snapshot and stops as soon as the limits
+// are reached, so each page only reads up to its own resume key.
 func (t *lockTableImpl) QueryLockTableState(
-	span roachpb.Span, opts QueryLockTableOptions,
-) ([]roachpb.LockStateInfo, QueryLockTableResumeState) {
+	ctx context.Context, span roachpb.Span, opts QueryLockTableOptions,
+) ([]roachpb.LockStateInfo, QueryLockTableResumeState, error) {
+	if opts.IncludeReplicatedUncontended && opts.Reader == nil {
+		return nil, QueryLockTableResumeState{}, errors.AssertionFailedf(
+			"a reader is required to include replicated uncontended locks")
+	}
+
+	// Grab tree snapshot to avoid holding read locks during iteration. The HLC
+	// timestamp is read while the read lock is held, so that the snapshot
+	// reflects the lock table's state as of that timestamp.
 	t.enabledMu.RLock()
-	defer t.enabledMu.RUnlock()
 	if !t.enabled {
+		t.enabledMu.RUnlock()
 		// If not enabled, don't return any locks from the query.
-		return []roachpb.LockStateInfo{}, QueryLockTableResumeState{}
+		return []roachpb.LockStateInfo{}, QueryLockTableResumeState{}, nil
 	}
-
-	// Grab tree snapshot to avoid holding read lock during iteration.
 	t.locks.mu.RLock()
 	snap := t.locks.Clone()
+	snapTS := t.clock.Now()
 	t.locks.mu.RUnlock()
+	t.enabledMu.RUnlock()
 	// Reset snapshot to free resources.
 	defer snap.Reset()
 
+	var repl replicatedLockScanner
+	defer repl.close()
+	if opts.IncludeReplicatedUncontended {
+		if err := repl.init(ctx, opts.Reader, span, opts.TxnID); err != nil {
+			return nil, QueryLockTableResumeState{}, err
+		}
+	}
+
 	now := t.clock.PhysicalTime()
 
 	lockTableState := make([]roachpb.LockStateInfo, 0, snap.Len())
-	resumeState := QueryLockTableResumeState{}
+	resumeState := QueryLockTableResumeState{Timestamp: snapTS}
 	var numLocks int64
 	var numBytes int64
-	var nextKey roachpb.Key
+	var lastKey roachpb.Key
 	var nextByteSize int64
 
+	// addLock adds the lock to the results, returning false instead if doing so
+	// would exceed our byte or count limits.
+	addLock := func(lInfo roachpb.LockStateInfo) bool {
+		nextByteSize = int64(lInfo.Size())
+		lInfo.RangeID = t.rID
+
+		// Check if adding the lock would exceed our byte or count limits,
+		// though we must ensure we return at least one lock.
+		if len(lockTableState) > 0 && opts.TargetBytes > 0 && (numBytes+nextByteSize) > opts.TargetBytes {
+			resumeState.ResumeReason = kvpb.RESUME_BYTE_LIMIT
+			return false
+		} else if len(lockTableState) > 0 && opts.MaxLocks > 0 && numLocks >= opts.MaxLocks {
+			resumeState.ResumeReason = kvpb.RESUME_KEY_LIMIT
+			return false
+		}
+
+		lockTableState = append(lockTableState, lInfo)
+		lastKey = lInfo.Key
+		numLocks++
+		numBytes += nextByteSize
+		return true
+	}
+	// addReplicatedLock adds the replicated locks at the scanner's current key
+	// to the results and advances the scanner, returning false instead if doing
+	// so would exceed our byte or count limits.
+	addReplicatedLock := func() (bool, error) {
+		if !addLock(repl.cur) {
+			return false, nil
+		}
+		return true, repl.next(ctx)
+	}
+
 	// Iterate over locks and gather metadata.
 	iter := snap.MakeIter()
 	ltRange := &keyLocks{key: span.Key, endKey: span.EndKey}
-	for iter.FirstOverlap(ltRange); iter.Valid(); iter.NextOverlap(ltRange) {
+	added := true
+	for iter.FirstOverlap(ltRange); added && iter.Valid(); iter.NextOverlap(ltRange) {
 		l := iter.Cur()
 
-		if ok, lInfo := l.collectLockStateInfo(opts.IncludeUncontended, now); ok {
-			nextKey = l.key
-			nextByteSize = int64(lInfo.Size())
-			lInfo.RangeID = t.rID
+		// Add the replicated locks found in storage at keys before this one.
+		var err error
+		for added && repl.valid && repl.cur.Key.Compare(l.key) < 0 {
+			if added, err = addReplicatedLock(); err != nil {
+				return nil, QueryLockTableResumeState{}, err
+			}
+		}
+		if !added {
+			break
+		}
 
-			// Check if adding the lock would exceed our byte or count limits,
-			// though we must ensure we return at least one lock.
-			if len(lockTableState) > 0 && opts.TargetBytes > 0 && (numBytes+nextByteSize) > opts.TargetBytes {
-				resumeState.ResumeReason = kvpb.RESUME_BYTE_LIMIT
-				break
-			} else if len(lockTableState) > 0 && opts.MaxLocks > 0 && numLocks >= opts.MaxLocks {
-				resumeState.ResumeReason = kvpb.RESUME_KEY_LIMIT
-				break
+		// The replicated locks at this key, if any, supersede its in-memory
+		// state.
+		if repl.valid && repl.cur.Key.Equal(l.key) {
+			if added, err = addReplicatedLock(); err != nil {
+				return nil, QueryLockTableResumeState{}, err
 			}
+			continue
+		}
 
-			lockTableState = append(lockTableState, lInfo)
-			numLocks++
-			numBytes += nextByteSize
+		if ok, lInfo := l.collectLockStateInfo(opts.IncludeUncontended, opts.TxnID, now); ok {
+			added = addLock(lInfo)
+		}
+	}
+	for added && repl.valid {
+		var err error
+		if added, err = addReplicatedLock(); err != nil {
+			return nil, QueryLockTableResumeState{}, err
 		}
 	}
 
 	// If we need to paginate results, set the continuation key in the ResumeSpan.
+	// The ResumeSpan is exclusive of the last returned key. At least one lock is
+	// always returned before pagination, so lastKey is set.
 	if resumeState.ResumeReason != 0 {
 		resumeState.ResumeNextBytes = nextByteSize
-		resumeState.ResumeSpan = &roachpb.Span{Key: nextKey, EndKey: span.EndKey}
+		resumeState.ResumeSpan = &roachpb.Span{Key: lastKey.Next(), EndKey: span.EndKey}
 	}
 	resumeState.TotalBytes = numBytes
 
-	return lockTableState, resumeState
+	return lockTableState, resumeState, nil
+}
+
+// replicatedLockScanner scans the replicated lock table keyspace overlapping a
+// span, one locked key at a time and in key order. The scan is lazy: the
+// storage iterator is only advanced when the caller asks for the next key, so a
+// caller that stops early doesn't pay for the rest of the span.
+type replicatedLockScanner struct {
+	iter  *storage.LockTableIterator
+	txnID uuid.UUID
+	// iterValid is true if the iterator is positioned at a lock that has not
+	// yet been consumed.
+	iterValid bool
+	// valid is true if cur holds the state of the replicated locks at the
+	// scanner's current key.
+	valid bool
+	cur   roachpb.LockStateInfo
+	locks []roachpb.Lock
+	meta  enginepb.MVCCMetadata
+}
+
+// init opens the scanner over the span using the reader and positions it at
+// the first locked key. If txnID is set, only the keys locked by the
+// transaction with this ID are returned.
+func (s *replicatedLockScanner) init(
+	ctx context.Context, reader storage.Reader, span roachpb.Span, txnID uuid.UUID,
+) error {
+	endKey := span.EndKey
+	if len(endKey) == 0 {
+		endKey = span.Key.Next()
+	}
+	ltStart, _ := keys.LockTableSingleKey(span.Key, nil)
+	ltEnd, _ := keys.LockTableSingleKey(endKey, nil)
+	iter, err := storage.NewLockTableIterator(reader, storage.LockTableIteratorOptions{
+		LowerBound:  ltStart,
+		UpperBound:  ltEnd,
+		MatchMinStr: lock.Shared, // all locks
+	})
+	if err != nil {
+		return err
+	}
+	s.iter = iter
+	s.txnID = txnID
+	if s.iterValid, err = iter.SeekEngineKeyGE(storage.EngineKey{Key: ltStart}); err != nil {
+		return err
+	}
+	return s.next(ctx)
+}
+
+// next advances the scanner to the next locked key, setting valid to false if
+// there is none.
+func (s *replicatedLockScanner) next(ctx context.Context) error {
+	s.valid = false
+	for s.iterValid {
+		s.locks = s.locks[:0]
+		for s.iterValid {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			l, err := s.unsafeLock()
+			if err != nil {
+				return err
+			}
+			if len(s.locks) > 0 && !l.Key.Equal(s.locks[0].Key) {
+				break
+			}
+			s.locks = append(s.locks, roachpb.MakeLock(s.meta.Txn, l.Key.Clone(), l.Strength))
+			if s.iterValid, err = s.iter.NextEngineKey(); err != nil {
+				return err
+			}
+		}
+		if ok, lInfo := makeReplicatedLockStateInfo(s.locks, s.txnID); ok {
+			s.cur = lInfo
+			s.valid = true
+			return nil
+		}
+	}
+	return nil
+}
+
+// unsafeLock decodes the lock that the iterator is positioned at. The key of
+// the returned lock is only valid until the iterator is moved, and its txn
+// meta is stored in s.meta.
+func (s *replicatedLockScanner) unsafeLock() (storage.LockTableKey, error) {
+	key, err := s.iter.UnsafeEngineKey()
+	if err != nil {
+		return storage.LockTableKey{}, err
+	}
+	ltKey, err := key.ToLockTableKey()
+	if err != nil {
+		return storage.LockTableKey{}, err
+	}
+	v, err := s.iter.UnsafeValue()
+	if err != nil {
+		return storage.LockTableKey{}, err
+	}
+	if err := protoutil.Unmarshal(v, &s.meta); err != nil {
+		return storage.LockTableKey{}, err
+	}
+	return ltKey, nil
+}
+
+// close releases the scanner's iterator, if it was opened.
+func (s *replicatedLockScanner) close() {
+	if s.iter != nil {
+		s.iter.Close()
+		s.iter = nil
+	}
+}
+
+// makeReplicatedLockStateInfo returns the state of the provided replicated
+// locks, which are all held on the same key. Each transaction holding the key
+// is reported once, with the strongest strength it holds the key with. The hold
+// duration of replicated locks is not known, so it is left unset. Returns false
+// if txnID is set and the transaction with this ID doesn't hold any of the
+// locks.
+func makeReplicatedLockStateInfo(
+	locks []roachpb.Lock, txnID uuid.UUID,
+) (bool, roachpb.LockStateInfo) {
+	holders := make([]roachpb.LockHolderInfo, 0, len(locks))
+	lockedByTxn := txnID == uuid.Nil
+	for i := range locks {
+		l := &locks[i]
+		lockedByTxn = lockedByTxn || l.Txn.ID == txnID
+		found := false
+		for j := range holders {
+			if holders[j].Txn.ID == l.Txn.ID {
+				if holders[j].Strength < l.Strength {
+					holders[j].Txn = l.Txn
+					holders[j].Strength = l.Strength
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			holders = append(holders, roachpb.LockHolderInfo{
+				Txn:        l.Txn,
+				Durability: lock.Replicated,
+				Strength:   l.Strength,
+			})
+		}
+	}
+	if !lockedByTxn {
+		return false, roachpb.LockStateInfo{}
+	}
+	lInfo := roachpb.LockStateInfo{
+		Key:        locks[0].Key,
+		LockHolder: &holders[0].Txn,
+		Durability: lock.Replicated,
+		Strength:   holders[0].Strength,
+	}
+	if len(holders) > 1 {
+		lInfo.AdditionalHolders = holders[1:]
+	}
+	return true, lInfo
 }
 
 // Metrics implements the lockTable interface.
@@ -4235,9 +7053,250 @@ func (t *lockTableImpl) Metrics() LockTableMetrics {
 	for iter.First(); iter.Valid(); iter.Next() {
 		iter.Cur().addToMetrics(&m, now)
 	}
+	m.EstimatedBytes = t.locks.estimatedBytes.Load()
+	m.MaxLocksPerTxnRejections = t.counters.maxLocksPerTxnRejections.Load()
+	m.AcquisitionsThrottled = t.counters.acquisitionsThrottled.Load()
+	m.WaitPolicyErrorRejections = t.counters.waitPolicyErrorRejections.Load()
+	m.WaiterPushes = t.counters.waiterPushes.Load()
+	m.EpochRegressionAcquisitions = t.counters.epochRegressionAcquisitions.Load()
+	m.OptimisticEvals = t.counters.optimisticEvals.Load()
+	m.OptimisticEvalFallbacks = t.counters.optimisticEvalFallbacks.Load()
+	m.OptimisticGuards = t.optimisticGuards.Load()
+	m.LocksGCed = t.counters.locksGCed.Load()
+	m.LocksClearedOnMemoryPressure = t.counters.locksClearedOnMemoryPressure.Load()
+	m.WaitersToldToWaitElsewhere = t.counters.waitersToldToWaitElsewhere.Load()
+	m.LocksFreedOnReplicatedAcquire = t.counters.locksFreedOnReplicatedAcquire.Load()
+	m.ReadersReleasedOnReplicatedAcquire = t.counters.readersReleasedOnReplicatedAcquire.Load()
+	m.PushedLocksResolvedInline = t.counters.pushedLocksResolvedInline.Load()
+	m.PushedLocksResolvedDeferred = t.counters.pushedLocksResolvedDeferred.Load()
+	m.ResolutionsDeduped = t.counters.resolutionsDeduped.Load()
+	m.ResolutionsPassedThrough = t.counters.resolutionsPassedThrough.Load()
+	m.DiscoveredLocksOfFinalizedTxns = t.counters.discoveredLocksOfFinalizedTxns.Load()
+	m.DiscoveredLocksRejected = t.counters.discoveredLocksRejected.Load()
+	m.HeldLockFastPathHits = t.counters.heldLockFastPathHits.Load()
+	m.RediscoveryLoopsDetected = t.counters.rediscoveryLoopsDetected.Load()
+	m.AcquisitionsWhileDisabled = t.counters.opsWhileDisabled[disabledOpAcquireLock].Load()
+	m.DiscoveredLocksWhileDisabled = t.counters.opsWhileDisabled[disabledOpAddDiscoveredLock].Load()
+	m.UpdatesWhileDisabled = t.counters.opsWhileDisabled[disabledOpUpdateLocks].Load()
 	return m
 }
 
+// ClaimantChangeEvents implements the lockTable interface.
+func (t *lockTableImpl) ClaimantChangeEvents() []ClaimantChangeEvent {
+	return t.claimantChanges.snapshot()
+}
+
+// ContentionByKeyRange implements the lockTable interface.
+func (t *lockTableImpl) ContentionByKeyRange(numBuckets int) LockContentionByKeyRange {
+	// Grab tree snapshot to avoid holding read lock during iteration.
+	t.locks.mu.RLock()
+	snap := t.locks.Clone()
+	t.locks.mu.RUnlock()
+	// Reset snapshot to free resources.
+	defer snap.Reset()
+
+	now := t.clock.PhysicalTime()
+	var local, global []LockMetrics
+	iter := snap.MakeIter()
+	for iter.First(); iter.Valid(); iter.Next() {
+		kl := iter.Cur()
+		kl.mu.Lock()
+		if !kl.isEmptyLock() {
+			if lm := kl.lockMetrics(now); keys.IsLocal(kl.key) {
+				local = append(local, lm)
+			} else {
+				global = append(global, lm)
+			}
+		}
+		kl.mu.Unlock()
+	}
+	return LockContentionByKeyRange{
+		Local:  bucketLockMetrics(local, numBuckets),
+		Global: bucketLockMetrics(global, numBuckets),
+	}
+}
+
+// TopKeysByMemory implements the lockTable interface.
+func (t *lockTableImpl) TopKeysByMemory(n int) []LockMemoryEstimate {
+	if n > MaxTopKeysByMemory {
+		n = MaxTopKeysByMemory
+	}
+	if n <= 0 {
+		return nil
+	}
+	// Grab tree snapshot to avoid holding read lock during iteration.
+	t.locks.mu.RLock()
+	snap := t.locks.Clone()
+	t.locks.mu.RUnlock()
+	// Reset snapshot to free resources.
+	defer snap.Reset()
+
+	topN := make([]LockMemoryEstimate, 0, n)
+	iter := snap.MakeIter()
+	for iter.First(); iter.Valid(); iter.Next() {
+		kl := iter.Cur()
+		kl.mu.Lock()
+		if !kl.isEmptyLock() {
+			topN = addToTopKeysByMemory(topN, kl.memoryEstimate(), n)
+		}
+		kl.mu.Unlock()
+	}
+	return topN
+}
+
+// TopTxnsByContention implements the lockTable interface.
+func (t *lockTableImpl) TopTxnsByContention(n int) []TxnContention {
+	if n > MaxTopTxnsByContention {
+		n = MaxTopTxnsByContention
+	}
+	if n <= 0 {
+		return nil
+	}
+	// Grab tree snapshot to avoid holding read lock during iteration.
+	t.locks.mu.RLock()
+	snap := t.locks.Clone()
+	t.locks.mu.RUnlock()
+	// Reset snapshot to free resources.
+	defer snap.Reset()
+
+	now := t.clock.PhysicalTime()
+	var res []TxnContention
+	idxByTxn := make(map[uuid.UUID]int)
+	iter := snap.MakeIter()
+	for iter.First(); iter.Valid(); iter.Next() {
+		kl := iter.Cur()
+		kl.mu.Lock()
+		c, ok := kl.contention(now)
+		kl.mu.Unlock()
+		if !ok {
+			continue
+		}
+		i, ok := idxByTxn[c.TxnID]
+		if !ok {
+			idxByTxn[c.TxnID] = len(res)
+			res = append(res, c)
+			continue
+		}
+		res[i].Locks += c.Locks
+		res[i].Waiters += c.Waiters
+		res[i].WaitDurationNanos += c.WaitDurationNanos
+	}
+	// Transactions causing the same amount of waiting retain the order of the
+	// first key they were encountered at.
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].WaitDurationNanos > res[j].WaitDurationNanos
+	})
+	if len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+// HotKeys implements the lockTable interface.
+func (t *lockTableImpl) HotKeys(n int) []roachpb.LockStateInfo {
+	if n > MaxHotKeys {
+		n = MaxHotKeys
+	}
+	if n <= 0 {
+		return nil
+	}
+	// Grab tree snapshot to avoid holding read lock during iteration.
+	t.locks.mu.RLock()
+	snap := t.locks.Clone()
+	t.locks.mu.RUnlock()
+	// Reset snapshot to free resources.
+	defer snap.Reset()
+
+	type hotKey struct {
+		info         roachpb.LockStateInfo
+		waiters      int
+		waitDuration time.Duration
+	}
+	now := t.clock.PhysicalTime()
+	var hot []hotKey
+	iter := snap.MakeIter()
+	for iter.First(); iter.Valid(); iter.Next() {
+		kl := iter.Cur()
+		kl.mu.Lock()
+		if waiters := kl.numActiveWaiters(); waiters > 0 {
+			waitDuration, _ := kl.totalAndMaxWaitDuration(now)
+			info := kl.lockStateInfo(now)
+			info.RangeID = t.rID
+			hot = append(hot, hotKey{info: info, waiters: waiters, waitDuration: waitDuration})
+		}
+		kl.mu.Unlock()
+	}
+	// Keys that are equally hot retain their key order.
+	sort.SliceStable(hot, func(i, j int) bool {
+		if hot[i].waiters != hot[j].waiters {
+			return hot[i].waiters > hot[j].waiters
+		}
+		return hot[i].waitDuration > hot[j].waitDuration
+	})
+	if len(hot) > n {
+		hot = hot[:n]
+	}
+	res := make([]roachpb.LockStateInfo, len(hot))
+	for i := range hot {
+		res[i] = hot[i].info
+	}
+	return res
+}
+
+// LongHeldLock is a lock that has been held for longer than a threshold, along
+// with the transaction holding it. See lockTable.PushLongHeldLocks.
+type LongHeldLock struct {
+	// Key is the key the lock is held on.
+	Key roachpb.Key
+	// Txn is the transaction holding the lock, which the caller should push.
+	Txn *enginepb.TxnMeta
+	// HeldDuration is the duration for which the lock has been held.
+	HeldDuration time.Duration
+}
+
+// PushLongHeldLocks implements the lockTable interface.
+func (t *lockTableImpl) PushLongHeldLocks(threshold time.Duration) []LongHeldLock {
+	// Grab tree snapshot to avoid holding read lock during iteration.
+	t.locks.mu.RLock()
+	snap := t.locks.Clone()
+	t.locks.mu.RUnlock()
+	// Reset snapshot to free resources.
+	defer snap.Reset()
+
+	now := t.clock.PhysicalTime()
+	var res []LongHeldLock
+	iter := snap.MakeIter()
+	for iter.First(); iter.Valid(); iter.Next() {
+		kl := iter.Cur()
+		kl.mu.Lock()
+		res = kl.appendLongHeldLocks(res, now, threshold, t.txnStatusCache)
+		kl.mu.Unlock()
+	}
+	return res
+}
+
+// QueueHeadCompatibility implements the lockTable interface.
+func (t *lockTableImpl) QueueHeadCompatibility() []LockQueueHeadCompatibility {
+	// Grab tree snapshot to avoid holding read lock during iteration.
+	t.locks.mu.RLock()
+	snap := t.locks.Clone()
+	t.locks.mu.RUnlock()
+	// Reset snapshot to free resources.
+	defer snap.Reset()
+
+	var res []LockQueueHeadCompatibility
+	iter := snap.MakeIter()
+	for iter.First(); iter.Valid(); iter.Next() {
+		kl := iter.Cur()
+		kl.mu.Lock()
+		if c, ok := kl.queueHeadCompatibility(t.settings); ok {
+			res = append(res, c)
+		}
+		kl.mu.Unlock()
+	}
+	return res
+}
+
 // String implements the lockTable interface.
 func (t *lockTableImpl) String() string {
 	var sb redact.StringBuilder
@@ -4247,13 +7306,133 @@ func (t *lockTableImpl) String() string {
 	for iter.First(); iter.Valid(); iter.Next() {
 		l := iter.Cur()
 		l.mu.Lock()
-		l.safeFormat(&sb, &t.txnStatusCache)
+		l.safeFormat(&sb, t.txnStatusCache)
 		l.mu.Unlock()
 	}
 	t.locks.mu.RUnlock()
 	return sb.String()
 }
 
+// RecordWaiterPush implements the lockTable interface.
+func (t *lockTableImpl) RecordWaiterPush() {
+	t.counters.waiterPushes.Add(1)
+}
+
+// RecordWaitPolicyErrorRejection implements the lockTable interface.
+func (t *lockTableImpl) RecordWaitPolicyErrorRejection() {
+	t.counters.waitPolicyErrorRejections.Add(1)
+}
+
+// DescribeKey implements the lockTable interface.
+func (t *lockTableImpl) DescribeKey(key roachpb.Key) (string, bool) {
+	t.locks.mu.RLock()
+	defer t.locks.mu.RUnlock()
+	iter := t.locks.MakeIter()
+	iter.FirstOverlap(&keyLocks{key: key})
+	if !iter.Valid() {
+		return "", false
+	}
+	l := iter.Cur()
+	var sb redact.StringBuilder
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.isEmptyLock() {
+		return "", false
+	}
+	l.safeFormat(&sb, t.txnStatusCache)
+	if len(l.notRemovable) > 0 {
+		sb.SafeString("   not removable, pinned by req: ")
+		for i, seqNum := range l.notRemovable {
+			if i > 0 {
+				sb.SafeString(", ")
+			}
+			sb.Printf("%d", seqNum)
+		}
+		sb.SafeString("\n")
+	}
+	return sb.String(), true
+}
+
+// ExplainConflict implements the lockTable interface.
+//
+// A request is blocked by the lock holders it conflicts with. It also queues
+// behind the conflicting locking requests in the key's wait-queue, though
+// whether it waits on them depends on its position in the queue. Note that
+// the conflicts are evaluated regardless of transactions; a lock held by the
+// request's own transaction does not in fact block it.
+func (t *lockTableImpl) ExplainConflict(key roachpb.Key, mode lock.Mode) string {
+	var sb redact.StringBuilder
+	sb.Printf("%s on %s:\n", redact.Safe(explainLockMode(mode)), key)
+	t.locks.mu.RLock()
+	defer t.locks.mu.RUnlock()
+	iter := t.locks.MakeIter()
+	iter.FirstOverlap(&keyLocks{key: key})
+	if !iter.Valid() {
+		sb.SafeString(" no locks or wait-queues\n")
+		return sb.String()
+	}
+	kl := iter.Cur()
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if kl.isEmptyLock() {
+		sb.SafeString(" no locks or wait-queues\n")
+		return sb.String()
+	}
+	explain := func(other lock.Mode) redact.SafeString {
+		if lock.Conflicts(mode, other, &t.settings.SV) {
+			return "conflicts"
+		}
+		return "compatible"
+	}
+	var holderConflicts, queuedConflicts int
+	for e := kl.holders.Front(); e != nil; e = e.Next() {
+		tl := e.Value
+		m := tl.getLockMode()
+		res := explain(m)
+		if res == "conflicts" {
+			holderConflicts++
+		}
+		sb.Printf(" holder: txn %s with %s: %s\n",
+			tl.txn.ID, redact.Safe(explainLockMode(m)), res)
+	}
+	for e := kl.queuedLockingRequests.Front(); e != nil; e = e.Next() {
+		qg := e.Value
+		res := explain(qg.mode)
+		if res == "conflicts" {
+			queuedConflicts++
+		}
+		txn := "non-txn"
+		if qg.guard.txn != nil {
+			txn = "txn " + qg.guard.txn.ID.String()
+		}
+		active := "inactive"
+		if qg.active {
+			active = "active"
+		}
+		sb.Printf(" queued: req %d, %s with %s (%s): %s\n",
+			redact.Safe(qg.guard.seqNum), redact.Safe(txn), redact.Safe(explainLockMode(qg.mode)),
+			redact.Safe(active), res)
+	}
+	sb.Printf(" conflicts with %d of %d holder(s) and %d of %d queued locking request(s)\n",
+		redact.Safe(holderConflicts), redact.Safe(kl.holders.Len()),
+		redact.Safe(queuedConflicts), redact.Safe(kl.queuedLockingRequests.Len()))
+	return sb.String()
+}
+
+// explainLockMode formats the supplied lock mode for ExplainConflict,
+// including the timestamp and isolation level only for the strengths whose
+// conflicts depend on them.
+func explainLockMode(m lock.Mode) string {
+	switch m.Strength {
+	case lock.None, lock.Exclusive:
+		return fmt.Sprintf("%s(ts: %s, iso: %s)", m.Strength, m.Timestamp, m.IsoLevel)
+	case lock.Intent:
+		return fmt.Sprintf("%s(ts: %s)", m.Strength, m.Timestamp)
+	default:
+		return m.Strength.String()
+	}
+}
+
 // assert panics with the supplied message if the condition does not hold true.
 func assert(condition bool, msg string) {
 	if !condition {
@@ -4261,9 +7440,9 @@ func assert(condition bool, msg string) {
 	}
 }
 
-// LockPromotionError is used to mark lock promotion errors.
-// TODO(arul): Once we've implemented lock promotion generally, we can remove
-// this machinery.
+// LockPromotionError is used to mark lock promotion errors, which are returned
+// when a transaction's attempt to promote its Shared lock deadlocks with that
+// of another transaction holding a Shared lock on the same key.
 type LockPromotionError struct{}
 
 func (e *LockPromotionError) Error() string {
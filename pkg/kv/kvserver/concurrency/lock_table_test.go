@@ -22,19 +22,25 @@ import (
 	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/kv/kvpb"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/concurrency/isolation"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/concurrency/lock"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/concurrency/poison"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/lockspanset"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/spanlatch"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/spanset"
+	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/txnwait"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/storage"
 	"github.com/cockroachdb/cockroach/pkg/storage/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/testutils/datapathutils"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/stop"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/uint128"
@@ -52,17 +58,41 @@ import (
 Test needs to handle caller constraints wrt latches being held. The datadriven
 test uses the following format:
 
-new-lock-table maxlocks=<int>
+new-lock-table maxlocks=<int> [track-ops-while-disabled] [max-locks-per-txn=<int>] [eager-queueing] [resolve-pushed-locks-inline] [priority-ordered-wait-queues] [rediscovery-loop-threshold=<int>] [per-key-acquisition-rate-limit=<int>] [consolidate-adjacent-lock-resolution] [disable-distinguished-waiters] [claimant-change-events=<int>] [epoch-regression-policy=<error|ignore|apply>] [discovered-lock-high-watermark=<float>] [cleared-lock-waiters-done-waiting] [release-locks-of-finalized-txns]
 ----
 
-  Creates a lockTable. The lockTable is initially enabled.
+  Creates a lockTable. The lockTable is initially enabled. If
+  track-ops-while-disabled is specified, operations received while the
+  lockTable is disabled are counted. If max-locks-per-txn is specified, the
+  number of keys a single transaction can hold locks on is capped. If
+  eager-queueing is specified, locking requests that start waiting also
+  enqueue (inactive) in the wait queues of the remaining locks in their
+  snapshot. If resolve-pushed-locks-inline is specified, non-locking readers
+  stop their scan to resolve replicated locks held by pushed transactions. If
+  priority-ordered-wait-queues is specified, wait queues are ordered by
+  transaction priority before sequence number. If rediscovery-loop-threshold
+  is specified, it overrides the threshold used to detect lock rediscovery
+  loops. If per-key-acquisition-rate-limit is specified, lock acquisitions on
+  each key are limited to that many per second. If
+  consolidate-adjacent-lock-resolution is specified, requests wait on, and
+  resolve, contiguous runs of locks held by the same transaction as a whole,
+  using ranged lock updates. If disable-distinguished-waiters is
+  specified, no distinguished waiter is designated for locks with waiters. If
+  claimant-change-events is specified, that many claimant change events are
+  retained. If epoch-regression-policy is specified, it overrides the handling
+  of epoch-regressing lock acquisitions. If discovered-lock-high-watermark is
+  specified, discovered locks are not tracked above that fraction of maxlocks.
+  If cleared-lock-waiters-done-waiting is specified, the waiters of cleared
+  replicated locks are told that they are done waiting. If
+  release-locks-of-finalized-txns is specified, the locks of transactions that
+  are found to be finalized by pushed-txn-updated are released.
 
 time-tick [m=<int>] [s=<int>] [ms=<int>] [ns=<int>]
 ----
 
   Forces the manual clock to tick forward m minutes, s seconds, ms milliseconds, and ns nanoseconds.
 
-new-txn txn=<name> ts=<int>[,<int>] epoch=<int> [seq=<int>] [iso=<level>]
+new-txn txn=<name> ts=<int>[,<int>] epoch=<int> [seq=<int>] [iso=<level>] [priority=<int>]
 ----
 
  Creates a TxnMeta.
@@ -98,6 +128,13 @@ release txn=<name> span=<start>[,<end>]
 
  Releases locks for the named transaction.
 
+release-batch txn=<name> spans=<start>[,<end>][+<start>[,<end>]...]
+----
+<error string>
+
+ Releases locks for the named transaction in each of the supplied spans, using
+ a single call to UpdateLocksBatch.
+
 update txn=<name> ts=<int>[,<int>] epoch=<int> span=<start>[,<end>] [ignored-seqs=<int>[-<int>][,<int>[-<int>]]]
 ----
 <error string>
@@ -134,6 +171,13 @@ dequeue r=<name>
  Calls lockTable.Dequeue for the named request. The request and guard are
  discarded after this.
 
+leave-wait-queues r=<name>
+----
+<error string>
+
+ Calls lockTable.LeaveWaitQueues for the named request. The request and guard
+ are retained, and a subsequent scan re-sequences the request with its guard.
+
 guard-state r=<name>
 ----
 new|old: state=<state> [txn=<name> ts=<ts>]
@@ -151,6 +195,12 @@ resolve-before-scanning r=<name>
 ----
 <intents to resolve>
 
+scan-progress r=<name>
+----
+scanning=<bool> steps=<int> str=<strength> index=<int> key=<key>
+
+ Prints the progress of the request's scans of the lockTable.
+
 enable [lease-seq=<seq>]
 ----
 
@@ -162,18 +212,93 @@ clear [disable]
 
  Calls lockTable.Clear. Optionally disables the lockTable.
 
+split k=<key>
+----
+left:
+<state of lock table>
+right:
+<state of RHS lock table>
+
+ Calls lockTable.SplitAt and installs the locks that were split off in a new
+ RHS lockTable using lockTable.Merge.
+
+merge
+----
+<state of lock table>
+
+ Detaches all locks from the RHS lockTable created by split, and installs them
+ in the lockTable using lockTable.Merge.
+
 print
 ----
 <state of lock table>
 
-query span=<start>[,<end> | /Max] [max-locks=<int>] [max-bytes=<int>] [uncontended]
+describe-key k=<key>
+----
+<state of the key's locks and wait-queues> | <key> is not locked
+
+ Prints the state of a single key using lockTable.DescribeKey, including the
+ requests that have pinned its lock as not removable.
+
+explain-conflict k=<key> strength=<strength> [ts=<int>[,<int>]] [iso=<level>]
+----
+<whether each lock holder and queued locking request conflicts with the mode>
+
+ Calls lockTable.ExplainConflict with the lock mode of the given strength,
+ timestamp and isolation level.
+
+query span=<start>[,<end> | /Max] [max-locks=<int>] [max-bytes=<int>] [uncontended] [holder-txn=<name>]
 ----
 
  Queries the lockTable over a given span (or over the entire LT if no span
  provided), returning lock state info up to a maximum number of locks or bytes
  if provided.  By default only returns contended locks (those with waiters),
- unless the uncontended option is given.
+ unless the uncontended option is given. If holder-txn is given, only the locks
+ held by that transaction are returned.
+
+
+contention-buckets n=<int>
+----
+<per-bucket contention for local keys and global keys>
+
+ Calls lockTable.ContentionByKeyRange, partitioning the locked keyspace into n
+ buckets.
+
+top-keys-by-memory n=<int>
+----
+<the n keys with the largest estimated memory footprint>
+
+ Calls lockTable.TopKeysByMemory.
 
+top-txns-by-contention n=<int>
+----
+<the n transactions whose locks have caused the most waiting>
+
+ Calls lockTable.TopTxnsByContention.
+
+hot-keys n=<int>
+----
+<the n keys with the most active waiters>
+
+ Calls lockTable.HotKeys.
+
+push-long-held-locks threshold=<duration>
+----
+<the locks held for longer than the threshold, and their holders>
+
+ Calls lockTable.PushLongHeldLocks.
+
+queue-head-compatibility
+----
+<the strength of the head of each unlocked key's queue and its compatible followers>
+
+ Calls lockTable.QueueHeadCompatibility.
+
+claimant-changes
+----
+<claimant change events, from oldest to newest>
+
+ Calls lockTable.ClaimantChangeEvents.
 
 metrics
 ----
@@ -188,6 +313,7 @@ func TestLockTableBasic(t *testing.T) {
 
 	datadriven.Walk(t, datapathutils.TestDataPath(t, "lock_table"), func(t *testing.T, path string) {
 		var lt lockTable
+		var rhs lockTable
 		var txnsByName map[string]*enginepb.TxnMeta
 		var txnCounter uint128.Uint128
 		var requestsByName map[string]Request
@@ -199,13 +325,75 @@ func TestLockTableBasic(t *testing.T) {
 			case "new-lock-table":
 				var maxLocks int
 				d.ScanArgs(t, "maxlocks", &maxLocks)
-				ltImpl := newLockTable(
-					int64(maxLocks), roachpb.RangeID(3), clock, cluster.MakeTestingClusterSettings(),
-				)
+				st := cluster.MakeTestingClusterSettings()
+				if d.HasArg("track-ops-while-disabled") {
+					TrackOperationsWhileDisabled.Override(context.Background(), &st.SV, true)
+				}
+				if d.HasArg("max-locks-per-txn") {
+					var maxLocksPerTxn int
+					d.ScanArgs(t, "max-locks-per-txn", &maxLocksPerTxn)
+					MaxLocksPerTransaction.Override(context.Background(), &st.SV, int64(maxLocksPerTxn))
+				}
+				if d.HasArg("eager-queueing") {
+					EagerQueueing.Override(context.Background(), &st.SV, true)
+				}
+				if d.HasArg("resolve-pushed-locks-inline") {
+					ResolvePushedLocksInline.Override(context.Background(), &st.SV, true)
+				}
+				if d.HasArg("priority-ordered-wait-queues") {
+					PriorityOrderedWaitQueues.Override(context.Background(), &st.SV, true)
+				}
+				if d.HasArg("rediscovery-loop-threshold") {
+					var threshold int
+					d.ScanArgs(t, "rediscovery-loop-threshold", &threshold)
+					LockRediscoveryLoopThreshold.Override(context.Background(), &st.SV, int64(threshold))
+				}
+				if d.HasArg("per-key-acquisition-rate-limit") {
+					var rate int
+					d.ScanArgs(t, "per-key-acquisition-rate-limit", &rate)
+					PerKeyLockAcquisitionRateLimit.Override(context.Background(), &st.SV, float64(rate))
+				}
+				if d.HasArg("consolidate-adjacent-lock-resolution") {
+					ConsolidateAdjacentLockResolution.Override(context.Background(), &st.SV, true)
+				}
+				if d.HasArg("disable-distinguished-waiters") {
+					DistinguishedWaitersEnabled.Override(context.Background(), &st.SV, false)
+				}
+				if d.HasArg("claimant-change-events") {
+					var size int
+					d.ScanArgs(t, "claimant-change-events", &size)
+					ClaimantChangeEventBufferSize.Override(context.Background(), &st.SV, int64(size))
+				}
+				if d.HasArg("epoch-regression-policy") {
+					var policy string
+					d.ScanArgs(t, "epoch-regression-policy", &policy)
+					v, ok := EpochRegressionAcquisitionPolicy.ParseEnum(policy)
+					if !ok {
+						d.Fatalf(t, "unknown epoch regression policy: %s", policy)
+					}
+					EpochRegressionAcquisitionPolicy.Override(context.Background(), &st.SV, v)
+				}
+				if d.HasArg("discovered-lock-high-watermark") {
+					var fracStr string
+					d.ScanArgs(t, "discovered-lock-high-watermark", &fracStr)
+					frac, err := strconv.ParseFloat(fracStr, 64)
+					if err != nil {
+						d.Fatalf(t, "%v", err)
+					}
+					DiscoveredLockHighWatermark.Override(context.Background(), &st.SV, frac)
+				}
+				if d.HasArg("cleared-lock-waiters-done-waiting") {
+					ClearedLockWaitersDoneWaiting.Override(context.Background(), &st.SV, true)
+				}
+				if d.HasArg("release-locks-of-finalized-txns") {
+					ReleaseLocksOfFinalizedTxns.Override(context.Background(), &st.SV, true)
+				}
+				ltImpl := newLockTable(int64(maxLocks), roachpb.RangeID(3), clock, st, nil /* statusCache */)
 				ltImpl.enabled = true
 				ltImpl.enabledSeq = 1
-				ltImpl.minKeysLocked = 0
+				ltImpl.minKeysLocked.Store(0)
 				lt = ltImpl
+				rhs = nil
 				txnsByName = make(map[string]*enginepb.TxnMeta)
 				txnCounter = uint128.FromInts(0, 0)
 				requestsByName = make(map[string]Request)
@@ -249,6 +437,10 @@ func TestLockTableBasic(t *testing.T) {
 					d.ScanArgs(t, "seq", &seq)
 				}
 				iso := ScanIsoLevel(t, d)
+				var priority int
+				if d.HasArg("priority") {
+					d.ScanArgs(t, "priority", &priority)
+				}
 				txnMeta, ok := txnsByName[txnName]
 				var id uuid.UUID
 				if ok {
@@ -262,6 +454,7 @@ func TestLockTableBasic(t *testing.T) {
 					Sequence:       enginepb.TxnSeq(seq),
 					WriteTimestamp: ts,
 					IsoLevel:       iso,
+					Priority:       enginepb.TxnPriority(priority),
 				}
 				return ""
 
@@ -311,7 +504,7 @@ func TestLockTableBasic(t *testing.T) {
 					d.Fatalf(t, "unknown txn %s", txnName)
 				}
 				ts := scanTimestamp(t, d)
-				waitPolicy := lock.WaitPolicy_Block
+				waitPolicy := scanWaitPolicy(t, d, false /* required */)
 				if d.HasArg("skip-locked") {
 					waitPolicy = lock.WaitPolicy_SkipLocked
 				}
@@ -417,6 +610,25 @@ func TestLockTableBasic(t *testing.T) {
 				}
 				return lt.String()
 
+			case "release-batch":
+				var txnName string
+				d.ScanArgs(t, "txn", &txnName)
+				txnMeta, ok := txnsByName[txnName]
+				if !ok {
+					d.Fatalf(t, "unknown txn %s", txnName)
+				}
+				var s string
+				d.ScanArgs(t, "spans", &s)
+				var ups []roachpb.LockUpdate
+				for _, spanStr := range strings.Split(s, "+") {
+					span := getSpan(t, d, spanStr)
+					ups = append(ups, roachpb.LockUpdate{Span: span, Txn: *txnMeta, Status: roachpb.COMMITTED})
+				}
+				if err := lt.UpdateLocksBatch(ups); err != nil {
+					return err.Error()
+				}
+				return lt.String()
+
 			case "update":
 				var txnName string
 				d.ScanArgs(t, "txn", &txnName)
@@ -532,6 +744,16 @@ func TestLockTableBasic(t *testing.T) {
 				delete(requestsByName, reqName)
 				return lt.String()
 
+			case "leave-wait-queues":
+				var reqName string
+				d.ScanArgs(t, "r", &reqName)
+				g := guardsByReqName[reqName]
+				if g == nil {
+					d.Fatalf(t, "unknown guard: %s", reqName)
+				}
+				lt.LeaveWaitQueues(g)
+				return lt.String()
+
 			case "should-wait":
 				var reqName string
 				d.ScanArgs(t, "r", &reqName)
@@ -573,6 +795,11 @@ func TestLockTableBasic(t *testing.T) {
 					return str + "state=waitSelf"
 				case waitQueueMaxLengthExceeded:
 					typeStr = "waitQueueMaxLengthExceeded"
+				case waitDeadlineExceeded:
+					typeStr = "waitDeadlineExceeded"
+				case waitThrottled:
+					return fmt.Sprintf("%sstate=waitThrottled key=%s retry-after=%s",
+						str, state.key, state.retryAfter)
 				case doneWaiting:
 					var toResolveStr string
 					if stateTransition {
@@ -593,8 +820,12 @@ func TestLockTableBasic(t *testing.T) {
 				if txnS == "" {
 					txnS = fmt.Sprintf("unknown txn with ID: %v", state.txn.ID)
 				}
-				return fmt.Sprintf("%sstate=%s txn=%s key=%s held=%t guard-strength=%s",
-					str, typeStr, txnS, state.key, state.held, state.guardStrength)
+				var endKeyStr string
+				if state.endKey != nil {
+					endKeyStr = fmt.Sprintf(" end-key=%s", state.endKey)
+				}
+				return fmt.Sprintf("%sstate=%s txn=%s key=%s%s held=%t guard-strength=%s",
+					str, typeStr, txnS, state.key, endKeyStr, state.held, state.guardStrength)
 
 			case "resolve-before-scanning":
 				var reqName string
@@ -605,6 +836,17 @@ func TestLockTableBasic(t *testing.T) {
 				}
 				return intentsToResolveToStr(g.ResolveBeforeScanning(), false)
 
+			case "scan-progress":
+				var reqName string
+				d.ScanArgs(t, "r", &reqName)
+				g := guardsByReqName[reqName]
+				if g == nil {
+					d.Fatalf(t, "unknown guard: %s", reqName)
+				}
+				sp := g.(*lockTableGuardImpl).ScanProgress()
+				return fmt.Sprintf("scanning=%t steps=%d str=%s index=%d key=%s",
+					sp.scanning, sp.steps, sp.str, sp.index, sp.key)
+
 			case "enable":
 				seq := int(1)
 				if d.HasArg("lease-seq") {
@@ -617,9 +859,51 @@ func TestLockTableBasic(t *testing.T) {
 				lt.Clear(d.HasArg("disable"))
 				return lt.String()
 
+			case "split":
+				var key string
+				d.ScanArgs(t, "k", &key)
+				ltImpl := lt.(*lockTableImpl)
+				rhsImpl := newLockTable(
+					ltImpl.maxKeysLocked.Load(), roachpb.RangeID(4), clock, ltImpl.settings, nil, /* statusCache */
+				)
+				rhsImpl.enabled = true
+				rhsImpl.enabledSeq = 1
+				rhsImpl.minKeysLocked.Store(0)
+				rhsImpl.Merge(lt.SplitAt(roachpb.RKey(key)))
+				rhs = rhsImpl
+				return fmt.Sprintf("left:\n%sright:\n%s", lt.String(), rhs.String())
+
+			case "merge":
+				if rhs == nil {
+					d.Fatalf(t, "no RHS lock table to merge")
+				}
+				lt.Merge(rhs.SplitAt(roachpb.RKeyMin))
+				rhs = nil
+				return lt.String()
+
 			case "print":
 				return lt.String()
 
+			case "describe-key":
+				var key string
+				d.ScanArgs(t, "k", &key)
+				str, ok := lt.DescribeKey(roachpb.Key(key))
+				if !ok {
+					return fmt.Sprintf("%q is not locked", key)
+				}
+				return str
+
+			case "explain-conflict":
+				var key string
+				d.ScanArgs(t, "k", &key)
+				str := ScanLockStrength(t, d)
+				var ts hlc.Timestamp
+				if d.HasArg("ts") {
+					ts = scanTimestamp(t, d)
+				}
+				txn := &enginepb.TxnMeta{IsoLevel: ScanIsoLevel(t, d)}
+				return lt.ExplainConflict(roachpb.Key(key), makeLockMode(str, txn, ts))
+
 			case "query":
 				span := keys.EverythingSpan
 				var maxLocks int
@@ -640,7 +924,19 @@ func TestLockTableBasic(t *testing.T) {
 					TargetBytes:        int64(targetBytes),
 					IncludeUncontended: d.HasArg("uncontended"),
 				}
-				lockInfos, resumeState := lt.QueryLockTableState(span, scanOpts)
+				if d.HasArg("holder-txn") {
+					var txnName string
+					d.ScanArgs(t, "holder-txn", &txnName)
+					txnMeta, ok := txnsByName[txnName]
+					if !ok {
+						d.Fatalf(t, "unknown txn %s", txnName)
+					}
+					scanOpts.TxnID = txnMeta.ID
+				}
+				lockInfos, resumeState, err := lt.QueryLockTableState(context.Background(), span, scanOpts)
+				if err != nil {
+					return err.Error()
+				}
 				var lockInfoBytes int64
 				for _, lockInfo := range lockInfos {
 					lockInfoBytes += int64(lockInfo.Size())
@@ -660,6 +956,109 @@ func TestLockTableBasic(t *testing.T) {
 				}
 				return buf.String()
 
+			case "contention-buckets":
+				var n int
+				d.ScanArgs(t, "n", &n)
+				contention := lt.ContentionByKeyRange(n)
+				var buf strings.Builder
+				for _, group := range []struct {
+					name    string
+					buckets []LockContentionBucket
+				}{
+					{"local", contention.Local},
+					{"global", contention.Global},
+				} {
+					fmt.Fprintf(&buf, "%s:\n", group.name)
+					for _, b := range group.buckets {
+						fmt.Fprintf(&buf, " span=%s locks=%d held=%d hold=%s waiters=%d readers=%d writers=%d wait=%s\n",
+							b.Span, b.Locks, b.LocksHeld, time.Duration(b.HoldDurationNanos),
+							b.Waiters, b.WaitingReaders, b.WaitingWriters, time.Duration(b.WaitDurationNanos))
+					}
+				}
+				return buf.String()
+
+			case "top-keys-by-memory":
+				var n int
+				d.ScanArgs(t, "n", &n)
+				var buf strings.Builder
+				for _, est := range lt.TopKeysByMemory(n) {
+					fmt.Fprintf(&buf, "key=%s bytes=%d holders=%d readers=%d locking-requests=%d\n",
+						est.Key, est.Bytes, est.Holders, est.WaitingReaders, est.QueuedLockingRequests)
+				}
+				return buf.String()
+
+			case "top-txns-by-contention":
+				var n int
+				d.ScanArgs(t, "n", &n)
+				var buf strings.Builder
+				for _, c := range lt.TopTxnsByContention(n) {
+					fmt.Fprintf(&buf, "txn=%s locks=%d waiters=%d wait=%s\n",
+						c.TxnID, c.Locks, c.Waiters, time.Duration(c.WaitDurationNanos))
+				}
+				return buf.String()
+
+			case "hot-keys":
+				var n int
+				d.ScanArgs(t, "n", &n)
+				var buf strings.Builder
+				for _, info := range lt.HotKeys(n) {
+					var waiters int
+					var wait time.Duration
+					for _, w := range info.Waiters {
+						if w.ActiveWaiter {
+							waiters++
+							wait += w.WaitDuration
+						}
+					}
+					holder := "none"
+					if info.LockHolder != nil {
+						holder = info.LockHolder.ID.String()
+					}
+					fmt.Fprintf(&buf, "key=%s holder=%s waiters=%d wait=%s\n",
+						info.Key, holder, waiters, wait)
+				}
+				return buf.String()
+
+			case "push-long-held-locks":
+				var thresholdStr string
+				d.ScanArgs(t, "threshold", &thresholdStr)
+				threshold, err := time.ParseDuration(thresholdStr)
+				if err != nil {
+					d.Fatalf(t, "%v", err)
+				}
+				var buf strings.Builder
+				for _, l := range lt.PushLongHeldLocks(threshold) {
+					fmt.Fprintf(&buf, "key=%s txn=%s held=%s\n", l.Key, l.Txn.ID, l.HeldDuration)
+				}
+				return buf.String()
+
+			case "queue-head-compatibility":
+				var buf strings.Builder
+				for _, c := range lt.QueueHeadCompatibility() {
+					fmt.Fprintf(&buf, "key=%s head=%s compatible-followers=%d locking-requests=%d\n",
+						c.Key, c.HeadStrength, c.CompatibleFollowers, c.QueuedLockingRequests)
+				}
+				return buf.String()
+
+			case "claimant-changes":
+				txnName := func(id uuid.UUID) string {
+					if id == (uuid.UUID{}) {
+						return "none"
+					}
+					for k, v := range txnsByName {
+						if v.ID.Equal(id) {
+							return k
+						}
+					}
+					return fmt.Sprintf("unknown txn with ID: %v", id)
+				}
+				var buf strings.Builder
+				for _, ev := range lt.ClaimantChangeEvents() {
+					fmt.Fprintf(&buf, "key=%s old=%s new=%s held=%t reason=%s\n",
+						ev.Key, txnName(ev.OldClaimant), txnName(ev.NewClaimant), ev.Held, ev.Reason)
+				}
+				return buf.String()
+
 			case "metrics":
 				metrics := lt.Metrics()
 				b, err := yaml.Marshal(&metrics)
@@ -730,10 +1129,10 @@ func scanSpans(
 			sa = spanset.SpanReadWrite
 		case lock.Exclusive:
 			sa = spanset.SpanReadWrite
-		case lock.Shared:
-			// Unlike non-locking reads, shared-locking reads are isolated at all
-			// timestamps (not just the request's timestamp); so we acquire a read
-			// latch at max timestamp. See
+		case lock.Shared, lock.Update:
+			// Unlike non-locking reads, shared and update locking reads are isolated
+			// at all timestamps (not just the request's timestamp); so we acquire a
+			// read latch at max timestamp. See
 			// https://github.com/cockroachdb/cockroach/issues/102264.
 			sa = spanset.SpanReadOnly
 			ts = hlc.MaxTimestamp
@@ -828,6 +1227,11 @@ func intentsToResolveToStr(toResolve []roachpb.LockUpdate, startOnNewLine bool)
 	}
 	fmt.Fprintf(&buf, "Intents to resolve:")
 	for i := range toResolve {
+		if len(toResolve[i].EndKey) > 0 {
+			fmt.Fprintf(&buf, "\n span=%s txn=%s status=%s", toResolve[i].Span,
+				toResolve[i].Txn.ID.Short(), toResolve[i].Status)
+			continue
+		}
 		fmt.Fprintf(&buf, "\n key=%s txn=%s status=%s", toResolve[i].Key,
 			toResolve[i].Txn.ID.Short(), toResolve[i].Status)
 	}
@@ -839,11 +1243,33 @@ func newLock(txn *enginepb.TxnMeta, key roachpb.Key, str lock.Strength) *roachpb
 	return &l
 }
 
+// newTestLockTable returns an enabled lockTable for range 3 that tracks locks
+// on up to maxLocks keys. A nil clock or settings is replaced by a testing one.
+func newTestLockTable(maxLocks int64, clock *hlc.Clock, st *cluster.Settings) *lockTableImpl {
+	if clock == nil {
+		clock = hlc.NewClockForTesting(nil)
+	}
+	if st == nil {
+		st = cluster.MakeTestingClusterSettings()
+	}
+	lt := newLockTable(maxLocks, roachpb.RangeID(3), clock, st, nil /* statusCache */)
+	lt.enabled = true
+	return lt
+}
+
+// makeTestTxn returns a new transaction that writes at timestamp 10.
+func makeTestTxn() *roachpb.Transaction {
+	return &roachpb.Transaction{
+		TxnMeta: enginepb.TxnMeta{ID: uuid.MakeV4(), WriteTimestamp: hlc.Timestamp{WallTime: 10}},
+	}
+}
+
 func TestLockTableMaxLocks(t *testing.T) {
 	lt := newLockTable(
 		5, roachpb.RangeID(3), hlc.NewClockForTesting(nil), cluster.MakeTestingClusterSettings(),
+		nil, /* statusCache */
 	)
-	lt.minKeysLocked = 0
+	lt.minKeysLocked.Store(0)
 	lt.enabled = true
 	var keys []roachpb.Key
 	var guards []lockTableGuard
@@ -940,7 +1366,7 @@ func TestLockTableMaxLocks(t *testing.T) {
 	require.Equal(t, int64(4), lt.lockCountForTesting())
 	// Bump down the enforcement interval manually, and bump up minKeysLocked.
 	lt.locks.lockAddMaxLocksCheckInterval = 1
-	lt.minKeysLocked = 2
+	lt.minKeysLocked.Store(2)
 	// Three more guards dequeued.
 	lt.Dequeue(guards[6])
 	lt.Dequeue(guards[7])
@@ -963,7 +1389,7 @@ func TestLockTableMaxLocks(t *testing.T) {
 	// minKeysLocked=2.
 	require.Equal(t, int64(2), lt.lockCountForTesting())
 	// Restore minKeysLocked to 0.
-	lt.minKeysLocked = 0
+	lt.minKeysLocked.Store(0)
 	// Add locks to push us over 5 locks.
 	for i := 16; i < 20; i++ {
 		added, err = lt.AddDiscoveredLock(
@@ -974,6 +1400,110 @@ func TestLockTableMaxLocks(t *testing.T) {
 	}
 	// Only the 1 notRemovable lock remains.
 	require.Equal(t, int64(1), lt.lockCountForTesting())
+	// All the locks removed from the lock table were cleared to relieve memory
+	// pressure. The two waiting guards were told to wait elsewhere when the
+	// locks they were waiting on were cleared.
+	m := lt.Metrics()
+	require.NotZero(t, m.LocksClearedOnMemoryPressure)
+	require.Equal(t, m.LocksGCed, m.LocksClearedOnMemoryPressure)
+	require.Equal(t, int64(2), m.WaitersToldToWaitElsewhere)
+	// Deliberately clearing the lock table doesn't count as memory pressure.
+	lt.Clear(true /* disable */)
+	m2 := lt.Metrics()
+	require.Equal(t, m.LocksGCed+1, m2.LocksGCed)
+	require.Equal(t, m.LocksClearedOnMemoryPressure, m2.LocksClearedOnMemoryPressure)
+	require.Equal(t, m.WaitersToldToWaitElsewhere, m2.WaitersToldToWaitElsewhere)
+}
+
+// TestTxnHeldLocksIndex tests that txnHeldLocks counts all the keys on which a
+// transaction holds locks, and indexes up to maxIndexedKeysLockedPerTxn of them
+// while ReleaseLocksOfFinalizedTxns is enabled.
+func TestTxnHeldLocksIndex(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	st := cluster.MakeTestingClusterSettings()
+	ReleaseLocksOfFinalizedTxns.Override(context.Background(), &st.SV, true)
+	c := txnHeldLocks{settings: st}
+	txnID := uuid.MakeV4()
+	var kls []*keyLocks
+	for i := 0; i < maxIndexedKeysLockedPerTxn+2; i++ {
+		kl := &keyLocks{key: roachpb.Key(fmt.Sprintf("%08d", i))}
+		kls = append(kls, kl)
+		c.inc(txnID, kl)
+	}
+	// Keys beyond the bound are counted, but not indexed.
+	require.Equal(t, int64(len(kls)), c.get(txnID))
+	indexed := kls[:maxIndexedKeysLockedPerTxn]
+	require.ElementsMatch(t, indexed, c.indexedKeys(txnID))
+
+	// Releasing an indexed key removes it from the index, which makes room for
+	// the next key the transaction locks.
+	c.dec(txnID, kls[0])
+	c.dec(txnID, kls[len(kls)-1])
+	require.Equal(t, int64(len(kls)-2), c.get(txnID))
+	require.ElementsMatch(t, indexed[1:], c.indexedKeys(txnID))
+	c.inc(txnID, kls[len(kls)-1])
+	require.ElementsMatch(t,
+		append(append([]*keyLocks(nil), indexed[1:]...), kls[len(kls)-1]), c.indexedKeys(txnID))
+
+	// Keys locked while the setting is disabled are counted, but not indexed.
+	ReleaseLocksOfFinalizedTxns.Override(context.Background(), &st.SV, false)
+	otherTxnID := uuid.MakeV4()
+	c.inc(otherTxnID, kls[0])
+	require.Equal(t, int64(1), c.get(otherTxnID))
+	require.Empty(t, c.indexedKeys(otherTxnID))
+	c.dec(otherTxnID, kls[0])
+
+	for _, kl := range kls[1:] {
+		c.dec(txnID, kl)
+	}
+	require.Zero(t, c.get(txnID))
+	require.Empty(t, c.indexedKeys(txnID))
+	require.Empty(t, c.txns)
+}
+
+// TestLockTableMaxKeysLockedSetting tests that changes to the MaxKeysLocked
+// cluster setting are applied to an existing lock table, and that lowering the
+// maximum below the number of keys locked clears locks right away.
+func TestLockTableMaxKeysLockedSetting(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	st := cluster.MakeTestingClusterSettings()
+	lt := newTestLockTable(100, nil, st)
+	txn := makeTestTxn()
+	for i := 0; i < 10; i++ {
+		k := roachpb.Key(fmt.Sprintf("%08d", i))
+		acq := roachpb.MakeLockAcquisition(txn, k, lock.Unreplicated, lock.Exclusive)
+		require.NoError(t, lt.AcquireLock(&acq))
+	}
+	require.Equal(t, int64(10), lt.lockCountForTesting())
+
+	// Raising the maximum doesn't clear any locks.
+	MaxKeysLocked.Override(ctx, &st.SV, 1000)
+	lt.OnMaxKeysLockedUpdated()
+	require.Equal(t, int64(1000), lt.maxKeysLocked.Load())
+	require.Equal(t, int64(500), lt.minKeysLocked.Load())
+	require.Equal(t, uint64(50), lt.locks.lockAddMaxLocksCheckInterval)
+	require.Equal(t, int64(10), lt.lockCountForTesting())
+
+	// Lowering the maximum below the number of keys locked clears locks down to
+	// the new minimum, without waiting for another lock to be acquired.
+	MaxKeysLocked.Override(ctx, &st.SV, 4)
+	lt.OnMaxKeysLockedUpdated()
+	require.Equal(t, int64(4), lt.maxKeysLocked.Load())
+	require.Equal(t, int64(2), lt.minKeysLocked.Load())
+	require.Equal(t, uint64(1), lt.locks.lockAddMaxLocksCheckInterval)
+	require.Equal(t, int64(2), lt.lockCountForTesting())
+
+	// Resetting the setting restores the maximum the lock table was constructed
+	// with.
+	MaxKeysLocked.Override(ctx, &st.SV, 0)
+	lt.OnMaxKeysLockedUpdated()
+	require.Equal(t, int64(100), lt.maxKeysLocked.Load())
+	require.Equal(t, int64(2), lt.lockCountForTesting())
 }
 
 // TestLockTableMaxLocksWithMultipleNotRemovableRefs tests the notRemovable
@@ -981,8 +1511,9 @@ func TestLockTableMaxLocks(t *testing.T) {
 func TestLockTableMaxLocksWithMultipleNotRemovableRefs(t *testing.T) {
 	lt := newLockTable(
 		2, roachpb.RangeID(3), hlc.NewClockForTesting(nil), cluster.MakeTestingClusterSettings(),
+		nil, /* statusCache */
 	)
-	lt.minKeysLocked = 0
+	lt.minKeysLocked.Store(0)
 	lt.enabled = true
 	var keys []roachpb.Key
 	var guards []lockTableGuard
@@ -1055,60 +1586,1537 @@ func TestLockTableMaxLocksWithMultipleNotRemovableRefs(t *testing.T) {
 	require.Equal(t, int64(1), lt.lockCountForTesting())
 }
 
-type workItem struct {
-	// Contains one of request or intents.
+// TestLockTableAddDiscoveredLocks tests that adding a batch of discovered
+// locks tracks all of them, enqueues the discoverer in each of their
+// wait-queues, and marks exactly one of them notRemovable. It also tests that
+// the keys of the locks that were ignored are returned.
+func TestLockTableAddDiscoveredLocks(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
 
-	// Request.
-	request        *Request
-	locksToAcquire []roachpb.Key
+	lt := newTestLockTable(1000, nil, nil)
 
-	// Update locks.
-	intents []roachpb.LockUpdate
+	span := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("z")}
+	latchSpans := &spanset.SpanSet{}
+	latchSpans.AddMVCC(spanset.SpanReadWrite, span, hlc.Timestamp{WallTime: 1})
+	lockSpans := &lockspanset.LockSpanSet{}
+	lockSpans.Add(lock.Intent, span)
+	req := Request{
+		Timestamp:  hlc.Timestamp{WallTime: 1},
+		LatchSpans: latchSpans,
+		LockSpans:  lockSpans,
+	}
+	g, err := lt.ScanAndEnqueue(req, nil)
+	require.Nil(t, err)
+	require.False(t, g.ShouldWait())
+
+	txnMeta := enginepb.TxnMeta{ID: uuid.MakeV4(), WriteTimestamp: hlc.Timestamp{WallTime: 10}}
+	var foundLocks []roachpb.Lock
+	for _, k := range []string{"b", "c", "d"} {
+		foundLocks = append(foundLocks, roachpb.MakeLock(&txnMeta, roachpb.Key(k), lock.Intent))
+	}
+	ignored, addErr := lt.AddDiscoveredLocks(foundLocks, 0, false, g)
+	require.NoError(t, addErr)
+	require.Empty(t, ignored)
+	require.Equal(t, int64(3), lt.lockCountForTesting())
+
+	gImpl := g.(*lockTableGuardImpl)
+	require.Equal(t, roachpb.Key("b"), gImpl.notRemovableLock.key)
+	var notRemovable int
+	iter := lt.locks.MakeIter()
+	for iter.First(); iter.Valid(); iter.Next() {
+		kl := iter.Cur()
+		kl.mu.Lock()
+		notRemovable += len(kl.notRemovable)
+		kl.mu.Unlock()
+		gImpl.mu.Lock()
+		_, inQueue := gImpl.mu.locks[kl]
+		gImpl.mu.Unlock()
+		require.True(t, inQueue, "not enqueued at %s", kl.key)
+	}
+	require.Equal(t, 1, notRemovable)
+	lt.Dequeue(g)
+
+	// Locks discovered under a stale lease sequence are ignored.
+	lt.enabledSeq = 1
+	g, err = lt.ScanAndEnqueue(req, nil)
+	require.Nil(t, err)
+	ignored, addErr = lt.AddDiscoveredLocks(foundLocks, 0, false, g)
+	require.NoError(t, addErr)
+	require.Equal(t, []roachpb.Key{roachpb.Key("b"), roachpb.Key("c"), roachpb.Key("d")}, ignored)
+	lt.Dequeue(g)
 }
 
-func (w *workItem) getRequestTxnID() uuid.UUID {
-	if w.request != nil && w.request.Txn != nil {
-		return w.request.Txn.ID
+// TestLockTableEstimatedBytes tests that the incrementally maintained estimate
+// of the lock table's memory footprint matches the sum of the estimates of the
+// keys in the lock table as locks are discovered, cleared in bulk to relieve
+// memory pressure, and garbage collected once resolved.
+func TestLockTableEstimatedBytes(t *testing.T) {
+	lt := newTestLockTable(5, nil, nil)
+	lt.minKeysLocked.Store(0)
+	requireEstimatedBytesConsistent := func() {
+		t.Helper()
+		var expected int64
+		lt.locks.mu.RLock()
+		iter := lt.locks.MakeIter()
+		for iter.First(); iter.Valid(); iter.Next() {
+			kl := iter.Cur()
+			kl.mu.Lock()
+			expected += kl.memoryEstimate().Bytes
+			kl.mu.Unlock()
+		}
+		lt.locks.mu.RUnlock()
+		require.Equal(t, expected, lt.Metrics().EstimatedBytes)
 	}
-	return uuid.UUID{}
+
+	var keys []roachpb.Key
+	latchSpans := &spanset.SpanSet{}
+	lockSpans := &lockspanset.LockSpanSet{}
+	for i := 0; i < 10; i++ {
+		k := roachpb.Key(fmt.Sprintf("%08d", i))
+		keys = append(keys, k)
+		latchSpans.AddMVCC(spanset.SpanReadWrite, roachpb.Span{Key: k}, hlc.Timestamp{WallTime: 1})
+		lockSpans.Add(lock.Intent, roachpb.Span{Key: k})
+	}
+	req := Request{
+		Timestamp:  hlc.Timestamp{WallTime: 1},
+		LatchSpans: latchSpans,
+		LockSpans:  lockSpans,
+	}
+	g, err := lt.ScanAndEnqueue(req, nil)
+	require.Nil(t, err)
+	require.Nil(t, g.ResolveBeforeScanning())
+	require.False(t, g.ShouldWait())
+	requireEstimatedBytesConsistent()
+
+	txnMeta := enginepb.TxnMeta{
+		ID:             uuid.MakeV4(),
+		Key:            roachpb.Key("anchor"),
+		WriteTimestamp: hlc.Timestamp{WallTime: 10},
+	}
+	// Discovering more locks than maxKeysLocked clears all but the notRemovable
+	// lock.
+	for _, k := range keys {
+		_, err := lt.AddDiscoveredLock(newLock(&txnMeta, k, lock.Intent), 0, false, g)
+		require.NoError(t, err)
+		requireEstimatedBytesConsistent()
+	}
+	require.NotZero(t, lt.Metrics().EstimatedBytes)
+
+	// The request waits on the remaining lock once it re-scans.
+	g, err = lt.ScanAndEnqueue(req, g)
+	require.Nil(t, err)
+	require.True(t, g.ShouldWait())
+	requireEstimatedBytesConsistent()
+
+	// Resolving the locks releases the request, after which the lock table is
+	// empty.
+	for _, k := range keys {
+		require.NoError(t, lt.UpdateLocks(&roachpb.LockUpdate{
+			Span: roachpb.Span{Key: k}, Txn: txnMeta, Status: roachpb.COMMITTED,
+		}))
+		requireEstimatedBytesConsistent()
+	}
+	lt.Dequeue(g)
+	requireEstimatedBytesConsistent()
+	require.Zero(t, lt.Metrics().EstimatedBytes)
 }
 
-func doWork(ctx context.Context, item *workItem, e *workloadExecutor) error {
-	defer func() {
-		e.doneWork <- item
-	}()
-	if item.request != nil {
-		var lg *spanlatch.Guard
-		var g lockTableGuard
-		var err error
-		for {
-			// Since we can't do a select involving latch acquisition and context
-			// cancellation, the code makes sure to release latches when returning
-			// early due to error. Otherwise other requests will get stuck and
-			// group.Wait() will not return until the test times out.
-			lg, err = e.lm.Acquire(context.Background(), item.request.LatchSpans, poison.Policy_Error)
-			if err != nil {
-				return err
-			}
-			var kvErr *Error
-			g, kvErr = e.lt.ScanAndEnqueue(*item.request, g)
-			if kvErr != nil {
-				return kvErr.GoError()
-			}
-			if !g.ShouldWait() {
-				break
-			}
-			e.lm.Release(lg)
-			var lastID uuid.UUID
-		L:
-			for {
-				select {
-				case <-g.NewStateChan():
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-				state, err := g.CurState()
-				if err != nil {
+// TestLockTableSharedTxnStatusCache verifies that the status of a transaction
+// learned by one lockTable is visible to the other lockTables sharing its
+// txnStatusCache, and that clearing a lockTable doesn't clear the shared cache.
+func TestLockTableSharedTxnStatusCache(t *testing.T) {
+	shared := NewSharedTxnStatusCache(4 /* numShards */)
+	clock := hlc.NewClockForTesting(nil)
+	st := cluster.MakeTestingClusterSettings()
+	lt1 := newLockTable(1000, roachpb.RangeID(3), clock, st, &shared.c)
+	lt2 := newLockTable(1000, roachpb.RangeID(4), clock, st, &shared.c)
+	lt3 := newLockTable(1000, roachpb.RangeID(5), clock, st, nil /* statusCache */)
+
+	txn := &roachpb.Transaction{
+		TxnMeta: enginepb.TxnMeta{ID: uuid.MakeV4()},
+		Status:  roachpb.ABORTED,
+	}
+	lt1.PushedTransactionUpdated(txn)
+	lt3.PushedTransactionUpdated(txn)
+	_, ok := lt2.txnStatusCache.finalizedTxns.get(txn.ID)
+	require.True(t, ok)
+
+	// Clearing a lockTable that shares its cache leaves the cache intact.
+	lt1.Clear(true /* disable */)
+	_, ok = lt2.txnStatusCache.finalizedTxns.get(txn.ID)
+	require.True(t, ok)
+
+	// Clearing a lockTable that maintains its own cache clears it.
+	lt3.Clear(true /* disable */)
+	_, ok = lt3.txnStatusCache.finalizedTxns.get(txn.ID)
+	require.False(t, ok)
+}
+
+// TestManagerOnTransactionsUpdated verifies that the finalized transactions in
+// a batch of updated transactions are added to the lock table's txnStatusCache,
+// and that the others are not.
+func TestManagerOnTransactionsUpdated(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	m := NewManager(Config{
+		NodeDesc:       &roachpb.NodeDescriptor{NodeID: 1},
+		RangeDesc:      &roachpb.RangeDescriptor{RangeID: 1},
+		Settings:       cluster.MakeTestingClusterSettings(),
+		Clock:          hlc.NewClockForTesting(nil),
+		TxnWaitMetrics: txnwait.NewMetrics(time.Minute),
+	}).(*managerImpl)
+	lt := m.lt.(*lockTableImpl)
+
+	committed, aborted := makeTestTxn(), makeTestTxn()
+	pending, staging := makeTestTxn(), makeTestTxn()
+	committed.Status, aborted.Status = roachpb.COMMITTED, roachpb.ABORTED
+	pending.Status, staging.Status = roachpb.PENDING, roachpb.STAGING
+	m.OnTransactionsUpdated(context.Background(), []*roachpb.Transaction{
+		committed, pending, aborted, staging,
+	})
+	for _, txn := range []*roachpb.Transaction{committed, aborted} {
+		cached, ok := lt.txnStatusCache.finalizedTxns.get(txn.ID)
+		require.True(t, ok)
+		require.Equal(t, txn, cached)
+	}
+	for _, txn := range []*roachpb.Transaction{pending, staging} {
+		_, ok := lt.txnStatusCache.finalizedTxns.get(txn.ID)
+		require.False(t, ok)
+		_, ok = lt.txnStatusCache.pendingTxns.get(txn.ID)
+		require.False(t, ok)
+	}
+}
+
+// TestLockTableWaitingStateLockHeldDuration verifies that a waiter's waiting
+// state reports how long the conflicting lock has been held, both when the
+// state is first computed and when the claimant transaction changes.
+func TestLockTableWaitingStateLockHeldDuration(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	manualClock := timeutil.NewManualTime(timeutil.Unix(0, 123))
+	lt := newTestLockTable(1000, hlc.NewClockForTesting(manualClock), nil)
+
+	k := roachpb.Key("a")
+	txn1, txn2, txn3 := makeTestTxn(), makeTestTxn(), makeTestTxn()
+	acquire := func(txn *roachpb.Transaction) {
+		acq := roachpb.MakeLockAcquisition(txn, k, lock.Unreplicated, lock.Exclusive)
+		require.NoError(t, lt.AcquireLock(&acq))
+	}
+	scan := func(txn *roachpb.Transaction) lockTableGuard {
+		latchSpans := &spanset.SpanSet{}
+		latchSpans.AddMVCC(spanset.SpanReadWrite, roachpb.Span{Key: k}, hlc.Timestamp{WallTime: 10})
+		lockSpans := &lockspanset.LockSpanSet{}
+		lockSpans.Add(lock.Intent, roachpb.Span{Key: k})
+		g, err := lt.ScanAndEnqueue(Request{
+			Txn:        txn,
+			Timestamp:  hlc.Timestamp{WallTime: 10},
+			LatchSpans: latchSpans,
+			LockSpans:  lockSpans,
+		}, nil)
+		require.Nil(t, err)
+		require.True(t, g.ShouldWait())
+		return g
+	}
+
+	acquire(txn1)
+	manualClock.Advance(5 * time.Second)
+	g2 := scan(txn2)
+	state, err := g2.CurState()
+	require.NoError(t, err)
+	require.Equal(t, txn1.ID, state.txn.ID)
+	require.Equal(t, 5*time.Second, state.lockHeldDuration)
+
+	// Once txn1 releases the lock, txn2's request claims it. A request from txn3
+	// then waits on an unheld lock, so the held duration is zero.
+	require.NoError(t, lt.UpdateLocks(&roachpb.LockUpdate{
+		Span: roachpb.Span{Key: k}, Txn: txn1.TxnMeta, Status: roachpb.COMMITTED,
+	}))
+	state, err = g2.CurState()
+	require.NoError(t, err)
+	require.Equal(t, doneWaiting, state.kind)
+	g3 := scan(txn3)
+	state, err = g3.CurState()
+	require.NoError(t, err)
+	require.Equal(t, txn2.ID, state.txn.ID)
+	require.False(t, state.held)
+	require.Zero(t, state.lockHeldDuration)
+
+	// When txn2 acquires the lock, the waiter is informed that the lock is now
+	// held, and the duration is measured from txn2's acquisition.
+	manualClock.Advance(2 * time.Second)
+	acquire(txn2)
+	lt.Dequeue(g2)
+	state, err = g3.CurState()
+	require.NoError(t, err)
+	require.Equal(t, txn2.ID, state.txn.ID)
+	require.True(t, state.held)
+	require.Zero(t, state.lockHeldDuration)
+	lt.Dequeue(g3)
+}
+
+// TestLockTableQueuedBeforeAcquireLatency tests that the time a request spent
+// queued before its transaction acquired the lock is recorded, but that the
+// time spent by a request that gave up waiting is not.
+func TestLockTableQueuedBeforeAcquireLatency(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	manualClock := timeutil.NewManualTime(timeutil.Unix(0, 123))
+	lt := newTestLockTable(1000, hlc.NewClockForTesting(manualClock), nil)
+	h := metric.NewHistogram(metric.HistogramOptions{
+		Metadata:     metric.Metadata{Name: "test.queued_before_acquire_latency"},
+		Duration:     time.Minute,
+		BucketConfig: metric.IOLatencyBuckets,
+	})
+	lt.counters.queuedBeforeAcquire = h
+
+	k := roachpb.Key("a")
+	txn1, txn2, txn3 := makeTestTxn(), makeTestTxn(), makeTestTxn()
+	acquire := func(txn *roachpb.Transaction) {
+		acq := roachpb.MakeLockAcquisition(txn, k, lock.Unreplicated, lock.Exclusive)
+		require.NoError(t, lt.AcquireLock(&acq))
+	}
+	scan := func(txn *roachpb.Transaction) lockTableGuard {
+		latchSpans := &spanset.SpanSet{}
+		latchSpans.AddMVCC(spanset.SpanReadWrite, roachpb.Span{Key: k}, hlc.Timestamp{WallTime: 10})
+		lockSpans := &lockspanset.LockSpanSet{}
+		lockSpans.Add(lock.Intent, roachpb.Span{Key: k})
+		g, err := lt.ScanAndEnqueue(Request{
+			Txn:        txn,
+			Timestamp:  hlc.Timestamp{WallTime: 10},
+			LatchSpans: latchSpans,
+			LockSpans:  lockSpans,
+		}, nil)
+		require.Nil(t, err)
+		require.True(t, g.ShouldWait())
+		return g
+	}
+
+	acquire(txn1)
+	g2 := scan(txn2)
+	g3 := scan(txn3)
+	manualClock.Advance(5 * time.Millisecond)
+	// txn3's request gives up waiting; it isn't recorded.
+	lt.Dequeue(g3)
+	count, _ := h.Total()
+	require.Zero(t, count)
+
+	// txn2's request is released once txn1 releases its lock, and txn2 acquires
+	// the lock.
+	require.NoError(t, lt.UpdateLocks(&roachpb.LockUpdate{
+		Span: roachpb.Span{Key: k}, Txn: txn1.TxnMeta, Status: roachpb.COMMITTED,
+	}))
+	acquire(txn2)
+	lt.Dequeue(g2)
+	count, sum := h.Total()
+	require.Equal(t, int64(1), count)
+	require.Equal(t, float64(5*time.Millisecond), sum)
+}
+
+// TestLockTableMaxLockWaitDuration verifies that a request with a maximum lock
+// wait duration transitions to the waitDeadlineExceeded state once it has
+// waited on a single lock for that long, and that the wait starts over when the
+// request moves on to wait on a different key.
+func TestLockTableMaxLockWaitDuration(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	manualClock := timeutil.NewManualTime(timeutil.Unix(0, 123))
+	lt := newTestLockTable(1000, hlc.NewClockForTesting(manualClock), nil)
+
+	keyA, keyB := roachpb.Key("a"), roachpb.Key("b")
+	txn1, txn2 := makeTestTxn(), makeTestTxn()
+	for _, k := range []roachpb.Key{keyA, keyB} {
+		acq := roachpb.MakeLockAcquisition(txn1, k, lock.Unreplicated, lock.Exclusive)
+		require.NoError(t, lt.AcquireLock(&acq))
+	}
+
+	span := roachpb.Span{Key: keyA, EndKey: roachpb.Key("c")}
+	latchSpans := &spanset.SpanSet{}
+	latchSpans.AddMVCC(spanset.SpanReadWrite, span, hlc.Timestamp{WallTime: 10})
+	lockSpans := &lockspanset.LockSpanSet{}
+	lockSpans.Add(lock.Intent, span)
+	g, err := lt.ScanAndEnqueue(Request{
+		Txn:                 txn2,
+		Timestamp:           hlc.Timestamp{WallTime: 10},
+		MaxLockWaitDuration: 5 * time.Second,
+		LatchSpans:          latchSpans,
+		LockSpans:           lockSpans,
+	}, nil)
+	require.Nil(t, err)
+	require.True(t, g.ShouldWait())
+	defer lt.Dequeue(g)
+
+	manualClock.Advance(4 * time.Second)
+	state, err := g.CurState()
+	require.NoError(t, err)
+	require.Equal(t, waitForDistinguished, state.kind)
+	require.Equal(t, keyA, state.key)
+
+	// Once the lock on a is released, the request waits on b, and the wait
+	// starts over.
+	require.NoError(t, lt.UpdateLocks(&roachpb.LockUpdate{
+		Span: roachpb.Span{Key: keyA}, Txn: txn1.TxnMeta, Status: roachpb.COMMITTED,
+	}))
+	manualClock.Advance(4 * time.Second)
+	state, err = g.CurState()
+	require.NoError(t, err)
+	require.Equal(t, waitForDistinguished, state.kind)
+	require.Equal(t, keyB, state.key)
+
+	manualClock.Advance(time.Second)
+	state, err = g.CurState()
+	require.NoError(t, err)
+	require.Equal(t, waitDeadlineExceeded, state.kind)
+	require.Equal(t, keyB, state.key)
+	require.Equal(t, txn1.ID, state.txn.ID)
+}
+
+// TestLockTableNonTxnWriterClaims verifies that a non-transactional writer
+// that supplies a claim identity claims a lock once it is released, so that
+// requests queued behind it wait for and push that identity, while one that
+// doesn't is removed from the wait-queue and lets the next request claim the
+// lock instead.
+func TestLockTableNonTxnWriterClaims(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	for _, claim := range []bool{false, true} {
+		t.Run(fmt.Sprintf("claim=%t", claim), func(t *testing.T) {
+			lt := newTestLockTable(1000, nil, nil)
+
+			k := roachpb.Key("a")
+			txn1, txn2 := makeTestTxn(), makeTestTxn()
+			acq := roachpb.MakeLockAcquisition(txn1, k, lock.Unreplicated, lock.Exclusive)
+			require.NoError(t, lt.AcquireLock(&acq))
+
+			claimTxn := &enginepb.TxnMeta{ID: uuid.MakeV4(), WriteTimestamp: hlc.Timestamp{WallTime: 10}}
+			makeReq := func(txn *roachpb.Transaction) Request {
+				latchSpans := &spanset.SpanSet{}
+				latchSpans.AddMVCC(spanset.SpanReadWrite, roachpb.Span{Key: k}, hlc.Timestamp{WallTime: 10})
+				lockSpans := &lockspanset.LockSpanSet{}
+				lockSpans.Add(lock.Intent, roachpb.Span{Key: k})
+				req := Request{
+					Txn:        txn,
+					Timestamp:  hlc.Timestamp{WallTime: 10},
+					LatchSpans: latchSpans,
+					LockSpans:  lockSpans,
+				}
+				if txn == nil && claim {
+					req.NonTxnClaimTxn = claimTxn
+				}
+				return req
+			}
+			nonTxnG, err := lt.ScanAndEnqueue(makeReq(nil), nil)
+			require.Nil(t, err)
+			require.True(t, nonTxnG.ShouldWait())
+			defer lt.Dequeue(nonTxnG)
+			txnG, err := lt.ScanAndEnqueue(makeReq(txn2), nil)
+			require.Nil(t, err)
+			require.True(t, txnG.ShouldWait())
+			defer lt.Dequeue(txnG)
+
+			require.NoError(t, lt.UpdateLocks(&roachpb.LockUpdate{
+				Span: roachpb.Span{Key: k}, Txn: txn1.TxnMeta, Status: roachpb.COMMITTED,
+			}))
+			state, err := nonTxnG.CurState()
+			require.NoError(t, err)
+			require.Equal(t, doneWaiting, state.kind)
+
+			state, err = txnG.CurState()
+			require.NoError(t, err)
+			if claim {
+				// The non-transactional writer claimed the lock under its claim
+				// identity, so the transactional request keeps waiting on it.
+				require.Equal(t, waitForDistinguished, state.kind)
+				require.False(t, state.held)
+				require.Equal(t, claimTxn.ID, state.txn.ID)
+			} else {
+				require.Equal(t, doneWaiting, state.kind)
+			}
+		})
+	}
+}
+
+// TestLockTableTwoNonTxnWriterClaims verifies that two non-transactional
+// writers queued on the same lock are told apart by their claim identities:
+// once the lock is released and the first one claims it, the second one waits
+// for the first one's identity if they differ, sits tight if they share it, and
+// proceeds if the first one had no identity to claim the lock under.
+func TestLockTableTwoNonTxnWriterClaims(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	claimTxn1 := &enginepb.TxnMeta{ID: uuid.MakeV4(), WriteTimestamp: hlc.Timestamp{WallTime: 10}}
+	claimTxn2 := &enginepb.TxnMeta{ID: uuid.MakeV4(), WriteTimestamp: hlc.Timestamp{WallTime: 10}}
+	testCases := []struct {
+		name                 string
+		claim1, claim2       *enginepb.TxnMeta
+		expState1, expState2 waitKind
+	}{
+		{
+			name:      "no identities",
+			expState1: doneWaiting, expState2: doneWaiting,
+		},
+		{
+			name:   "second identity",
+			claim2: claimTxn2,
+			// The first writer can't claim the lock, so it is removed from the
+			// wait-queue and the second one claims the lock instead.
+			expState1: doneWaiting, expState2: doneWaiting,
+		},
+		{
+			name:   "distinct identities",
+			claim1: claimTxn1, claim2: claimTxn2,
+			expState1: doneWaiting, expState2: waitForDistinguished,
+		},
+		{
+			name:   "shared identity",
+			claim1: claimTxn1, claim2: claimTxn1,
+			expState1: doneWaiting, expState2: waitSelf,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lt := newTestLockTable(1000, nil, nil)
+
+			k := roachpb.Key("a")
+			txn := makeTestTxn()
+			acq := roachpb.MakeLockAcquisition(txn, k, lock.Unreplicated, lock.Exclusive)
+			require.NoError(t, lt.AcquireLock(&acq))
+
+			makeReq := func(claimTxn *enginepb.TxnMeta) Request {
+				latchSpans := &spanset.SpanSet{}
+				latchSpans.AddMVCC(spanset.SpanReadWrite, roachpb.Span{Key: k}, hlc.Timestamp{WallTime: 10})
+				lockSpans := &lockspanset.LockSpanSet{}
+				lockSpans.Add(lock.Intent, roachpb.Span{Key: k})
+				return Request{
+					Timestamp:      hlc.Timestamp{WallTime: 10},
+					NonTxnClaimTxn: claimTxn,
+					LatchSpans:     latchSpans,
+					LockSpans:      lockSpans,
+				}
+			}
+			g1, err := lt.ScanAndEnqueue(makeReq(tc.claim1), nil)
+			require.Nil(t, err)
+			require.True(t, g1.ShouldWait())
+			defer lt.Dequeue(g1)
+			g2, err := lt.ScanAndEnqueue(makeReq(tc.claim2), nil)
+			require.Nil(t, err)
+			require.True(t, g2.ShouldWait())
+			defer lt.Dequeue(g2)
+
+			require.NoError(t, lt.UpdateLocks(&roachpb.LockUpdate{
+				Span: roachpb.Span{Key: k}, Txn: txn.TxnMeta, Status: roachpb.COMMITTED,
+			}))
+			state, err := g1.CurState()
+			require.NoError(t, err)
+			require.Equal(t, tc.expState1, state.kind)
+
+			state, err = g2.CurState()
+			require.NoError(t, err)
+			require.Equal(t, tc.expState2, state.kind)
+			if tc.expState2 == waitForDistinguished {
+				require.False(t, state.held)
+				require.Equal(t, tc.claim1.ID, state.txn.ID)
+			}
+		})
+	}
+}
+
+// TestLockTableWaitPositionEstimate tests that a request's estimated position
+// in line accounts for the requests that are ordered before it: those that
+// sequenced before it or, with PriorityOrderedWaitQueues, those from higher
+// priority transactions.
+func TestLockTableWaitPositionEstimate(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testutils.RunTrueAndFalse(t, "byPriority", func(t *testing.T, byPriority bool) {
+		st := cluster.MakeTestingClusterSettings()
+		PriorityOrderedWaitQueues.Override(context.Background(), &st.SV, byPriority)
+		lt := newTestLockTable(1000, nil, st)
+
+		k := roachpb.Key("a")
+		holder := makeTestTxn()
+		holder.Priority = 1
+		acq := roachpb.MakeLockAcquisition(holder, k, lock.Unreplicated, lock.Exclusive)
+		require.NoError(t, lt.AcquireLock(&acq))
+
+		// The last request to sequence has the highest priority.
+		var guards []lockTableGuard
+		for _, priority := range []enginepb.TxnPriority{1, 1, 5} {
+			latchSpans := &spanset.SpanSet{}
+			latchSpans.AddMVCC(spanset.SpanReadWrite, roachpb.Span{Key: k}, hlc.Timestamp{WallTime: 10})
+			lockSpans := &lockspanset.LockSpanSet{}
+			lockSpans.Add(lock.Intent, roachpb.Span{Key: k})
+			txn := makeTestTxn()
+			txn.Priority = priority
+			g, err := lt.ScanAndEnqueue(Request{
+				Txn:        txn,
+				Timestamp:  hlc.Timestamp{WallTime: 10},
+				LatchSpans: latchSpans,
+				LockSpans:  lockSpans,
+			}, nil)
+			require.Nil(t, err)
+			require.True(t, g.ShouldWait())
+			guards = append(guards, g)
+		}
+		expPositions := []int{0, 1, 2}
+		if byPriority {
+			expPositions = []int{1, 2, 0}
+		}
+		for i, g := range guards {
+			require.Equal(t, expPositions[i], g.WaitPositionEstimate())
+		}
+
+		// Once the first request to sequence gives up, everyone ordered behind it
+		// moves up in line.
+		lt.Dequeue(guards[0])
+		expPositions = []int{0, 1}
+		if byPriority {
+			expPositions = []int{1, 0}
+		}
+		require.Equal(t, expPositions[0], guards[1].WaitPositionEstimate())
+		require.Equal(t, expPositions[1], guards[2].WaitPositionEstimate())
+		lt.Dequeue(guards[1])
+		lt.Dequeue(guards[2])
+	})
+}
+
+// TestLockTableWaitingStateTxnPriority verifies that a waiter's waiting state
+// reports the priority of the conflicting lock holder, and that the priority is
+// reported as unknown when the conflict is a running request that has yet to
+// acquire the lock.
+func TestLockTableWaitingStateTxnPriority(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	lt := newTestLockTable(1000, nil, nil)
+
+	k := roachpb.Key("a")
+	txn1, txn2, txn3 := makeTestTxn(), makeTestTxn(), makeTestTxn()
+	txn1.Priority, txn2.Priority, txn3.Priority = 7, 8, 9
+	acquire := func(txn *roachpb.Transaction) {
+		acq := roachpb.MakeLockAcquisition(txn, k, lock.Unreplicated, lock.Exclusive)
+		require.NoError(t, lt.AcquireLock(&acq))
+	}
+	scan := func(txn *roachpb.Transaction) lockTableGuard {
+		latchSpans := &spanset.SpanSet{}
+		latchSpans.AddMVCC(spanset.SpanReadWrite, roachpb.Span{Key: k}, hlc.Timestamp{WallTime: 10})
+		lockSpans := &lockspanset.LockSpanSet{}
+		lockSpans.Add(lock.Intent, roachpb.Span{Key: k})
+		g, err := lt.ScanAndEnqueue(Request{
+			Txn:        txn,
+			Timestamp:  hlc.Timestamp{WallTime: 10},
+			LatchSpans: latchSpans,
+			LockSpans:  lockSpans,
+		}, nil)
+		require.Nil(t, err)
+		require.True(t, g.ShouldWait())
+		return g
+	}
+
+	acquire(txn1)
+	g2 := scan(txn2)
+	state, err := g2.CurState()
+	require.NoError(t, err)
+	require.Equal(t, txn1.ID, state.txn.ID)
+	require.True(t, state.txnPriorityKnown)
+	require.Equal(t, enginepb.TxnPriority(7), state.txnPriority)
+	require.False(t, state.unacquiredClaim)
+
+	// Once txn1 releases the lock, txn2's request claims it without holding it.
+	// A request from txn3 waiting on it doesn't learn txn2's priority.
+	require.NoError(t, lt.UpdateLocks(&roachpb.LockUpdate{
+		Span: roachpb.Span{Key: k}, Txn: txn1.TxnMeta, Status: roachpb.COMMITTED,
+	}))
+	g3 := scan(txn3)
+	state, err = g3.CurState()
+	require.NoError(t, err)
+	require.Equal(t, txn2.ID, state.txn.ID)
+	require.False(t, state.held)
+	require.False(t, state.txnPriorityKnown)
+	require.Zero(t, state.txnPriority)
+	require.True(t, state.unacquiredClaim)
+	require.Contains(t, state.String(), "holding unacquired claim")
+
+	// When txn2 acquires the lock, the waiter learns its priority.
+	acquire(txn2)
+	lt.Dequeue(g2)
+	state, err = g3.CurState()
+	require.NoError(t, err)
+	require.Equal(t, txn2.ID, state.txn.ID)
+	require.True(t, state.txnPriorityKnown)
+	require.Equal(t, enginepb.TxnPriority(8), state.txnPriority)
+	lt.Dequeue(g3)
+}
+
+// TestLockTableIgnoredLockHolderTxns tests that a non-locking read does not
+// conflict with locks held by transactions it has been told to ignore, unless
+// it discovered them during evaluation, and that locking requests are not
+// allowed to ignore any transactions.
+func TestLockTableIgnoredLockHolderTxns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	lt := newTestLockTable(1000, nil, nil)
+
+	sibling, txn := makeTestTxn(), makeTestTxn()
+	makeReq := func(txn *roachpb.Transaction, k roachpb.Key, ignore bool) Request {
+		latchSpans := &spanset.SpanSet{}
+		latchSpans.AddMVCC(spanset.SpanReadOnly, roachpb.Span{Key: k}, hlc.Timestamp{WallTime: 10})
+		lockSpans := &lockspanset.LockSpanSet{}
+		lockSpans.Add(lock.None, roachpb.Span{Key: k})
+		req := Request{
+			Txn:        txn,
+			Timestamp:  hlc.Timestamp{WallTime: 10},
+			LatchSpans: latchSpans,
+			LockSpans:  lockSpans,
+		}
+		if ignore {
+			req.IgnoredLockHolderTxns = []uuid.UUID{sibling.ID}
+		}
+		return req
+	}
+
+	// The sibling holds an unreplicated lock on key a.
+	keyA := roachpb.Key("a")
+	acq := roachpb.MakeLockAcquisition(sibling, keyA, lock.Unreplicated, lock.Exclusive)
+	require.NoError(t, lt.AcquireLock(&acq))
+
+	g, err := lt.ScanAndEnqueue(makeReq(txn, keyA, true /* ignore */), nil)
+	require.Nil(t, err)
+	require.False(t, g.ShouldWait())
+	// Unlike a lock held by a finalized transaction, the lock isn't resolved.
+	require.Empty(t, g.ResolveBeforeScanning())
+	lt.Dequeue(g)
+
+	g, err = lt.ScanAndEnqueue(makeReq(txn, keyA, false /* ignore */), nil)
+	require.Nil(t, err)
+	require.True(t, g.ShouldWait())
+	lt.Dequeue(g)
+
+	// A locking request may not ignore the sibling's locks.
+	lockingReq := makeReq(txn, keyA, true /* ignore */)
+	lockingReq.LatchSpans = &spanset.SpanSet{}
+	lockingReq.LatchSpans.AddMVCC(spanset.SpanReadWrite, roachpb.Span{Key: keyA}, hlc.Timestamp{WallTime: 10})
+	lockingReq.LockSpans = &lockspanset.LockSpanSet{}
+	lockingReq.LockSpans.Add(lock.Exclusive, roachpb.Span{Key: keyA})
+	g, err = lt.ScanAndEnqueue(lockingReq, nil)
+	require.Nil(t, g)
+	require.NotNil(t, err)
+	require.Regexp(t, "only supported for non-locking reads", err.GoError())
+
+	// The sibling's replicated lock on key c, discovered by another request, is
+	// ignored too.
+	keyC := roachpb.Key("c")
+	g, err = lt.ScanAndEnqueue(makeReq(txn, keyC, false /* ignore */), nil)
+	require.Nil(t, err)
+	added, addErr := lt.AddDiscoveredLock(
+		newLock(&sibling.TxnMeta, keyC, lock.Intent), 0, false, g)
+	require.NoError(t, addErr)
+	require.True(t, added)
+	lt.Dequeue(g)
+	g, err = lt.ScanAndEnqueue(makeReq(txn, keyC, true /* ignore */), nil)
+	require.Nil(t, err)
+	require.False(t, g.ShouldWait())
+	require.Empty(t, g.ResolveBeforeScanning())
+	lt.Dequeue(g)
+
+	// Once the request discovers the sibling's replicated lock on key b during
+	// evaluation, it no longer ignores the lock.
+	keyB := roachpb.Key("b")
+	g, err = lt.ScanAndEnqueue(makeReq(txn, keyB, true /* ignore */), nil)
+	require.Nil(t, err)
+	require.False(t, g.ShouldWait())
+	added, addErr = lt.AddDiscoveredLock(
+		newLock(&sibling.TxnMeta, keyB, lock.Intent), 0, false, g)
+	require.NoError(t, addErr)
+	require.True(t, added)
+	g, err = lt.ScanAndEnqueue(makeReq(txn, keyB, true /* ignore */), g)
+	require.Nil(t, err)
+	require.True(t, g.ShouldWait())
+	state, stateErr := g.CurState()
+	require.NoError(t, stateErr)
+	require.Equal(t, sibling.ID, state.txn.ID)
+	lt.Dequeue(g)
+}
+
+// TestLockRediscoveryTrackerEvictsOldest verifies that a full shard of a
+// lockRediscoveryTracker evicts the key whose window started the longest ago to
+// make room for a new key.
+func TestLockRediscoveryTrackerEvictsOldest(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	var r lockRediscoveryTracker
+	const perShard = maxTrackedLockRediscoveries / lockRediscoveryTrackerShards
+	// Find enough keys that map to the same shard to overflow it.
+	sh := r.shard(roachpb.Key("k0"))
+	var ks []roachpb.Key
+	for i := 0; len(ks) <= perShard; i++ {
+		if k := roachpb.Key(fmt.Sprintf("k%d", i)); r.shard(k) == sh {
+			ks = append(ks, k)
+		}
+	}
+
+	txnID := uuid.MakeV4()
+	now := timeutil.Unix(0, 123)
+	record := func(k roachpb.Key) int64 {
+		now = now.Add(time.Millisecond)
+		count, _ := r.record(k, txnID, now, 100 /* threshold */)
+		return count
+	}
+	for _, k := range ks[:perShard] {
+		require.Equal(t, int64(1), record(k))
+	}
+	// Rediscovering a key within its window doesn't restart the window.
+	require.Equal(t, int64(2), record(ks[0]))
+
+	// Tracking one more key evicts the oldest one, which starts over when it's
+	// discovered again, evicting the next oldest.
+	require.Equal(t, int64(1), record(ks[perShard]))
+	require.Equal(t, int64(1), record(ks[0]))
+	require.Equal(t, int64(2), record(ks[2]))
+	require.Equal(t, int64(1), record(ks[1]))
+	require.Len(t, sh.entries, perShard)
+}
+
+// TestClaimantChangeBuffer verifies that a claimantChangeBuffer retains the
+// most recent events, including across changes of its size.
+func TestClaimantChangeBuffer(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	var b claimantChangeBuffer
+	require.Empty(t, b.snapshot())
+	keysOf := func(events []ClaimantChangeEvent) []string {
+		var res []string
+		for _, ev := range events {
+			res = append(res, string(ev.Key))
+		}
+		return res
+	}
+	record := func(size int, ks ...string) {
+		for _, k := range ks {
+			b.record(ClaimantChangeEvent{Key: roachpb.Key(k)}, size)
+		}
+	}
+
+	record(3, "a", "b")
+	require.Equal(t, []string{"a", "b"}, keysOf(b.snapshot()))
+	record(3, "c", "d", "e")
+	require.Equal(t, []string{"c", "d", "e"}, keysOf(b.snapshot()))
+	// Shrinking the buffer retains the most recent events.
+	record(2, "f")
+	require.Equal(t, []string{"e", "f"}, keysOf(b.snapshot()))
+	// Growing the buffer retains all events.
+	record(4, "g", "h", "i")
+	require.Equal(t, []string{"f", "g", "h", "i"}, keysOf(b.snapshot()))
+}
+
+// TestLockTableOptimisticEvalMetrics verifies that the lock table tracks the
+// guards created by ScanOptimistic, and counts the requests that evaluate
+// optimistically and those that fall back to pessimistic evaluation.
+func TestLockTableOptimisticEvalMetrics(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	lt := newTestLockTable(1000, nil, nil)
+
+	ts := hlc.Timestamp{WallTime: 10}
+	holder := makeTestTxn()
+	acq := roachpb.MakeLockAcquisition(holder, roachpb.Key("a"), lock.Unreplicated, lock.Exclusive)
+	require.NoError(t, lt.AcquireLock(&acq))
+
+	span := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("c")}
+	latchSpans := &spanset.SpanSet{}
+	latchSpans.AddMVCC(spanset.SpanReadOnly, span, ts)
+	lockSpans := &lockspanset.LockSpanSet{}
+	lockSpans.Add(lock.None, span)
+	req := Request{Txn: makeTestTxn(), Timestamp: ts, LatchSpans: latchSpans, LockSpans: lockSpans}
+
+	// A request that conflicts with the lock falls back to pessimistic
+	// evaluation.
+	g1 := lt.ScanOptimistic(req)
+	g2 := lt.ScanOptimistic(req)
+	require.Equal(t, int64(2), lt.Metrics().OptimisticGuards)
+	require.False(t, g1.CheckOptimisticNoConflicts(lockSpans))
+	g1, err := lt.ScanAndEnqueue(req, g1)
+	require.Nil(t, err)
+	require.True(t, g1.ShouldWait())
+	m := lt.Metrics()
+	require.Equal(t, int64(1), m.OptimisticGuards)
+	require.Equal(t, int64(2), m.OptimisticEvals)
+	require.Equal(t, int64(1), m.OptimisticEvalFallbacks)
+	lt.Dequeue(g1)
+
+	// A request that is dequeued after evaluating optimistically did not fall
+	// back.
+	lt.Dequeue(g2)
+	m = lt.Metrics()
+	require.Equal(t, int64(0), m.OptimisticGuards)
+	require.Equal(t, int64(2), m.OptimisticEvals)
+	require.Equal(t, int64(1), m.OptimisticEvalFallbacks)
+}
+
+// TestLockTableResolutionDedupMetrics verifies that the lock table counts the
+// replicated locks to resolve that requests pass through for resolution, and
+// those dropped because another request already resolved them.
+func TestLockTableResolutionDedupMetrics(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	lt := newTestLockTable(1000, nil, nil)
+
+	ts := hlc.Timestamp{WallTime: 10}
+	makeReq := func(str lock.Strength, span roachpb.Span) Request {
+		latchSpans := &spanset.SpanSet{}
+		sa := spanset.SpanReadWrite
+		if str == lock.None {
+			sa = spanset.SpanReadOnly
+		}
+		latchSpans.AddMVCC(sa, span, ts)
+		lockSpans := &lockspanset.LockSpanSet{}
+		lockSpans.Add(str, span)
+		return Request{Txn: makeTestTxn(), Timestamp: ts, LatchSpans: latchSpans, LockSpans: lockSpans}
+	}
+	keyA, keyB := roachpb.Key("a"), roachpb.Key("b")
+
+	// The lock on a is discovered before its holder is known to be finalized,
+	// so it is added to the lock table.
+	finalized := makeTestTxn()
+	g, err := lt.ScanAndEnqueue(makeReq(lock.None, roachpb.Span{Key: keyA}), nil)
+	require.Nil(t, err)
+	foundLock := roachpb.MakeLock(&finalized.TxnMeta, keyA, lock.Intent)
+	added, addErr := lt.AddDiscoveredLock(&foundLock, 0, false, g)
+	require.NoError(t, addErr)
+	require.True(t, added)
+	lt.Dequeue(g)
+	finalized.Status = roachpb.ABORTED
+	lt.PushedTransactionUpdated(finalized)
+
+	holder := makeTestTxn()
+	acq := roachpb.MakeLockAcquisition(holder, keyB, lock.Unreplicated, lock.Exclusive)
+	require.NoError(t, lt.AcquireLock(&acq))
+
+	// g1 accumulates the lock on a to resolve, but waits at b.
+	g1, err := lt.ScanAndEnqueue(makeReq(lock.Intent, roachpb.Span{Key: keyA, EndKey: roachpb.Key("c")}), nil)
+	require.Nil(t, err)
+	require.True(t, g1.ShouldWait())
+
+	// g2 also accumulates the lock on a to resolve. It finishes its scan first,
+	// so its lock update is passed through, removing the lock from the lock
+	// table.
+	g2, err := lt.ScanAndEnqueue(makeReq(lock.None, roachpb.Span{Key: keyA}), nil)
+	require.Nil(t, err)
+	require.Len(t, g2.ResolveBeforeScanning(), 1)
+	m := lt.Metrics()
+	require.Equal(t, int64(0), m.ResolutionsDeduped)
+	require.Equal(t, int64(1), m.ResolutionsPassedThrough)
+
+	// Once the lock on b is released, g1 finishes its scan, and its lock update
+	// is dropped as a no-op.
+	require.NoError(t, lt.UpdateLocks(&roachpb.LockUpdate{
+		Span: roachpb.Span{Key: keyB}, Txn: holder.TxnMeta, Status: roachpb.COMMITTED,
+	}))
+	state, stateErr := g1.CurState()
+	require.NoError(t, stateErr)
+	require.Equal(t, doneWaiting, state.kind)
+	require.Empty(t, g1.ResolveBeforeScanning())
+	m = lt.Metrics()
+	require.Equal(t, int64(1), m.ResolutionsDeduped)
+	require.Equal(t, int64(1), m.ResolutionsPassedThrough)
+
+	lt.Dequeue(g1)
+	lt.Dequeue(g2)
+}
+
+// TestLockTableContentionByKeyRangeLocalKeys verifies that locks on range-local
+// keys are bucketed separately from locks on global keys.
+func TestLockTableContentionByKeyRangeLocalKeys(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	manualClock := timeutil.NewManualTime(timeutil.Unix(0, 123))
+	lt := newTestLockTable(1000, hlc.NewClockForTesting(manualClock), nil)
+
+	txn := makeTestTxn()
+	for _, k := range []roachpb.Key{
+		keys.RangeDescriptorKey(roachpb.RKey("a")),
+		keys.RangeDescriptorKey(roachpb.RKey("z")),
+		roachpb.Key("a"),
+		roachpb.Key("b"),
+	} {
+		acq := roachpb.MakeLockAcquisition(txn, k, lock.Unreplicated, lock.Exclusive)
+		require.NoError(t, lt.AcquireLock(&acq))
+	}
+	manualClock.Advance(time.Second)
+
+	contention := lt.ContentionByKeyRange(2)
+	for _, buckets := range [][]LockContentionBucket{contention.Local, contention.Global} {
+		require.Len(t, buckets, 2)
+		for _, b := range buckets {
+			require.Equal(t, int64(1), b.Locks)
+			require.Equal(t, int64(1), b.LocksHeld)
+			require.Equal(t, time.Second.Nanoseconds(), b.HoldDurationNanos)
+		}
+	}
+	for _, b := range contention.Local {
+		require.True(t, keys.IsLocal(b.Span.Key))
+		require.True(t, keys.IsLocal(b.Span.EndKey))
+	}
+	require.Equal(t, roachpb.Key("a"), contention.Global[0].Span.Key)
+	require.Equal(t, roachpb.Key("b").Next(), contention.Global[1].Span.EndKey)
+
+	// An empty lock table has no buckets.
+	lt.Clear(true /* disable */)
+	require.Equal(t, LockContentionByKeyRange{}, lt.ContentionByKeyRange(2))
+}
+
+// TestLockTableSplitMergeRangeLocalKeys verifies that SplitAt partitions locks
+// on range-local keys by their address, and that Merge merges the holders of a
+// transferred lock into a lock on the same key that is already tracked.
+func TestLockTableSplitMergeRangeLocalKeys(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	clock := hlc.NewClockForTesting(timeutil.NewManualTime(timeutil.Unix(0, 123)))
+	st := cluster.MakeTestingClusterSettings()
+	newLT := func(rangeID roachpb.RangeID) *lockTableImpl {
+		lt := newLockTable(1000, rangeID, clock, st, nil /* statusCache */)
+		lt.enabled = true
+		return lt
+	}
+	lhs, rhs := newLT(3), newLT(4)
+
+	txn1, txn2, txn3 := makeTestTxn(), makeTestTxn(), makeTestTxn()
+	acquire := func(lt *lockTableImpl, txn *roachpb.Transaction, k roachpb.Key, str lock.Strength) {
+		acq := roachpb.MakeLockAcquisition(txn, k, lock.Unreplicated, str)
+		require.NoError(t, lt.AcquireLock(&acq))
+	}
+	lockedKeys := func(lt *lockTableImpl) []roachpb.Key {
+		lt.locks.mu.RLock()
+		defer lt.locks.mu.RUnlock()
+		var ks []roachpb.Key
+		iter := lt.locks.MakeIter()
+		for iter.First(); iter.Valid(); iter.Next() {
+			ks = append(ks, iter.Cur().key)
+		}
+		return ks
+	}
+
+	lhsLocal := keys.RangeDescriptorKey(roachpb.RKey("a"))
+	rhsLocal := keys.RangeDescriptorKey(roachpb.RKey("c"))
+	keyA, keyC, keyD := roachpb.Key("a"), roachpb.Key("c"), roachpb.Key("d")
+	for _, k := range []roachpb.Key{lhsLocal, rhsLocal, keyA, keyC} {
+		acquire(lhs, txn1, k, lock.Exclusive)
+	}
+	acquire(lhs, txn1, keyD, lock.Shared)
+
+	// The lock on the range-local key addressed to the RHS moves to the RHS,
+	// even though it sorts before the split key.
+	rhs.Merge(lhs.SplitAt(roachpb.RKey("b")))
+	require.Equal(t, []roachpb.Key{lhsLocal, keyA}, lockedKeys(lhs))
+	require.Equal(t, []roachpb.Key{rhsLocal, keyC, keyD}, lockedKeys(rhs))
+
+	// Another transaction acquires a lock on one of the keys split off to the
+	// RHS, in the LHS, and a request waits on it.
+	acquire(lhs, txn2, keyD, lock.Shared)
+	latchSpans := &spanset.SpanSet{}
+	latchSpans.AddMVCC(spanset.SpanReadWrite, roachpb.Span{Key: keyD}, hlc.Timestamp{WallTime: 10})
+	lockSpans := &lockspanset.LockSpanSet{}
+	lockSpans.Add(lock.Exclusive, roachpb.Span{Key: keyD})
+	req := Request{
+		Txn:        txn3,
+		Timestamp:  hlc.Timestamp{WallTime: 10},
+		LatchSpans: latchSpans,
+		LockSpans:  lockSpans,
+	}
+	g, err := lhs.ScanAndEnqueue(req, nil)
+	require.Nil(t, err)
+	require.True(t, g.ShouldWait())
+
+	// Merging the RHS back merges the holders of the lock, and the waiting
+	// request continues to wait on the lock's first holder.
+	lhs.Merge(rhs.SplitAt(roachpb.RKeyMin))
+	require.Equal(t, []roachpb.Key{lhsLocal, rhsLocal, keyA, keyC, keyD}, lockedKeys(lhs))
+	require.Empty(t, lockedKeys(rhs))
+	state, stateErr := g.CurState()
+	require.NoError(t, stateErr)
+	require.Equal(t, waitForDistinguished, state.kind)
+	require.Equal(t, txn2.ID, state.txn.ID)
+	lhs.locks.mu.RLock()
+	iter := lhs.locks.MakeIter()
+	iter.FirstOverlap(&keyLocks{key: keyD})
+	require.True(t, iter.Valid())
+	var holders []uuid.UUID
+	for _, tl := range iter.Cur().lockHolders() {
+		holders = append(holders, tl.txn.ID)
+	}
+	lhs.locks.mu.RUnlock()
+	require.Equal(t, []uuid.UUID{txn2.ID, txn1.ID}, holders)
+	lhs.Dequeue(g)
+}
+
+// TestLockTableSameTxnScanDonation verifies that, if SameTxnScanDonation is
+// enabled, a request released from a wait-queue because its own transaction
+// acquired the lock skips the keys a request from the same transaction already
+// found to be free of conflicting locks, and that its latched scan checks
+// those keys again.
+func TestLockTableSameTxnScanDonation(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	testutils.RunTrueAndFalse(t, "enabled", func(t *testing.T, enabled bool) {
+		clock := hlc.NewClockForTesting(timeutil.NewManualTime(timeutil.Unix(0, 123)))
+		st := cluster.MakeTestingClusterSettings()
+		SameTxnScanDonation.Override(context.Background(), &st.SV, enabled)
+		lt := newTestLockTable(1000, clock, st)
+
+		txn1, txn2, txn3 := makeTestTxn(), makeTestTxn(), makeTestTxn()
+		acquire := func(txn *roachpb.Transaction, k roachpb.Key) {
+			acq := roachpb.MakeLockAcquisition(txn, k, lock.Unreplicated, lock.Exclusive)
+			require.NoError(t, lt.AcquireLock(&acq))
+		}
+		keyA, keyC := roachpb.Key("a"), roachpb.Key("c")
+		span := roachpb.Span{Key: keyA, EndKey: roachpb.Key("d")}
+		makeReq := func() Request {
+			latchSpans := &spanset.SpanSet{}
+			latchSpans.AddMVCC(spanset.SpanReadWrite, span, hlc.Timestamp{WallTime: 10})
+			lockSpans := &lockspanset.LockSpanSet{}
+			lockSpans.Add(lock.Exclusive, span)
+			return Request{
+				Txn:        txn2,
+				Timestamp:  hlc.Timestamp{WallTime: 10},
+				LatchSpans: latchSpans,
+				LockSpans:  lockSpans,
+			}
+		}
+
+		// Two requests from txn2 wait on txn1's lock.
+		acquire(txn1, keyA)
+		req2, req4 := makeReq(), makeReq()
+		g2, err := lt.ScanAndEnqueue(req2, nil)
+		require.Nil(t, err)
+		require.True(t, g2.ShouldWait())
+		g4, err := lt.ScanAndEnqueue(req4, nil)
+		require.Nil(t, err)
+		require.True(t, g4.ShouldWait())
+
+		// txn1 commits. req2 claims the lock and, once re-sequenced, finds no
+		// conflicting locks in its spans.
+		up := roachpb.MakeLockUpdate(txn1, roachpb.Span{Key: keyA})
+		up.Status = roachpb.COMMITTED
+		require.NoError(t, lt.UpdateLocks(&up))
+		g2, err = lt.ScanAndEnqueue(req2, g2)
+		require.Nil(t, err)
+		require.False(t, g2.ShouldWait())
+
+		// txn3 acquires a lock in the spans req2 already scanned, and then req2
+		// acquires its lock, releasing req4.
+		acquire(txn3, keyC)
+		acquire(txn2, keyA)
+		state, stateErr := g4.CurState()
+		require.NoError(t, stateErr)
+		if enabled {
+			require.Equal(t, doneWaiting, state.kind)
+		} else {
+			require.Equal(t, waitForDistinguished, state.kind)
+			require.Equal(t, txn3.ID, state.txn.ID)
+			require.Equal(t, keyC, state.key)
+		}
+
+		// The latched scan does not rely on the donated spans.
+		g4, err = lt.ScanAndEnqueue(req4, g4)
+		require.Nil(t, err)
+		require.True(t, g4.ShouldWait())
+		state, stateErr = g4.CurState()
+		require.NoError(t, stateErr)
+		require.Equal(t, waitForDistinguished, state.kind)
+		require.Equal(t, txn3.ID, state.txn.ID)
+		require.Equal(t, keyC, state.key)
+
+		lt.Dequeue(g2)
+		lt.Dequeue(g4)
+	})
+}
+
+// TestLockTableWatchDoneWaiting verifies that the channel returned by a
+// doneWaitingWatcher is closed only once the request is done waiting,
+// including when the request's waiting state has to be computed by resuming
+// its scan, or once the request is in a state that requires the caller to take
+// action.
+func TestLockTableWatchDoneWaiting(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	stopper := stop.NewStopper()
+	defer stopper.Stop(ctx)
+	lt := newTestLockTable(1000, nil, nil)
+
+	txn1, txn2, txn3, txn4 := makeTestTxn(), makeTestTxn(), makeTestTxn(), makeTestTxn()
+	for _, k := range []string{"a", "b"} {
+		acq := roachpb.MakeLockAcquisition(txn1, roachpb.Key(k), lock.Unreplicated, lock.Exclusive)
+		require.NoError(t, lt.AcquireLock(&acq))
+	}
+	scan := func(txn *roachpb.Transaction, span roachpb.Span, maxWaitQueueLength int) lockTableGuard {
+		latchSpans := &spanset.SpanSet{}
+		latchSpans.AddMVCC(spanset.SpanReadWrite, span, hlc.Timestamp{WallTime: 10})
+		lockSpans := &lockspanset.LockSpanSet{}
+		lockSpans.Add(lock.Intent, span)
+		g, err := lt.ScanAndEnqueue(Request{
+			Txn:                    txn,
+			Timestamp:              hlc.Timestamp{WallTime: 10},
+			LatchSpans:             latchSpans,
+			LockSpans:              lockSpans,
+			MaxLockWaitQueueLength: maxWaitQueueLength,
+		}, nil)
+		require.Nil(t, err)
+		return g
+	}
+	watch := func(ctx context.Context, g lockTableGuard) *doneWaitingWatcher {
+		w, err := g.WatchDoneWaiting(ctx, stopper)
+		require.NoError(t, err)
+		return w
+	}
+	release := func(k string) {
+		require.NoError(t, lt.UpdateLocks(&roachpb.LockUpdate{
+			Span: roachpb.Span{Key: roachpb.Key(k)}, Txn: txn1.TxnMeta, Status: roachpb.COMMITTED,
+		}))
+	}
+	requireOpen := func(w *doneWaitingWatcher) {
+		select {
+		case <-w.Done():
+			t.Fatalf("watch ended unexpectedly in state %s, err: %v", w.State(), w.Err())
+		default:
+		}
+	}
+
+	// A request that doesn't need to wait is done waiting immediately.
+	g := scan(txn2, roachpb.Span{Key: roachpb.Key("c")}, 0 /* maxWaitQueueLength */)
+	w := watch(ctx, g)
+	<-w.Done()
+	require.NoError(t, w.Err())
+	require.Equal(t, doneWaiting, w.State().kind)
+	lt.Dequeue(g)
+
+	// A request waiting on a and b is only done waiting once both locks are
+	// released. Releasing a requires the request to resume its scan to notice
+	// the lock on b.
+	g = scan(txn2, roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("c")}, 0 /* maxWaitQueueLength */)
+	require.True(t, g.ShouldWait())
+	w = watch(ctx, g)
+	requireOpen(w)
+	release("a")
+	requireOpen(w)
+	release("b")
+	<-w.Done()
+	require.NoError(t, w.Err())
+	require.Equal(t, doneWaiting, w.State().kind)
+
+	// A request that waits behind g's claim on a.
+	g3 := scan(txn3, roachpb.Span{Key: roachpb.Key("a")}, 0 /* maxWaitQueueLength */)
+	require.True(t, g3.ShouldWait())
+
+	// A request that finds the wait-queue on a too long ends the watch, as it
+	// must be rejected.
+	g4 := scan(txn4, roachpb.Span{Key: roachpb.Key("a")}, 1 /* maxWaitQueueLength */)
+	require.True(t, g4.ShouldWait())
+	w = watch(ctx, g4)
+	<-w.Done()
+	require.NoError(t, w.Err())
+	require.Equal(t, waitQueueMaxLengthExceeded, w.State().kind)
+
+	// Canceling the context ends the watch with an error.
+	watchCtx, cancel := context.WithCancel(ctx)
+	w = watch(watchCtx, g3)
+	requireOpen(w)
+	cancel()
+	<-w.Done()
+	require.ErrorIs(t, w.Err(), context.Canceled)
+	lt.Dequeue(g)
+	lt.Dequeue(g3)
+	lt.Dequeue(g4)
+}
+
+// TestLockTableQueryPagingWithConcurrentAcquisitions pages through the lock
+// table using QueryLockTableState while other locks are concurrently acquired,
+// and verifies that keys are returned in order, that no key is returned twice,
+// and that no lock held for the duration of the paging is skipped.
+func TestLockTableQueryPagingWithConcurrentAcquisitions(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	lt := newTestLockTable(10000, nil, nil)
+
+	// Locks on the even keys are held for the duration of the test. Locks on
+	// the odd keys are acquired concurrently with the paging.
+	const numKeys = 400
+	key := func(i int) roachpb.Key { return roachpb.Key(fmt.Sprintf("%04d", i)) }
+	txn := makeTestTxn()
+	stable := make(map[string]struct{})
+	for i := 0; i < numKeys; i += 2 {
+		acq := roachpb.MakeLockAcquisition(txn, key(i), lock.Unreplicated, lock.Exclusive)
+		require.NoError(t, lt.AcquireLock(&acq))
+		stable[string(key(i))] = struct{}{}
+	}
+
+	span := roachpb.Span{Key: key(0), EndKey: key(numKeys)}
+	opts := QueryLockTableOptions{MaxLocks: 7, IncludeUncontended: true}
+	for iter := 0; iter < 10; iter++ {
+		var g errgroup.Group
+		stop := make(chan struct{})
+		g.Go(func() error {
+			rng := rand.New(rand.NewSource(uint64(timeutil.Now().UnixNano())))
+			otherTxn := makeTestTxn()
+			for {
+				select {
+				case <-stop:
+					return nil
+				default:
+				}
+				acq := roachpb.MakeLockAcquisition(
+					otherTxn, key(2*rng.Intn(numKeys/2)+1), lock.Unreplicated, lock.Exclusive)
+				if err := lt.AcquireLock(&acq); err != nil {
+					return err
+				}
+			}
+		})
+
+		var lastKey roachpb.Key
+		var lastTS hlc.Timestamp
+		seenStable := 0
+		pageSpan := span
+		for {
+			lockInfos, resumeState, err := lt.QueryLockTableState(context.Background(), pageSpan, opts)
+			require.NoError(t, err)
+			// Each page is served from a snapshot taken at a later timestamp.
+			require.True(t, lastTS.Less(resumeState.Timestamp),
+				"snapshot timestamp %s not after %s", resumeState.Timestamp, lastTS)
+			lastTS = resumeState.Timestamp
+			for _, lockInfo := range lockInfos {
+				if lastKey != nil {
+					require.True(t, lastKey.Compare(lockInfo.Key) < 0,
+						"key %s returned after key %s", lockInfo.Key, lastKey)
+				}
+				lastKey = lockInfo.Key
+				if _, ok := stable[string(lockInfo.Key)]; ok {
+					seenStable++
+				}
+			}
+			if resumeState.ResumeSpan == nil {
+				break
+			}
+			require.Len(t, lockInfos, int(opts.MaxLocks))
+			require.Equal(t, lastKey.Next(), resumeState.ResumeSpan.Key)
+			require.Equal(t, span.EndKey, resumeState.ResumeSpan.EndKey)
+			pageSpan = *resumeState.ResumeSpan
+		}
+		close(stop)
+		require.NoError(t, g.Wait())
+		require.Equal(t, len(stable), seenStable)
+
+		// Release the concurrently acquired locks before the next iteration. This
+		// clears the whole lock table, so re-acquire the locks on the even keys.
+		lt.Clear(false /* disable */)
+		for i := 0; i < numKeys; i += 2 {
+			acq := roachpb.MakeLockAcquisition(txn, key(i), lock.Unreplicated, lock.Exclusive)
+			require.NoError(t, lt.AcquireLock(&acq))
+		}
+	}
+}
+
+// TestLockTableQueryReplicatedUncontendedLocks tests that QueryLockTableState
+// surfaces the replicated locks that aren't tracked by the lock table when
+// asked to, that it prefers the replicated locks over the in-memory state of the
+// keys that are, and that it pages through the merged results.
+func TestLockTableQueryReplicatedUncontendedLocks(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	eng := storage.NewDefaultInMemForTesting()
+	defer eng.Close()
+
+	lt := newTestLockTable(100, nil, nil)
+
+	makeTxn := func(name string) *roachpb.Transaction {
+		txn := roachpb.MakeTransaction(name, roachpb.Key("a"), 0, 0, hlc.Timestamp{WallTime: 10}, 0, 1, 0)
+		return &txn
+	}
+	txn1, txn2, txn3 := makeTxn("txn1"), makeTxn("txn2"), makeTxn("txn3")
+	acquireReplicated := func(txn *roachpb.Transaction, str lock.Strength, k string) {
+		require.NoError(t, storage.MVCCAcquireLock(ctx, eng, txn, str, roachpb.Key(k), nil, 0))
+	}
+	acquireUnreplicated := func(txn *roachpb.Transaction, k string) {
+		acq := roachpb.MakeLockAcquisition(txn, roachpb.Key(k), lock.Unreplicated, lock.Exclusive)
+		require.NoError(t, lt.AcquireLock(&acq))
+	}
+
+	// a: replicated exclusive lock held by txn1.
+	// b: replicated shared locks held by txn1 and txn2, unreplicated exclusive
+	//    lock held by txn3 in the lock table.
+	// c: unreplicated exclusive lock held by txn1 in the lock table.
+	// d: replicated shared and exclusive locks held by txn2.
+	acquireReplicated(txn1, lock.Exclusive, "a")
+	acquireReplicated(txn1, lock.Shared, "b")
+	acquireReplicated(txn2, lock.Shared, "b")
+	acquireUnreplicated(txn3, "b")
+	acquireUnreplicated(txn1, "c")
+	acquireReplicated(txn2, lock.Shared, "d")
+	acquireReplicated(txn2, lock.Exclusive, "d")
+
+	span := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("z")}
+	query := func(opts QueryLockTableOptions) ([]roachpb.LockStateInfo, QueryLockTableResumeState) {
+		opts.IncludeUncontended = true
+		lockInfos, resumeState, err := lt.QueryLockTableState(ctx, span, opts)
+		require.NoError(t, err)
+		return lockInfos, resumeState
+	}
+
+	// Without the option, only the keys tracked by the lock table are returned.
+	lockInfos, _ := query(QueryLockTableOptions{})
+	require.Len(t, lockInfos, 2)
+	require.Equal(t, roachpb.Key("b"), lockInfos[0].Key)
+	require.Equal(t, roachpb.Key("c"), lockInfos[1].Key)
+
+	// With the option, the replicated locks are merged in key order. The
+	// replicated locks at b, which are held by multiple transactions, supersede
+	// its in-memory state.
+	lockInfos, resumeState := query(QueryLockTableOptions{
+		IncludeReplicatedUncontended: true, Reader: eng,
+	})
+	require.Nil(t, resumeState.ResumeSpan)
+	require.Len(t, lockInfos, 4)
+	require.Equal(t, roachpb.Key("a"), lockInfos[0].Key)
+	require.Equal(t, txn1.ID, lockInfos[0].LockHolder.ID)
+	require.Equal(t, lock.Replicated, lockInfos[0].Durability)
+	require.Equal(t, lock.Exclusive, lockInfos[0].Strength)
+	require.Empty(t, lockInfos[0].AdditionalHolders)
+	require.Equal(t, roachpb.RangeID(3), lockInfos[0].RangeID)
+	require.Equal(t, roachpb.Key("b"), lockInfos[1].Key)
+	require.Equal(t, lock.Replicated, lockInfos[1].Durability)
+	require.Equal(t, lock.Shared, lockInfos[1].Strength)
+	require.Len(t, lockInfos[1].AdditionalHolders, 1)
+	require.ElementsMatch(t,
+		[]uuid.UUID{txn1.ID, txn2.ID},
+		[]uuid.UUID{lockInfos[1].LockHolder.ID, lockInfos[1].AdditionalHolders[0].Txn.ID})
+	require.Equal(t, roachpb.Key("c"), lockInfos[2].Key)
+	require.Equal(t, lock.Unreplicated, lockInfos[2].Durability)
+	require.Equal(t, roachpb.Key("d"), lockInfos[3].Key)
+	require.Equal(t, txn2.ID, lockInfos[3].LockHolder.ID)
+	require.Equal(t, lock.Exclusive, lockInfos[3].Strength)
+	require.Empty(t, lockInfos[3].AdditionalHolders)
+
+	// Single key spans are supported.
+	lockInfos, _, err := lt.QueryLockTableState(ctx, roachpb.Span{Key: roachpb.Key("b")}, QueryLockTableOptions{
+		IncludeUncontended: true, IncludeReplicatedUncontended: true, Reader: eng,
+	})
+	require.NoError(t, err)
+	require.Len(t, lockInfos, 1)
+	require.Equal(t, lock.Replicated, lockInfos[0].Durability)
+
+	// The transaction filter applies to the replicated locks.
+	lockInfos, _ = query(QueryLockTableOptions{
+		IncludeReplicatedUncontended: true, Reader: eng, TxnID: txn2.ID,
+	})
+	require.Len(t, lockInfos, 2)
+	require.Equal(t, roachpb.Key("b"), lockInfos[0].Key)
+	require.Equal(t, roachpb.Key("d"), lockInfos[1].Key)
+
+	// The limits apply to the merged results.
+	lockInfos, resumeState = query(QueryLockTableOptions{
+		IncludeReplicatedUncontended: true, Reader: eng, MaxLocks: 3,
+	})
+	require.Len(t, lockInfos, 3)
+	require.Equal(t, kvpb.RESUME_KEY_LIMIT, resumeState.ResumeReason)
+	require.Equal(t, roachpb.Key("c").Next(), resumeState.ResumeSpan.Key)
+
+	// Paging one lock at a time visits every key exactly once.
+	var pagedKeys []roachpb.Key
+	for pageSpan := span; ; {
+		lockInfos, resumeState, err = lt.QueryLockTableState(ctx, pageSpan, QueryLockTableOptions{
+			IncludeUncontended: true, IncludeReplicatedUncontended: true, Reader: eng, MaxLocks: 1,
+		})
+		require.NoError(t, err)
+		require.Len(t, lockInfos, 1)
+		pagedKeys = append(pagedKeys, lockInfos[0].Key)
+		if resumeState.ResumeSpan == nil {
+			break
+		}
+		pageSpan = *resumeState.ResumeSpan
+	}
+	require.Equal(t, []roachpb.Key{
+		roachpb.Key("a"), roachpb.Key("b"), roachpb.Key("c"), roachpb.Key("d"),
+	}, pagedKeys)
+
+	// A reader must be provided.
+	_, _, err = lt.QueryLockTableState(ctx, span, QueryLockTableOptions{
+		IncludeReplicatedUncontended: true,
+	})
+	require.Error(t, err)
+}
+
+type workItem struct {
+	// Contains one of request or intents.
+
+	// Request.
+	request        *Request
+	locksToAcquire []roachpb.Key
+
+	// Update locks.
+	intents []roachpb.LockUpdate
+}
+
+func (w *workItem) getRequestTxnID() uuid.UUID {
+	if w.request != nil && w.request.Txn != nil {
+		return w.request.Txn.ID
+	}
+	return uuid.UUID{}
+}
+
+func doWork(ctx context.Context, item *workItem, e *workloadExecutor) error {
+	defer func() {
+		e.doneWork <- item
+	}()
+	if item.request != nil {
+		var lg *spanlatch.Guard
+		var g lockTableGuard
+		var err error
+		for {
+			// Since we can't do a select involving latch acquisition and context
+			// cancellation, the code makes sure to release latches when returning
+			// early due to error. Otherwise other requests will get stuck and
+			// group.Wait() will not return until the test times out.
+			lg, err = e.lm.Acquire(context.Background(), item.request.LatchSpans, poison.Policy_Error)
+			if err != nil {
+				return err
+			}
+			var kvErr *Error
+			g, kvErr = e.lt.ScanAndEnqueue(*item.request, g)
+			if kvErr != nil {
+				return kvErr.GoError()
+			}
+			if !g.ShouldWait() {
+				break
+			}
+			e.lm.Release(lg)
+			var lastID uuid.UUID
+		L:
+			for {
+				select {
+				case <-g.NewStateChan():
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				state, err := g.CurState()
+				if err != nil {
 					return err
 				}
 				switch state.kind {
@@ -1233,6 +3241,7 @@ func newWorkLoadExecutor(items []workloadItem, concurrency int) *workloadExecuto
 	const maxLocks = 100000
 	lt := newLockTable(
 		maxLocks, roachpb.RangeID(3), hlc.NewClockForTesting(nil), cluster.MakeTestingClusterSettings(),
+		nil, /* statusCache */
 	)
 	lt.enabled = true
 	return &workloadExecutor{
@@ -1806,57 +3815,62 @@ func runRequests(b *testing.B, pb iterations, items []benchWorkItem, env benchEn
 // group are contending), the number of outstanding requests per group, and
 // the number of read keys for the requests in each group (when the number of
 // read keys is equal to the total keys, there is no contention within the
-// group). The number of groups is either 1 or GOMAXPROCS, in order to use
-// RunParallel() -- it doesn't seem possible to get parallelism between these
-// two values when using B.RunParallel() since B.SetParallelism() accepts an
-// integer multiplier to GOMAXPROCS.
+// group), with and without EagerQueueing. The number of groups is either 1 or
+// GOMAXPROCS, in order to use RunParallel() -- it doesn't seem possible to get
+// parallelism between these two values when using B.RunParallel() since
+// B.SetParallelism() accepts an integer multiplier to GOMAXPROCS.
 func BenchmarkLockTable(b *testing.B) {
 	maxGroups := runtime.GOMAXPROCS(0)
 	const numKeys = 5
-	for _, numGroups := range []int{1, maxGroups} {
-		for _, outstandingPerGroup := range []int{1, 2, 4, 8, 16} {
-			for numReadKeys := 0; numReadKeys <= numKeys; numReadKeys++ {
-				b.Run(
-					fmt.Sprintf("groups=%d,outstanding=%d,read=%d/", numGroups, outstandingPerGroup,
-						numReadKeys),
-					func(b *testing.B) {
-						var numRequestsWaited uint64
-						var numScanCalls uint64
-						const maxLocks = 100000
-						lt := newLockTable(
-							maxLocks,
-							roachpb.RangeID(3),
-							hlc.NewClockForTesting(nil),
-							cluster.MakeTestingClusterSettings(),
-						)
-						lt.enabled = true
-						env := benchEnv{
-							lm:                &spanlatch.Manager{},
-							lt:                lt,
-							numRequestsWaited: &numRequestsWaited,
-							numScanCalls:      &numScanCalls,
-						}
-						var requestsPerGroup [][]benchWorkItem
-						for i := 0; i < numGroups; i++ {
-							requestsPerGroup = append(requestsPerGroup,
-								createRequests(i, outstandingPerGroup, numKeys, numReadKeys))
-						}
-						b.ResetTimer()
-						if numGroups > 1 {
-							var groupNum int32 = -1
-							b.RunParallel(func(pb *testing.PB) {
-								index := atomic.AddInt32(&groupNum, 1)
-								runRequests(b, pb, requestsPerGroup[index], env)
-							})
-						} else {
-							iters := &simpleIters{b.N}
-							runRequests(b, iters, requestsPerGroup[0], env)
-						}
-						if log.V(1) {
-							log.Infof(context.Background(), "num requests that waited: %d, num scan calls: %d\n",
-								atomic.LoadUint64(&numRequestsWaited), atomic.LoadUint64(&numScanCalls))
-						}
-					})
+	for _, eager := range []bool{false, true} {
+		for _, numGroups := range []int{1, maxGroups} {
+			for _, outstandingPerGroup := range []int{1, 2, 4, 8, 16} {
+				for numReadKeys := 0; numReadKeys <= numKeys; numReadKeys++ {
+					b.Run(
+						fmt.Sprintf("eager=%t,groups=%d,outstanding=%d,read=%d/", eager, numGroups,
+							outstandingPerGroup, numReadKeys),
+						func(b *testing.B) {
+							var numRequestsWaited uint64
+							var numScanCalls uint64
+							const maxLocks = 100000
+							st := cluster.MakeTestingClusterSettings()
+							EagerQueueing.Override(context.Background(), &st.SV, eager)
+							lt := newLockTable(
+								maxLocks,
+								roachpb.RangeID(3),
+								hlc.NewClockForTesting(nil),
+								st,
+								nil, /* statusCache */
+							)
+							lt.enabled = true
+							env := benchEnv{
+								lm:                &spanlatch.Manager{},
+								lt:                lt,
+								numRequestsWaited: &numRequestsWaited,
+								numScanCalls:      &numScanCalls,
+							}
+							var requestsPerGroup [][]benchWorkItem
+							for i := 0; i < numGroups; i++ {
+								requestsPerGroup = append(requestsPerGroup,
+									createRequests(i, outstandingPerGroup, numKeys, numReadKeys))
+							}
+							b.ResetTimer()
+							if numGroups > 1 {
+								var groupNum int32 = -1
+								b.RunParallel(func(pb *testing.PB) {
+									index := atomic.AddInt32(&groupNum, 1)
+									runRequests(b, pb, requestsPerGroup[index], env)
+								})
+							} else {
+								iters := &simpleIters{b.N}
+								runRequests(b, iters, requestsPerGroup[0], env)
+							}
+							if log.V(1) {
+								log.Infof(context.Background(), "num requests that waited: %d, num scan calls: %d\n",
+									atomic.LoadUint64(&numRequestsWaited), atomic.LoadUint64(&numScanCalls))
+							}
+						})
+				}
 			}
 		}
 	}
@@ -1873,6 +3887,7 @@ func BenchmarkLockTableMetrics(b *testing.B) {
 				roachpb.RangeID(3),
 				hlc.NewClockForTesting(nil),
 				cluster.MakeTestingClusterSettings(),
+				nil, /* statusCache */
 			)
 			lt.enabled = true
 
@@ -1896,6 +3911,186 @@ func BenchmarkLockTableMetrics(b *testing.B) {
 	}
 }
 
+// BenchmarkLockTableScanDenseFinalizedLocks measures the scan of a non-locking
+// reader over a densely locked key range, with every key locked by a finalized
+// transaction, with and without consolidating the resolution of adjacent locks
+// (see ConsolidateAdjacentLockResolution).
+func BenchmarkLockTableScanDenseFinalizedLocks(b *testing.B) {
+	for _, consolidate := range []bool{false, true} {
+		for _, locks := range []int{1 << 4, 1 << 8, 1 << 12} {
+			b.Run(fmt.Sprintf("consolidate=%t/locks=%d", consolidate, locks), func(b *testing.B) {
+				const maxLocks = 100000
+				st := cluster.MakeTestingClusterSettings()
+				ConsolidateAdjacentLockResolution.Override(context.Background(), &st.SV, consolidate)
+
+				ts := hlc.Timestamp{WallTime: 10}
+				holder := makeTestTxn()
+				holder.Status = roachpb.ABORTED
+				span := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("b")}
+				latchSpans := &spanset.SpanSet{}
+				latchSpans.AddMVCC(spanset.SpanReadOnly, span, ts)
+				lockSpans := &lockspanset.LockSpanSet{}
+				lockSpans.Add(lock.None, span)
+				req := Request{Timestamp: ts, LatchSpans: latchSpans, LockSpans: lockSpans}
+				foundLocks := make([]roachpb.Lock, locks)
+				for i := range foundLocks {
+					foundLocks[i] = roachpb.MakeLock(&holder.TxnMeta, roachpb.Key(fmt.Sprintf("a%05d", i)), lock.Intent)
+				}
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					// The scan resolves the locks, so populate a new lock table for each
+					// iteration.
+					b.StopTimer()
+					lt := newTestLockTable(maxLocks, nil, st)
+					g, err := lt.ScanAndEnqueue(req, nil)
+					if err != nil {
+						b.Fatal(err)
+					}
+					for j := range foundLocks {
+						if _, err := lt.AddDiscoveredLock(&foundLocks[j], lt.enabledSeq, false, g); err != nil {
+							b.Fatal(err)
+						}
+					}
+					lt.Dequeue(g)
+					lt.PushedTransactionUpdated(holder)
+					b.StartTimer()
+
+					g, err = lt.ScanAndEnqueue(req, nil)
+					if err != nil {
+						b.Fatal(err)
+					}
+					lt.Dequeue(g)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkLockTableScanDenseLocks measures the sequencing of a non-locking
+// reader over a densely locked key range, with every key locked by a
+// transaction that the reader waits on and pushes, with and without
+// consolidating the waiting states and resolution of adjacent locks (see
+// ConsolidateAdjacentLockResolution). Each iteration scans the lock table
+// until the reader can proceed, standing in for the lockTableWaiter by
+// resolving the locks in the span of each waiting state once its holder has
+// been pushed, and the locks that each scan asks to resolve.
+func BenchmarkLockTableScanDenseLocks(b *testing.B) {
+	for _, consolidate := range []bool{false, true} {
+		for _, locks := range []int{1 << 4, 1 << 8, 1 << 12} {
+			b.Run(fmt.Sprintf("consolidate=%t/locks=%d", consolidate, locks), func(b *testing.B) {
+				const maxLocks = 100000
+				st := cluster.MakeTestingClusterSettings()
+				ConsolidateAdjacentLockResolution.Override(context.Background(), &st.SV, consolidate)
+
+				ts := hlc.Timestamp{WallTime: 10}
+				holder := makeTestTxn()
+				abortedHolder := holder.Clone()
+				abortedHolder.Status = roachpb.ABORTED
+				span := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("b")}
+				latchSpans := &spanset.SpanSet{}
+				latchSpans.AddMVCC(spanset.SpanReadOnly, span, ts)
+				lockSpans := &lockspanset.LockSpanSet{}
+				lockSpans.Add(lock.None, span)
+				req := Request{Timestamp: ts, LatchSpans: latchSpans, LockSpans: lockSpans}
+				foundLocks := make([]roachpb.Lock, locks)
+				for i := range foundLocks {
+					foundLocks[i] = roachpb.MakeLock(&holder.TxnMeta, roachpb.Key(fmt.Sprintf("a%05d", i)), lock.Intent)
+				}
+
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					// The scans resolve the locks, so populate a new lock table for each
+					// iteration.
+					b.StopTimer()
+					lt := newTestLockTable(maxLocks, nil, st)
+					g, err := lt.ScanAndEnqueue(req, nil)
+					if err != nil {
+						b.Fatal(err)
+					}
+					for j := range foundLocks {
+						if _, err := lt.AddDiscoveredLock(&foundLocks[j], lt.enabledSeq, false, g); err != nil {
+							b.Fatal(err)
+						}
+					}
+					lt.Dequeue(g)
+					b.StartTimer()
+
+					g = nil
+					for {
+						g, err = lt.ScanAndEnqueue(req, g)
+						if err != nil {
+							b.Fatal(err)
+						}
+						if !g.ShouldWait() {
+							break
+						}
+						state, err := g.CurState()
+						if err != nil {
+							b.Fatal(err)
+						}
+						if state.kind == doneWaiting {
+							if err := lt.UpdateLocksBatch(g.ResolveBeforeScanning()); err != nil {
+								b.Fatal(err)
+							}
+							continue
+						}
+						lt.PushedTransactionUpdated(abortedHolder)
+						up := roachpb.MakeLockUpdate(abortedHolder, roachpb.Span{Key: state.key, EndKey: state.endKey})
+						if err := lt.UpdateLocks(&up); err != nil {
+							b.Fatal(err)
+						}
+					}
+					lt.Dequeue(g)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkLockTableResequence measures the time and allocations of
+// re-sequencing a request that reads a span through the lock table, either by
+// leaving the wait queues and re-scanning with its previous guard (whose
+// snapshot of the lock table is kept if no lock was added or removed since it
+// was taken) or by dequeuing and scanning with a new guard.
+func BenchmarkLockTableResequence(b *testing.B) {
+	for _, reuse := range []bool{false, true} {
+		b.Run(fmt.Sprintf("prev-guard=%t", reuse), func(b *testing.B) {
+			const maxLocks = 100000
+			lt := newTestLockTable(maxLocks, nil, nil)
+			ts := hlc.Timestamp{WallTime: 10}
+			txn := makeTestTxn()
+			span := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("b")}
+			latchSpans := &spanset.SpanSet{}
+			latchSpans.AddMVCC(spanset.SpanReadOnly, span, ts)
+			lockSpans := &lockspanset.LockSpanSet{}
+			lockSpans.Add(lock.None, span)
+			req := Request{Txn: txn, Timestamp: ts, LatchSpans: latchSpans, LockSpans: lockSpans}
+
+			g, err := lt.ScanAndEnqueue(req, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if reuse {
+					lt.LeaveWaitQueues(g)
+					g, err = lt.ScanAndEnqueue(req, g)
+				} else {
+					lt.Dequeue(g)
+					g, err = lt.ScanAndEnqueue(req, nil)
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			lt.Dequeue(g)
+		})
+	}
+}
+
 // TODO(sbhola):
 // - More datadriven and randomized test cases:
 //   - both local and global keys
@@ -1980,8 +4175,12 @@ func TestCanElideWaitingStateUpdateConsidersAllFields(t *testing.T) {
 		"txn":                   includeWhenDeciding,
 		"key":                   includeWhenDeciding,
 		"held":                  includeWhenDeciding,
+		"unacquiredClaim":       doNotIncludeWhenDeciding,
 		"queuedLockingRequests": doNotIncludeWhenDeciding,
 		"queuedReaders":         doNotIncludeWhenDeciding,
+		"lockHeldDuration":      doNotIncludeWhenDeciding,
+		"txnPriority":           doNotIncludeWhenDeciding,
+		"txnPriorityKnown":      doNotIncludeWhenDeciding,
 		"guardStrength":         doNotIncludeWhenDeciding,
 	}
 	ws := waitingState{}
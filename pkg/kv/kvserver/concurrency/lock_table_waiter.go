@@ -147,6 +147,12 @@ func (w *lockTableWaiterImpl) WaitOn(
 	var timerWaitingState waitingState
 	// Used to enforce lock timeouts.
 	var lockDeadline time.Time
+	// Used to check back with the lockTable once the request may have waited on
+	// a lock for longer than its maximum lock wait duration.
+	var lockWaitTimer *timeutil.Timer
+	var lockWaitTimerC <-chan time.Time
+	var lockWaitKey roachpb.Key
+	var lockWaitDeadline time.Time
 
 	tracer := newContentionEventTracer(tracing.SpanFromContext(ctx), w.clock)
 	// Make sure the contention time info is finalized when exiting the function.
@@ -169,6 +175,21 @@ func (w *lockTableWaiterImpl) WaitOn(
 			tracer.notify(ctx, state)
 			switch state.kind {
 			case waitFor, waitForDistinguished:
+				// If the request has a maximum lock wait duration, the lockTable
+				// rejects it once it has waited on the lock for that long. The
+				// lockTable measures the wait from when the request started waiting
+				// on the key, so the deadline is only reset when the key changes.
+				if req.MaxLockWaitDuration != 0 && !lockWaitKey.Equal(state.key) {
+					if lockWaitTimer == nil {
+						lockWaitTimer = timeutil.NewTimer()
+						defer lockWaitTimer.Stop()
+					}
+					lockWaitDeadline = w.clock.PhysicalTime().Add(req.MaxLockWaitDuration)
+					lockWaitTimer.Reset(req.MaxLockWaitDuration)
+					lockWaitTimerC = lockWaitTimer.C
+					lockWaitKey = state.key
+				}
+
 				// waitFor indicates that the request is waiting on another
 				// transaction. This transaction may be the lock holder of a
 				// conflicting lock or the head of a lock-wait queue that the
@@ -185,7 +206,11 @@ func (w *lockTableWaiterImpl) WaitOn(
 				// out the longer deadlock detection delay before recognizing and
 				// recovering from the failure of a transaction coordinator for
 				// *each* of that transaction's previously written intents.
-				livenessPush := state.kind == waitForDistinguished
+				//
+				// If the lockTable doesn't designate distinguished waiters, every
+				// waiter performs the liveness push instead.
+				livenessPush := state.kind == waitForDistinguished ||
+					!DistinguishedWaitersEnabled.Get(&w.st.SV)
 				deadlockPush := true
 				waitPolicyPush := req.WaitPolicy == lock.WaitPolicy_Error
 
@@ -311,6 +336,30 @@ func (w *lockTableWaiterImpl) WaitOn(
 				// result, the request was rejected.
 				return newLockConflictErr(req, state, reasonWaitQueueMaxLengthExceeded)
 
+			case waitDeadlineExceeded:
+				// The request waited on a lock for longer than its configured maximum
+				// lock wait duration. As a result, the request was rejected.
+				return newLockConflictErr(req, state, reasonLockTimeout)
+
+			case waitThrottled:
+				// The request attempted to enter a lock wait-queue while the key's
+				// lock acquisition rate limit was exceeded, so it did not. Back off
+				// until the key's rate allows another acquisition, and then
+				// re-acquire latches and check the lockTable again.
+				log.VEventf(ctx, 3, "backing off for %s", state.retryAfter)
+				backoff := timeutil.NewTimer()
+				defer backoff.Stop()
+				backoff.Reset(state.retryAfter)
+				select {
+				case <-backoff.C:
+					backoff.Read = true
+					return nil
+				case <-ctxDoneC:
+					return kvpb.NewError(ctx.Err())
+				case <-shouldQuiesceC:
+					return kvpb.NewError(&kvpb.NodeUnavailableError{})
+				}
+
 			case doneWaiting:
 				// The request has waited for all conflicting locks to be released
 				// and is at the front of any lock wait-queues. It can now stop
@@ -421,6 +470,38 @@ func (w *lockTableWaiterImpl) WaitOn(
 				return err
 			}
 
+		case <-lockWaitTimerC:
+			// The request may have waited on its current lock for longer than its
+			// maximum lock wait duration. Ask the lockTable, which decides whether it
+			// has.
+			lockWaitTimerC = nil
+			lockWaitTimer.Read = true
+			state, err := guard.CurState()
+			if err != nil {
+				return kvpb.NewError(err)
+			}
+			switch state.kind {
+			case waitDeadlineExceeded:
+				log.VEventf(ctx, 3, "lock wait-queue event: %s", state)
+				tracer.notify(ctx, state)
+				return newLockConflictErr(req, state, reasonLockTimeout)
+			case waitFor, waitForDistinguished:
+				if lockWaitKey.Equal(state.key) {
+					// Still waiting on the same lock, but not for long enough yet
+					// according to the lockTable's clock. Check back once the
+					// deadline is reached. If it already has been, the lockTable
+					// must have started the wait on the key over, so do the same.
+					untilDeadline := w.timeUntilDeadline(lockWaitDeadline)
+					if untilDeadline == 0 {
+						lockWaitDeadline = w.clock.PhysicalTime().Add(req.MaxLockWaitDuration)
+						untilDeadline = req.MaxLockWaitDuration
+					}
+					lockWaitTimer.Reset(untilDeadline)
+					lockWaitTimerC = lockWaitTimer.C
+				}
+			}
+			// Any other state change is delivered through newStateC.
+
 		case <-ctxDoneC:
 			return kvpb.NewError(ctx.Err())
 
@@ -449,6 +530,9 @@ func (w *lockTableWaiterImpl) pushLockTxn(
 	ctx context.Context, req Request, ws waitingState,
 ) *Error {
 	if w.disableTxnPushing {
+		if req.WaitPolicy == lock.WaitPolicy_Error {
+			w.lt.RecordWaitPolicyErrorRejection()
+		}
 		return newLockConflictErr(req, ws, reasonWaitPolicy)
 	}
 
@@ -495,11 +579,13 @@ func (w *lockTableWaiterImpl) pushLockTxn(
 		log.VEventf(ctx, 2, "pushing txn %s to abort", ws.txn.Short())
 	}
 
+	w.lt.RecordWaiterPush()
 	pusheeTxn, err := w.ir.PushTransaction(ctx, ws.txn, h, pushType)
 	if err != nil {
 		// If pushing with an Error WaitPolicy and the push fails, then the lock
 		// holder is still active. Transform the error into a LockConflictError.
 		if _, ok := err.GetDetail().(*kvpb.TransactionPushError); ok && req.WaitPolicy == lock.WaitPolicy_Error {
+			w.lt.RecordWaitPolicyErrorRejection()
 			err = newLockConflictErr(req, ws, reasonWaitPolicy)
 		}
 		return err
@@ -541,7 +627,10 @@ func (w *lockTableWaiterImpl) pushLockTxn(
 	// with the responsibility to abort the intents (for example if we find the
 	// transaction aborted). To do better here, we need per-intent information
 	// on whether we need to poison.
-	resolve := roachpb.MakeLockUpdate(pusheeTxn, roachpb.Span{Key: ws.key})
+	//
+	// If the waiting state represents a run of keys locked by the pushee, the
+	// entire run is updated at once.
+	resolve := roachpb.MakeLockUpdate(pusheeTxn, roachpb.Span{Key: ws.key, EndKey: ws.endKey})
 	if pusheeTxn.Status == roachpb.PENDING {
 		// The pushee was still PENDING at the time that the push observed its
 		// transaction record. It is safe to use the clock observation we gathered
@@ -677,6 +766,7 @@ func (w *lockTableWaiterImpl) pushRequestTxn(
 	pushType := kvpb.PUSH_ABORT
 	log.VEventf(ctx, 3, "pushing txn %s to detect request deadlock", ws.txn.Short())
 
+	w.lt.RecordWaiterPush()
 	_, err := w.ir.PushTransaction(ctx, ws.txn, h, pushType)
 	if err != nil {
 		return err
@@ -909,55 +999,184 @@ func (c *txnStatusCache) add(txn *roachpb.Transaction) {
 	}
 }
 
+// addBatch adds each of the supplied transactions to the cache, as if by add,
+// but acquires the lock of each unsharded partition only once.
+func (c *txnStatusCache) addBatch(txns []*roachpb.Transaction) {
+	c.finalizedTxns.addBatch(txns, func(txn *roachpb.Transaction) bool {
+		return txn.Status.IsFinalized()
+	})
+	c.pendingTxns.addBatch(txns, func(txn *roachpb.Transaction) bool {
+		return !txn.Status.IsFinalized()
+	})
+}
+
 func (c *txnStatusCache) clear() {
 	c.finalizedTxns.clear()
 	c.pendingTxns.clear()
 }
 
-// txnCache is a small LRU cache that holds Transaction objects.
+// SharedTxnStatusCache is a txnStatusCache that is shared across the lockTables
+// of all Ranges on a Store. This allows the status of a transaction that was
+// learned by pushing it on one Range to be used on the others, instead of each
+// Range maintaining its own cache.
+//
+// Unlike the small cache individual to a Range, the shared cache is sized to
+// the Store and sharded by transaction ID, so that the Ranges don't contend on
+// a single mutex. It must be constructed using NewSharedTxnStatusCache.
+type SharedTxnStatusCache struct {
+	c txnStatusCache
+}
+
+// sharedTxnCacheShardSize is the number of transactions held by each shard of
+// each partition of a SharedTxnStatusCache.
+const sharedTxnCacheShardSize = 64
+
+// NewSharedTxnStatusCache constructs a SharedTxnStatusCache with the supplied
+// number of shards, each of which holds sharedTxnCacheShardSize finalized and
+// as many pending transactions.
+func NewSharedTxnStatusCache(numShards int) *SharedTxnStatusCache {
+	if numShards < 1 {
+		numShards = 1
+	}
+	c := &SharedTxnStatusCache{}
+	c.c.finalizedTxns.initShards(numShards, sharedTxnCacheShardSize)
+	c.c.pendingTxns.initShards(numShards, sharedTxnCacheShardSize)
+	return c
+}
+
+// txnCache is an LRU cache that holds Transaction objects. By default, it is a
+// small cache behind a single mutex. If initShards is called, it is instead
+// partitioned by transaction ID into shards, each an LRU cache of its own.
 //
 // The zero value of this struct is ready for use.
 type txnCache struct {
 	mu   syncutil.Mutex
 	txns [8]*roachpb.Transaction // [MRU, ..., LRU]
+
+	// shards, if set, partition the cache by transaction ID, in which case mu
+	// and txns are unused.
+	shards []txnCacheShard
+}
+
+// txnCacheShard is a shard of a sharded txnCache.
+type txnCacheShard struct {
+	mu   syncutil.Mutex
+	txns []*roachpb.Transaction // [MRU, ..., LRU]
+}
+
+// initShards partitions the (empty) receiver into the supplied number of
+// shards, each holding up to shardSize transactions.
+func (c *txnCache) initShards(numShards, shardSize int) {
+	c.shards = make([]txnCacheShard, numShards)
+	for i := range c.shards {
+		c.shards[i].txns = make([]*roachpb.Transaction, shardSize)
+	}
+}
+
+// shardFor returns the shard that holds the transaction with the supplied ID.
+//
+// REQUIRES: the cache is sharded.
+func (c *txnCache) shardFor(id uuid.UUID) *txnCacheShard {
+	return &c.shards[id.ToUint128().Lo%uint64(len(c.shards))]
 }
 
 func (c *txnCache) get(id uuid.UUID) (*roachpb.Transaction, bool) {
+	if c.shards != nil {
+		s := c.shardFor(id)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return txnLRUGet(s.txns, id)
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if idx := c.getIdxLocked(id); idx >= 0 {
-		txn := c.txns[idx]
-		c.moveFrontLocked(txn, idx)
-		return txn, true
-	}
-	return nil, false
+	return txnLRUGet(c.txns[:], id)
 }
 
 func (c *txnCache) add(txn *roachpb.Transaction) {
+	if c.shards != nil {
+		s := c.shardFor(txn.ID)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		txnLRUAdd(s.txns, txn)
+		return
+	}
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if idx := c.getIdxLocked(txn.ID); idx >= 0 {
-		if curTxn := c.txns[idx]; txn.WriteTimestamp.Less(curTxn.WriteTimestamp) {
+	txnLRUAdd(c.txns[:], txn)
+}
+
+// addBatch adds each of the supplied transactions for which the filter returns
+// true to the cache, in order, so that the last of them ends up as the most
+// recently used. Transactions that appear multiple times in the batch are
+// de-duplicated by ID, just as if they had been added one at a time.
+//
+// If the cache is sharded, the lock of each shard is acquired once per
+// transaction, rather than once for the whole batch.
+func (c *txnCache) addBatch(
+	txns []*roachpb.Transaction, filter func(*roachpb.Transaction) bool,
+) {
+	if c.shards != nil {
+		for _, txn := range txns {
+			if filter(txn) {
+				c.add(txn)
+			}
+		}
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, txn := range txns {
+		if filter(txn) {
+			txnLRUAdd(c.txns[:], txn)
+		}
+	}
+}
+
+func (c *txnCache) clear() {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		txnLRUClear(s.txns)
+		s.mu.Unlock()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	txnLRUClear(c.txns[:])
+}
+
+// The functions below operate on the transactions held by an LRU cache, in
+// [MRU, ..., LRU] order. They require the cache's lock to be held.
+
+func txnLRUGet(txns []*roachpb.Transaction, id uuid.UUID) (*roachpb.Transaction, bool) {
+	if idx := txnLRUGetIdx(txns, id); idx >= 0 {
+		txn := txns[idx]
+		txnLRUMoveFront(txns, txn, idx)
+		return txn, true
+	}
+	return nil, false
+}
+
+func txnLRUAdd(txns []*roachpb.Transaction, txn *roachpb.Transaction) {
+	if idx := txnLRUGetIdx(txns, txn.ID); idx >= 0 {
+		if curTxn := txns[idx]; txn.WriteTimestamp.Less(curTxn.WriteTimestamp) {
 			// If the new txn has a lower write timestamp than the cached txn,
 			// just move the cached txn to the front of the LRU cache.
 			txn = curTxn
 		}
-		c.moveFrontLocked(txn, idx)
+		txnLRUMoveFront(txns, txn, idx)
 	} else {
-		c.insertFrontLocked(txn)
+		txnLRUInsertFront(txns, txn)
 	}
 }
 
-func (c *txnCache) clear() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	for i := range c.txns {
-		c.txns[i] = nil
+func txnLRUClear(txns []*roachpb.Transaction) {
+	for i := range txns {
+		txns[i] = nil
 	}
 }
 
-func (c *txnCache) getIdxLocked(id uuid.UUID) int {
-	for i, txn := range c.txns {
+func txnLRUGetIdx(txns []*roachpb.Transaction, id uuid.UUID) int {
+	for i, txn := range txns {
 		if txn != nil && txn.ID == id {
 			return i
 		}
@@ -965,14 +1184,14 @@ func (c *txnCache) getIdxLocked(id uuid.UUID) int {
 	return -1
 }
 
-func (c *txnCache) moveFrontLocked(txn *roachpb.Transaction, cur int) {
-	copy(c.txns[1:cur+1], c.txns[:cur])
-	c.txns[0] = txn
+func txnLRUMoveFront(txns []*roachpb.Transaction, txn *roachpb.Transaction, cur int) {
+	copy(txns[1:cur+1], txns[:cur])
+	txns[0] = txn
 }
 
-func (c *txnCache) insertFrontLocked(txn *roachpb.Transaction) {
-	copy(c.txns[1:], c.txns[:])
-	c.txns[0] = txn
+func txnLRUInsertFront(txns []*roachpb.Transaction, txn *roachpb.Transaction) {
+	copy(txns[1:], txns[:])
+	txns[0] = txn
 }
 
 // tagContentionTracer is the tracing span tag that the *contentionEventTracer
@@ -1173,7 +1392,7 @@ func (tag *contentionTag) notify(ctx context.Context, s waitingState) *kvpb.Cont
 		tag.mu.waitStart = now
 		tag.mu.numLocks++
 		return res
-	case doneWaiting, waitQueueMaxLengthExceeded:
+	case doneWaiting, waitQueueMaxLengthExceeded, waitDeadlineExceeded, waitThrottled:
 		// There will be no more state updates; we're done waiting.
 		res := tag.generateEventLocked()
 		tag.mu.waiting = false
@@ -15,6 +15,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"runtime"
 	"testing"
 	"time"
 
@@ -84,6 +85,11 @@ func (g *mockLockTableGuard) CurState() (waitingState, error) {
 func (g *mockLockTableGuard) ResolveBeforeScanning() []roachpb.LockUpdate {
 	return g.toResolve
 }
+func (g *mockLockTableGuard) WatchDoneWaiting(
+	ctx context.Context, stopper *stop.Stopper,
+) (*doneWaitingWatcher, error) {
+	return watchDoneWaiting(ctx, stopper, g)
+}
 func (g *mockLockTableGuard) CheckOptimisticNoConflicts(*lockspanset.LockSpanSet) (ok bool) {
 	return true
 }
@@ -92,6 +98,9 @@ func (g *mockLockTableGuard) IsKeyLockedByConflictingTxn(
 ) (bool, *enginepb.TxnMeta, error) {
 	panic("unimplemented")
 }
+func (g *mockLockTableGuard) WaitPositionEstimate() int {
+	panic("unimplemented")
+}
 func (g *mockLockTableGuard) notify() { g.signal <- struct{}{} }
 
 // mockLockTable overrides TransactionIsFinalized, which is the only LockTable
@@ -193,6 +202,26 @@ func TestLockTableWaiterWithTxn(t *testing.T) {
 				testErrorWaitPush(t, waitQueueMaxLengthExceeded, makeReq, dontExpectPush, reasonWaitQueueMaxLengthExceeded)
 			})
 
+			t.Run("waitDeadlineExceeded", func(t *testing.T) {
+				testErrorWaitPush(t, waitDeadlineExceeded, makeReq, dontExpectPush, reasonLockTimeout)
+			})
+
+			t.Run("waitThrottled", func(t *testing.T) {
+				t.Log("waitThrottled causes requests to back off without pushing")
+				w, _, g, _ := setupLockTableWaiterTest()
+				defer w.stopper.Stop(ctx)
+
+				g.state = waitingState{
+					kind:       waitThrottled,
+					key:        roachpb.Key("keyA"),
+					retryAfter: time.Millisecond,
+				}
+				g.notify()
+
+				err := w.WaitOn(ctx, makeReq(), g)
+				require.Nil(t, err)
+			})
+
 			t.Run("doneWaiting", func(t *testing.T) {
 				w, _, g, _ := setupLockTableWaiterTest()
 				defer w.stopper.Stop(ctx)
@@ -269,6 +298,10 @@ func TestLockTableWaiterWithNonTxn(t *testing.T) {
 			testErrorWaitPush(t, waitQueueMaxLengthExceeded, makeReq, dontExpectPush, reasonWaitQueueMaxLengthExceeded)
 		})
 
+		t.Run("waitDeadlineExceeded", func(t *testing.T) {
+			testErrorWaitPush(t, waitDeadlineExceeded, makeReq, dontExpectPush, reasonLockTimeout)
+		})
+
 		t.Run("doneWaiting", func(t *testing.T) {
 			w, _, g, _ := setupLockTableWaiterTest()
 			defer w.stopper.Stop(ctx)
@@ -481,6 +514,10 @@ func TestLockTableWaiterWithErrorWaitPolicy(t *testing.T) {
 			testErrorWaitPush(t, waitQueueMaxLengthExceeded, makeReq, dontExpectPush, reasonWaitQueueMaxLengthExceeded)
 		})
 
+		t.Run("waitDeadlineExceeded", func(t *testing.T) {
+			testErrorWaitPush(t, waitDeadlineExceeded, makeReq, dontExpectPush, reasonLockTimeout)
+		})
+
 		t.Run("doneWaiting", func(t *testing.T) {
 			w, _, g, _ := setupLockTableWaiterTest()
 			defer w.stopper.Stop(ctx)
@@ -527,6 +564,11 @@ func testErrorWaitPush(
 			}
 			g.notify()
 
+			// Only rejections caused by the wait policy are counted as such.
+			rejections := func() int64 {
+				return w.lt.(*mockLockTable).counters.waitPolicyErrorRejections.Load()
+			}
+
 			// If expPushTS is empty, expect an error immediately.
 			if expPushTS == dontExpectPush {
 				err := w.WaitOn(ctx, req, g)
@@ -534,6 +576,7 @@ func testErrorWaitPush(
 				lcErr := new(kvpb.LockConflictError)
 				require.True(t, errors.As(err.GoError(), &lcErr))
 				require.Equal(t, errReason, lcErr.Reason)
+				require.Zero(t, rejections())
 				return
 			}
 
@@ -590,8 +633,10 @@ func testErrorWaitPush(
 				lcErr := new(kvpb.LockConflictError)
 				require.True(t, errors.As(err.GoError(), &lcErr))
 				require.Equal(t, errReason, lcErr.Reason)
+				require.Equal(t, int64(1), rejections())
 			} else {
 				require.Nil(t, err)
+				require.Zero(t, rejections())
 			}
 		})
 	})
@@ -644,6 +689,10 @@ func TestLockTableWaiterWithLockTimeout(t *testing.T) {
 				testErrorWaitPush(t, waitQueueMaxLengthExceeded, makeReq, dontExpectPush, reasonWaitQueueMaxLengthExceeded)
 			})
 
+			t.Run("waitDeadlineExceeded", func(t *testing.T) {
+				testErrorWaitPush(t, waitDeadlineExceeded, makeReq, dontExpectPush, reasonLockTimeout)
+			})
+
 			t.Run("doneWaiting", func(t *testing.T) {
 				w, _, g, _ := setupLockTableWaiterTest()
 				defer w.stopper.Stop(ctx)
@@ -954,6 +1003,46 @@ func TestTxnCacheUpdatesTxn(t *testing.T) {
 	require.Equal(t, txnPushed.WriteTimestamp, txnInCache.WriteTimestamp)
 }
 
+func TestTxnCacheAddBatch(t *testing.T) {
+	var c, expC txnCache
+	const overflow = 4
+	var txns [len(c.txns) + overflow]roachpb.Transaction
+	for i := range txns {
+		txns[i] = makeTxnProto(fmt.Sprintf("txn %d", i))
+	}
+	// The batch contains duplicates, including a pushed version of a txn that
+	// is followed by its original version.
+	pushed := txns[1].Clone()
+	pushed.WriteTimestamp = pushed.WriteTimestamp.Add(1, 0)
+	var batch []*roachpb.Transaction
+	for i := range txns {
+		batch = append(batch, &txns[i])
+	}
+	batch = append(batch, pushed, &txns[1], &txns[len(txns)-1])
+
+	// Adding the batch is equivalent to adding each txn individually.
+	all := func(*roachpb.Transaction) bool { return true }
+	c.addBatch(batch, all)
+	for _, txn := range batch {
+		expC.add(txn)
+	}
+	require.Equal(t, expC.txns, c.txns)
+
+	// Each txn is only present once, in LRU order. The pushed version of txn 1
+	// is retained over its original version.
+	require.Equal(t, &txns[len(txns)-1], c.txns[0])
+	require.Equal(t, pushed, c.txns[1])
+	for i, txnInCache := range c.txns[2:] {
+		require.Equal(t, &txns[len(txns)-2-i], txnInCache)
+	}
+
+	// Transactions for which the filter returns false are not added.
+	var filtered txnCache
+	filtered.addBatch(batch, func(txn *roachpb.Transaction) bool { return txn.ID == txns[2].ID })
+	require.Equal(t, &txns[2], filtered.txns[0])
+	require.Nil(t, filtered.txns[1])
+}
+
 func BenchmarkTxnCache(b *testing.B) {
 	rng := rand.New(rand.NewSource(timeutil.Now().UnixNano()))
 	var c txnCache
@@ -975,6 +1064,98 @@ func BenchmarkTxnCache(b *testing.B) {
 	}
 }
 
+func TestTxnCacheSharded(t *testing.T) {
+	const numShards, shardSize = 4, 4
+	var c txnCache
+	c.initShards(numShards, shardSize)
+
+	// The sharded cache holds more transactions than the unsharded one, and
+	// each shard evicts its own LRU transaction once full.
+	txns := make([]roachpb.Transaction, len(c.txns)+numShards*shardSize)
+	for i := range txns {
+		txns[i] = makeTxnProto(fmt.Sprintf("txn %d", i))
+		c.add(&txns[i])
+	}
+	var cached int
+	for i := range c.shards {
+		s := &c.shards[i]
+		require.Len(t, s.txns, shardSize)
+		for _, txn := range s.txns {
+			if txn != nil {
+				require.Equal(t, s, c.shardFor(txn.ID))
+				cached++
+			}
+		}
+	}
+	for i := len(txns) - 1; i >= 0; i-- {
+		if txn, ok := c.get(txns[i].ID); ok {
+			require.Equal(t, &txns[i], txn)
+		}
+	}
+	require.Greater(t, cached, len(c.txns))
+	require.LessOrEqual(t, cached, numShards*shardSize)
+
+	// The most recently added transaction is always retained.
+	last := &txns[len(txns)-1]
+	txn, ok := c.get(last.ID)
+	require.True(t, ok)
+	require.Equal(t, last, txn)
+
+	// Adding a batch is equivalent to adding each transaction individually.
+	var expC txnCache
+	expC.initShards(numShards, shardSize)
+	var batch []*roachpb.Transaction
+	for i := range txns {
+		batch = append(batch, &txns[i])
+		expC.add(&txns[i])
+	}
+	c.clear()
+	c.addBatch(batch, func(*roachpb.Transaction) bool { return true })
+	for i := range c.shards {
+		require.Equal(t, expC.shards[i].txns, c.shards[i].txns)
+	}
+
+	// Clearing the cache clears all of its shards.
+	c.clear()
+	for i := range txns {
+		_, ok := c.get(txns[i].ID)
+		require.False(t, ok)
+	}
+}
+
+// BenchmarkTxnStatusCacheConcurrent compares a txnStatusCache individual to a
+// Range with one shared across the Ranges of a Store, as accessed concurrently
+// by the requests on those Ranges.
+func BenchmarkTxnStatusCacheConcurrent(b *testing.B) {
+	const numTxns = 1024
+	txns := make([]roachpb.Transaction, numTxns)
+	for i := range txns {
+		txns[i] = makeTxnProto(fmt.Sprintf("txn %d", i))
+		txns[i].Status = roachpb.ABORTED
+	}
+	for _, shared := range []bool{false, true} {
+		b.Run(fmt.Sprintf("shared=%t", shared), func(b *testing.B) {
+			var c *txnStatusCache
+			if shared {
+				c = &NewSharedTxnStatusCache(runtime.GOMAXPROCS(0)).c
+			} else {
+				c = &txnStatusCache{}
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				rng := rand.New(rand.NewSource(timeutil.Now().UnixNano()))
+				for i := 0; pb.Next(); i++ {
+					txn := &txns[rng.Intn(len(txns))]
+					if i%2 == 0 {
+						c.add(txn)
+					} else {
+						_, _ = c.finalizedTxns.get(txn.ID)
+					}
+				}
+			})
+		})
+	}
+}
+
 func TestContentionEventTracer(t *testing.T) {
 	tr := tracing.NewTracer()
 	ctx, sp := tr.StartSpanCtx(context.Background(), "foo", tracing.WithRecording(tracingpb.RecordingVerbose))
@@ -11,8 +11,14 @@
 package concurrency
 
 import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+
+	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/concurrency/lock"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/spanlatch"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 )
 
 // LatchMetrics holds information about the state of a latchManager.
@@ -26,6 +32,12 @@ type TopKLockMetrics = [3]LockMetrics
 type LockTableMetrics struct {
 	// The number of locks.
 	Locks int64
+	// The estimated number of bytes of memory held by the lock table's per-key
+	// state: the keys, their lock holders, and the requests in their
+	// wait-queues. See LockMemoryEstimate for how each key's footprint is
+	// estimated. The estimate is maintained incrementally as the lock table
+	// changes, rather than computed when the metrics are collected.
+	EstimatedBytes int64
 	// The number of locks actively held by transactions.
 	LocksHeld int64
 	// The aggregate nanoseconds locks have been active in the lock table and
@@ -43,10 +55,155 @@ type LockTableMetrics struct {
 	// The aggregate number of waiting readers in wait-queues across all locks.
 	WaitingReaders int64
 	// The aggregate number of waiting writers in wait-queues across all locks.
+	// This is the sum of WaitingWritersActive and WaitingWritersInactive.
 	WaitingWriters int64
+	// The aggregate number of waiting writers in wait-queues across all locks
+	// that are actively waiting, and that are inactive waiters, respectively.
+	// Inactive waiters hold a (possibly joint) claim on the lock and aren't
+	// blocked on it.
+	WaitingWritersActive   int64
+	WaitingWritersInactive int64
+	// The aggregate number of waiting writers in wait-queues across all locks
+	// that are non-transactional. These are included in WaitingWriters.
+	// Non-transactional writers have no transaction to push and are cleared
+	// from wait-queues in bulk, so they contend differently than transactional
+	// writers.
+	NonTxnWaitingWriters int64
 	// The aggregate nanoseconds spent in wait-queues, aggregated across each
 	// waiter in the wait-queue of every lock in the lock table.
 	TotalWaitDurationNanos int64
+	// The number of locks with waiting non-locking readers that are blocked by
+	// an intent, and by an unreplicated exclusive lock, respectively. Readers
+	// blocked by intents point at slow intent resolution, whereas readers
+	// blocked by unreplicated exclusive locks point at contention with locking
+	// reads (e.g. SELECT FOR UPDATE). A lock held both as an intent and as an
+	// unreplicated exclusive lock is counted as blocking on the intent.
+	LocksWithReadersBlockedByIntent           int64
+	LocksWithReadersBlockedByUnreplicatedLock int64
+	// The number of held locks with each strength. Each holder of a lock is
+	// counted separately, so a key locked by two transactions with the Shared
+	// strength counts twice. A holder is counted under the strongest strength
+	// with which it holds the lock.
+	SharedLocksHeld    int64
+	ExclusiveLocksHeld int64
+	IntentsHeld        int64
+	// The number of requests currently evaluating optimistically, i.e. whose
+	// lock table guards were created by ScanOptimistic and have neither been
+	// dequeued nor re-scanned pessimistically. Their snapshots of the lock
+	// table pin the locks they reference in memory.
+	OptimisticGuards int64
+
+	// The cumulative number of lock acquisitions rejected, and discovered locks
+	// not tracked, because their transaction held locks on as many keys as
+	// permitted by kv.lock_table.max_locks_per_transaction.
+	MaxLocksPerTxnRejections int64
+
+	// The cumulative number of times locking requests were throttled, either
+	// when sequencing or when queueing eagerly, because they exceeded
+	// kv.lock_table.per_key_acquisition_rate_limit on a key.
+	AcquisitionsThrottled int64
+
+	// The cumulative number of requests with a WaitPolicy_Error that were
+	// rejected with a LockConflictError because of a conflicting lock whose
+	// holder could not be pushed out of the way. Requests using
+	// WaitPolicy_SkipLocked are not included, as their conflicts are handled
+	// during evaluation.
+	WaitPolicyErrorRejections int64
+
+	// The cumulative number of pushes of conflicting transactions performed by
+	// requests waiting in the lock table, whether to detect coordinator
+	// failures, to detect deadlocks, or to resolve conflicts. See
+	// kv.lock_table.distinguished_waiters.enabled.
+	WaiterPushes int64
+	// The cumulative number of unreplicated lock acquisitions made by a
+	// transaction at an epoch prior to the one it already held the lock at. See
+	// kv.lock_table.epoch_regression_acquisition_policy.
+	EpochRegressionAcquisitions int64
+	// The cumulative number of requests that evaluated optimistically, i.e.
+	// whose lock table guards were created by ScanOptimistic.
+	OptimisticEvals int64
+	// The cumulative number of requests that evaluated optimistically but had
+	// to be re-sequenced pessimistically, because their optimistic evaluation
+	// conflicted with a latch or a lock. Compared with OptimisticEvals, this
+	// indicates whether optimistic evaluation benefits a workload.
+	OptimisticEvalFallbacks int64
+
+	// The cumulative number of locks removed from the lock table, either
+	// because they became empty and were garbage collected or because they were
+	// cleared (e.g. to relieve memory pressure, or when the lock table was
+	// disabled). Compared with the rate of lock acquisitions and discoveries,
+	// this indicates the churn in the lock table.
+	LocksGCed int64
+
+	// The cumulative number of locks cleared from the lock table to relieve
+	// memory pressure, because it tracked more keys than
+	// kv.lock_table.maximum_keys_locked permits, and the number of waiters of
+	// those locks that were told to wait elsewhere as a result. Locks cleared
+	// deliberately, e.g. when the lock table is disabled, are not included. A
+	// non-zero rate indicates that the lock table is discarding wait-queue state
+	// and may explain latency blips for contended workloads.
+	LocksClearedOnMemoryPressure int64
+	WaitersToldToWaitElsewhere   int64
+
+	// The cumulative number of uncontended unreplicated locks that were dropped
+	// from the lock table when their holder re-acquired them with the Replicated
+	// durability, relying on the MVCC intent instead, and the number of waiting
+	// non-locking readers released as a result.
+	LocksFreedOnReplicatedAcquire      int64
+	ReadersReleasedOnReplicatedAcquire int64
+
+	// The cumulative number of replicated locks held by transactions known to
+	// have been pushed above a non-locking reader's timestamp that readers
+	// resolved inline, as soon as they were encountered, and deferred, to be
+	// resolved in a batch at the end of the reader's scan, respectively. See
+	// kv.lock_table.resolve_pushed_locks_inline.enabled.
+	PushedLocksResolvedInline   int64
+	PushedLocksResolvedDeferred int64
+
+	// The cumulative number of replicated locks to resolve, accumulated by
+	// requests scanning the lock table, that were dropped because another
+	// request had already resolved them, and that were instead passed through
+	// to the request to resolve, respectively. Locks held by transactions that
+	// are pushed but not finalized are always passed through. A low rate of
+	// deduplication coupled with a high rate of resolution may indicate that
+	// requests are duplicating intent resolution work.
+	ResolutionsDeduped       int64
+	ResolutionsPassedThrough int64
+
+	// The cumulative number of discovered locks that were not added to the lock
+	// table because their holder was known to be finalized. These locks are
+	// instead resolved by the discovering request before it re-scans the lock
+	// table.
+	DiscoveredLocksOfFinalizedTxns int64
+
+	// The cumulative number of discovered locks that were not added to the lock
+	// table because it was above its high watermark. The discovering requests
+	// rediscover these locks on their next evaluation attempt. See
+	// kv.lock_table.discovered_lock_high_watermark.
+	DiscoveredLocksRejected int64
+
+	// The cumulative number of times a request scanning the lock table did not
+	// need to wait at a lock because its transaction already held the lock with
+	// a sufficient strength. A low rate on a workload whose transactions are
+	// expected to revisit the keys they have locked may indicate a bug in lock
+	// tracking.
+	HeldLockFastPathHits int64
+
+	// The cumulative number of lock rediscovery loops detected by the lock
+	// table, i.e. the number of times the same lock (by key and holder) was
+	// discovered by requests more than
+	// kv.lock_table.rediscovery_loop_detection.threshold times in a short
+	// window. Each loop is counted once per window. A non-zero value points to
+	// a divergence between the lock table and the replicated keyspace.
+	RediscoveryLoopsDetected int64
+
+	// The cumulative number of lock acquisitions, discovered locks, and lock
+	// updates, respectively, received while the lock table was disabled. These
+	// are only tracked if kv.lock_table.track_operations_while_disabled.enabled
+	// is set.
+	AcquisitionsWhileDisabled    int64
+	DiscoveredLocksWhileDisabled int64
+	UpdatesWhileDisabled         int64
 
 	// The top-k locks with the most waiters (readers + writers) in their
 	// wait-queue, ordered in descending order.
@@ -73,8 +230,13 @@ type LockMetrics struct {
 	Waiters int64
 	// The number of waiting readers in the lock's wait queue.
 	WaitingReaders int64
-	// The number of waiting writers in the lock's wait queue.
+	// The number of waiting writers in the lock's wait queue. This is the sum
+	// of WaitingWritersActive and WaitingWritersInactive.
 	WaitingWriters int64
+	// The number of waiting writers in the lock's wait queue that are actively
+	// waiting, and that are inactive waiters, respectively.
+	WaitingWritersActive   int64
+	WaitingWritersInactive int64
 	// The total number of nanoseconds all waiters have been in the lock's wait
 	// queue.
 	WaitDurationNanos int64
@@ -98,6 +260,8 @@ func (m *LockTableMetrics) addLockMetrics(lm LockMetrics) {
 		m.Waiters += lm.Waiters
 		m.WaitingReaders += lm.WaitingReaders
 		m.WaitingWriters += lm.WaitingWriters
+		m.WaitingWritersActive += lm.WaitingWritersActive
+		m.WaitingWritersInactive += lm.WaitingWritersInactive
 		m.TotalWaitDurationNanos += lm.WaitDurationNanos
 		m.addToTopKLocksByWaiters(lm)
 		m.addToTopKLocksByWaitDuration(lm)
@@ -138,3 +302,208 @@ func addToTopK(topK []LockMetrics, lm LockMetrics, cmp func(LockMetrics) int64)
 		}
 	}
 }
+
+// LockContentionByKeyRange holds the contention on the locks in a lockTable,
+// aggregated into buckets of key spans. Locks on range-local keys and locks on
+// global keys are bucketed separately, as the two keyspaces share no useful
+// notion of distance.
+type LockContentionByKeyRange struct {
+	Local  []LockContentionBucket
+	Global []LockContentionBucket
+}
+
+// LockContentionBucket holds the aggregated state of the locks in a lockTable
+// whose keys fall within a span.
+type LockContentionBucket struct {
+	// The span covered by the bucket.
+	Span roachpb.Span
+	// The number of locks in the bucket.
+	Locks int64
+	// The number of locks in the bucket that are actively held.
+	LocksHeld int64
+	// The total number of nanoseconds the bucket's locks have been held.
+	HoldDurationNanos int64
+	// The number of waiters in the wait queues of the bucket's locks.
+	Waiters int64
+	// The number of waiting readers in the wait queues of the bucket's locks.
+	WaitingReaders int64
+	// The number of waiting writers in the wait queues of the bucket's locks.
+	WaitingWriters int64
+	// The total number of nanoseconds all waiters have been in the wait queues
+	// of the bucket's locks.
+	WaitDurationNanos int64
+}
+
+// addLockMetrics adds the provided LockMetrics to the receiver.
+func (b *LockContentionBucket) addLockMetrics(lm LockMetrics) {
+	b.Locks++
+	if lm.Held {
+		b.LocksHeld++
+		b.HoldDurationNanos += lm.HoldDurationNanos
+	}
+	b.Waiters += lm.Waiters
+	b.WaitingReaders += lm.WaitingReaders
+	b.WaitingWriters += lm.WaitingWriters
+	b.WaitDurationNanos += lm.WaitDurationNanos
+}
+
+// bucketLockMetrics aggregates the provided LockMetrics, which must be sorted
+// by key, into numBuckets buckets. The buckets partition the span between the
+// first and the last key into sub-spans of equal width, where the width is
+// measured over the 8 bytes that follow the longest common prefix of the first
+// and last key. Empty buckets are included in the result. Nil is returned if
+// there are no LockMetrics to aggregate.
+func bucketLockMetrics(lms []LockMetrics, numBuckets int) []LockContentionBucket {
+	if len(lms) == 0 || numBuckets <= 0 {
+		return nil
+	}
+	first, last := lms[0].Key, lms[len(lms)-1].Key
+	prefixLen := 0
+	for prefixLen < len(first) && prefixLen < len(last) && first[prefixLen] == last[prefixLen] {
+		prefixLen++
+	}
+	pos := func(key roachpb.Key) uint64 {
+		var buf [8]byte
+		copy(buf[:], key[prefixLen:])
+		return binary.BigEndian.Uint64(buf[:])
+	}
+	lo, hi := pos(first), pos(last)
+	width, n := hi-lo, uint64(numBuckets)
+
+	buckets := make([]LockContentionBucket, numBuckets)
+	buckets[0].Span.Key = first
+	for i := 1; i < numBuckets; i++ {
+		// lo + width*i/n, computed without overflowing.
+		prodHi, prodLo := bits.Mul64(width, uint64(i))
+		quo, _ := bits.Div64(prodHi, prodLo, n)
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], lo+quo)
+		boundary := make(roachpb.Key, 0, prefixLen+8)
+		boundary = append(boundary, first[:prefixLen]...)
+		boundary = append(boundary, bytes.TrimRight(buf[:], "\x00")...)
+		// Boundaries must never regress, which they could otherwise do after
+		// trailing zeros are trimmed.
+		if prev := buckets[i-1].Span.Key; boundary.Compare(prev) < 0 {
+			boundary = prev
+		}
+		buckets[i-1].Span.EndKey = boundary
+		buckets[i].Span.Key = boundary
+	}
+	buckets[numBuckets-1].Span.EndKey = last.Next()
+
+	b := 0
+	for _, lm := range lms {
+		for b < numBuckets-1 && lm.Key.Compare(buckets[b].Span.EndKey) >= 0 {
+			b++
+		}
+		buckets[b].addLockMetrics(lm)
+	}
+	return buckets
+}
+
+// MaxTopKeysByMemory is the maximum number of keys for which the lockTable
+// reports its estimated memory footprint. See lockTable.TopKeysByMemory.
+const MaxTopKeysByMemory = 100
+
+// The constants used to estimate the memory footprint of the state tracked by
+// a lockTable for a key. They approximate the size of the structs, list
+// elements, and map entries involved, and are deliberately fixed so that
+// estimates are comparable across versions and independent of the layout of
+// the lockTable's internal structs.
+const (
+	// keyLocksEstimatedBytes is the estimated footprint of the per-key state,
+	// excluding the key itself.
+	keyLocksEstimatedBytes = 256
+	// lockHolderEstimatedBytes is the estimated footprint of each lock holder,
+	// excluding its transaction's anchor key.
+	lockHolderEstimatedBytes = 320
+	// queuedRequestEstimatedBytes is the estimated footprint of each request in
+	// a key's wait-queues.
+	queuedRequestEstimatedBytes = 64
+)
+
+// LockMemoryEstimate holds the estimated memory footprint of the state tracked
+// by a lockTable for a key: the key, its lock holders, and the requests in its
+// wait-queues. The estimate is computed as keyLocksEstimatedBytes plus the
+// length of the key, plus lockHolderEstimatedBytes plus the length of the
+// transaction's anchor key for each holder, plus queuedRequestEstimatedBytes for
+// each waiting reader and queued locking request.
+type LockMemoryEstimate struct {
+	// The locked key.
+	Key roachpb.Key
+	// The estimated number of bytes.
+	Bytes int64
+	// The number of lock holders.
+	Holders int64
+	// The number of waiting readers.
+	WaitingReaders int64
+	// The number of queued locking requests, whether actively waiting or not.
+	QueuedLockingRequests int64
+}
+
+// addToTopKeysByMemory inserts the provided estimate into topN, which is
+// ordered by decreasing estimated bytes and holds at most n estimates, and
+// returns the resulting slice. Estimates with the same number of bytes retain
+// the order in which they were inserted.
+func addToTopKeysByMemory(
+	topN []LockMemoryEstimate, est LockMemoryEstimate, n int,
+) []LockMemoryEstimate {
+	i := len(topN)
+	for i > 0 && est.Bytes > topN[i-1].Bytes {
+		i--
+	}
+	if i == n {
+		return topN
+	}
+	if len(topN) < n {
+		topN = append(topN, LockMemoryEstimate{})
+	}
+	copy(topN[i+1:], topN[i:])
+	topN[i] = est
+	return topN
+}
+
+// MaxTopTxnsByContention is the maximum number of transactions for which the
+// lockTable reports the contention they cause. See
+// lockTable.TopTxnsByContention.
+const MaxTopTxnsByContention = 100
+
+// MaxHotKeys is the maximum number of keys for which the lockTable reports
+// its state as a contention hot spot. See lockTable.HotKeys.
+const MaxHotKeys = 100
+
+// TxnContention holds the contention caused by the locks held by a transaction
+// in a lockTable. Waiters are attributed to the transaction that has claimed
+// the lock they are waiting on, i.e. the transaction they push, so a lock held
+// by multiple transactions is only attributed to one of them.
+type TxnContention struct {
+	// The ID of the transaction.
+	TxnID uuid.UUID
+	// The number of locks claimed by the transaction that have active waiters.
+	Locks int64
+	// The number of active waiters on those locks.
+	Waiters int64
+	// The total number of nanoseconds the active waiters have been waiting on
+	// those locks.
+	WaitDurationNanos int64
+}
+
+// LockQueueHeadCompatibility describes the queue of locking requests at a key
+// that isn't locked. When the lock on a key is released, the request at the
+// head of the queue is released along with the consecutive requests that
+// follow it and are compatible with it, so a single incompatible request
+// behind the head holds back all the requests queued behind it, even those
+// compatible with the head.
+type LockQueueHeadCompatibility struct {
+	// The key.
+	Key roachpb.Key
+	// The lock strength of the transactional request at the head of the queue.
+	// Non-transactional requests ahead of it are ignored, as they are released
+	// regardless of the requests that follow them.
+	HeadStrength lock.Strength
+	// The number of consecutive requests that immediately follow the head and
+	// are compatible with it.
+	CompatibleFollowers int64
+	// The number of queued locking requests, whether actively waiting or not.
+	QueuedLockingRequests int64
+}
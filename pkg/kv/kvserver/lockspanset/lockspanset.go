@@ -22,6 +22,9 @@ import (
 
 type LockSpanSet struct {
 	spans [lock.NumLockStrength][]roachpb.Span
+	// nonEmpty is a bitmask of the lock strengths that have at least one span
+	// in the set. Bit i corresponds to lock.Strength(i).
+	nonEmpty uint32
 }
 
 var lockSpanSetPool = sync.Pool{
@@ -42,6 +45,14 @@ func (l *LockSpanSet) GetSpans(str lock.Strength) []roachpb.Span {
 // lock strength.
 func (l *LockSpanSet) Add(str lock.Strength, span roachpb.Span) {
 	l.spans[str] = append(l.spans[str], span)
+	l.nonEmpty |= 1 << str
+}
+
+// NonEmptyStrengths returns a bitmask of the lock strengths that have at least
+// one span in the LockSpanSet. Bit i is set iff GetSpans(lock.Strength(i)) is
+// non-empty.
+func (l *LockSpanSet) NonEmptyStrengths() uint32 {
+	return l.nonEmpty
 }
 
 // SortAndDeDup sorts the spans in the LockSpanSet and removes any duplicates.
@@ -66,6 +77,7 @@ func (l *LockSpanSet) Release() {
 		}
 		l.spans[st] = recycle
 	}
+	l.nonEmpty = 0
 	lockSpanSetPool.Put(l)
 }
 
@@ -101,9 +113,29 @@ func (l *LockSpanSet) Copy() *LockSpanSet {
 	for st := range l.spans {
 		n.spans[st] = append(n.spans[st], l.spans[st]...)
 	}
+	n.nonEmpty = l.nonEmpty
 	return n
 }
 
+// Equal returns whether the receiver and the supplied LockSpanSet contain the
+// same spans, in the same order, for every lock strength.
+func (l *LockSpanSet) Equal(o *LockSpanSet) bool {
+	if l == o {
+		return true
+	}
+	for st := range l.spans {
+		if len(l.spans[st]) != len(o.spans[st]) {
+			return false
+		}
+		for i := range l.spans[st] {
+			if !l.spans[st][i].Equal(o.spans[st][i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // Reserve space for N additional spans.
 func (l *LockSpanSet) Reserve(str lock.Strength, n int) {
 	existing := l.spans[str]
@@ -127,3 +127,54 @@ func TestLockSpanSetCopy(t *testing.T) {
 	lss.Add(lock.None, roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("b")})
 	require.NotEqual(t, lss, c)
 }
+
+// TestLockSpanSetEqual tests equality of lock span sets.
+func TestLockSpanSetEqual(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	lss := New()
+	lss.Add(lock.None, roachpb.Span{Key: roachpb.Key("abc")})
+	lss.Add(lock.Update, roachpb.Span{Key: roachpb.Key("b"), EndKey: roachpb.Key("c")})
+	require.True(t, lss.Equal(lss))
+
+	c := lss.Copy()
+	require.True(t, lss.Equal(c))
+	require.True(t, c.Equal(lss))
+
+	// The same span with a different strength is not equal.
+	other := New()
+	other.Add(lock.None, roachpb.Span{Key: roachpb.Key("abc")})
+	other.Add(lock.Exclusive, roachpb.Span{Key: roachpb.Key("b"), EndKey: roachpb.Key("c")})
+	require.False(t, lss.Equal(other))
+
+	c.Add(lock.None, roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("b")})
+	require.False(t, lss.Equal(c))
+}
+
+// TestLockSpanSetNonEmptyStrengths tests that the bitmask of non-empty lock
+// strengths tracks the spans added to the set.
+func TestLockSpanSetNonEmptyStrengths(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	lss := New()
+	require.Zero(t, lss.NonEmptyStrengths())
+
+	lss.Add(lock.None, roachpb.Span{Key: roachpb.Key("a")})
+	lss.Add(lock.Exclusive, roachpb.Span{Key: roachpb.Key("b")})
+	lss.Add(lock.Exclusive, roachpb.Span{Key: roachpb.Key("c")})
+	exp := uint32(1<<lock.None | 1<<lock.Exclusive)
+	require.Equal(t, exp, lss.NonEmptyStrengths())
+	for str := lock.Strength(0); str < lock.NumLockStrength; str++ {
+		nonEmpty := lss.NonEmptyStrengths()&(1<<str) != 0
+		require.Equal(t, len(lss.GetSpans(str)) > 0, nonEmpty, "strength %s", str)
+	}
+
+	c := lss.Copy()
+	require.Equal(t, exp, c.NonEmptyStrengths())
+	c.Release()
+
+	lss.Release()
+	require.Zero(t, New().NonEmptyStrengths())
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/storage"
 	"github.com/cockroachdb/cockroach/pkg/storage/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/util/admission"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/metric"
 	"github.com/cockroachdb/cockroach/pkg/util/metric/aggmetric"
@@ -2022,6 +2023,13 @@ throttled they do count towards 'delay.total' and 'delay.enginebackpressure'.
 		Measurement: "Locks",
 		Unit:        metric.Unit_COUNT,
 	}
+	metaConcurrencyLockTableEstimatedBytes = metric.Metadata{
+		Name: "kv.concurrency.lock_table_estimated_bytes",
+		Help: "Estimated memory held by the state tracked in lock tables, including " +
+			"the locked keys, their lock holders, and their wait-queues",
+		Measurement: "Memory",
+		Unit:        metric.Unit_BYTES,
+	}
 	metaConcurrencyAverageLockHoldDurationNanos = metric.Metadata{
 		Name: "kv.concurrency.avg_lock_hold_duration_nanos",
 		Help: "Average lock hold duration across locks currently held in lock tables. " +
@@ -2042,6 +2050,19 @@ throttled they do count towards 'delay.total' and 'delay.enginebackpressure'.
 		Measurement: "Locks",
 		Unit:        metric.Unit_COUNT,
 	}
+	metaConcurrencyLockWaitQueueActiveWriters = metric.Metadata{
+		Name:        "kv.concurrency.lock_wait_queue_active_writers",
+		Help:        "Number of locking requests actively waiting in a lock wait-queue",
+		Measurement: "Lock-Queue Waiters",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaConcurrencyLockWaitQueueInactiveWriters = metric.Metadata{
+		Name: "kv.concurrency.lock_wait_queue_inactive_writers",
+		Help: "Number of locking requests in a lock wait-queue that are not actively " +
+			"waiting, as they hold a claim on the lock",
+		Measurement: "Lock-Queue Waiters",
+		Unit:        metric.Unit_COUNT,
+	}
 	metaConcurrencyLockWaitQueueWaiters = metric.Metadata{
 		Name:        "kv.concurrency.lock_wait_queue_waiters",
 		Help:        "Number of requests actively waiting in a lock wait-queue",
@@ -2066,6 +2087,63 @@ throttled they do count towards 'delay.total' and 'delay.enginebackpressure'.
 		Measurement: "Lock-Queue Waiters",
 		Unit:        metric.Unit_COUNT,
 	}
+	metaConcurrencyPushedLocksResolvedInline = metric.Metadata{
+		Name: "kv.concurrency.pushed_locks_resolved_inline",
+		Help: "Number of replicated locks of pushed transactions that non-locking " +
+			"readers resolved inline while scanning a lock table, summed over the " +
+			"lock tables of the replicas on this store",
+		Measurement: "Locks",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaConcurrencyPushedLocksResolvedDeferred = metric.Metadata{
+		Name: "kv.concurrency.pushed_locks_resolved_deferred",
+		Help: "Number of replicated locks of pushed transactions that non-locking " +
+			"readers deferred resolving until the end of their lock table scan, " +
+			"summed over the lock tables of the replicas on this store",
+		Measurement: "Locks",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaConcurrencyDiscoveredLocksOfFinalizedTxns = metric.Metadata{
+		Name: "kv.concurrency.discovered_locks_of_finalized_txns",
+		Help: "Number of discovered locks that were not added to a lock table because " +
+			"their holder was known to be finalized, and were resolved by the " +
+			"discovering request instead, summed over the lock tables of the replicas " +
+			"on this store",
+		Measurement: "Locks",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaConcurrencyWaitPolicyErrorRejections = metric.Metadata{
+		Name: "kv.concurrency.wait_policy_error_rejections",
+		Help: "Number of requests using the Error wait policy that were rejected " +
+			"because of a conflicting lock, summed over the lock tables of the " +
+			"replicas on this store",
+		Measurement: "Requests",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaConcurrencyRediscoveryLoopsDetected = metric.Metadata{
+		Name: "kv.concurrency.rediscovery_loops_detected",
+		Help: "Number of lock rediscovery loops detected, in which a request repeatedly " +
+			"discovered the same lock, summed over the lock tables of the replicas on " +
+			"this store",
+		Measurement: "Lock Rediscovery Loops",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaConcurrencyEpochRegressionAcquisitions = metric.Metadata{
+		Name: "kv.concurrency.epoch_regression_acquisitions",
+		Help: "Number of unreplicated lock acquisitions made by a transaction at an " +
+			"epoch prior to the one it already held the lock at, summed over the lock " +
+			"tables of the replicas on this store",
+		Measurement: "Lock Acquisitions",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaConcurrencyLockQueuedBeforeAcquireLatency = metric.Metadata{
+		Name: "kv.concurrency.lock_queued_before_acquire_latency",
+		Help: "Latency between a request entering a lock wait-queue and its transaction " +
+			"acquiring the lock. Requests that stop waiting without acquiring the lock " +
+			"are not included",
+		Measurement: "Latency",
+		Unit:        metric.Unit_NANOSECONDS,
+	}
 
 	// Closed timestamp metrics.
 	metaClosedTimestampMaxBehindNanos = metric.Metadata{
@@ -2176,6 +2254,10 @@ type StoreMetrics struct {
 	// LoadSplitterMetrics stores metrics for load-based splitter split key.
 	*split.LoadSplitterMetrics
 
+	// IOLoadListenerMetrics stores the metrics maintained by IO admission
+	// control for the store.
+	*admission.IOLoadListenerMetrics
+
 	// Replica metrics.
 	ReplicaCount                  *metric.Gauge // Does not include uninitialized or reserved replicas.
 	ReservedReplicaCount          *metric.Gauge
@@ -2510,13 +2592,23 @@ type StoreMetrics struct {
 
 	// Concurrency control metrics.
 	Locks                          *metric.Gauge
+	LockTableEstimatedBytes        *metric.Gauge
 	AverageLockHoldDurationNanos   *metric.Gauge
 	MaxLockHoldDurationNanos       *metric.Gauge
 	LocksWithWaitQueues            *metric.Gauge
 	LockWaitQueueWaiters           *metric.Gauge
+	LockWaitQueueActiveWriters     *metric.Gauge
+	LockWaitQueueInactiveWriters   *metric.Gauge
 	AverageLockWaitDurationNanos   *metric.Gauge
 	MaxLockWaitDurationNanos       *metric.Gauge
 	MaxLockWaitQueueWaitersForLock *metric.Gauge
+	PushedLocksResolvedInline      *metric.Gauge
+	PushedLocksResolvedDeferred    *metric.Gauge
+	DiscoveredLocksOfFinalizedTxns *metric.Gauge
+	WaitPolicyErrorRejections      *metric.Gauge
+	RediscoveryLoopsDetected       *metric.Gauge
+	EpochRegressionAcquisitions    *metric.Gauge
+	LockQueuedBeforeAcquireLatency metric.IHistogram
 
 	// Ingestion metrics
 	IngestCount *metric.Gauge
@@ -2826,6 +2918,7 @@ func newStoreMetrics(histogramWindow time.Duration) *StoreMetrics {
 			PopularKeyCount: metric.NewCounter(metaPopularKeyCount),
 			NoSplitKeyCount: metric.NewCounter(metaNoSplitKeyCount),
 		},
+		IOLoadListenerMetrics: admission.MakeIOLoadListenerMetrics(),
 
 		// Replica metrics.
 		ReplicaCount:                  metric.NewGauge(metaReplicaCount),
@@ -3196,13 +3289,28 @@ func newStoreMetrics(histogramWindow time.Duration) *StoreMetrics {
 
 		// Concurrency control metrics.
 		Locks:                          metric.NewGauge(metaConcurrencyLocks),
+		LockTableEstimatedBytes:        metric.NewGauge(metaConcurrencyLockTableEstimatedBytes),
 		AverageLockHoldDurationNanos:   metric.NewGauge(metaConcurrencyAverageLockHoldDurationNanos),
 		MaxLockHoldDurationNanos:       metric.NewGauge(metaConcurrencyMaxLockHoldDurationNanos),
 		LocksWithWaitQueues:            metric.NewGauge(metaConcurrencyLocksWithWaitQueues),
 		LockWaitQueueWaiters:           metric.NewGauge(metaConcurrencyLockWaitQueueWaiters),
+		LockWaitQueueActiveWriters:     metric.NewGauge(metaConcurrencyLockWaitQueueActiveWriters),
+		LockWaitQueueInactiveWriters:   metric.NewGauge(metaConcurrencyLockWaitQueueInactiveWriters),
 		AverageLockWaitDurationNanos:   metric.NewGauge(metaConcurrencyAverageLockWaitDurationNanos),
 		MaxLockWaitDurationNanos:       metric.NewGauge(metaConcurrencyMaxLockWaitDurationNanos),
 		MaxLockWaitQueueWaitersForLock: metric.NewGauge(metaConcurrencyMaxLockWaitQueueWaitersForLock),
+		PushedLocksResolvedInline:      metric.NewGauge(metaConcurrencyPushedLocksResolvedInline),
+		PushedLocksResolvedDeferred:    metric.NewGauge(metaConcurrencyPushedLocksResolvedDeferred),
+		DiscoveredLocksOfFinalizedTxns: metric.NewGauge(metaConcurrencyDiscoveredLocksOfFinalizedTxns),
+		WaitPolicyErrorRejections:      metric.NewGauge(metaConcurrencyWaitPolicyErrorRejections),
+		RediscoveryLoopsDetected:       metric.NewGauge(metaConcurrencyRediscoveryLoopsDetected),
+		EpochRegressionAcquisitions:    metric.NewGauge(metaConcurrencyEpochRegressionAcquisitions),
+		LockQueuedBeforeAcquireLatency: metric.NewHistogram(metric.HistogramOptions{
+			Mode:         metric.HistogramModePreferHdrLatency,
+			Metadata:     metaConcurrencyLockQueuedBeforeAcquireLatency,
+			Duration:     histogramWindow,
+			BucketConfig: metric.IOLatencyBuckets,
+		}),
 
 		// Closed timestamp metrics.
 		ClosedTimestampMaxBehindNanos: metric.NewGauge(metaClosedTimestampMaxBehindNanos),
@@ -3250,6 +3358,7 @@ func newStoreMetrics(histogramWindow time.Duration) *StoreMetrics {
 
 	storeRegistry.AddMetricStruct(sm)
 	storeRegistry.AddMetricStruct(sm.LoadSplitterMetrics)
+	storeRegistry.AddMetricStruct(sm.IOLoadListenerMetrics)
 	return sm
 }
 
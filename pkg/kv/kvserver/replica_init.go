@@ -107,17 +107,19 @@ func newUninitializedReplicaWithoutRaftGroup(
 		store:          store,
 		abortSpan:      abortspan.New(rangeID),
 		concMgr: concurrency.NewManager(concurrency.Config{
-			NodeDesc:          store.nodeDesc,
-			RangeDesc:         uninitState.Desc,
-			Settings:          store.ClusterSettings(),
-			DB:                store.DB(),
-			Clock:             store.Clock(),
-			Stopper:           store.Stopper(),
-			IntentResolver:    store.intentResolver,
-			TxnWaitMetrics:    store.txnWaitMetrics,
-			SlowLatchGauge:    store.metrics.SlowLatchRequests,
-			DisableTxnPushing: store.TestingKnobs().DontPushOnLockConflictError,
-			TxnWaitKnobs:      store.TestingKnobs().TxnWaitKnobs,
+			NodeDesc:                       store.nodeDesc,
+			RangeDesc:                      uninitState.Desc,
+			Settings:                       store.ClusterSettings(),
+			DB:                             store.DB(),
+			Clock:                          store.Clock(),
+			Stopper:                        store.Stopper(),
+			IntentResolver:                 store.intentResolver,
+			TxnStatusCache:                 store.txnStatusCache,
+			TxnWaitMetrics:                 store.txnWaitMetrics,
+			SlowLatchGauge:                 store.metrics.SlowLatchRequests,
+			LockQueuedBeforeAcquireLatency: store.metrics.LockQueuedBeforeAcquireLatency,
+			DisableTxnPushing:              store.TestingKnobs().DontPushOnLockConflictError,
+			TxnWaitKnobs:                   store.TestingKnobs().TxnWaitKnobs,
 		}),
 	}
 	r.sideTransportClosedTimestamp.init(store.cfg.ClosedTimestampReceiver, rangeID)
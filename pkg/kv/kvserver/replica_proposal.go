@@ -783,7 +783,12 @@ func (r *Replica) handleReadWriteLocalEvalResult(ctx context.Context, lResult re
 
 	if lResult.AcquiredLocks != nil {
 		for i := range lResult.AcquiredLocks {
-			r.concMgr.OnLockAcquired(ctx, &lResult.AcquiredLocks[i])
+			if err := r.concMgr.OnLockAcquired(ctx, &lResult.AcquiredLocks[i]); err != nil {
+				// The command has already been applied, so the acquisition can't
+				// be rejected. The lock table will rediscover the lock if another
+				// request runs into it.
+				log.VEventf(ctx, 2, "lock table did not track acquired lock: %v", err)
+			}
 		}
 		lResult.AcquiredLocks = nil
 	}
@@ -796,9 +801,7 @@ func (r *Replica) handleReadWriteLocalEvalResult(ctx context.Context, lResult re
 	}
 
 	if lResult.UpdatedTxns != nil {
-		for _, txn := range lResult.UpdatedTxns {
-			r.concMgr.OnTransactionUpdated(ctx, txn)
-		}
+		r.concMgr.OnTransactionsUpdated(ctx, lResult.UpdatedTxns)
 		lResult.UpdatedTxns = nil
 	}
 
@@ -511,10 +511,19 @@ func (r *Replica) handleReadOnlyLocalEvalResult(
 	if lResult.AcquiredLocks != nil {
 		// These will all be unreplicated locks.
 		log.Eventf(ctx, "acquiring %d unreplicated locks", len(lResult.AcquiredLocks))
+		var pErr *kvpb.Error
 		for i := range lResult.AcquiredLocks {
-			r.concMgr.OnLockAcquired(ctx, &lResult.AcquiredLocks[i])
+			if err := r.concMgr.OnLockAcquired(ctx, &lResult.AcquiredLocks[i]); err != nil && pErr == nil {
+				// The lock table refused to track the lock, so it is not held.
+				// Fail the request with the retryable error so that its
+				// transaction does not proceed as if it were.
+				pErr = kvpb.NewErrorWithTxn(err, ba.Txn)
+			}
 		}
 		lResult.AcquiredLocks = nil
+		if pErr != nil {
+			return pErr
+		}
 	}
 
 	if !lResult.IsZero() {
@@ -524,12 +524,17 @@ func (r *Replica) executeBatchWithConcurrencyRetries(
 		// having already released the guard's latches, or in case of certain types
 		// of read-only requests (see `canReadOnlyRequestDropLatchesBeforeEval`), it
 		// may have released the guard's latches.
+		//
+		// If the batch is going to be sequenced again with the same latch and lock
+		// spans, its concurrency guard is retained, so that the next sequencing
+		// attempt reuses the guard's spans and lock table guard.
 		dropLatchesAndLockWaitQueues := func(reuseLatchAndLockSpans bool) {
 			if g != nil {
-				latchSpans, lockSpans = nil, nil
 				if reuseLatchAndLockSpans {
-					latchSpans, lockSpans = g.TakeSpanSets()
+					r.concMgr.DropLatchesAndLockWaitQueues(g)
+					return
 				}
+				latchSpans, lockSpans = nil, nil
 				r.concMgr.FinishReq(g)
 				g = nil
 			}
@@ -11291,7 +11291,7 @@ func TestReplicaQueryLocks(t *testing.T) {
 			if includeUncontended && limitResults {
 				require.NotNil(t, resp.Header().ResumeSpan, "expected resume span")
 				require.Equal(t, kvpb.RESUME_KEY_LIMIT, resp.Header().ResumeReason)
-				require.Equal(t, roachpb.Key("b"), resp.Header().ResumeSpan.Key)
+				require.Equal(t, keyA.Next(), resp.Header().ResumeSpan.Key)
 			} else {
 				require.Nil(t, resp.Header().ResumeSpan)
 				require.Equal(t, kvpb.RESUME_UNKNOWN, resp.Header().ResumeReason)
@@ -40,6 +40,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/allocator/storepool"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/batcheval"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/closedts/sidetransport"
+	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/concurrency"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/idalloc"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/intentresolver"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/kvadmission"
@@ -135,6 +136,13 @@ var defaultRaftSchedulerConcurrency = envutil.EnvOrDefaultInt(
 // counts, while also avoiding starvation by excessive sharding.
 var defaultRaftSchedulerShardSize = envutil.EnvOrDefaultInt("COCKROACH_SCHEDULER_SHARD_SIZE", 16)
 
+// defaultTxnStatusCacheShards is the number of shards of the transaction status
+// cache shared by the replicas on a store. The transactions pushed on a store,
+// and with them the accesses to the cache, scale with the number of CPUs, so
+// the cache is sized and sharded by them, capped at 64 shards.
+var defaultTxnStatusCacheShards = envutil.EnvOrDefaultInt(
+	"COCKROACH_TXN_STATUS_CACHE_SHARDS", min(2*runtime.GOMAXPROCS(0), 64))
+
 // defaultRaftEntryCacheSize is the default size in bytes for the Raft entry
 // cache, divided evenly between stores. The Raft entry cache is shared by all
 // Raft groups managed by each store. It is used to cache uncommitted raft log
@@ -859,6 +867,7 @@ type Store struct {
 	raftEntryCache      *raftentry.Cache
 	limiters            batcheval.Limiters
 	txnWaitMetrics      *txnwait.Metrics
+	txnStatusCache      *concurrency.SharedTxnStatusCache
 	sstSnapshotStorage  SSTSnapshotStorage
 	protectedtsReader   spanconfig.ProtectedTSReader
 	ctSender            *sidetransport.Sender
@@ -1491,6 +1500,7 @@ func NewStore(
 
 	s.txnWaitMetrics = txnwait.NewMetrics(cfg.HistogramWindowInterval)
 	s.metrics.registry.AddMetricStruct(s.txnWaitMetrics)
+	s.txnStatusCache = concurrency.NewSharedTxnStatusCache(defaultTxnStatusCacheShards)
 	s.snapshotApplyQueue = multiqueue.NewMultiQueue(int(cfg.SnapshotApplyLimit))
 	s.snapshotSendQueue = multiqueue.NewMultiQueue(int(cfg.SnapshotSendLimit))
 
@@ -1565,6 +1575,12 @@ func NewStore(
 		s.limiters.ConcurrentRangefeedIters.SetLimit(
 			int(concurrentRangefeedItersLimit.Get(&cfg.Settings.SV)))
 	})
+	concurrency.MaxKeysLocked.SetOnChange(&cfg.Settings.SV, func(ctx context.Context) {
+		s.VisitReplicas(func(r *Replica) (wantMore bool) {
+			r.concMgr.OnMaxKeysLockedUpdated()
+			return true
+		})
+	})
 
 	authorizer := cfg.TestingKnobs.TenantRateKnobs.Authorizer
 	if cfg.RPCContext != nil && cfg.RPCContext.TenantRPCAuthorizer != nil {
@@ -3031,13 +3047,22 @@ func (s *Store) updateReplicationGauges(ctx context.Context) error {
 		slowRaftProposalCount     int64
 
 		locks                          int64
+		lockTableEstimatedBytes        int64
 		totalLockHoldDurationNanos     int64
 		maxLockHoldDurationNanos       int64
 		locksWithWaitQueues            int64
 		lockWaitQueueWaiters           int64
+		lockWaitQueueActiveWriters     int64
+		lockWaitQueueInactiveWriters   int64
 		totalLockWaitDurationNanos     int64
 		maxLockWaitDurationNanos       int64
 		maxLockWaitQueueWaitersForLock int64
+		pushedLocksResolvedInline      int64
+		pushedLocksResolvedDeferred    int64
+		discoveredLocksOfFinalizedTxns int64
+		waitPolicyErrorRejections      int64
+		rediscoveryLoopsDetected       int64
+		epochRegressionAcquisitions    int64
 
 		minMaxClosedTS hlc.Timestamp
 	)
@@ -3121,10 +3146,19 @@ func (s *Store) updateReplicationGauges(ctx context.Context) error {
 		s.metrics.RecentReplicaQueriesPerSecond.RecordValue(loadStats.QueriesPerSecond)
 
 		locks += metrics.LockTableMetrics.Locks
+		lockTableEstimatedBytes += metrics.LockTableMetrics.EstimatedBytes
 		totalLockHoldDurationNanos += metrics.LockTableMetrics.TotalLockHoldDurationNanos
 		locksWithWaitQueues += metrics.LockTableMetrics.LocksWithWaitQueues
 		lockWaitQueueWaiters += metrics.LockTableMetrics.Waiters
+		lockWaitQueueActiveWriters += metrics.LockTableMetrics.WaitingWritersActive
+		lockWaitQueueInactiveWriters += metrics.LockTableMetrics.WaitingWritersInactive
 		totalLockWaitDurationNanos += metrics.LockTableMetrics.TotalWaitDurationNanos
+		pushedLocksResolvedInline += metrics.LockTableMetrics.PushedLocksResolvedInline
+		pushedLocksResolvedDeferred += metrics.LockTableMetrics.PushedLocksResolvedDeferred
+		discoveredLocksOfFinalizedTxns += metrics.LockTableMetrics.DiscoveredLocksOfFinalizedTxns
+		waitPolicyErrorRejections += metrics.LockTableMetrics.WaitPolicyErrorRejections
+		rediscoveryLoopsDetected += metrics.LockTableMetrics.RediscoveryLoopsDetected
+		epochRegressionAcquisitions += metrics.LockTableMetrics.EpochRegressionAcquisitions
 		if w := metrics.LockTableMetrics.TopKLocksByWaiters[0].Waiters; w > maxLockWaitQueueWaitersForLock {
 			maxLockWaitQueueWaitersForLock = w
 		}
@@ -3180,13 +3214,22 @@ func (s *Store) updateReplicationGauges(ctx context.Context) error {
 	}
 
 	s.metrics.Locks.Update(locks)
+	s.metrics.LockTableEstimatedBytes.Update(lockTableEstimatedBytes)
 	s.metrics.AverageLockHoldDurationNanos.Update(averageLockHoldDurationNanos)
 	s.metrics.MaxLockHoldDurationNanos.Update(maxLockHoldDurationNanos)
 	s.metrics.LocksWithWaitQueues.Update(locksWithWaitQueues)
 	s.metrics.LockWaitQueueWaiters.Update(lockWaitQueueWaiters)
+	s.metrics.LockWaitQueueActiveWriters.Update(lockWaitQueueActiveWriters)
+	s.metrics.LockWaitQueueInactiveWriters.Update(lockWaitQueueInactiveWriters)
 	s.metrics.AverageLockWaitDurationNanos.Update(averageLockWaitDurationNanos)
 	s.metrics.MaxLockWaitDurationNanos.Update(maxLockWaitDurationNanos)
 	s.metrics.MaxLockWaitQueueWaitersForLock.Update(maxLockWaitQueueWaitersForLock)
+	s.metrics.PushedLocksResolvedInline.Update(pushedLocksResolvedInline)
+	s.metrics.PushedLocksResolvedDeferred.Update(pushedLocksResolvedDeferred)
+	s.metrics.DiscoveredLocksOfFinalizedTxns.Update(discoveredLocksOfFinalizedTxns)
+	s.metrics.WaitPolicyErrorRejections.Update(waitPolicyErrorRejections)
+	s.metrics.RediscoveryLoopsDetected.Update(rediscoveryLoopsDetected)
+	s.metrics.EpochRegressionAcquisitions.Update(epochRegressionAcquisitions)
 
 	if !minMaxClosedTS.IsEmpty() {
 		nanos := timeutil.Since(minMaxClosedTS.GoTime()).Nanoseconds()
@@ -148,8 +148,11 @@ func (s *Store) MergeRange(
 	leftRepl.loadStats.Merge(rightRepl.loadStats)
 
 	// Clear the concurrency manager's lock and txn wait-queues to redirect the
-	// queued transactions to the left-hand replica, if necessary.
-	rightRepl.concMgr.OnRangeMerge()
+	// queued transactions to the left-hand replica, if necessary. The locks are
+	// handed to the left-hand replica's lock table so that they don't need to
+	// be re-discovered.
+	transferredLocks := rightRepl.concMgr.OnRangeMerge()
+	leftRepl.concMgr.OnLocksTransferred(transferredLocks)
 
 	// Track Whether the leaseholders were aligned for later updating the
 	// minValidObservedTimestamp.
@@ -309,11 +309,11 @@ func (s *Store) SplitRange(
 	defer s.mu.Unlock()
 	leftRepl.setDescRaftMuLocked(ctx, newLeftDesc)
 
-	// Clear the LHS lock and txn wait-queues, to redirect to the RHS if
-	// appropriate. We do this after setDescWithoutProcessUpdate to ensure
-	// that no pre-split commands are inserted into the wait-queues after we
-	// clear them.
-	leftRepl.concMgr.OnRangeSplit()
+	// Clear the LHS txn wait-queue and the RHS half of its lock table, to
+	// redirect to the RHS if appropriate. We do this after
+	// setDescWithoutProcessUpdate to ensure that no pre-split commands are
+	// inserted into the wait-queues after we clear them.
+	transferredLocks := leftRepl.concMgr.OnRangeSplit(rightDesc.StartKey)
 
 	if rightReplOrNil == nil {
 		// There is no RHS replica, so (heuristically) halve the load stats for the
@@ -324,6 +324,10 @@ func (s *Store) SplitRange(
 	}
 	rightRepl := rightReplOrNil
 
+	// Hand the locks on the RHS keys to the RHS lock table, which has already
+	// been enabled if the RHS replica is the leaseholder.
+	rightRepl.concMgr.OnLocksTransferred(transferredLocks)
+
 	// Split the replica load of the LHS evenly (50:50) with the RHS. NB: this
 	// ignores the split point, and makes as simplifying assumption that
 	// distribution across all tracked load stats is identical.
@@ -2068,8 +2068,20 @@ func (ls LockStateInfo) SafeFormat(w redact.SafePrinter, r rune) {
 		}
 	}
 	w.Printf("holder=%s ", redactableLockHolder)
+	w.Printf("strength=%s ", ls.Strength)
 	w.Printf("durability=%s ", ls.Durability)
 	w.Printf("duration=%s", ls.HoldDuration)
+	if len(ls.AdditionalHolders) > 0 {
+		w.Printf("\n additional holders:")
+		for _, h := range ls.AdditionalHolders {
+			if expand {
+				w.Printf("\n  holder=%s", h.Txn.ID)
+			} else {
+				w.Printf("\n  holder=%s", h.Txn.Short())
+			}
+			w.Printf(" strength=%s durability=%s", h.Strength, h.Durability)
+		}
+	}
 	if len(ls.Waiters) > 0 {
 		w.Printf("\n waiters:")
 
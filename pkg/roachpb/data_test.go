@@ -2174,6 +2174,12 @@ func TestLockStateInfoSafeFormat(t *testing.T) {
 		Sequence:          123,
 		CoordinatorNodeID: 1,
 	}
+	otherHolder := enginepb.TxnMeta{
+		Key:            Key("b"),
+		ID:             uuid.Must(uuid.FromString("cafebabe-0000-0000-0000-000000000000")),
+		WriteTimestamp: hlc.Timestamp{Logical: 2},
+		MinTimestamp:   hlc.Timestamp{Logical: 2},
+	}
 	lockStateInfo := &LockStateInfo{
 		RangeID:      35,
 		Key:          Key("bar"),
@@ -2181,28 +2187,40 @@ func TestLockStateInfoSafeFormat(t *testing.T) {
 		Durability:   lock.Unreplicated,
 		HoldDuration: 5 * time.Minute,
 		Waiters:      []lock.Waiter{waiter1, waiter2},
+		Strength:     lock.Shared,
+		AdditionalHolders: []LockHolderInfo{
+			{Txn: otherHolder, Durability: lock.Replicated, Strength: lock.Shared},
+		},
 	}
 
 	require.EqualValues(t,
-		"range_id=35 key=\"bar\" holder=deadbeef durability=Unreplicated duration=5m0s\n"+
+		"range_id=35 key=\"bar\" holder=deadbeef strength=Shared durability=Unreplicated duration=5m0s\n"+
+			" additional holders:\n"+
+			"  holder=cafebabe strength=Shared durability=Replicated\n"+
 			" waiters:\n"+
 			"  waiting_txn:6ba7b810 active_waiter:true strength:Exclusive wait_duration:2m15s\n"+
 			"  waiting_txn:<nil> active_waiter:false strength:None wait_duration:17ms",
 		redact.Sprint(lockStateInfo).StripMarkers())
 	require.EqualValues(t,
-		"range_id=35 key=\"bar\" holder=deadbeef-0000-0000-0000-000000000000 durability=Unreplicated duration=5m0s\n"+
+		"range_id=35 key=\"bar\" holder=deadbeef-0000-0000-0000-000000000000 strength=Shared durability=Unreplicated duration=5m0s\n"+
+			" additional holders:\n"+
+			"  holder=cafebabe-0000-0000-0000-000000000000 strength=Shared durability=Replicated\n"+
 			" waiters:\n"+
 			"  waiting_txn:6ba7b810-9dad-11d1-80b4-00c04fd430c8 active_waiter:true strength:Exclusive wait_duration:2m15s\n"+
 			"  waiting_txn:<nil> active_waiter:false strength:None wait_duration:17ms",
 		redact.Sprintf("%+v", lockStateInfo).StripMarkers())
 	require.EqualValues(t,
-		"range_id=35 key=‹×› holder=deadbeef durability=Unreplicated duration=5m0s\n"+
+		"range_id=35 key=‹×› holder=deadbeef strength=Shared durability=Unreplicated duration=5m0s\n"+
+			" additional holders:\n"+
+			"  holder=cafebabe strength=Shared durability=Replicated\n"+
 			" waiters:\n"+
 			"  waiting_txn:6ba7b810 active_waiter:true strength:Exclusive wait_duration:2m15s\n"+
 			"  waiting_txn:<nil> active_waiter:false strength:None wait_duration:17ms",
 		redact.Sprint(lockStateInfo).Redact())
 	require.EqualValues(t,
-		"range_id=35 key=‹×› holder=‹×› durability=Unreplicated duration=5m0s\n"+
+		"range_id=35 key=‹×› holder=‹×› strength=Shared durability=Unreplicated duration=5m0s\n"+
+			" additional holders:\n"+
+			"  holder=‹×› strength=Shared durability=Replicated\n"+
 			" waiters:\n"+
 			"  waiting_txn:‹×› active_waiter:true strength:Exclusive wait_duration:2m15s\n"+
 			"  waiting_txn:<nil> active_waiter:false strength:None wait_duration:17ms",
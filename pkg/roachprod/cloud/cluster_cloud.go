@@ -190,6 +190,9 @@ func ListCloud(l *logger.Logger, options vm.ListOptions) (*Cloud, error) {
 	}
 
 	if err := g.Wait(); err != nil {
+		if options.FailOnProviderError {
+			return nil, err
+		}
 		// We continue despite the error as we don't want to fail for all providers if only one
 		// has an issue. The function that calls ListCloud may not even use the erring provider.
 		// If it does, it will fail later when it doesn't find the specified cluster.
@@ -0,0 +1,266 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package roachprod
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/roachprod/install"
+	"github.com/cockroachdb/cockroach/pkg/roachprod/logger"
+	"github.com/cockroachdb/cockroach/pkg/util/httputil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/errors"
+)
+
+// describeHealthTimeout bounds the health check made against each node by
+// Describe.
+const describeHealthTimeout = 10 * time.Second
+
+// ClusterDescription is a report describing a cluster and each of its nodes,
+// as returned by Describe. It is JSON-serializable.
+type ClusterDescription struct {
+	Name      string            `json:"name"`
+	Secure    bool              `json:"secure"`
+	Nodes     []NodeDescription `json:"nodes"`
+	Generated time.Time         `json:"generated"`
+	// Errors lists the parts of the report that could not be gathered for the
+	// cluster as a whole. Errors specific to a single node are reported in the
+	// node's NodeDescription.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// NodeDescription describes a single node in a ClusterDescription.
+type NodeDescription struct {
+	Node int `json:"node"`
+
+	// VM metadata and topology.
+	VMName      string        `json:"vm_name"`
+	Provider    string        `json:"provider"`
+	ProviderID  string        `json:"provider_id"`
+	Project     string        `json:"project,omitempty"`
+	MachineType string        `json:"machine_type"`
+	Zone        string        `json:"zone"`
+	Locality    string        `json:"locality,omitempty"`
+	PublicIP    string        `json:"public_ip"`
+	PrivateIP   string        `json:"private_ip"`
+	DNS         string        `json:"dns,omitempty"`
+	Preemptible bool          `json:"preemptible"`
+	CreatedAt   time.Time     `json:"created_at"`
+	Lifetime    time.Duration `json:"lifetime"`
+
+	// Process status, as reported by Status.
+	Running bool   `json:"running"`
+	Version string `json:"version,omitempty"`
+	Pid     string `json:"pid,omitempty"`
+
+	// Healthy is set if the node's /health?ready=1 endpoint reported that the
+	// node is ready. It is nil if the health check could not be made.
+	Healthy *bool `json:"healthy,omitempty"`
+
+	// DiskUsage describes the first store's filesystem. It is nil if the disk
+	// usage could not be gathered.
+	DiskUsage *DiskUsage `json:"disk_usage,omitempty"`
+
+	// Errors lists the parts of the report that could not be gathered for this
+	// node.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// DiskUsage describes the usage of the filesystem containing a store.
+type DiskUsage struct {
+	Path           string `json:"path"`
+	TotalBytes     int64  `json:"total_bytes"`
+	UsedBytes      int64  `json:"used_bytes"`
+	AvailableBytes int64  `json:"available_bytes"`
+}
+
+// Describe returns a report on the named cluster, combining the metadata of
+// its VMs with the status, health, disk usage and cockroach version of each
+// node. The parts of the report are gathered in parallel, and failures to
+// gather any of them are recorded in the report instead of failing the call;
+// an error is only returned if the cluster cannot be found.
+func Describe(
+	ctx context.Context, l *logger.Logger, clusterName string,
+) (ClusterDescription, error) {
+	if err := LoadClusters(); err != nil {
+		return ClusterDescription{}, err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return ClusterDescription{}, err
+	}
+
+	nodes := c.TargetNodes()
+	desc := ClusterDescription{
+		Name:      c.Name,
+		Secure:    c.Secure,
+		Nodes:     make([]NodeDescription, len(nodes)),
+		Generated: timeutil.Now(),
+	}
+	nodeDescs := make(map[install.Node]*NodeDescription, len(nodes))
+	for i, n := range nodes {
+		cVM := c.VMs[n-1]
+		nd := &desc.Nodes[i]
+		*nd = NodeDescription{
+			Node:        int(n),
+			VMName:      cVM.Name,
+			Provider:    cVM.Provider,
+			ProviderID:  cVM.ProviderID,
+			Project:     cVM.Project,
+			MachineType: cVM.MachineType,
+			Zone:        cVM.Zone,
+			PublicIP:    cVM.PublicIP,
+			PrivateIP:   cVM.PrivateIP,
+			DNS:         cVM.DNS,
+			Preemptible: cVM.Preemptible,
+			CreatedAt:   cVM.CreatedAt,
+			Lifetime:    cVM.Lifetime,
+		}
+		if locality, err := cVM.Locality(); err != nil {
+			nd.Errors = append(nd.Errors, fmt.Sprintf("locality: %v", err))
+		} else {
+			nd.Locality = locality
+		}
+		nodeDescs[n] = nd
+	}
+
+	// The gatherers below run concurrently and only fill in their own fields
+	// of each NodeDescription. Errors are appended under mu.
+	var mu sync.Mutex
+	addNodeErr := func(n install.Node, what string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if nd, ok := nodeDescs[n]; ok {
+			nd.Errors = append(nd.Errors, fmt.Sprintf("%s: %v", what, err))
+		}
+	}
+	addClusterErr := func(what string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		desc.Errors = append(desc.Errors, fmt.Sprintf("%s: %v", what, err))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		statuses, err := c.Status(ctx, l)
+		if err != nil {
+			addClusterErr("status", err)
+			return
+		}
+		for _, s := range statuses {
+			n := install.Node(s.NodeID)
+			if s.Err != nil {
+				addNodeErr(n, "status", s.Err)
+				continue
+			}
+			if nd, ok := nodeDescs[n]; ok {
+				nd.Running = s.Running
+				nd.Version = s.Version
+				nd.Pid = s.Pid
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		httpClient := httputil.NewClientWithTimeout(describeHealthTimeout)
+		if _, _, err := c.ParallelE(ctx, l, nodes, func(ctx context.Context, node install.Node) (*install.RunResultDetails, error) {
+			res := &install.RunResultDetails{Node: node}
+			healthy, err := describeNodeHealth(ctx, c, httpClient, node)
+			if err != nil {
+				addNodeErr(node, "health", err)
+				return res, nil
+			}
+			nodeDescs[node].Healthy = &healthy
+			return res, nil
+		}, install.WithWaitOnFail()); err != nil {
+			addClusterErr("health", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		results, err := c.RunWithDetails(ctx, l, nodes, "disk usage",
+			"df -B1 --output=target,size,used,avail {store-dir} | tail -n 1")
+		if err != nil {
+			addClusterErr("disk usage", err)
+			return
+		}
+		for _, r := range results {
+			if r.Err != nil {
+				addNodeErr(r.Node, "disk usage", r.Err)
+				continue
+			}
+			usage, err := parseDiskUsage(r.Stdout)
+			if err != nil {
+				addNodeErr(r.Node, "disk usage", err)
+				continue
+			}
+			if nd, ok := nodeDescs[r.Node]; ok {
+				nd.DiskUsage = usage
+			}
+		}
+	}()
+	wg.Wait()
+
+	return desc, nil
+}
+
+// describeNodeHealth returns whether the node's /health?ready=1 endpoint
+// reports that the node is ready to accept SQL connections.
+func describeNodeHealth(
+	ctx context.Context, c *install.SyncedCluster, httpClient *httputil.Client, node install.Node,
+) (bool, error) {
+	port, err := c.NodeUIPort(ctx, node)
+	if err != nil {
+		return false, err
+	}
+	scheme := "http"
+	if c.Secure {
+		scheme = "https"
+	}
+	healthURL := fmt.Sprintf("%s://%s:%d/health?ready=1", scheme, c.Host(node), port)
+	resp, err := httpClient.Get(ctx, healthURL)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// parseDiskUsage parses the output of `df -B1 --output=target,size,used,avail`
+// for a single filesystem, without the header.
+func parseDiskUsage(out string) (*DiskUsage, error) {
+	fields := strings.Fields(out)
+	if len(fields) != 4 {
+		return nil, errors.Newf("unexpected df output: %q", out)
+	}
+	var vals [3]int64
+	for i := range vals {
+		v, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unexpected df output: %q", out)
+		}
+		vals[i] = v
+	}
+	return &DiskUsage{
+		Path:           fields[0],
+		TotalBytes:     vals[0],
+		UsedBytes:      vals[1],
+		AvailableBytes: vals[2],
+	}, nil
+}
@@ -22,6 +22,7 @@ import (
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -1148,6 +1149,41 @@ func (c *SyncedCluster) RunWithDetails(
 	return results, nil
 }
 
+// RunPerNodeWithDetails runs a (possibly different) command on each node in
+// cmds, in parallel, and returns the results details of each node keyed by
+// node. Like RunWithDetails, it waits for all commands to complete before
+// returning unless encountering a roachprod error.
+func (c *SyncedCluster) RunPerNodeWithDetails(
+	ctx context.Context, l *logger.Logger, title string, cmds map[Node]string,
+) (map[Node]RunResultDetails, error) {
+	nodes := make(Nodes, 0, len(cmds))
+	for n := range cmds {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+	display := fmt.Sprintf("%s:%v: %s", c.Name, nodes, title)
+
+	resultPtrs, _, err := c.ParallelE(ctx, l, nodes, func(ctx context.Context, node Node) (*RunResultDetails, error) {
+		opts := RunCmdOptions{
+			includeRoachprodEnvVars: true,
+			stdout:                  l.Stdout,
+			stderr:                  l.Stderr,
+		}
+		return c.runCmdOnSingleNode(ctx, l, node, cmds[node], opts)
+	}, WithDisplay(display), WithWaitOnFail())
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[Node]RunResultDetails, len(nodes))
+	for i, v := range resultPtrs {
+		if v != nil {
+			results[nodes[i]] = *v
+		}
+	}
+	return results, nil
+}
+
 var roachprodRetryOptions = retry.Options{
 	InitialBackoff: 10 * time.Second,
 	Multiplier:     2,
@@ -1602,6 +1638,12 @@ func (c *SyncedCluster) checkForCertificates(ctx context.Context, l *logger.Logg
 	return c.fileExistsOnFirstNode(ctx, l, filepath.Join(dir, certsTarName))
 }
 
+// HasCertificates returns whether the cluster has a certs bundle, i.e. whether
+// it was set up to run securely.
+func (c *SyncedCluster) HasCertificates(ctx context.Context, l *logger.Logger) bool {
+	return c.checkForCertificates(ctx, l)
+}
+
 // checkForTenantCertificates checks if the cluster already has a tenant-certs bundle created
 // on the first node.
 func (c *SyncedCluster) checkForTenantCertificates(ctx context.Context, l *logger.Logger) bool {
@@ -2616,6 +2658,10 @@ type ParallelResult struct {
 // the function fails, but returns a nil error. A non-nil error returned by the
 // function denotes a roachprod error and will not be retried regardless of the
 // retry options.
+//
+// If ctx is cancelled, or its deadline is exceeded, no further invocations are
+// started and ParallelE returns ctx.Err() promptly; invocations in flight
+// observe the cancellation through the context passed to them.
 // NB: Result order is the same as input node order
 func (c *SyncedCluster) ParallelE(
 	ctx context.Context,
@@ -2638,7 +2684,9 @@ func (c *SyncedCluster) ParallelE(
 	}
 
 	completed := make(chan ParallelResult, count)
-	errorChannel := make(chan error)
+	// NB: errorChannel is buffered so that invocations that fail after we've
+	// stopped listening (e.g. because ctx was cancelled) don't block forever.
+	errorChannel := make(chan error, count)
 
 	var wg sync.WaitGroup
 	wg.Add(count)
@@ -2717,7 +2765,7 @@ func (c *SyncedCluster) ParallelE(
 						return results, true, nil
 					}
 				}
-				if index < count {
+				if index < count && ctx.Err() == nil {
 					startNext()
 				}
 			}
@@ -2727,6 +2775,9 @@ func (c *SyncedCluster) ParallelE(
 				groupCancel()
 				return nil, false, err
 			}
+		case <-ctx.Done():
+			groupCancel()
+			return nil, false, ctx.Err()
 		}
 
 		if !config.Quiet && l.File == nil {
@@ -123,6 +123,12 @@ type StartOpts struct {
 	SkipInit        bool
 	StoreCount      int
 	EncryptedStores bool
+	// RAMDiskSizeGB, if positive, makes roachprod.Start mount a RAM disk of
+	// that size at RAMDiskMountDir (DefaultRAMDiskMountDir, if empty) on each
+	// node, unless one is already mounted there, and place the node's store on
+	// it, unless a store is specified in ExtraArgs.
+	RAMDiskSizeGB   int
+	RAMDiskMountDir string
 
 	// -- Options that apply only to StartTenantSQL target --
 	TenantName     string
@@ -132,6 +138,10 @@ type StartOpts struct {
 	KVCluster      *SyncedCluster
 }
 
+// DefaultRAMDiskMountDir is where a RAM disk is mounted by default when
+// StartOpts.RAMDiskSizeGB is set.
+const DefaultRAMDiskMountDir = "/mnt/ramdisk"
+
 // startSQLTimeout identifies the COCKROACH_CONNECT_TIMEOUT to use (in seconds)
 // for sql cmds within syncedCluster.Start().
 const startSQLTimeout = 1200
@@ -478,8 +488,30 @@ func (c *SyncedCluster) ExecSQL(
 	tenantInstance int,
 	args []string,
 ) error {
+	results, err := c.ExecSQLWithDetails(ctx, l, nodes, tenantName, tenantInstance, args)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		l.Printf("node %d:\n%s", r.Node, r.CombinedOut)
+	}
+
+	return nil
+}
+
+// ExecSQLWithDetails is like ExecSQL, but returns the result of running
+// `cockroach sql` on each node, including its output, instead of logging it.
+func (c *SyncedCluster) ExecSQLWithDetails(
+	ctx context.Context,
+	l *logger.Logger,
+	nodes Nodes,
+	tenantName string,
+	tenantInstance int,
+	args []string,
+) ([]RunResultDetails, error) {
 	display := fmt.Sprintf("%s: executing sql", c.Name)
-	results, _, err := c.ParallelE(ctx, l, nodes, func(ctx context.Context, node Node) (*RunResultDetails, error) {
+	resultPtrs, _, err := c.ParallelE(ctx, l, nodes, func(ctx context.Context, node Node) (*RunResultDetails, error) {
 		desc, err := c.DiscoverService(ctx, node, tenantName, ServiceTypeSQL, tenantInstance)
 		if err != nil {
 			return nil, err
@@ -500,14 +532,16 @@ func (c *SyncedCluster) ExecSQL(
 	}, WithDisplay(display), WithWaitOnFail())
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, r := range results {
-		l.Printf("node %d:\n%s", r.Node, r.CombinedOut)
+	results := make([]RunResultDetails, len(nodes))
+	for i, v := range resultPtrs {
+		if v != nil {
+			results[i] = *v
+		}
 	}
-
-	return nil
+	return results, nil
 }
 
 func (c *SyncedCluster) startNode(
@@ -733,7 +767,13 @@ func (c *SyncedCluster) generateStartArgs(
 func (c *SyncedCluster) generateStartFlagsKV(node Node, startOpts StartOpts) []string {
 	var args []string
 	var storeDirs []string
-	if idx := argExists(startOpts.ExtraArgs, "--store"); idx == -1 {
+	if idx := argExists(startOpts.ExtraArgs, "--store"); idx == -1 && startOpts.RAMDiskSizeGB > 0 {
+		// The store is placed on the RAM disk mounted by roachprod.Start.
+		storeDir := startOpts.RAMDiskMountDir
+		storeDirs = append(storeDirs, storeDir)
+		args = append(args, `--store`,
+			fmt.Sprintf(`path=%s,attrs=store1:node%d:node%dstore1`, storeDir, node, node))
+	} else if idx == -1 {
 		for i := 1; i <= startOpts.StoreCount; i++ {
 			storeDir := c.NodeDir(node, i)
 			storeDirs = append(storeDirs, storeDir)
@@ -905,7 +945,9 @@ func (c *SyncedCluster) generateKeyCmd(
 	}
 
 	var storeDirs []string
-	if storeArgIdx := argExists(startOpts.ExtraArgs, "--store"); storeArgIdx == -1 {
+	if storeArgIdx := argExists(startOpts.ExtraArgs, "--store"); storeArgIdx == -1 && startOpts.RAMDiskSizeGB > 0 {
+		storeDirs = append(storeDirs, startOpts.RAMDiskMountDir)
+	} else if storeArgIdx == -1 {
 		for i := 1; i <= startOpts.StoreCount; i++ {
 			storeDir := c.NodeDir(node, i)
 			storeDirs = append(storeDirs, storeDir)
@@ -120,6 +120,11 @@ sudo apt-get install -y \
 curl -s https://packagecloud.io/install/repositories/akopytov/sysbench/script.deb.sh | sudo bash;
 sudo apt-get update;
 sudo apt-get install -y sysbench;
+`,
+
+	"tcpdump": `
+sudo apt-get update;
+sudo apt-get install -y tcpdump;
 `,
 
 	"tools": `
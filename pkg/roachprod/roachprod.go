@@ -13,9 +13,12 @@ package roachprod
 import (
 	"bytes"
 	"context"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
@@ -30,6 +33,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/alessio/shellescape"
 	"github.com/cockroachdb/cockroach/pkg/build"
 	"github.com/cockroachdb/cockroach/pkg/cli/exit"
 	"github.com/cockroachdb/cockroach/pkg/roachprod/cloud"
@@ -46,6 +50,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/server/debug/replay"
 	"github.com/cockroachdb/cockroach/pkg/util/ctxgroup"
 	"github.com/cockroachdb/cockroach/pkg/util/httputil"
+	"github.com/cockroachdb/cockroach/pkg/util/humanizeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/retry"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
@@ -405,6 +410,42 @@ func RunWithDetails(
 	return c.RunWithDetails(ctx, l, c.Nodes, TruncateString(cmd, 30), cmd)
 }
 
+// RunPerNode runs a different command on each node of the cluster, in
+// parallel, with cmds mapping node numbers to the command to run on them. It
+// returns the results of each node's command, keyed by node number. As with
+// RunWithDetails, a command failing on a node is reported in that node's
+// result, rather than as an error.
+func RunPerNode(
+	ctx context.Context, l *logger.Logger, clusterName string, cmds map[int]string,
+) (map[int]install.RunResultDetails, error) {
+	if len(cmds) == 0 {
+		return nil, errors.New("no commands specified")
+	}
+	if err := LoadClusters(); err != nil {
+		return nil, err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	nodeCmds := make(map[install.Node]string, len(cmds))
+	for n, cmd := range cmds {
+		if n < 1 || n > len(c.VMs) {
+			return nil, errors.Errorf("invalid node %d for cluster %s with %d nodes", n, clusterName, len(c.VMs))
+		}
+		nodeCmds[install.Node(n)] = cmd
+	}
+	results, err := c.RunPerNodeWithDetails(ctx, l, "running per-node commands", nodeCmds)
+	if err != nil {
+		return nil, err
+	}
+	byNode := make(map[int]install.RunResultDetails, len(results))
+	for n, res := range results {
+		byNode[int(n)] = res
+	}
+	return byNode, nil
+}
+
 // SQL runs `cockroach sql` on a remote cluster. If a single node is passed,
 // an interactive session may start.
 //
@@ -544,6 +585,23 @@ func Reset(l *logger.Logger, clusterName string) error {
 	})
 }
 
+// WithTimeout runs fn, typically a closure around one of the long-running
+// operations in this package (e.g. CreateSnapshot, ApplySnapshots or
+// SetupSSH), with a context that is cancelled once the supplied timeout
+// elapses. These operations stop starting new work, and cancel their
+// outstanding parallel work, when their context is cancelled; ApplySnapshots
+// is the exception once it has started replacing volumes. If the timeout
+// is exceeded, the returned error is a *timeutil.TimeoutError describing op. A
+// non-positive timeout runs fn without a deadline.
+func WithTimeout(
+	ctx context.Context, op string, timeout time.Duration, fn func(ctx context.Context) error,
+) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	return timeutil.RunWithTimeout(ctx, op, timeout, fn)
+}
+
 // SetupSSH sets up the keys and host keys for the vms in the cluster.
 func SetupSSH(ctx context.Context, l *logger.Logger, clusterName string) error {
 	if err := LoadClusters(); err != nil {
@@ -570,6 +628,9 @@ func SetupSSH(ctx context.Context, l *logger.Logger, clusterName string) error {
 
 	// Configure SSH for machines in the zones we operate on.
 	if err := vm.ProvidersSequential(providers, func(p vm.Provider) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		unlock, lockErr := lock.AcquireFilesystemLock(config.DefaultLockPath)
 		if lockErr != nil {
 			return lockErr
@@ -583,7 +644,10 @@ func SetupSSH(ctx context.Context, l *logger.Logger, clusterName string) error {
 	cloudCluster.PrintDetails(l)
 	// Run ssh-keygen -R serially on each new VM in case an IP address has been recycled
 	for _, v := range cloudCluster.VMs {
-		cmd := exec.Command("ssh-keygen", "-R", v.PublicIP)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		cmd := exec.CommandContext(ctx, "ssh-keygen", "-R", v.PublicIP)
 
 		out, err := cmd.CombinedOutput()
 		if err != nil {
@@ -686,6 +750,14 @@ func Start(
 	if err != nil {
 		return err
 	}
+	if startOpts.RAMDiskSizeGB > 0 {
+		if startOpts.RAMDiskMountDir == "" {
+			startOpts.RAMDiskMountDir = install.DefaultRAMDiskMountDir
+		}
+		if err := mountRAMDisk(ctx, l, c, startOpts.RAMDiskSizeGB, startOpts.RAMDiskMountDir); err != nil {
+			return err
+		}
+	}
 	return c.Start(ctx, l, startOpts)
 }
 
@@ -810,8 +882,42 @@ sudo chmod 777 /mnt/data1
 	return nil
 }
 
-// Install installs third party software.
-func Install(ctx context.Context, l *logger.Logger, clusterName string, software []string) error {
+// storeKeyIDLength is the length of the ID at the start of a store key file,
+// which is followed by a 16, 24 or 32 byte AES key.
+const storeKeyIDLength = 32
+
+// rotatedStoreKeyFile is the file, relative to a node's working directory,
+// that RotateEncryptionKey copies the new store key to before installing it.
+const rotatedStoreKeyFile = "store-key.rotate"
+
+// encryptedStoreRE matches the store path and store key file of the
+// --enterprise-encryption flags in a node's start script.
+var encryptedStoreRE = regexp.MustCompile(`path=([^,']+),key=([^,']+)`)
+
+// RotateEncryptionKey rotates the store key of the encrypted stores of every
+// node in the cluster to the key in newKeyPath, a local file holding a 32-byte
+// key ID followed by an AES key. Nodes are restarted one at a time, each with
+// its current key as the old key and the new key as the active key, so that
+// the node re-encrypts its data keys with the new key without losing any data.
+// The new key replaces the store key file the node was started with, and the
+// previous key is kept alongside it with a ".old" suffix, so that the node can
+// be restarted with Start as before. The rotation of each node is verified in
+// its logs before moving on to the next one. Clusters that weren't started with
+// encrypted stores are refused.
+func RotateEncryptionKey(
+	ctx context.Context, l *logger.Logger, clusterName string, newKeyPath string,
+) error {
+	key, err := os.ReadFile(newKeyPath)
+	if err != nil {
+		return errors.Wrap(err, "reading new store key")
+	}
+	switch len(key) - storeKeyIDLength {
+	case 16, 24, 32:
+	default:
+		return errors.Newf("invalid store key %s: expected a %d-byte key ID followed by a 16, 24 or 32-byte key, got %d bytes",
+			newKeyPath, storeKeyIDLength, len(key))
+	}
+	keyID := hex.EncodeToString(key[:storeKeyIDLength])
 	if err := LoadClusters(); err != nil {
 		return err
 	}
@@ -820,26 +926,101 @@ func Install(ctx context.Context, l *logger.Logger, clusterName string, software
 		return err
 	}
 
-	// As seen in #103316, this can hit a 503 Service Unavailable when
-	// trying to download the package, so we retry every 30 seconds
-	// for up to 5 mins below. The caller may choose to fail or skip the test.
-	return retry.WithMaxAttempts(ctx, retry.Options{
-		InitialBackoff: 30 * time.Second,
-		Multiplier:     1,
-	}, 10, func() error {
-		err := install.Install(ctx, l, c, software)
-		err = errors.Wrapf(err, "retryable infrastructure error: could not install %s", software)
-		if err != nil {
-			l.Printf(err.Error())
+	// The start script of a node is written to its working directory, and
+	// records the stores it was started with and their keys.
+	workDir := func(node install.Node) string {
+		if c.IsLocal() {
+			return local.VMDir(c.Name, int(node))
+		}
+		return "."
+	}
+	cmds := make(map[install.Node]string, len(c.Nodes))
+	for _, node := range c.Nodes {
+		cmds[node] = fmt.Sprintf(`grep -oE "path=[^,']+,key=[^,']+" %s || true`,
+			path.Join(workDir(node), "cockroach.sh"))
+	}
+	results, err := c.RunPerNodeWithDetails(ctx, l, "reading store encryption flags", cmds)
+	if err != nil {
+		return err
+	}
+	storeKeys := make(map[install.Node][]string, len(c.Nodes))
+	for _, node := range c.Nodes {
+		res := results[node]
+		if res.Err != nil {
+			return errors.Wrapf(res.Err, "reading store encryption flags on node %d", node)
 		}
+		for _, m := range encryptedStoreRE.FindAllStringSubmatch(res.Stdout, -1) {
+			if m[2] != "plain" {
+				storeKeys[node] = append(storeKeys[node], m[2])
+			}
+		}
+		if len(storeKeys[node]) == 0 {
+			return errors.Newf("node %d was not started with encrypted stores", node)
+		}
+	}
+
+	if err := c.Put(ctx, l, c.Nodes, newKeyPath, rotatedStoreKeyFile); err != nil {
 		return err
-	})
+	}
+	for _, node := range c.Nodes {
+		// Restart the nodes one at a time, so that the cluster remains available
+		// throughout the rotation.
+		nodeC := *c
+		nodeC.Nodes = install.Nodes{node}
+		if err := nodeC.Stop(ctx, l, 15 /* sig */, true /* wait */, 0 /* maxWait */); err != nil {
+			return errors.Wrapf(err, "stopping node %d", node)
+		}
+
+		var cmd strings.Builder
+		fmt.Fprintf(&cmd, "set -euo pipefail\ncd %s\n", workDir(node))
+		for _, storeKey := range storeKeys[node] {
+			fmt.Fprintf(&cmd, "mv %[1]s %[1]s.old\ncp %[2]s %[1]s\nchmod 600 %[1]s\n", storeKey, rotatedStoreKeyFile)
+			fmt.Fprintf(&cmd, `sed -i "s#key=%[1]s,old-key=[^,']*#key=%[1]s,old-key=%[1]s.old#" cockroach.sh`+"\n", storeKey)
+		}
+		fmt.Fprintf(&cmd, "rm %s\n./cockroach.sh\n", rotatedStoreKeyFile)
+		if err := nodeC.Run(ctx, l, l.Stdout, l.Stderr, nodeC.Nodes, "restarting with new store key", cmd.String()); err != nil {
+			return errors.Wrapf(err, "restarting node %d with new store key", node)
+		}
+
+		// Each store logs the keys it loaded when it is opened.
+		logFile := path.Join(c.LogDir(node, "" /* tenantName */, 0 /* instance */), "cockroach.log")
+		if err := nodeC.Run(ctx, l, l.Stdout, l.Stderr, nodeC.Nodes, "verifying store key rotation", fmt.Sprintf(`
+for i in $(seq 60); do
+  if [ "$(grep -cE 'loaded active store key: [^,]*%s' %s 2>/dev/null)" -ge %d ]; then
+    exit 0
+  fi
+  sleep 1
+done
+echo "stores did not load the new store key" >&2
+exit 1
+`, keyID, logFile, len(storeKeys[node]))); err != nil {
+			return errors.Wrapf(err, "verifying store key rotation on node %d", node)
+		}
+		l.Printf("node %d: rotated %d store(s) to store key %s", node, len(storeKeys[node]), keyID)
+	}
+	return nil
 }
 
-// Download downloads 3rd party tools, using a GCS cache if possible.
-func Download(
-	ctx context.Context, l *logger.Logger, clusterName string, src, sha, dest string,
-) error {
+// diskStallBlkioDir is the cgroup v1 blkio hierarchy used to throttle the data
+// disk in SimulateDiskStall. Nodes using cgroup v2 fall back to io.max in
+// diskStallIOMaxFile.
+const (
+	diskStallBlkioDir  = "/sys/fs/cgroup/blkio"
+	diskStallIOMaxFile = "/sys/fs/cgroup/system.slice/io.max"
+)
+
+// SimulateDiskStall stalls the data disk (the device mounted at /mnt/data1) of
+// the given node for the supplied duration by throttling its read and write
+// throughput to 1 byte per second through cgroup I/O limits, and then lifts the
+// throttle. Any process performing I/O on the disk during the stall blocks, as
+// it would on a stalled disk. The throttle is lifted even if the stall is
+// interrupted by the cancellation of ctx.
+func SimulateDiskStall(
+	ctx context.Context, l *logger.Logger, clusterName string, node int, duration time.Duration,
+) (retErr error) {
+	if duration <= 0 {
+		return errors.Newf("invalid disk stall duration %s", duration)
+	}
 	if err := LoadClusters(); err != nil {
 		return err
 	}
@@ -847,12 +1028,75 @@ func Download(
 	if err != nil {
 		return err
 	}
-	return install.Download(ctx, l, c, src, sha, dest)
+	if c.IsLocal() {
+		return errors.New("disk stalls cannot be simulated on local clusters")
+	}
+	if node < 1 || node > len(c.VMs) {
+		return errors.Errorf("invalid node %d for cluster %s with %d nodes", node, clusterName, len(c.VMs))
+	}
+	nodes := install.Nodes{install.Node(node)}
+
+	// Determine the major:minor device numbers of the data disk. The cgroup I/O
+	// limits apply to whole devices, rather than to mount points.
+	results, err := c.RunWithDetails(ctx, l, nodes, "finding data disk",
+		`lsblk -dno MAJ:MIN "$(findmnt -no SOURCE /mnt/data1)"`)
+	if err != nil {
+		return err
+	}
+	if results[0].Err != nil {
+		return errors.Wrapf(results[0].Err, "finding data disk of node %d", node)
+	}
+	device := strings.TrimSpace(results[0].Stdout)
+	if _, _, ok := strings.Cut(device, ":"); !ok {
+		return errors.Newf("unexpected device numbers %q for data disk of node %d", device, node)
+	}
+
+	setThrottle := func(ctx context.Context, title string, blkioBPS int, ioMax string) error {
+		return c.Run(ctx, l, l.Stdout, l.Stderr, nodes, title, fmt.Sprintf(`
+set -euo pipefail
+if [ -d %[1]s ]; then
+  echo "%[3]s %[4]d" | sudo tee %[1]s/blkio.throttle.read_bps_device >/dev/null
+  echo "%[3]s %[4]d" | sudo tee %[1]s/blkio.throttle.write_bps_device >/dev/null
+else
+  echo "%[3]s %[5]s" | sudo tee %[2]s >/dev/null
+fi
+`, diskStallBlkioDir, diskStallIOMaxFile, device, blkioBPS, ioMax))
+	}
+
+	// NB: the throttle is lifted using a fresh context, so that it is lifted
+	// even if ctx is canceled during the stall.
+	defer func() {
+		if err := setThrottle(context.Background(), "resuming disk", 0, "rbps=max wbps=max"); err != nil {
+			retErr = errors.CombineErrors(retErr,
+				errors.Wrapf(err, "resuming the data disk of node %d", node))
+		}
+	}()
+	l.Printf("stalling the data disk (%s) of node %d for %s", device, node, duration)
+	if err := setThrottle(ctx, "stalling disk", 1, "rbps=1 wbps=1"); err != nil {
+		return err
+	}
+
+	select {
+	case <-time.After(duration):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-// DistributeCerts distributes certificates to the nodes in a cluster.
-// If the certificates already exist, no action is taken.
-func DistributeCerts(ctx context.Context, l *logger.Logger, clusterName string) error {
+// ramDiskWarnFraction is the fraction of a node's memory above which
+// MountRAMDisk warns that the RAM disk leaves little memory for cockroach.
+const ramDiskWarnFraction = 0.5
+
+// MountRAMDisk creates a tmpfs of sizeGB GiB mounted at mountDir on each node
+// in the cluster, for tests that want storage backed by memory rather than
+// disk. Nodes on which something is already mounted at mountDir are left
+// alone. Start mounts the RAM disk, and places the store on it, when
+// StartOpts.RAMDiskSizeGB is set. The contents of the RAM disk are lost when
+// it is unmounted or the node is restarted.
+func MountRAMDisk(
+	ctx context.Context, l *logger.Logger, clusterName string, sizeGB int, mountDir string,
+) error {
 	if err := LoadClusters(); err != nil {
 		return err
 	}
@@ -860,27 +1104,54 @@ func DistributeCerts(ctx context.Context, l *logger.Logger, clusterName string)
 	if err != nil {
 		return err
 	}
-	return c.DistributeCerts(ctx, l)
+	return mountRAMDisk(ctx, l, c, sizeGB, mountDir)
 }
 
-// Put copies a local file to the nodes in a cluster.
-func Put(
-	ctx context.Context, l *logger.Logger, clusterName, src, dest string, useTreeDist bool,
+func mountRAMDisk(
+	ctx context.Context, l *logger.Logger, c *install.SyncedCluster, sizeGB int, mountDir string,
 ) error {
-	if err := LoadClusters(); err != nil {
-		return err
+	if sizeGB <= 0 {
+		return errors.Newf("invalid RAM disk size %dGB", sizeGB)
 	}
-	c, err := newCluster(l, clusterName, install.UseTreeDistOption(useTreeDist))
+	if c.IsLocal() {
+		return errors.New("RAM disks cannot be mounted on local clusters")
+	}
+
+	results, err := c.RunWithDetails(ctx, l, c.Nodes, "reading memory size",
+		`awk '/^MemTotal:/ {print $2}' /proc/meminfo`)
 	if err != nil {
 		return err
 	}
-	return c.Put(ctx, l, c.Nodes, src, dest)
+	sizeBytes := int64(sizeGB) << 30
+	for _, res := range results {
+		if res.Err != nil {
+			return errors.Wrapf(res.Err, "reading memory size of node %d", res.Node)
+		}
+		memKB, err := strconv.ParseInt(strings.TrimSpace(res.Stdout), 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "parsing memory size of node %d", res.Node)
+		}
+		memBytes := memKB << 10
+		if sizeBytes >= memBytes {
+			return errors.Newf("RAM disk of %dGB does not fit in the %s of memory of node %d",
+				sizeGB, humanizeutil.IBytes(memBytes), res.Node)
+		}
+		if float64(sizeBytes) > ramDiskWarnFraction*float64(memBytes) {
+			l.Printf("WARNING: RAM disk of %dGB uses more than %.0f%% of the %s of memory of node %d",
+				sizeGB, ramDiskWarnFraction*100, humanizeutil.IBytes(memBytes), res.Node)
+		}
+	}
+
+	return c.Run(ctx, l, l.Stdout, l.Stderr, c.Nodes, "mounting RAM disk",
+		genRAMDiskMountCommands(sizeGB, mountDir))
 }
 
-// Get copies a remote file from the nodes in a cluster.
-// If the file is retrieved from multiple nodes the destination
-// file name will be prefixed with the node number.
-func Get(ctx context.Context, l *logger.Logger, clusterName, src, dest string) error {
+// UnmountRAMDisk unmounts the RAM disk mounted at mountDir by MountRAMDisk on
+// each node in the cluster, discarding its contents. Nodes on which nothing is
+// mounted at mountDir are skipped.
+func UnmountRAMDisk(
+	ctx context.Context, l *logger.Logger, clusterName string, mountDir string,
+) error {
 	if err := LoadClusters(); err != nil {
 		return err
 	}
@@ -888,136 +1159,1639 @@ func Get(ctx context.Context, l *logger.Logger, clusterName, src, dest string) e
 	if err != nil {
 		return err
 	}
-	return c.Get(ctx, l, c.Nodes, src, dest)
-}
-
-type PGURLOptions struct {
-	Secure         bool
-	External       bool
-	TenantName     string
-	TenantInstance int
+	if c.IsLocal() {
+		return errors.New("RAM disks cannot be mounted on local clusters")
+	}
+	return c.Run(ctx, l, l.Stdout, l.Stderr, c.Nodes, "unmounting RAM disk",
+		fmt.Sprintf("if mountpoint -q %[1]s; then sudo umount -f %[1]s; fi", mountDir))
 }
 
-// PgURL generates pgurls for the nodes in a cluster.
-func PgURL(
-	ctx context.Context, l *logger.Logger, clusterName, certsDir string, opts PGURLOptions,
-) ([]string, error) {
+// sysctlConfDir is the directory in which SetSysctl persists kernel parameters,
+// so that they survive reboots. Each parameter is written to its own file,
+// named after the parameter.
+const sysctlConfDir = "/etc/sysctl.d"
+
+// sysctlNameRE matches the dotted names of kernel parameters, e.g.
+// vm.swappiness or net.ipv4.conf.all.rp_filter.
+var sysctlNameRE = regexp.MustCompile(`^[a-z0-9_]+(\.[a-zA-Z0-9_-]+)+$`)
+
+// SetSysctl sets the supplied kernel parameters, keyed by their sysctl name
+// (e.g. vm.swappiness), on every node in the cluster. The parameters are
+// persisted under /etc/sysctl.d and applied immediately, and the values in
+// effect are logged for each node. Setting a parameter again replaces its
+// previous value, so repeated calls don't accumulate configuration. Parameters
+// that are unknown to the kernel of any node cause an error before any
+// parameter is set.
+func SetSysctl(
+	ctx context.Context, l *logger.Logger, clusterName string, params map[string]string,
+) error {
+	if len(params) == 0 {
+		return errors.New("no sysctl parameters specified")
+	}
+	names := make([]string, 0, len(params))
+	for name, value := range params {
+		if !sysctlNameRE.MatchString(name) {
+			return errors.Newf("invalid sysctl parameter name %q", name)
+		}
+		if strings.TrimSpace(value) == "" || strings.ContainsAny(value, "\n\r") {
+			return errors.Newf("invalid value %q for sysctl parameter %s", value, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
 	if err := LoadClusters(); err != nil {
-		return nil, err
+		return err
 	}
-	c, err := newCluster(l, clusterName, install.SecureOption(opts.Secure), install.PGUrlCertsDirOption(certsDir))
+	c, err := newCluster(l, clusterName)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if c.IsLocal() {
+		return errors.New("sysctl parameters cannot be set on local clusters")
 	}
-	nodes := c.TargetNodes()
-	ips := make([]string, len(nodes))
 
-	if opts.External {
-		for i := 0; i < len(nodes); i++ {
-			ips[i] = c.VMs[nodes[i]-1].PublicIP
+	// Every parameter has a file under /proc/sys, with the dots in its name
+	// replaced by slashes. Print the names of those that don't.
+	var checkCmd strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&checkCmd, "[ -e /proc/sys/%s ] || echo %s\n", strings.ReplaceAll(name, ".", "/"), name)
+	}
+	results, err := c.RunWithDetails(ctx, l, c.Nodes, "checking sysctl parameters", checkCmd.String())
+	if err != nil {
+		return err
+	}
+	for _, res := range results {
+		if res.Err != nil {
+			return errors.Wrapf(res.Err, "checking sysctl parameters on node %d", res.Node)
 		}
-	} else {
-		for i := 0; i < len(nodes); i++ {
-			ip, err := c.GetInternalIP(nodes[i])
-			if err == nil {
-				ips[i] = ip
-			}
+		if unknown := strings.Fields(res.Stdout); len(unknown) > 0 {
+			return errors.Newf("unknown sysctl parameters on node %d: %s", res.Node, strings.Join(unknown, ", "))
 		}
 	}
 
-	var urls []string
-	for i, ip := range ips {
-		desc, err := c.DiscoverService(ctx, nodes[i], opts.TenantName, install.ServiceTypeSQL, opts.TenantInstance)
-		if err != nil {
-			return nil, err
-		}
-		if ip == "" {
-			return nil, errors.Errorf("empty ip: %v", ips)
-		}
-		urls = append(urls, c.NodeURL(ip, desc.Port, opts.TenantName))
+	var applyCmd strings.Builder
+	applyCmd.WriteString("set -euo pipefail\n")
+	files := make([]string, len(names))
+	for i, name := range names {
+		files[i] = path.Join(sysctlConfDir, fmt.Sprintf("99-roachprod-%s.conf", name))
+		fmt.Fprintf(&applyCmd, "echo %s | sudo tee %s >/dev/null\n",
+			shellescape.Quote(fmt.Sprintf("%s = %s", name, params[name])), files[i])
 	}
-	if len(urls) != len(nodes) {
-		return nil, errors.Errorf("have nodes %v, but urls %v from ips %v", nodes, urls, ips)
+	fmt.Fprintf(&applyCmd, "sudo sysctl -p %s\n", strings.Join(files, " "))
+	results, err = c.RunWithDetails(ctx, l, c.Nodes, "setting sysctl parameters", applyCmd.String())
+	if err != nil {
+		return err
 	}
-	return urls, nil
+	for _, res := range results {
+		if res.Err != nil {
+			return errors.Wrapf(res.Err, "setting sysctl parameters on node %d", res.Node)
+		}
+		l.Printf("node %d: applied sysctl parameters:\n%s", res.Node, strings.TrimSpace(res.Stdout))
+	}
+	return nil
 }
 
-type urlConfig struct {
-	path           string
-	usePublicIP    bool
-	openInBrowser  bool
-	secure         bool
-	port           int
-	tenantName     string
-	tenantInstance int
+// NTPConfig configures the time synchronization of a node. See ConfigureNTP.
+// The zero value restores the node's original configuration.
+type NTPConfig struct {
+	// Disable stops the chrony daemon, so that the node's clock is no longer
+	// disciplined and drifts freely.
+	Disable bool
+	// Servers, if set, replaces the time servers that chrony synchronizes the
+	// clock with, e.g. with a controlled server. Incompatible with Disable.
+	Servers []string
+	// DriftPPM, if non-zero, sets the frequency offset of the node's clock, in
+	// parts per million: the clock runs fast if it is positive and slow if it is
+	// negative. It requires Disable, as chrony would otherwise correct the
+	// drift, and is bounded by the kernel to ±maxNTPDriftPPM.
+	DriftPPM float64
 }
 
-func urlGenerator(
-	ctx context.Context,
-	c *install.SyncedCluster,
-	l *logger.Logger,
-	nodes install.Nodes,
-	uConfig urlConfig,
-) ([]string, error) {
-	var urls []string
-	for i, node := range nodes {
-		host := vm.Name(c.Name, int(node)) + "." + gce.Subdomain
+// maxNTPDriftPPM is the largest frequency offset, in parts per million, that
+// the kernel accepts.
+const maxNTPDriftPPM = 500
 
-		// verify DNS is working / fallback to IPs if not.
-		if i == 0 && !uConfig.usePublicIP {
-			if _, err := net.LookupHost(host); err != nil {
-				l.Errorf("no valid DNS (yet?). might need to re-run `sync`?")
-				uConfig.usePublicIP = true
-			}
-		}
+// chronyConf is the path to the chrony config file, and chronyOrigConf the
+// path at which ConfigureNTP saves the original config before modifying it.
+const (
+	chronyConf     = "/etc/chrony/chrony.conf"
+	chronyOrigConf = chronyConf + ".roachprod-orig"
+)
 
-		if uConfig.usePublicIP {
-			host = c.VMs[node-1].PublicIP
-		}
-		port := uConfig.port
-		if port == 0 {
-			desc, err := c.DiscoverService(ctx, node, uConfig.tenantName, install.ServiceTypeUI, uConfig.tenantInstance)
-			if err != nil {
-				return nil, err
-			}
-			port = desc.Port
-		}
-		scheme := "http"
-		if c.Secure {
-			scheme = "https"
-		}
-		if !strings.HasPrefix(uConfig.path, "/") {
-			uConfig.path = "/" + uConfig.path
-		}
-		url := fmt.Sprintf("%s://%s:%d%s", scheme, host, port, uConfig.path)
-		urls = append(urls, url)
-		if uConfig.openInBrowser {
-			cmd := browserCmd(url)
+// hostRE matches host names and IP addresses.
+var hostRE = regexp.MustCompile(`^[a-zA-Z0-9.:-]+$`)
 
-			if err := cmd.Run(); err != nil {
-				return nil, err
-			}
+// validate returns an error if the config is invalid.
+func (cfg NTPConfig) validate() error {
+	if cfg.Disable && len(cfg.Servers) > 0 {
+		return errors.New("NTP servers cannot be configured while NTP is disabled")
+	}
+	if cfg.DriftPPM != 0 && !cfg.Disable {
+		return errors.New("clock drift can only be introduced while NTP is disabled")
+	}
+	if math.Abs(cfg.DriftPPM) > maxNTPDriftPPM {
+		return errors.Newf("clock drift of %.2fppm exceeds the maximum of %dppm", cfg.DriftPPM, maxNTPDriftPPM)
+	}
+	for _, server := range cfg.Servers {
+		if !hostRE.MatchString(server) {
+			return errors.Newf("invalid NTP server %q", server)
 		}
 	}
-	return urls, nil
+	return nil
 }
 
-func browserCmd(url string) *exec.Cmd {
-	var cmd string
-	var args []string
-	switch runtime.GOOS {
-	case "darwin":
-		cmd = "/usr/bin/open"
-	case "windows":
-		cmd = "cmd"
-		args = []string{"/c", "start"}
-	default:
-		cmd = "xdg-open"
+// ConfigureNTP configures the time synchronization of the supplied node of the
+// cluster, managing the node's chrony daemon: it may be disabled (optionally
+// introducing clock drift), pointed at other time servers, or restored to its
+// original configuration. The original chrony config is saved the first time
+// the node is configured, so that it can be restored. The resulting state of
+// the daemon and of the clock's frequency offset is logged.
+func ConfigureNTP(
+	ctx context.Context, l *logger.Logger, clusterName string, node int, cfg NTPConfig,
+) error {
+	if err := cfg.validate(); err != nil {
+		return err
 	}
-	args = append(args, url)
-	return exec.Command(cmd, args...)
-}
-
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return err
+	}
+	if c.IsLocal() {
+		return errors.New("NTP cannot be configured on local clusters")
+	}
+	if node < 1 || node > len(c.VMs) {
+		return errors.Errorf("invalid node %d for cluster %s with %d nodes", node, clusterName, len(c.VMs))
+	}
+
+	var cmd strings.Builder
+	cmd.WriteString("set -euo pipefail\n")
+	fmt.Fprintf(&cmd, "[ -e %[2]s ] || sudo cp %[1]s %[2]s\n", chronyConf, chronyOrigConf)
+	// The frequency offset is set using adjtimex, which is only installed when
+	// needed. It is reset whenever chrony resumes disciplining the clock.
+	resetDrift := "if command -v adjtimex >/dev/null; then sudo adjtimex -f 0; fi\n"
+	switch {
+	case cfg.Disable:
+		cmd.WriteString("sudo systemctl stop chrony\n")
+		if cfg.DriftPPM != 0 {
+			cmd.WriteString("command -v adjtimex >/dev/null || sudo apt-get install -qy adjtimex\n")
+			// adjtimex expects the frequency offset in units of 2^-16 ppm.
+			fmt.Fprintf(&cmd, "sudo adjtimex -f %d\n", int64(math.Round(cfg.DriftPPM*(1<<16))))
+		} else {
+			cmd.WriteString(resetDrift)
+		}
+	case len(cfg.Servers) > 0:
+		// Replace the time sources of the original config with the servers.
+		quoted := make([]string, len(cfg.Servers))
+		for i, server := range cfg.Servers {
+			quoted[i] = shellescape.Quote(server)
+		}
+		fmt.Fprintf(&cmd, "{ grep -Ev '^\\s*(server|pool|peer)\\s' %s || true; printf 'server %%s iburst\\n' %s; } | sudo tee %s >/dev/null\n",
+			chronyOrigConf, strings.Join(quoted, " "), chronyConf)
+		cmd.WriteString(resetDrift)
+		cmd.WriteString("sudo systemctl restart chrony\n")
+	default:
+		fmt.Fprintf(&cmd, "sudo cp %s %s\n", chronyOrigConf, chronyConf)
+		cmd.WriteString(resetDrift)
+		cmd.WriteString("sudo systemctl restart chrony\n")
+	}
+	// Report the effective state.
+	cmd.WriteString(`echo "chrony: $(systemctl is-active chrony || true)"
+if command -v adjtimex >/dev/null; then sudo adjtimex -p | grep -E '^ *frequency:'; fi
+if systemctl is-active --quiet chrony; then chronyc -n sources; fi
+`)
+	results, err := c.RunWithDetails(ctx, l, install.Nodes{install.Node(node)}, "configuring NTP", cmd.String())
+	if err != nil {
+		return err
+	}
+	res := results[0]
+	if res.Err != nil {
+		return errors.Wrapf(res.Err, "configuring NTP on node %d: %s", node, strings.TrimSpace(res.Stderr))
+	}
+	l.Printf("node %d: NTP configured:\n%s", node, strings.TrimSpace(res.Stdout))
+	return nil
+}
+
+// FirewallDirection is the direction of the traffic dropped by a FirewallRule.
+type FirewallDirection int
+
+const (
+	// FirewallBoth drops traffic both from and to the peer.
+	FirewallBoth FirewallDirection = iota
+	// FirewallInbound drops traffic from the peer.
+	FirewallInbound
+	// FirewallOutbound drops traffic to the peer.
+	FirewallOutbound
+)
+
+// FirewallRule drops the traffic between a node and one of its peers. Rules
+// only affect the node they're applied on, so a symmetric partition between
+// two nodes can be created with a single FirewallBoth rule, and an
+// asymmetric one with a FirewallInbound or FirewallOutbound rule.
+type FirewallRule struct {
+	// Node is the node on which the rule is applied.
+	Node install.Node
+	// Peer is the node whose traffic is dropped.
+	Peer install.Node
+	// Port, if non-zero, restricts the rule to TCP traffic destined to the
+	// port: the node's port for inbound traffic and the peer's port for
+	// outbound traffic.
+	Port int
+	// Direction is the direction of the dropped traffic.
+	Direction FirewallDirection
+}
+
+// firewallChain is the iptables chain that holds the rules installed by
+// SetFirewall. Keeping them in a dedicated chain allows ClearFirewall to
+// remove them without disturbing any other rules on the nodes.
+const firewallChain = "ROACHPROD"
+
+// SetFirewall applies the supplied firewall rules on the nodes of the cluster,
+// using iptables. Applying a rule that is already in place is a no-op. The
+// rules can be removed with ClearFirewall.
+func SetFirewall(
+	ctx context.Context, l *logger.Logger, clusterName string, rules []FirewallRule,
+) error {
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return err
+	}
+	if c.IsLocal() {
+		return errors.New("firewall rules cannot be set on local clusters")
+	}
+
+	rulesByNode := make(map[install.Node][]FirewallRule)
+	for _, r := range rules {
+		for _, n := range []install.Node{r.Node, r.Peer} {
+			if n < 1 || int(n) > len(c.VMs) {
+				return errors.Newf("invalid node %d in firewall rule", n)
+			}
+		}
+		if r.Node == r.Peer {
+			return errors.Newf("firewall rule on node %d cannot drop its own traffic", r.Node)
+		}
+		rulesByNode[r.Node] = append(rulesByNode[r.Node], r)
+	}
+
+	nodes := make(install.Nodes, 0, len(rulesByNode))
+	for n := range rulesByNode {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+	for _, n := range nodes {
+		cmds := []string{
+			fmt.Sprintf("sudo iptables -N %s 2>/dev/null || true", firewallChain),
+		}
+		for _, builtin := range []string{"INPUT", "OUTPUT"} {
+			cmds = append(cmds, fmt.Sprintf("sudo iptables -C %[1]s -j %[2]s 2>/dev/null || sudo iptables -I %[1]s -j %[2]s",
+				builtin, firewallChain))
+		}
+		for _, r := range rulesByNode[n] {
+			peerIP, err := c.GetInternalIP(r.Peer)
+			if err != nil {
+				return err
+			}
+			for _, spec := range firewallRuleSpecs(r, peerIP) {
+				cmds = append(cmds, fmt.Sprintf("sudo iptables -C %[1]s %[2]s 2>/dev/null || sudo iptables -A %[1]s %[2]s",
+					firewallChain, spec))
+			}
+		}
+		if err := c.Run(ctx, l, l.Stdout, l.Stderr, install.Nodes{n}, "setting firewall rules",
+			strings.Join(cmds, " && ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClearFirewall removes all the firewall rules applied by SetFirewall on the
+// nodes of the cluster. Nodes without such rules are skipped.
+func ClearFirewall(ctx context.Context, l *logger.Logger, clusterName string) error {
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return err
+	}
+	if c.IsLocal() {
+		return errors.New("firewall rules cannot be set on local clusters")
+	}
+	return c.Run(ctx, l, l.Stdout, l.Stderr, c.Nodes, "clearing firewall rules", fmt.Sprintf(`
+if sudo iptables -L %[1]s -n >/dev/null 2>&1; then
+  while sudo iptables -D INPUT -j %[1]s 2>/dev/null; do :; done
+  while sudo iptables -D OUTPUT -j %[1]s 2>/dev/null; do :; done
+  sudo iptables -F %[1]s
+  sudo iptables -X %[1]s
+fi
+`, firewallChain))
+}
+
+// firewallRuleSpecs returns the iptables rule specifications implementing the
+// supplied rule, given the internal IP of its peer.
+func firewallRuleSpecs(r FirewallRule, peerIP string) []string {
+	port := ""
+	if r.Port != 0 {
+		port = fmt.Sprintf(" -p tcp --dport %d", r.Port)
+	}
+	var specs []string
+	if r.Direction == FirewallBoth || r.Direction == FirewallInbound {
+		specs = append(specs, fmt.Sprintf("-s %s%s -j DROP", peerIP, port))
+	}
+	if r.Direction == FirewallBoth || r.Direction == FirewallOutbound {
+		specs = append(specs, fmt.Sprintf("-d %s%s -j DROP", peerIP, port))
+	}
+	return specs
+}
+
+// LatencyPair adds latency to the traffic from a group of nodes to another,
+// e.g. to emulate the round-trip time between two regions. The latency is
+// added to the packets sent by the source nodes to the destination nodes, so
+// the round-trip time between them increases by RTT; for the replies to also
+// be delayed, add the reverse pair.
+type LatencyPair struct {
+	// Src are the nodes whose outgoing traffic is delayed.
+	Src install.Nodes
+	// Dst are the nodes whose incoming traffic from Src is delayed.
+	Dst install.Nodes
+	// RTT is the latency added to the round-trip time from Src to Dst.
+	RTT time.Duration
+}
+
+// latencyQdiscHandle is the handle of the root qdisc installed by
+// InjectLatency. It identifies the qdiscs that ClearLatency may remove without
+// disturbing any other traffic control configuration on the nodes.
+const latencyQdiscHandle = "1a7e:"
+
+// maxLatencyClasses is the maximum number of distinct latencies that can be
+// injected on a node: a prio qdisc has at most 16 bands, the first 3 of which
+// carry the undelayed traffic.
+const maxLatencyClasses = 13
+
+// clearLatencyCmd removes the qdisc installed by InjectLatency from all the
+// network interfaces of a node.
+var clearLatencyCmd = fmt.Sprintf(`
+for dev in $(ls /sys/class/net); do
+  if tc qdisc show dev "$dev" root | grep -q '^qdisc prio %[1]s '; then
+    sudo tc qdisc del dev "$dev" root
+  fi
+done
+`, latencyQdiscHandle)
+
+// InjectLatency adds latency to the traffic between the nodes of the cluster,
+// as specified by the supplied pairs, using netem qdiscs that filter on the
+// internal IPs of the destination nodes. The latency previously injected on
+// the source nodes is replaced, so applying the same pairs repeatedly is a
+// no-op. The latency can be removed with ClearLatency.
+func InjectLatency(
+	ctx context.Context, l *logger.Logger, clusterName string, pairs []LatencyPair,
+) error {
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return err
+	}
+	if c.IsLocal() {
+		return errors.New("latency cannot be injected on local clusters")
+	}
+
+	// Map each source node to the latency of each of its destinations.
+	delays := make(map[install.Node]map[install.Node]time.Duration)
+	for _, p := range pairs {
+		if p.RTT <= 0 {
+			return errors.Newf("invalid latency %s", p.RTT)
+		}
+		for _, n := range append(append(install.Nodes{}, p.Src...), p.Dst...) {
+			if n < 1 || int(n) > len(c.VMs) {
+				return errors.Newf("invalid node %d in latency pair", n)
+			}
+		}
+		for _, src := range p.Src {
+			if delays[src] == nil {
+				delays[src] = make(map[install.Node]time.Duration)
+			}
+			for _, dst := range p.Dst {
+				if src == dst {
+					return errors.Newf("cannot inject latency from node %d to itself", src)
+				}
+				if d, ok := delays[src][dst]; ok && d != p.RTT {
+					return errors.Newf("conflicting latencies %s and %s from node %d to node %d",
+						d, p.RTT, src, dst)
+				}
+				delays[src][dst] = p.RTT
+			}
+		}
+	}
+
+	nodes := make(install.Nodes, 0, len(delays))
+	for n := range delays {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+	for _, n := range nodes {
+		dsts := make(install.Nodes, 0, len(delays[n]))
+		for dst := range delays[n] {
+			dsts = append(dsts, dst)
+		}
+		sort.Slice(dsts, func(i, j int) bool { return dsts[i] < dsts[j] })
+
+		// Each distinct latency gets a band of the prio qdisc, past the 3 bands
+		// that carry the undelayed traffic, with a netem qdisc attached to it.
+		bands := make(map[time.Duration]int)
+		var cmd strings.Builder
+		cmd.WriteString("set -euo pipefail\n")
+		cmd.WriteString(clearLatencyCmd)
+		var filters strings.Builder
+		for _, dst := range dsts {
+			ip, err := c.GetInternalIP(dst)
+			if err != nil {
+				return err
+			}
+			if filters.Len() == 0 {
+				fmt.Fprintf(&cmd, "dev=$(ip -o route get %s | sed -n 's/.* dev \\([^ ]*\\).*/\\1/p')\n", ip)
+			}
+			d := delays[n][dst]
+			band, ok := bands[d]
+			if !ok {
+				band = len(bands) + 4
+				bands[d] = band
+			}
+			fmt.Fprintf(&filters, "sudo tc filter add dev \"$dev\" parent %s protocol ip prio 1 u32 match ip dst %s/32 flowid %s%x\n",
+				latencyQdiscHandle, ip, latencyQdiscHandle, band)
+		}
+		if len(bands) > maxLatencyClasses {
+			return errors.Newf("node %d has %d distinct latencies, exceeding the maximum of %d",
+				n, len(bands), maxLatencyClasses)
+		}
+		fmt.Fprintf(&cmd, "sudo tc qdisc replace dev \"$dev\" root handle %s prio bands %d\n",
+			latencyQdiscHandle, len(bands)+3)
+		for d, band := range bands {
+			fmt.Fprintf(&cmd, "sudo tc qdisc add dev \"$dev\" parent %s%x netem delay %dus\n",
+				latencyQdiscHandle, band, d.Microseconds())
+		}
+		cmd.WriteString(filters.String())
+		if err := c.Run(ctx, l, l.Stdout, l.Stderr, install.Nodes{n}, "injecting latency",
+			cmd.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClearLatency removes all the latency injected by InjectLatency on the nodes
+// of the cluster. Nodes without injected latency are skipped.
+func ClearLatency(ctx context.Context, l *logger.Logger, clusterName string) error {
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return err
+	}
+	if c.IsLocal() {
+		return errors.New("latency cannot be injected on local clusters")
+	}
+	return c.Run(ctx, l, l.Stdout, l.Stderr, c.Nodes, "clearing injected latency", clearLatencyCmd)
+}
+
+// packetCaptureFile is the file on each node that CapturePackets writes the
+// captured packets to.
+const packetCaptureFile = "/tmp/roachprod-packets.pcap"
+
+// CapturePackets captures the packets matching the supplied BPF filter (e.g.
+// "tcp port 26257"), or all packets if the filter is empty, on all interfaces
+// of the given nodes for the supplied duration, and copies the resulting pcap
+// files into destDir/n<node>/. tcpdump is installed on the nodes that don't
+// have it, and the pcap files are removed from the nodes once they have been
+// retrieved, or if the capture fails.
+func CapturePackets(
+	ctx context.Context,
+	l *logger.Logger,
+	clusterName string,
+	nodes []int,
+	filter string,
+	duration time.Duration,
+	destDir string,
+) error {
+	if duration <= 0 {
+		return errors.Newf("invalid capture duration %s", duration)
+	}
+	if len(nodes) == 0 {
+		return errors.New("no nodes specified")
+	}
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return err
+	}
+	if c.IsLocal() {
+		return errors.New("packets cannot be captured on local clusters")
+	}
+	c.Nodes = nil
+	for _, n := range nodes {
+		if n < 1 || n > len(c.VMs) {
+			return errors.Errorf("invalid node %d for cluster %s with %d nodes", n, clusterName, len(c.VMs))
+		}
+		c.Nodes = append(c.Nodes, install.Node(n))
+	}
+
+	results, err := c.RunWithDetails(ctx, l, c.Nodes, "checking for tcpdump", "command -v tcpdump")
+	if err != nil {
+		return err
+	}
+	installC := *c
+	installC.Nodes = nil
+	for _, res := range results {
+		if res.Err != nil {
+			installC.Nodes = append(installC.Nodes, res.Node)
+		}
+	}
+	if len(installC.Nodes) > 0 {
+		if err := install.Install(ctx, l, &installC, []string{"tcpdump"}); err != nil {
+			return err
+		}
+	}
+
+	defer func() {
+		if err := c.Run(ctx, l, l.Stdout, l.Stderr, c.Nodes, "removing packet captures",
+			fmt.Sprintf("sudo rm -f %s", packetCaptureFile)); err != nil {
+			l.Printf("failed to remove packet captures: %v", err)
+		}
+	}()
+	// NB: tcpdump exits successfully when interrupted, which --preserve-status
+	// propagates.
+	captureCmd := fmt.Sprintf("sudo timeout --preserve-status -s INT %gs tcpdump -i any -n -w %s",
+		duration.Seconds(), packetCaptureFile)
+	if filter != "" {
+		captureCmd += " " + shellescape.Quote(filter)
+	}
+	captureCmd += fmt.Sprintf(" && sudo chmod 644 %s", packetCaptureFile)
+	if err := c.Run(ctx, l, l.Stdout, l.Stderr, c.Nodes,
+		fmt.Sprintf("capturing packets for %s", duration), captureCmd); err != nil {
+		return err
+	}
+
+	for _, node := range c.Nodes {
+		nodeDir := filepath.Join(destDir, fmt.Sprintf("n%d", node))
+		if err := os.MkdirAll(nodeDir, 0755); err != nil {
+			return err
+		}
+		dest := filepath.Join(nodeDir, path.Base(packetCaptureFile))
+		if err := c.Get(ctx, l, install.Nodes{node}, packetCaptureFile, dest); err != nil {
+			return errors.Wrapf(err, "retrieving packet capture from node %d", node)
+		}
+		l.Printf("node %d: packet capture written to %s", node, dest)
+	}
+	return nil
+}
+
+// ChaosEventKind is the kind of fault injected, or healed, by a ChaosEvent.
+type ChaosEventKind int
+
+const (
+	// ChaosPartition drops traffic according to the event's Rules, as
+	// SetFirewall does.
+	ChaosPartition ChaosEventKind = iota
+	// ChaosHealPartition removes the rules applied by all previous
+	// ChaosPartition events, as ClearFirewall does.
+	ChaosHealPartition
+	// ChaosLatency injects latency between the event's Latency pairs, as
+	// InjectLatency does.
+	ChaosLatency
+	// ChaosClearLatency removes the latency injected by all previous
+	// ChaosLatency events, as ClearLatency does.
+	ChaosClearLatency
+	// ChaosDiskStall stalls the data disk of the event's Node for its Duration,
+	// as SimulateDiskStall does. Later events don't wait for the stall to end.
+	ChaosDiskStall
+	// ChaosKill kills the cockroach process of the event's Node with SIGKILL.
+	ChaosKill
+	// ChaosRestart restarts the cockroach process of the event's Node, after a
+	// ChaosKill event, with the flags that it was last started with.
+	ChaosRestart
+)
+
+func (k ChaosEventKind) String() string {
+	switch k {
+	case ChaosPartition:
+		return "partition"
+	case ChaosHealPartition:
+		return "heal partition"
+	case ChaosLatency:
+		return "latency"
+	case ChaosClearLatency:
+		return "clear latency"
+	case ChaosDiskStall:
+		return "disk stall"
+	case ChaosKill:
+		return "kill"
+	case ChaosRestart:
+		return "restart"
+	default:
+		return fmt.Sprintf("ChaosEventKind(%d)", int(k))
+	}
+}
+
+// ChaosEvent is a fault injected into, or healed in, a cluster at a scheduled
+// time by RunChaosSchedule.
+type ChaosEvent struct {
+	// At is the offset from the start of the schedule at which the event
+	// occurs.
+	At time.Duration
+	// Kind is the kind of the event, which determines which of the following
+	// fields apply to it.
+	Kind ChaosEventKind
+	// Rules are the firewall rules applied by a ChaosPartition event.
+	Rules []FirewallRule
+	// Latency are the latency pairs injected by a ChaosLatency event.
+	Latency []LatencyPair
+	// Node is the node targeted by a ChaosDiskStall, ChaosKill or ChaosRestart
+	// event.
+	Node int
+	// Duration is the duration of a ChaosDiskStall event.
+	Duration time.Duration
+}
+
+// validate returns an error if the event is invalid for a cluster with the
+// supplied number of nodes.
+func (ev ChaosEvent) validate(numNodes int) error {
+	if ev.At < 0 {
+		return errors.Newf("invalid offset %s", ev.At)
+	}
+	switch ev.Kind {
+	case ChaosPartition:
+		if len(ev.Rules) == 0 {
+			return errors.New("no firewall rules specified")
+		}
+	case ChaosLatency:
+		if len(ev.Latency) == 0 {
+			return errors.New("no latency pairs specified")
+		}
+	case ChaosHealPartition, ChaosClearLatency:
+	case ChaosDiskStall, ChaosKill, ChaosRestart:
+		if ev.Node < 1 || ev.Node > numNodes {
+			return errors.Newf("invalid node %d for cluster with %d nodes", ev.Node, numNodes)
+		}
+		if ev.Kind == ChaosDiskStall && ev.Duration <= 0 {
+			return errors.Newf("invalid disk stall duration %s", ev.Duration)
+		}
+	default:
+		return errors.Newf("unknown event kind %s", ev.Kind)
+	}
+	return nil
+}
+
+// RunChaosSchedule injects and heals the faults described by the supplied
+// events into the cluster, each at its offset from the start of the schedule,
+// and returns once the last event has occurred and all disk stalls have ended.
+// Events with the same offset occur in the order in which they are supplied.
+// Whether the schedule completes, fails, or is interrupted by the cancellation
+// of ctx, all the faults it injected are healed before it returns: partitions
+// and latency are removed, disk stalls are lifted, and killed nodes that
+// weren't restarted are restarted.
+func RunChaosSchedule(
+	ctx context.Context, l *logger.Logger, clusterName string, schedule []ChaosEvent,
+) (retErr error) {
+	if len(schedule) == 0 {
+		return errors.New("no chaos events specified")
+	}
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return err
+	}
+	events := append([]ChaosEvent(nil), schedule...)
+	for i, ev := range events {
+		if err := ev.validate(len(c.VMs)); err != nil {
+			return errors.Wrapf(err, "chaos event %d (%s at %s)", i, ev.Kind, ev.At)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At < events[j].At })
+
+	// The faults that have been injected, and must be healed before returning.
+	var partitioned, delayed bool
+	killed := make(map[install.Node]bool)
+	stallCtx, cancelStalls := context.WithCancel(ctx)
+	stalls := ctxgroup.WithContext(stallCtx)
+	// NB: the faults are healed using a fresh context, so that they are healed
+	// even if ctx is canceled.
+	defer func() {
+		if retErr != nil {
+			cancelStalls()
+		}
+		if err := stalls.Wait(); err != nil && retErr == nil {
+			retErr = err
+		}
+		cancelStalls()
+		healCtx := context.Background()
+		if partitioned {
+			if err := ClearFirewall(healCtx, l, clusterName); err != nil {
+				retErr = errors.CombineErrors(retErr, errors.Wrap(err, "healing partitions"))
+			}
+		}
+		if delayed {
+			if err := ClearLatency(healCtx, l, clusterName); err != nil {
+				retErr = errors.CombineErrors(retErr, errors.Wrap(err, "clearing latency"))
+			}
+		}
+		for node := range killed {
+			if err := restartChaosNode(healCtx, l, c, node); err != nil {
+				retErr = errors.CombineErrors(retErr, errors.Wrapf(err, "restarting node %d", node))
+			}
+		}
+	}()
+
+	start := timeutil.Now()
+	for _, ev := range events {
+		if wait := ev.At - timeutil.Since(start); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		l.Printf("chaos event at %s: %s", ev.At, ev.Kind)
+		node := install.Node(ev.Node)
+		var err error
+		switch ev.Kind {
+		case ChaosPartition:
+			partitioned = true
+			err = SetFirewall(ctx, l, clusterName, ev.Rules)
+		case ChaosHealPartition:
+			if err = ClearFirewall(ctx, l, clusterName); err == nil {
+				partitioned = false
+			}
+		case ChaosLatency:
+			delayed = true
+			err = InjectLatency(ctx, l, clusterName, ev.Latency)
+		case ChaosClearLatency:
+			if err = ClearLatency(ctx, l, clusterName); err == nil {
+				delayed = false
+			}
+		case ChaosDiskStall:
+			ev := ev
+			stalls.GoCtx(func(ctx context.Context) error {
+				return SimulateDiskStall(ctx, l, clusterName, ev.Node, ev.Duration)
+			})
+		case ChaosKill:
+			nodeC := *c
+			nodeC.Nodes = install.Nodes{node}
+			if err = nodeC.Stop(ctx, l, 9 /* sig */, true /* wait */, 0 /* maxWait */); err == nil {
+				killed[node] = true
+			}
+		case ChaosRestart:
+			if err = restartChaosNode(ctx, l, c, node); err == nil {
+				delete(killed, node)
+			}
+		}
+		if err != nil {
+			return errors.Wrapf(err, "chaos event at %s (%s)", ev.At, ev.Kind)
+		}
+	}
+	return nil
+}
+
+// restartChaosNode restarts the cockroach process of the supplied node by
+// running the start script that it was last started with, which preserves the
+// flags it was started with.
+func restartChaosNode(
+	ctx context.Context, l *logger.Logger, c *install.SyncedCluster, node install.Node,
+) error {
+	cmd := "./cockroach.sh"
+	if c.IsLocal() {
+		cmd = fmt.Sprintf("cd %s && %s", local.VMDir(c.Name, int(node)), cmd)
+	}
+	return c.Run(ctx, l, l.Stdout, l.Stderr, install.Nodes{node}, "restarting node", cmd)
+}
+
+// Install installs third party software.
+func Install(ctx context.Context, l *logger.Logger, clusterName string, software []string) error {
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return err
+	}
+
+	// As seen in #103316, this can hit a 503 Service Unavailable when
+	// trying to download the package, so we retry every 30 seconds
+	// for up to 5 mins below. The caller may choose to fail or skip the test.
+	return retry.WithMaxAttempts(ctx, retry.Options{
+		InitialBackoff: 30 * time.Second,
+		Multiplier:     1,
+	}, 10, func() error {
+		err := install.Install(ctx, l, c, software)
+		err = errors.Wrapf(err, "retryable infrastructure error: could not install %s", software)
+		if err != nil {
+			l.Printf(err.Error())
+		}
+		return err
+	})
+}
+
+// Download downloads 3rd party tools, using a GCS cache if possible.
+func Download(
+	ctx context.Context, l *logger.Logger, clusterName string, src, sha, dest string,
+) error {
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return err
+	}
+	return install.Download(ctx, l, c, src, sha, dest)
+}
+
+// DistributeCerts distributes certificates to the nodes in a cluster.
+// If the certificates already exist, no action is taken.
+func DistributeCerts(ctx context.Context, l *logger.Logger, clusterName string) error {
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return err
+	}
+	return c.DistributeCerts(ctx, l)
+}
+
+// Put copies a local file to the nodes in a cluster.
+func Put(
+	ctx context.Context, l *logger.Logger, clusterName, src, dest string, useTreeDist bool,
+) error {
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName, install.UseTreeDistOption(useTreeDist))
+	if err != nil {
+		return err
+	}
+	return c.Put(ctx, l, c.Nodes, src, dest)
+}
+
+// Get copies a remote file from the nodes in a cluster.
+// If the file is retrieved from multiple nodes the destination
+// file name will be prefixed with the node number.
+func Get(ctx context.Context, l *logger.Logger, clusterName, src, dest string) error {
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return err
+	}
+	return c.Get(ctx, l, c.Nodes, src, dest)
+}
+
+// clientCertUserRE matches the SQL user names for which client certs may be
+// fetched.
+var clientCertUserRE = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// FetchClientCerts copies the CA cert and the client cert and key of the
+// supplied SQL user (root, if empty) from the first node of a secure cluster
+// into destDir, e.g. to connect a local SQL client to the cluster. The key is
+// only readable by its owner, as required by SQL clients.
+func FetchClientCerts(
+	ctx context.Context, l *logger.Logger, clusterName, destDir, user string,
+) error {
+	if user == "" {
+		user = "root"
+	}
+	if !clientCertUserRE.MatchString(user) {
+		return errors.Newf("invalid user %q", user)
+	}
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return err
+	}
+	if !c.HasCertificates(ctx, l) {
+		return errors.Newf("cluster %s is insecure: it has no certificates", clusterName)
+	}
+
+	files := []struct {
+		name string
+		mode os.FileMode
+	}{
+		{"ca.crt", 0644},
+		{fmt.Sprintf("client.%s.crt", user), 0644},
+		{fmt.Sprintf("client.%s.key", user), 0600},
+	}
+	certsDir := c.CertsDir(1)
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, filepath.Join(certsDir, f.name))
+	}
+	if err := c.Run(ctx, l, l.Stdout, l.Stderr, install.Nodes{1}, "checking client certs",
+		fmt.Sprintf("test -e %s", strings.Join(paths, " -a -e "))); err != nil {
+		return errors.Wrapf(err, "no client certs for user %s; only root and testuser have them by default", user)
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+	for i, f := range files {
+		dest := filepath.Join(destDir, f.name)
+		if err := c.Get(ctx, l, install.Nodes{1}, paths[i], dest); err != nil {
+			return err
+		}
+		if err := os.Chmod(dest, f.mode); err != nil {
+			return err
+		}
+	}
+	l.Printf("client certs for user %s written to %s", user, destDir)
+	return nil
+}
+
+// CollectArtifacts copies the files and directories matching any of the
+// supplied glob patterns (e.g. "logs/*.log" or "logs/heap_profiler/*") from
+// each node of the cluster into destDir/n<node>/, preserving their paths
+// relative to the node's working directory. Patterns are expanded by the shell
+// on each node, so the set of matches may differ between nodes. Collection is
+// best-effort: a failure to collect from one node or file doesn't prevent the
+// others from being collected, and all the errors are returned.
+func CollectArtifacts(
+	ctx context.Context, l *logger.Logger, clusterName string, patterns []string, destDir string,
+) error {
+	if len(patterns) == 0 {
+		return errors.New("no artifact patterns specified")
+	}
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return err
+	}
+
+	// NB: the patterns are deliberately left unquoted, so that the shell expands
+	// them. Patterns that don't match anything expand to nothing.
+	results, err := c.RunWithDetails(ctx, l, c.Nodes, "listing artifacts", fmt.Sprintf(
+		`shopt -s nullglob globstar; for f in %s; do echo "$f"; done`, strings.Join(patterns, " ")))
+	if err != nil {
+		return err
+	}
+
+	var combinedErr error
+	for _, res := range results {
+		if res.Err != nil {
+			combinedErr = errors.CombineErrors(combinedErr,
+				errors.Wrapf(res.Err, "listing artifacts on node %d", res.Node))
+			continue
+		}
+		nodeDir := filepath.Join(destDir, fmt.Sprintf("n%d", res.Node))
+		seen := make(map[string]struct{})
+		for _, src := range strings.Split(strings.TrimSpace(res.Stdout), "\n") {
+			if _, ok := seen[src]; ok || src == "" {
+				continue
+			}
+			seen[src] = struct{}{}
+			dest := filepath.Join(nodeDir, filepath.Clean("/"+src))
+			if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+				return err
+			}
+			if err := c.Get(ctx, l, install.Nodes{res.Node}, src, dest); err != nil {
+				combinedErr = errors.CombineErrors(combinedErr,
+					errors.Wrapf(err, "collecting %s from node %d", src, res.Node))
+			}
+		}
+	}
+	return combinedErr
+}
+
+// ContinuousProfilesPattern matches the CPU profiles written by the nodes of a
+// cluster once StartContinuousProfiling has been called, relative to the
+// nodes' working directory. It can be passed to CollectArtifacts.
+const ContinuousProfilesPattern = "logs/pprof_dump/cpuprof.*"
+
+// continuousProfilingSettings are the cluster settings configured by
+// StartContinuousProfiling and reset by StopContinuousProfiling.
+var continuousProfilingSettings = []string{
+	"server.cpu_profile.cpu_usage_combined_threshold",
+	"server.cpu_profile.interval",
+}
+
+// StartContinuousProfiling configures the nodes of the cluster to write CPU
+// profiles to logs/pprof_dump (see ContinuousProfilesPattern) until
+// StopContinuousProfiling is called. The CPU usage threshold is lowered to 0,
+// so a node takes a profile at least once every interval as long as it uses
+// any CPU, and in between whenever its CPU usage rises above that of its last
+// profile. The number of profiles retained on each node is bounded by
+// server.cpu_profile.total_dump_size_limit.
+func StartContinuousProfiling(
+	ctx context.Context, l *logger.Logger, clusterName string, secure bool, interval time.Duration,
+) error {
+	if interval <= 0 {
+		return errors.Newf("invalid profiling interval %s", interval)
+	}
+	// NB: the profiler still compares the CPU usage against a high water mark,
+	// which is reset to the threshold every interval. With a threshold of 0,
+	// any CPU usage exceeds the reset high water mark.
+	return setContinuousProfilingSettings(ctx, l, clusterName, secure, fmt.Sprintf(
+		"SET CLUSTER SETTING %s = 0; SET CLUSTER SETTING %s = '%s';",
+		continuousProfilingSettings[0], continuousProfilingSettings[1], interval))
+}
+
+// StopContinuousProfiling stops the periodic CPU profiles started by
+// StartContinuousProfiling. Profiles already written are left in place.
+func StopContinuousProfiling(
+	ctx context.Context, l *logger.Logger, clusterName string, secure bool,
+) error {
+	var stmts []string
+	for _, name := range continuousProfilingSettings {
+		stmts = append(stmts, fmt.Sprintf("RESET CLUSTER SETTING %s;", name))
+	}
+	return setContinuousProfilingSettings(ctx, l, clusterName, secure, strings.Join(stmts, " "))
+}
+
+func setContinuousProfilingSettings(
+	ctx context.Context, l *logger.Logger, clusterName string, secure bool, stmts string,
+) error {
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName, install.SecureOption(secure))
+	if err != nil {
+		return err
+	}
+	// Cluster settings apply to all the nodes, so it suffices to set them
+	// through the first one.
+	return c.ExecSQL(ctx, l, c.Nodes[:1], "" /* tenantName */, 0 /* tenantInstance */, []string{"-e", stmts})
+}
+
+// OOMHeapDumpsPattern matches the heap profiles written by the nodes of a
+// cluster once ConfigureOOMHeapDump has been called, relative to the nodes'
+// working directory. It can be passed to CollectArtifacts.
+const OOMHeapDumpsPattern = "logs/" + heapProfileDirName + "/memprof.*"
+
+// heapProfileDirName is the name of the directory, under the log directory,
+// that nodes write their heap profiles to.
+const heapProfileDirName = "heap_profiler"
+
+// minOOMHeapDumpFreeBytes is the free space that ConfigureOOMHeapDump requires
+// on the disk holding a node's heap profiles. It leaves room for a full
+// server.mem_profile.total_dump_size_limit worth of profiles, with plenty to
+// spare for the logs that share the disk.
+const minOOMHeapDumpFreeBytes = 1 << 30 // 1GiB
+
+// ConfigureOOMHeapDump configures the nodes of the cluster to write a Go heap
+// profile to logs/heap_profiler (see OOMHeapDumpsPattern) whenever their heap
+// exceeds the supplied fraction of their memory and the size of any previous
+// profile, so that the profiles leading up to an OOM can be collected
+// afterwards. On nodes whose log disk doesn't have room for the profiles, the
+// directory is moved to the data disk and linked to from the log directory.
+// The location of the profiles is logged for each node.
+func ConfigureOOMHeapDump(
+	ctx context.Context, l *logger.Logger, clusterName string, threshold float64,
+) error {
+	if threshold <= 0 || threshold >= 1 {
+		return errors.Newf("invalid heap usage threshold %.2f: must be a fraction in (0, 1)", threshold)
+	}
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return err
+	}
+	c.Secure = c.HasCertificates(ctx, l)
+
+	// NB: the directory is created ahead of the node, which only creates it
+	// when it starts.
+	cmds := make(map[install.Node]string, len(c.Nodes))
+	for _, node := range c.Nodes {
+		logDir := c.LogDir(node, "" /* tenantName */, 0 /* instance */)
+		dumpDir := path.Join(logDir, heapProfileDirName)
+		var cmd strings.Builder
+		cmd.WriteString("set -euo pipefail\n")
+		cmd.WriteString(`avail() { df --output=avail -B1 "$1" | tail -n 1 | tr -d ' '; }` + "\n")
+		fmt.Fprintf(&cmd, "mkdir -p %s\n", logDir)
+		if !c.IsLocal() {
+			altDir := path.Join(c.NodeDir(node, 1 /* storeIndex */), heapProfileDirName)
+			fmt.Fprintf(&cmd, `if [ ! -L %[1]s ] && [ "$(avail %[2]s)" -lt %[3]d ] && [ "$(avail %[4]s)" -ge %[3]d ]; then
+  mkdir -p %[5]s
+  if [ -d %[1]s ]; then find %[1]s -mindepth 1 -maxdepth 1 -exec mv -t %[5]s {} +; rmdir %[1]s; fi
+  ln -s %[5]s %[1]s
+fi
+`, dumpDir, logDir, minOOMHeapDumpFreeBytes, path.Dir(altDir), altDir)
+		}
+		fmt.Fprintf(&cmd, "mkdir -p %[1]s\necho \"$(readlink -f %[1]s) $(avail %[1]s/)\"\n", dumpDir)
+		cmds[node] = cmd.String()
+	}
+	results, err := c.RunPerNodeWithDetails(ctx, l, "preparing heap profile directory", cmds)
+	if err != nil {
+		return err
+	}
+	dirs := make(map[install.Node]string, len(results))
+	for _, node := range c.Nodes {
+		res := results[node]
+		if res.Err != nil {
+			return errors.Wrapf(res.Err, "preparing heap profile directory on node %d", node)
+		}
+		fields := strings.Fields(res.Stdout)
+		if len(fields) != 2 {
+			return errors.Newf("unexpected output preparing heap profile directory on node %d: %q", node, res.Stdout)
+		}
+		avail, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "parsing free space on node %d", node)
+		}
+		if avail < minOOMHeapDumpFreeBytes {
+			return errors.Newf("only %s free for heap profiles in %s on node %d, need %s",
+				humanizeutil.IBytes(avail), fields[0], node, humanizeutil.IBytes(minOOMHeapDumpFreeBytes))
+		}
+		dirs[node] = fields[0]
+	}
+
+	// Cluster settings apply to all the nodes, so it suffices to set them
+	// through the first one.
+	stmt := fmt.Sprintf("SET CLUSTER SETTING server.mem_profile.heap_usage_threshold = %g;", threshold)
+	if err := c.ExecSQL(ctx, l, c.Nodes[:1], "" /* tenantName */, 0 /* tenantInstance */, []string{"-e", stmt}); err != nil {
+		return err
+	}
+	for _, node := range c.Nodes {
+		l.Printf("node %d: heap profiles above %.0f%% of memory written to %s", node, threshold*100, dirs[node])
+	}
+	return nil
+}
+
+// tracingSettings are the cluster settings configured by EnableTracing and
+// reset by DisableTracing, in that order: the address of the OpenTelemetry
+// collector that spans are exported to, the registry of active spans, which
+// must be enabled for spans to be recorded, and the probability that a
+// transaction collects execution statistics, which traces its statements.
+var tracingSettings = []string{
+	"trace.opentelemetry.collector",
+	"trace.span_registry.enabled",
+	"sql.txn_stats.sample_rate",
+}
+
+// defaultOTLPCollectorPort is the port of an OpenTelemetry collector when
+// none is specified, as assumed by trace.opentelemetry.collector.
+const defaultOTLPCollectorPort = "4317"
+
+// collectorAddr returns the <host>:<port> address of the supplied collector,
+// which may also be specified as a URL, e.g. "http://collector:4317".
+func collectorAddr(collector string) (string, error) {
+	hostPort := collector
+	if strings.Contains(collector, "://") {
+		u, err := url.Parse(collector)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid collector URL %q", collector)
+		}
+		hostPort = u.Host
+	}
+	if hostPort == "" {
+		return "", errors.Newf("invalid collector %q", collector)
+	}
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host, port = hostPort, defaultOTLPCollectorPort
+	}
+	if host == "" || !hostRE.MatchString(host) {
+		return "", errors.Newf("invalid collector host in %q", collector)
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		return "", errors.Newf("invalid collector port in %q", collector)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// EnableTracing configures the cluster to export the spans of all traces to
+// the supplied OpenTelemetry collector, specified as <host>:<port> or as a
+// URL, and to trace the statements of all transactions. The collector must be
+// reachable from every node of the cluster; this is checked before any
+// setting is changed. Tracing has a performance cost, and can be disabled with
+// DisableTracing.
+func EnableTracing(
+	ctx context.Context, l *logger.Logger, clusterName string, secure bool, collectorURL string,
+) error {
+	addr, err := collectorAddr(collectorURL)
+	if err != nil {
+		return err
+	}
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName, install.SecureOption(secure))
+	if err != nil {
+		return err
+	}
+
+	host, port, _ := net.SplitHostPort(addr)
+	results, err := c.RunWithDetails(ctx, l, c.Nodes, "checking trace collector",
+		fmt.Sprintf("timeout 5 bash -c '</dev/tcp/%s/%s'", host, port))
+	if err != nil {
+		return err
+	}
+	var unreachable install.Nodes
+	for _, res := range results {
+		if res.Err != nil {
+			unreachable = append(unreachable, res.Node)
+		}
+	}
+	if len(unreachable) > 0 {
+		return errors.Newf("trace collector %s is unreachable from nodes %v", addr, unreachable)
+	}
+
+	// Cluster settings apply to all the nodes, so it suffices to set them
+	// through the first one.
+	stmt := fmt.Sprintf("SET CLUSTER SETTING %s = '%s'; SET CLUSTER SETTING %s = true; SET CLUSTER SETTING %s = 1;",
+		tracingSettings[0], addr, tracingSettings[1], tracingSettings[2])
+	if err := c.ExecSQL(ctx, l, c.Nodes[:1], "" /* tenantName */, 0 /* tenantInstance */, []string{"-e", stmt}); err != nil {
+		return err
+	}
+	rows, err := querySQLRows(ctx, l, c, "verifying tracing settings",
+		fmt.Sprintf("SHOW CLUSTER SETTING %s", tracingSettings[0]))
+	if err != nil {
+		return err
+	}
+	if len(rows) != 1 || len(rows[0]) != 1 || rows[0][0] != addr {
+		return errors.Newf("trace collector not set to %s: %v", addr, rows)
+	}
+	l.Printf("exporting traces to %s", addr)
+	return nil
+}
+
+// DisableTracing stops the export of traces enabled by EnableTracing,
+// restoring the default values of the settings it changed.
+func DisableTracing(
+	ctx context.Context, l *logger.Logger, clusterName string, secure bool,
+) error {
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName, install.SecureOption(secure))
+	if err != nil {
+		return err
+	}
+	var stmts []string
+	for _, name := range tracingSettings {
+		stmts = append(stmts, fmt.Sprintf("RESET CLUSTER SETTING %s;", name))
+	}
+	stmt := strings.Join(stmts, " ")
+	return c.ExecSQL(ctx, l, c.Nodes[:1], "" /* tenantName */, 0 /* tenantInstance */, []string{"-e", stmt})
+}
+
+// BackupOpts configures the backup taken by RunBackup.
+type BackupOpts struct {
+	// Secure indicates whether the cluster is secure.
+	Secure bool
+	// Target is the target of the backup, e.g. "DATABASE tpcc" or "TABLE
+	// bank.bank". The whole cluster is backed up if it is empty.
+	Target string
+	// Options are added to the WITH clause of the BACKUP statement, e.g.
+	// "revision_history".
+	Options []string
+	// Wait, if set, makes RunBackup wait for the backup job to complete.
+	Wait bool
+	// PollInterval is the interval at which the backup job is polled when Wait
+	// is set. Defaults to defaultJobPollInterval.
+	PollInterval time.Duration
+}
+
+// defaultJobPollInterval is the interval at which jobs are polled while
+// waiting for them to complete.
+const defaultJobPollInterval = 10 * time.Second
+
+// querySQLRows runs the supplied statement on the first node of the cluster,
+// and returns the rows of its result, excluding the header.
+func querySQLRows(
+	ctx context.Context, l *logger.Logger, c *install.SyncedCluster, title, stmt string,
+) ([][]string, error) {
+	results, err := c.ExecSQLWithDetails(ctx, l, c.Nodes[:1], "" /* tenantName */, 0, /* tenantInstance */
+		[]string{"--format=csv", "-e", stmt})
+	if err != nil {
+		return nil, err
+	}
+	out := strings.TrimSpace(results[0].CombinedOut)
+	if results[0].Err != nil {
+		return nil, errors.Wrapf(results[0].Err, "%s: %s", title, out)
+	}
+	r := csv.NewReader(strings.NewReader(out))
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil || len(rows) == 0 {
+		return nil, errors.Newf("%s: unexpected output %q", title, out)
+	}
+	return rows[1:], nil
+}
+
+// waitForJobs polls the supplied jobs every pollInterval until all of them
+// reach a terminal state, and returns an error naming those that didn't
+// succeed, with their error messages.
+func waitForJobs(
+	ctx context.Context,
+	l *logger.Logger,
+	c *install.SyncedCluster,
+	jobIDs []int,
+	pollInterval time.Duration,
+) error {
+	if pollInterval <= 0 {
+		pollInterval = defaultJobPollInterval
+	}
+	ids := make([]string, len(jobIDs))
+	for i, id := range jobIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+	stmt := fmt.Sprintf(
+		"SELECT job_id, status, coalesce(error, '') FROM crdb_internal.jobs WHERE job_id IN (%s)",
+		strings.Join(ids, ", "))
+	for {
+		rows, err := querySQLRows(ctx, l, c, "polling jobs", stmt)
+		if err != nil {
+			return err
+		}
+		statuses := make(map[string][]string, len(rows))
+		for _, row := range rows {
+			if len(row) != 3 {
+				return errors.Newf("unexpected job status: %v", row)
+			}
+			statuses[row[0]] = row[1:]
+		}
+		var pending, failed []string
+		for _, id := range ids {
+			st, ok := statuses[id]
+			if !ok {
+				return errors.Newf("job %s not found", id)
+			}
+			switch status, jobErr := st[0], st[1]; status {
+			case "succeeded":
+			case "failed", "canceled", "revert-failed":
+				failed = append(failed, fmt.Sprintf("job %s %s: %s", id, status, jobErr))
+			default:
+				pending = append(pending, fmt.Sprintf("job %s is %s", id, status))
+			}
+		}
+		if len(pending) == 0 {
+			if len(failed) > 0 {
+				return errors.Newf("%d of %d jobs did not succeed: %s",
+					len(failed), len(ids), strings.Join(failed, "; "))
+			}
+			l.Printf("%d jobs succeeded", len(ids))
+			return nil
+		}
+		l.Printf("waiting for %d of %d jobs: %s", len(pending), len(ids), strings.Join(pending, ", "))
+		select {
+		case <-time.After(pollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// WaitForJobs waits for the supplied jobs to reach a terminal state, and
+// returns an error naming those that failed or were canceled, with their error
+// messages. If timeout is positive, WaitForJobs gives up waiting after it.
+func WaitForJobs(
+	ctx context.Context,
+	l *logger.Logger,
+	clusterName string,
+	secure bool,
+	jobIDs []int,
+	timeout time.Duration,
+) error {
+	if len(jobIDs) == 0 {
+		return nil
+	}
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName, install.SecureOption(secure))
+	if err != nil {
+		return err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := waitForJobs(ctx, l, c, jobIDs, defaultJobPollInterval); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) && timeout > 0 {
+			return errors.Wrapf(err, "timed out after %s waiting for jobs %v", timeout, jobIDs)
+		}
+		return err
+	}
+	return nil
+}
+
+// redactedURIParamMarkers are the substrings that identify the query
+// parameters of a cloud storage URI that hold credentials, e.g.
+// AWS_SECRET_ACCESS_KEY or CREDENTIALS.
+var redactedURIParamMarkers = []string{"SECRET", "KEY", "TOKEN", "CREDENTIALS", "PASSWORD"}
+
+// redactStorageURI returns the supplied cloud storage URI with the values of
+// its credential parameters, and any password, redacted, for logging.
+func redactStorageURI(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "<unparseable URI>"
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "redacted")
+	}
+	params := u.Query()
+	for name := range params {
+		for _, marker := range redactedURIParamMarkers {
+			if strings.Contains(strings.ToUpper(name), marker) {
+				params.Set(name, "redacted")
+				break
+			}
+		}
+	}
+	u.RawQuery = params.Encode()
+	return u.String()
+}
+
+// RunBackup takes a backup of the cluster, or of opts.Target, into the cloud
+// storage location uri, and returns the ID of the backup job. The URI may
+// carry the authentication parameters of the storage provider (e.g.
+// AUTH=specified&AWS_ACCESS_KEY_ID=...); their values are redacted from the
+// logs. If opts.Wait is set, RunBackup waits for the job to complete, and
+// returns an error carrying the job's error message if it doesn't succeed.
+func RunBackup(
+	ctx context.Context, l *logger.Logger, clusterName string, uri string, opts BackupOpts,
+) (jobID int, _ error) {
+	if uri == "" {
+		return 0, errors.New("no backup destination specified")
+	}
+	if err := LoadClusters(); err != nil {
+		return 0, err
+	}
+	c, err := newCluster(l, clusterName, install.SecureOption(opts.Secure))
+	if err != nil {
+		return 0, err
+	}
+	target := opts.Target
+	if target != "" {
+		target += " "
+	}
+	// The job runs detached, so that the statement returns the job's ID right
+	// away instead of blocking until the backup completes.
+	withOpts := append([]string{"detached"}, opts.Options...)
+	stmt := fmt.Sprintf("BACKUP %sINTO '%s' WITH %s",
+		target, strings.ReplaceAll(uri, "'", "''"), strings.Join(withOpts, ", "))
+	l.Printf("backing up %sto %s", target, redactStorageURI(uri))
+	rows, err := querySQLRows(ctx, l, c, "starting backup", stmt)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) != 1 || len(rows[0]) == 0 {
+		return 0, errors.Newf("starting backup: unexpected result %v", rows)
+	}
+	row := rows[0]
+	if jobID, err = strconv.Atoi(row[0]); err != nil {
+		return 0, errors.Wrapf(err, "parsing backup job ID %q", row[0])
+	}
+	l.Printf("started backup job %d", jobID)
+	if !opts.Wait {
+		return jobID, nil
+	}
+	return jobID, waitForJobs(ctx, l, c, []int{jobID}, opts.PollInterval)
+}
+
+type PGURLOptions struct {
+	Secure         bool
+	External       bool
+	TenantName     string
+	TenantInstance int
+}
+
+// PgURL generates pgurls for the nodes in a cluster.
+func PgURL(
+	ctx context.Context, l *logger.Logger, clusterName, certsDir string, opts PGURLOptions,
+) ([]string, error) {
+	if err := LoadClusters(); err != nil {
+		return nil, err
+	}
+	c, err := newCluster(l, clusterName, install.SecureOption(opts.Secure), install.PGUrlCertsDirOption(certsDir))
+	if err != nil {
+		return nil, err
+	}
+	nodes := c.TargetNodes()
+	ips := make([]string, len(nodes))
+
+	if opts.External {
+		for i := 0; i < len(nodes); i++ {
+			ips[i] = c.VMs[nodes[i]-1].PublicIP
+		}
+	} else {
+		for i := 0; i < len(nodes); i++ {
+			ip, err := c.GetInternalIP(nodes[i])
+			if err == nil {
+				ips[i] = ip
+			}
+		}
+	}
+
+	var urls []string
+	for i, ip := range ips {
+		desc, err := c.DiscoverService(ctx, nodes[i], opts.TenantName, install.ServiceTypeSQL, opts.TenantInstance)
+		if err != nil {
+			return nil, err
+		}
+		if ip == "" {
+			return nil, errors.Errorf("empty ip: %v", ips)
+		}
+		urls = append(urls, c.NodeURL(ip, desc.Port, opts.TenantName))
+	}
+	if len(urls) != len(nodes) {
+		return nil, errors.Errorf("have nodes %v, but urls %v from ips %v", nodes, urls, ips)
+	}
+	return urls, nil
+}
+
+type urlConfig struct {
+	path           string
+	usePublicIP    bool
+	openInBrowser  bool
+	secure         bool
+	port           int
+	tenantName     string
+	tenantInstance int
+}
+
+func urlGenerator(
+	ctx context.Context,
+	c *install.SyncedCluster,
+	l *logger.Logger,
+	nodes install.Nodes,
+	uConfig urlConfig,
+) ([]string, error) {
+	var urls []string
+	for i, node := range nodes {
+		host := vm.Name(c.Name, int(node)) + "." + gce.Subdomain
+
+		// verify DNS is working / fallback to IPs if not.
+		if i == 0 && !uConfig.usePublicIP {
+			if _, err := net.LookupHost(host); err != nil {
+				l.Errorf("no valid DNS (yet?). might need to re-run `sync`?")
+				uConfig.usePublicIP = true
+			}
+		}
+
+		if uConfig.usePublicIP {
+			host = c.VMs[node-1].PublicIP
+		}
+		port := uConfig.port
+		if port == 0 {
+			desc, err := c.DiscoverService(ctx, node, uConfig.tenantName, install.ServiceTypeUI, uConfig.tenantInstance)
+			if err != nil {
+				return nil, err
+			}
+			port = desc.Port
+		}
+		scheme := "http"
+		if c.Secure {
+			scheme = "https"
+		}
+		if !strings.HasPrefix(uConfig.path, "/") {
+			uConfig.path = "/" + uConfig.path
+		}
+		url := fmt.Sprintf("%s://%s:%d%s", scheme, host, port, uConfig.path)
+		urls = append(urls, url)
+		if uConfig.openInBrowser {
+			cmd := browserCmd(url)
+
+			if err := cmd.Run(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return urls, nil
+}
+
+func browserCmd(url string) *exec.Cmd {
+	var cmd string
+	var args []string
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = "/usr/bin/open"
+	case "windows":
+		cmd = "cmd"
+		args = []string{"/c", "start"}
+	default:
+		cmd = "xdg-open"
+	}
+	args = append(args, url)
+	return exec.Command(cmd, args...)
+}
+
 // AdminURL generates admin UI URLs for the nodes in a cluster.
 func AdminURL(
 	ctx context.Context,
@@ -1051,6 +2825,9 @@ type PprofOpts struct {
 	Open         bool
 	StartingPort int
 	Duration     time.Duration
+	// Dir is the directory in which the profiles are written. Defaults to the
+	// current directory.
+	Dir string
 }
 
 // Pprof TODO
@@ -1096,7 +2873,8 @@ func Pprof(ctx context.Context, l *logger.Logger, clusterName string, opts Pprof
 		if c.Secure {
 			scheme = "https"
 		}
-		outputFile := fmt.Sprintf("pprof-%s-%d-%s-%04d.out", profType, startTime, c.Name, node)
+		outputFile := filepath.Join(opts.Dir,
+			fmt.Sprintf("pprof-%s-%d-%s-%04d.out", profType, startTime, c.Name, node))
 		outputDir := filepath.Dir(outputFile)
 		file, err := os.CreateTemp(outputDir, ".pprof")
 		if err != nil {
@@ -1245,7 +3023,141 @@ func Destroy(
 		}); err != nil {
 		return err
 	}
-	l.Printf("OK")
+	l.Printf("OK")
+	return nil
+}
+
+// ScaleDown gracefully removes the given nodes from the cluster: it
+// decommissions the cockroach nodes running on them, waits for the
+// decommissioning to complete, stops them, and then destroys their VMs and
+// removes them from the cluster's cached metadata. Since nodes are numbered by
+// their position in the cluster, only the highest-numbered nodes can be
+// removed, so that the remaining nodes keep their numbers. ScaleDown refuses to
+// remove nodes if fewer nodes would remain than the number of replicas of some
+// range.
+func ScaleDown(
+	ctx context.Context, l *logger.Logger, clusterName string, secure bool, removeNodes []int,
+) error {
+	if len(removeNodes) == 0 {
+		return errors.New("no nodes to remove specified")
+	}
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName, install.SecureOption(secure))
+	if err != nil {
+		return err
+	}
+	if c.IsLocal() {
+		return errors.New("local clusters cannot be scaled down")
+	}
+
+	remaining := len(c.VMs) - len(removeNodes)
+	nodes := make(install.Nodes, 0, len(removeNodes))
+	for _, n := range removeNodes {
+		nodes = append(nodes, install.Node(n))
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+	for i, n := range nodes {
+		if int(n) != remaining+i+1 {
+			return errors.Newf("only the last %d nodes (%d-%d) of cluster %s can be removed, not %v",
+				len(removeNodes), remaining+1, len(c.VMs), clusterName, removeNodes)
+		}
+	}
+	coordinator := install.Node(1)
+
+	binary := c.Binary
+	if !filepath.IsAbs(binary) {
+		binary = "./" + binary
+	}
+	nodeURL := func(n install.Node) (string, error) {
+		port, err := c.NodePort(ctx, n)
+		if err != nil {
+			return "", err
+		}
+		return c.NodeURL("localhost", port, "" /* sharedTenantName */), nil
+	}
+	// querySQL runs the given single-valued query on node n and returns its
+	// result.
+	querySQL := func(n install.Node, title, query string) (string, error) {
+		pgURL, err := nodeURL(n)
+		if err != nil {
+			return "", err
+		}
+		results, err := c.RunWithDetails(ctx, l, install.Nodes{n}, title, fmt.Sprintf(
+			"%s sql --url '%s' --format=csv -e %q", binary, pgURL, query))
+		if err != nil {
+			return "", err
+		}
+		if results[0].Err != nil {
+			return "", errors.Wrapf(results[0].Err, "%s on node %d", title, n)
+		}
+		lines := strings.Split(strings.TrimSpace(results[0].Stdout), "\n")
+		return strings.TrimSpace(lines[len(lines)-1]), nil
+	}
+
+	// Ensure that the remaining nodes can hold all the replicas of every range.
+	out, err := querySQL(coordinator, "checking replication factor",
+		"SELECT max(array_length(replicas, 1)) FROM crdb_internal.ranges_no_leases")
+	if err != nil {
+		return err
+	}
+	replicas, err := strconv.Atoi(out)
+	if err != nil {
+		return errors.Wrapf(err, "parsing replication factor %q", out)
+	}
+	if remaining < replicas {
+		return errors.Newf("removing %d nodes would leave %d nodes in cluster %s, "+
+			"fewer than the %d replicas of some ranges", len(removeNodes), remaining, clusterName, replicas)
+	}
+
+	nodeIDs := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		id, err := querySQL(n, "getting node ID", "SELECT crdb_internal.node_id()")
+		if err != nil {
+			return err
+		}
+		l.Printf("node %d: decommissioning cockroach node n%s", n, id)
+		nodeIDs = append(nodeIDs, id)
+	}
+	pgURL, err := nodeURL(coordinator)
+	if err != nil {
+		return err
+	}
+	// NB: the decommission command reports the progress of each node, until
+	// all of them are fully decommissioned.
+	if err := c.Run(ctx, l, l.Stdout, l.Stderr, install.Nodes{coordinator}, "decommissioning nodes",
+		fmt.Sprintf("%s node decommission %s --wait=all --url '%s'",
+			binary, strings.Join(nodeIDs, " "), pgURL)); err != nil {
+		return err
+	}
+
+	stopC := *c
+	stopC.Nodes = nodes
+	for _, n := range nodes {
+		l.Printf("node %d: decommissioned, stopping", n)
+	}
+	if err := stopC.Stop(ctx, l, 9 /* sig */, true /* wait */, 0 /* maxWait */); err != nil {
+		return err
+	}
+
+	var vms vm.List
+	for _, n := range nodes {
+		l.Printf("node %d: stopped, destroying VM %s", n, c.VMs[n-1].Name)
+		vms = append(vms, c.VMs[n-1])
+	}
+	if err := vm.FanOut(vms, func(p vm.Provider, vms vm.List) error {
+		return p.Delete(l, vms)
+	}); err != nil {
+		return err
+	}
+
+	metadata := c.Cluster
+	metadata.VMs = append(vm.List(nil), c.VMs[:remaining]...)
+	if err := saveCluster(l, &metadata); err != nil {
+		return err
+	}
+	l.Printf("removed %d nodes from cluster %s, %d nodes remain", len(nodes), clusterName, remaining)
 	return nil
 }
 
@@ -1329,6 +3241,173 @@ func RemoveLabels(l *logger.Logger, clusterName string, labels []string) error {
 	})
 }
 
+// RenameCluster renames the cluster oldName to newName. VMs cannot be renamed,
+// so the new name is recorded in the vm.TagCluster label of each of the
+// cluster's VMs, which takes precedence over the name derived from the VM name
+// (see vm.VM.ClusterName). DNS entries are keyed by VM name, so they are
+// unaffected. The local cluster cache is updated to reflect the new name.
+//
+// If the labels cannot be updated on all the cluster's VMs, the original
+// labels are restored; if that also fails, the returned error lists the VMs
+// that may be left labeled with the new name.
+func RenameCluster(ctx context.Context, l *logger.Logger, oldName, newName string) error {
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	if config.IsLocalClusterName(oldName) || config.IsLocalClusterName(newName) {
+		return errors.New("renaming local clusters is not supported")
+	}
+	if oldName == newName {
+		return errors.Newf("cluster %s is already named %s", oldName, newName)
+	}
+	if err := verifyClusterName(l, newName, "" /* username */); err != nil {
+		return err
+	}
+	// The name is stored as a label, which providers sanitize.
+	if sanitized := vm.SanitizeLabel(newName); sanitized != newName {
+		return errors.Newf("cluster name %s cannot be used as a label, did you mean %s", newName, sanitized)
+	}
+
+	unlock, err := lock.AcquireFilesystemLock(config.DefaultLockPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cld, err := cloud.ListCloud(l, vm.ListOptions{})
+	if err != nil {
+		return err
+	}
+	c, ok := cld.Clusters[oldName]
+	if !ok {
+		return fmt.Errorf("cluster %s does not exist", oldName)
+	}
+	if _, ok := cld.Clusters[newName]; ok {
+		return &ClusterAlreadyExistsError{name: newName}
+	}
+
+	// Check that all the VMs are on providers that support labels before making
+	// any changes.
+	byProvider := make(map[string]vm.List)
+	var providers []string
+	for _, v := range c.VMs {
+		if v.Provider != gce.ProviderName && v.Provider != aws.ProviderName {
+			return errors.Newf("cannot rename cluster %s: provider %s does not support labels",
+				oldName, v.Provider)
+		}
+		if _, ok := byProvider[v.Provider]; !ok {
+			providers = append(providers, v.Provider)
+		}
+		byProvider[v.Provider] = append(byProvider[v.Provider], v)
+	}
+	sort.Strings(providers)
+
+	setClusterLabel := func(provider, name string) error {
+		return vm.ForProvider(provider, func(p vm.Provider) error {
+			return p.AddLabels(l, byProvider[provider], map[string]string{vm.TagCluster: name})
+		})
+	}
+	// A provider's VMs are only known to be unchanged if relabeling them was
+	// never attempted, so restore the labels on all attempted providers.
+	var attempted []string
+	for _, provider := range providers {
+		err := ctx.Err()
+		if err == nil {
+			attempted = append(attempted, provider)
+			err = setClusterLabel(provider, newName)
+		}
+		if err == nil {
+			continue
+		}
+		err = errors.Wrapf(err, "renaming cluster %s to %s", oldName, newName)
+		var inconsistent vm.List
+		for _, attemptedProvider := range attempted {
+			if restoreErr := setClusterLabel(attemptedProvider, oldName); restoreErr != nil {
+				l.Errorf("failed to restore %s label on %s VMs: %v", vm.TagCluster, attemptedProvider, restoreErr)
+				inconsistent = append(inconsistent, byProvider[attemptedProvider]...)
+			}
+		}
+		if len(inconsistent) > 0 {
+			return errors.WithHintf(err,
+				"the %s label of VMs %s may be set to %s; run `roachprod sync` and retry the rename, "+
+					"or set the label on the remaining VMs of the cluster",
+				vm.TagCluster, strings.Join(inconsistent.Names(), ", "), newName)
+		}
+		return errors.WithHint(err, "the cluster was left unchanged")
+	}
+	l.Printf("Renamed cluster %s to %s", oldName, newName)
+
+	// Update the cache, which removes the entry for the old name.
+	cld, err = cloud.ListCloud(l, vm.ListOptions{})
+	if err != nil {
+		return err
+	}
+	if _, ok := cld.Clusters[newName]; !ok {
+		return errors.Newf("cluster %s not found after rename; run `roachprod sync`", newName)
+	}
+	return syncClustersCache(l, cld)
+}
+
+// SetDNSRecords upserts the given A and SRV records in the GCE DNS zone used
+// for service discovery, e.g. to register a load balancer alias pointing at
+// the cluster's nodes. Record names must be within the cluster's subdomain
+// (<name>.<cluster>.<domain>); existing data for a record name is preserved.
+func SetDNSRecords(
+	ctx context.Context, l *logger.Logger, clusterName string, records []vm.DNSRecord,
+) error {
+	return withClusterDNSProvider(l, clusterName, records, func(p vm.DNSProvider) error {
+		if err := p.CreateRecords(ctx, records...); err != nil {
+			return err
+		}
+		l.Printf("Set %d DNS record(s) for cluster %s", len(records), clusterName)
+		return nil
+	})
+}
+
+// RemoveDNSRecords removes DNS records previously added with SetDNSRecords.
+// The same validation applies to the record names.
+func RemoveDNSRecords(
+	ctx context.Context, l *logger.Logger, clusterName string, records []vm.DNSRecord,
+) error {
+	return withClusterDNSProvider(l, clusterName, records, func(p vm.DNSProvider) error {
+		if err := p.DeleteRecords(ctx, records...); err != nil {
+			return err
+		}
+		l.Printf("Removed %d DNS record(s) for cluster %s", len(records), clusterName)
+		return nil
+	})
+}
+
+// withClusterDNSProvider validates that the records belong to the cluster's
+// subdomain in the GCE DNS provider and invokes the action with the provider.
+func withClusterDNSProvider(
+	l *logger.Logger, clusterName string, records []vm.DNSRecord, action func(vm.DNSProvider) error,
+) error {
+	if err := LoadClusters(); err != nil {
+		return err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return err
+	}
+	if c.IsLocal() {
+		return errors.Newf("DNS records cannot be set for local cluster %s", c.Name)
+	}
+	return vm.ForDNSProvider(gce.ProviderName, func(p vm.DNSProvider) error {
+		suffix := fmt.Sprintf(".%s.%s", c.Name, p.Domain())
+		for _, record := range records {
+			if record.Type != vm.A && record.Type != vm.SRV {
+				return errors.Newf("record %s: unsupported DNS record type %q", record.Name, record.Type)
+			}
+			if name := strings.TrimSuffix(record.Name, "."); !strings.HasSuffix(name, suffix) {
+				return errors.Newf("record %s is not within the subdomain of cluster %s (*%s)",
+					record.Name, c.Name, suffix)
+			}
+		}
+		return action(p)
+	})
+}
+
 // Create TODO
 func Create(
 	ctx context.Context,
@@ -1413,6 +3492,91 @@ func Create(
 	return SetupSSH(ctx, l, clusterName)
 }
 
+// transientCreateErrorMarkers are substrings of the errors returned by the
+// cloud providers' CLIs when provisioning fails for reasons that may resolve
+// on their own: exhausted quotas or capacity, and API rate limits.
+var transientCreateErrorMarkers = []string{
+	// GCE.
+	"QUOTA_EXCEEDED",
+	"ZONE_RESOURCE_POOL_EXHAUSTED",
+	"RESOURCE_EXHAUSTED",
+	"rateLimitExceeded",
+	"Rate Limit Exceeded",
+	// AWS.
+	"InsufficientInstanceCapacity",
+	"RequestLimitExceeded",
+	"VcpuLimitExceeded",
+	"Throttling",
+	// Azure.
+	"AllocationFailed",
+	"OperationNotAllowed",
+	"TooManyRequests",
+}
+
+// IsTransientCreateError returns whether err, returned by Create, is due to a
+// transient provisioning failure (e.g. an exhausted quota or capacity, or a
+// rate limit), in which case creating the cluster again may succeed. Other
+// errors, such as an invalid machine type, are considered permanent.
+func IsTransientCreateError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var alreadyExists *ClusterAlreadyExistsError
+	if errors.As(err, &alreadyExists) {
+		return false
+	}
+	msg := err.Error()
+	for _, marker := range transientCreateErrorMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateWithRetry is like Create, but retries the creation of the cluster,
+// with exponential backoff, up to maxAttempts times if it fails due to a
+// transient provisioning error (see IsTransientCreateError). Create cleans up
+// partially-created clusters before each retry.
+func CreateWithRetry(
+	ctx context.Context,
+	l *logger.Logger,
+	username string,
+	numNodes int,
+	createVMOpts vm.CreateOpts,
+	providerOptsContainer vm.ProviderOptionsContainer,
+	maxAttempts int,
+) error {
+	if maxAttempts <= 0 {
+		return errors.Newf("invalid number of attempts %d", maxAttempts)
+	}
+	opts := retry.Options{
+		InitialBackoff: 30 * time.Second,
+		MaxBackoff:     5 * time.Minute,
+		Multiplier:     2,
+	}
+	var err error
+	for r := retry.StartWithCtx(ctx, opts); r.Next(); {
+		err = Create(ctx, l, username, numNodes, createVMOpts, providerOptsContainer)
+		if err == nil || !IsTransientCreateError(err) {
+			return err
+		}
+		attempt := r.CurrentAttempt() + 1
+		l.Printf("attempt %d of %d to create cluster %s failed with a transient error: %s",
+			attempt, maxAttempts, createVMOpts.ClusterName, err)
+		// NB: MaxRetries of zero means retrying forever, so the number of
+		// attempts is bounded here instead.
+		if attempt >= maxAttempts {
+			break
+		}
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return errors.CombineErrors(err, ctxErr)
+	}
+	return errors.Wrapf(err, "creating cluster %s failed after %d attempts",
+		createVMOpts.ClusterName, maxAttempts)
+}
+
 // GC garbage-collects expired clusters and unused SSH keypairs in AWS.
 func GC(l *logger.Logger, dryrun bool) error {
 	if err := LoadClusters(); err != nil {
@@ -1427,6 +3591,95 @@ func GC(l *logger.Logger, dryrun bool) error {
 	return errors.CombineErrors(err, otherErr)
 }
 
+// ListOrphanedVolumes lists the volumes created by roachprod in the named
+// provider that aren't attached to any VM and don't belong to a live cluster.
+// Such volumes are typically left behind by destroyed clusters. Volumes that
+// are labeled as belonging to a live cluster are never considered orphaned,
+// even if unattached, since they may be about to be attached to one of its
+// VMs. An error is returned if any provider fails to list its VMs, since the
+// volumes of the clusters it didn't list would otherwise appear orphaned.
+func ListOrphanedVolumes(
+	ctx context.Context, l *logger.Logger, provider string,
+) ([]vm.Volume, error) {
+	if err := LoadClusters(); err != nil {
+		return nil, err
+	}
+	cld, err := cloud.ListCloud(l, vm.ListOptions{
+		IncludeEmptyClusters: true,
+		FailOnProviderError:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	liveClusters := make(map[string]struct{}, len(cld.Clusters))
+	for name := range cld.Clusters {
+		liveClusters[vm.SanitizeLabel(name)] = struct{}{}
+	}
+
+	var orphaned []vm.Volume
+	if err := vm.ForProvider(provider, func(p vm.Provider) error {
+		lister, ok := p.(vm.ListUnattachedVolumes)
+		if !ok {
+			return errors.Errorf("provider %s does not support listing unattached volumes", p.Name())
+		}
+		volumes, err := lister.ListUnattachedVolumes(l)
+		if err != nil {
+			return err
+		}
+		for _, v := range volumes {
+			if clusterName, ok := v.Labels[vm.TagCluster]; ok {
+				if _, live := liveClusters[vm.SanitizeLabel(clusterName)]; live {
+					continue
+				}
+			}
+			orphaned = append(orphaned, v)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Slice(orphaned, func(i, j int) bool {
+		return orphaned[i].ProviderResourceID < orphaned[j].ProviderResourceID
+	})
+	return orphaned, nil
+}
+
+// CleanupOrphanedVolumes deletes the volumes returned by ListOrphanedVolumes
+// for the named provider, and returns them. Unless destroy is set, this is a
+// dry run: the volumes are only logged, and not deleted.
+func CleanupOrphanedVolumes(
+	ctx context.Context, l *logger.Logger, provider string, destroy bool,
+) ([]vm.Volume, error) {
+	orphaned, err := ListOrphanedVolumes(ctx, l, provider)
+	if err != nil {
+		return nil, err
+	}
+	if !destroy {
+		for _, v := range orphaned {
+			l.Printf("would delete orphaned volume %s (zone=%s, size=%dGB)", v.ProviderResourceID, v.Zone, v.Size)
+		}
+		return orphaned, nil
+	}
+
+	var deleted []vm.Volume
+	err = vm.ForProvider(provider, func(p vm.Provider) error {
+		var errs error
+		for _, v := range orphaned {
+			if err := ctx.Err(); err != nil {
+				return errors.CombineErrors(errs, err)
+			}
+			if err := p.DeleteVolume(l, v, nil /* vm */); err != nil {
+				errs = errors.CombineErrors(errs, errors.Wrapf(err, "deleting volume %s", v.ProviderResourceID))
+				continue
+			}
+			l.Printf("deleted orphaned volume %s (zone=%s, size=%dGB)", v.ProviderResourceID, v.Zone, v.Size)
+			deleted = append(deleted, v)
+		}
+		return errs
+	})
+	return deleted, err
+}
+
 // LogsOpts TODO
 type LogsOpts struct {
 	Dir, Filter, ProgramFilter string
@@ -1450,6 +3703,104 @@ func Logs(l *logger.Logger, clusterName, dest, username string, logsOpts LogsOpt
 	)
 }
 
+// WaitForLogMessage tails the cockroach log on the given node until a line
+// matching the supplied regular expression is logged, and returns that line.
+// Lines logged before the call are considered as well. An error is returned if
+// no matching line is found before the timeout elapses.
+func WaitForLogMessage(
+	ctx context.Context,
+	l *logger.Logger,
+	clusterName string,
+	node int,
+	pattern string,
+	timeout time.Duration,
+) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid log message pattern %q", pattern)
+	}
+	if err := LoadClusters(); err != nil {
+		return "", err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return "", err
+	}
+	if node < 1 || node > len(c.VMs) {
+		return "", errors.Errorf("invalid node %d for cluster %s with %d nodes", node, clusterName, len(c.VMs))
+	}
+	n := install.Node(node)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	// The matcher cancels the context once it finds a matching line, which
+	// terminates the tail below.
+	m := &logLineMatcher{re: re, onMatch: cancel}
+	logFile := filepath.Join(c.LogDir(n, "" /* tenantName */, 0 /* instance */), "cockroach.log")
+	// NB: -F keeps following the log file across rotations, and -n +1 outputs
+	// the file from the start so that lines logged before the call match too.
+	cmd := fmt.Sprintf("tail -n +1 -F %s", logFile)
+	runErr := c.Run(ctx, l, m, io.Discard, install.Nodes{n}, "waiting for log message", cmd)
+	if line, ok := m.matchedLine(); ok {
+		return line, nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", errors.Errorf(
+			"timed out after %s waiting for a log message matching %q on node %d", timeout, pattern, node)
+	}
+	if runErr != nil {
+		return "", errors.Wrapf(runErr, "failed to tail log on node %d", node)
+	}
+	return "", errors.Errorf("stopped tailing log on node %d before a line matching %q was found", node, pattern)
+}
+
+// logLineMatcher is an io.Writer that splits what is written to it into lines
+// and records the first line matching re, calling onMatch once it does.
+type logLineMatcher struct {
+	re      *regexp.Regexp
+	onMatch func()
+
+	mu struct {
+		syncutil.Mutex
+		partial []byte
+		line    string
+		found   bool
+	}
+}
+
+var _ io.Writer = &logLineMatcher{}
+
+// Write implements the io.Writer interface.
+func (m *logLineMatcher) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.mu.found {
+		return len(p), nil
+	}
+	m.mu.partial = append(m.mu.partial, p...)
+	for {
+		i := bytes.IndexByte(m.mu.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := strings.TrimSuffix(string(m.mu.partial[:i]), "\r")
+		m.mu.partial = m.mu.partial[i+1:]
+		if m.re.MatchString(line) {
+			m.mu.line, m.mu.found = line, true
+			m.mu.partial = nil
+			m.onMatch()
+			break
+		}
+	}
+	return len(p), nil
+}
+
+func (m *logLineMatcher) matchedLine() (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mu.line, m.mu.found
+}
+
 // StageURL TODO
 func StageURL(
 	l *logger.Logger, applicationName, version, stageOS string, stageArch string,
@@ -1612,6 +3963,92 @@ func GrafanaURL(
 	return urls[0], nil
 }
 
+// grafanaAPITimeout is the timeout of each request made to the Grafana HTTP
+// API by ExportGrafana.
+const grafanaAPITimeout = 30 * time.Second
+
+// ExportGrafana exports the JSON model of each dashboard of the Grafana
+// instance launched by StartGrafana to destDir, as <uid>.json, so that the
+// dashboards can be re-imported into another Grafana instance to investigate a
+// test after the cluster is gone. The dashboards are queried through the
+// Grafana HTTP API, which StartGrafana makes accessible anonymously.
+func ExportGrafana(ctx context.Context, l *logger.Logger, clusterName, destDir string) error {
+	grafanaURL, err := GrafanaURL(ctx, l, clusterName, false)
+	if err != nil {
+		return err
+	}
+	httpClient := httputil.NewClientWithTimeout(grafanaAPITimeout)
+	// get issues a GET request to the supplied API path, and returns the
+	// response body.
+	get := func(apiPath string) ([]byte, error) {
+		resp, err := httpClient.Get(ctx, grafanaURL+apiPath)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.Newf("GET %s: %s: %s", apiPath, resp.Status, body)
+		}
+		return body, nil
+	}
+
+	if _, err := get("/api/health"); err != nil {
+		return errors.Wrapf(err,
+			"grafana does not appear to be running on cluster %s; was it started with StartGrafana?",
+			clusterName)
+	}
+	body, err := get("/api/search?type=dash-db")
+	if err != nil {
+		return errors.Wrap(err, "listing grafana dashboards")
+	}
+	var dashboards []struct {
+		UID   string `json:"uid"`
+		Title string `json:"title"`
+	}
+	if err := json.Unmarshal(body, &dashboards); err != nil {
+		return errors.Wrap(err, "decoding grafana dashboards")
+	}
+	if len(dashboards) == 0 {
+		return errors.Newf("no grafana dashboards found on cluster %s", clusterName)
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+	for _, d := range dashboards {
+		body, err := get("/api/dashboards/uid/" + url.PathEscape(d.UID))
+		if err != nil {
+			return errors.Wrapf(err, "exporting grafana dashboard %q", d.Title)
+		}
+		// The response wraps the dashboard's JSON model with metadata that is
+		// specific to this Grafana instance; only the model is exported.
+		var resp struct {
+			Dashboard json.RawMessage `json:"dashboard"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return errors.Wrapf(err, "decoding grafana dashboard %q", d.Title)
+		}
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, resp.Dashboard, "", "  "); err != nil {
+			return errors.Wrapf(err, "decoding grafana dashboard %q", d.Title)
+		}
+		destFile := filepath.Join(destDir, d.UID+".json")
+		if err := os.WriteFile(destFile, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		l.Printf("exported grafana dashboard %q to %s", d.Title, destFile)
+	}
+	return nil
+}
+
+// prometheusSnapshotTimeout is the timeout used by PrometheusSnapshot when the
+// caller does not supply a deadline.
+const prometheusSnapshotTimeout = 5 * time.Minute
+
 // PrometheusSnapshot takes a snapshot of prometheus and stores the snapshot and
 // a script to spin up a docker instance for it to the given directory. We
 // assume the last node contains the prometheus server.
@@ -1632,8 +4069,13 @@ func PrometheusSnapshot(
 
 	promNode := install.Nodes{nodes[len(nodes)-1]}
 
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
-	defer cancel()
+	// Bound the snapshot by a default timeout, unless the caller supplied a
+	// deadline of its own.
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, prometheusSnapshotTimeout)
+		defer cancel()
+	}
 	if err := prometheus.Snapshot(ctx, c, l, promNode, dumpDir); err != nil {
 		l.Printf("failed to get prometheus snapshot: %v", err)
 		return err
@@ -1641,6 +4083,68 @@ func PrometheusSnapshot(
 	return nil
 }
 
+// nodeVersions returns the version of the cockroach binary on each of the
+// cluster's nodes, keyed by 1-indexed node ID, as reported by Status. The
+// version is empty for nodes on which it could not be determined.
+func nodeVersions(
+	ctx context.Context, l *logger.Logger, c *install.SyncedCluster,
+) (map[int]string, error) {
+	nodesStatus, err := c.Status(ctx, l)
+	if err != nil {
+		return nil, err
+	}
+	versions := make(map[int]string, len(nodesStatus))
+	for _, status := range nodesStatus {
+		versions[status.NodeID] = strings.TrimPrefix(status.Version, "cockroach-")
+	}
+	return versions, nil
+}
+
+// ClusterVersions returns the version of the cockroach binary on each of the
+// nodes in the named cluster, keyed by node ID. The version is empty for nodes
+// on which it could not be determined, e.g. because no binary was staged.
+func ClusterVersions(
+	ctx context.Context, l *logger.Logger, clusterName string,
+) (map[int]string, error) {
+	if err := LoadClusters(); err != nil {
+		return nil, err
+	}
+	c, err := newCluster(l, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	return nodeVersions(ctx, l, c)
+}
+
+// AssertUniformVersion returns an error if the nodes in the named cluster are
+// not all running the same version of the cockroach binary, listing the nodes
+// on each version. It is typically used to verify that a rolling upgrade
+// completed.
+func AssertUniformVersion(ctx context.Context, l *logger.Logger, clusterName string) error {
+	versions, err := ClusterVersions(ctx, l, clusterName)
+	if err != nil {
+		return err
+	}
+	nodesByVersion := make(map[string][]int)
+	for node, version := range versions {
+		if version == "" {
+			version = "unknown"
+		}
+		nodesByVersion[version] = append(nodesByVersion[version], node)
+	}
+	if len(nodesByVersion) <= 1 {
+		return nil
+	}
+	mismatches := make([]string, 0, len(nodesByVersion))
+	for version, nodes := range nodesByVersion {
+		sort.Ints(nodes)
+		mismatches = append(mismatches, fmt.Sprintf("%s on nodes %v", version, nodes))
+	}
+	sort.Strings(mismatches)
+	return errors.Newf("cluster %s is running mixed versions: %s",
+		clusterName, strings.Join(mismatches, "; "))
+}
+
 // SnapshotTTL controls how long volume snapshots are kept around.
 const SnapshotTTL = 30 * 24 * time.Hour // 30 days
 
@@ -1659,18 +4163,11 @@ func CreateSnapshot(
 	}
 
 	nodes := c.TargetNodes()
-	nodesStatus, err := c.Status(ctx, l)
-
+	versions, err := nodeVersions(ctx, l, c)
 	if err != nil {
 		return nil, err
 	}
 
-	// 1-indexed node IDs.
-	statusByNodeID := make(map[int]install.NodeStatus)
-	for _, status := range nodesStatus {
-		statusByNodeID[status.NodeID] = status
-	}
-
 	// TODO(irfansharif): Add validation that we're using some released version,
 	// probably the predecessor one. Also ensure that any running CRDB processes
 	// have been stopped since we're taking raw disk snapshots cluster-wide.
@@ -1683,11 +4180,10 @@ func CreateSnapshot(
 		res := &install.RunResultDetails{Node: node}
 
 		cVM := c.VMs[node-1]
-		crdbVersion := statusByNodeID[int(node)].Version
+		crdbVersion := versions[int(node)]
 		if crdbVersion == "" {
 			crdbVersion = "unknown"
 		}
-		crdbVersion = strings.TrimPrefix(crdbVersion, "cockroach-")
 		// N.B. snapshot name cannot exceed 63 characters, so we use short sha for dev version.
 		if index := strings.Index(crdbVersion, "dev-"); index != -1 {
 			sha := crdbVersion[index+4:]
@@ -1711,6 +4207,9 @@ func CreateSnapshot(
 		}
 
 		if err := vm.ForProvider(cVM.Provider, func(provider vm.Provider) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			volumes, err := provider.ListVolumes(l, &cVM)
 			if err != nil {
 				return err
@@ -1721,6 +4220,11 @@ func CreateSnapshot(
 			}
 
 			for _, volume := range volumes {
+				// The provider APIs don't accept a context, so check for
+				// cancellation between each (potentially slow) call.
+				if err := ctx.Err(); err != nil {
+					return err
+				}
 				snapshotFingerprintInfix := strings.ReplaceAll(
 					fmt.Sprintf("%s-n%d", crdbVersion, len(nodes)), ".", "-")
 				snapshotName := fmt.Sprintf("%s-%s-%04d", vsco.Name, snapshotFingerprintInfix, node)
@@ -1797,7 +4301,14 @@ func ApplySnapshots(
 		// TODO(irfansharif): Validate labels (version, instance types).
 	}
 
-	// Detach and delete existing volumes. This is destructive.
+	// Detach and delete existing volumes. This is destructive, so bail out if
+	// we've been cancelled before starting. Once started, the volumes are
+	// deleted and replaced using a fresh context, so that a cancellation
+	// doesn't leave the nodes without any volumes attached.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ctx = context.Background()
 	if err := c.Parallel(ctx, l, c.TargetNodes(), func(ctx context.Context, node install.Node) (*install.RunResultDetails, error) {
 		res := &install.RunResultDetails{Node: node}
 
@@ -1899,6 +4410,17 @@ func genMountCommands(devicePath, mountDir string) string {
 	}, " && ")
 }
 
+// genRAMDiskMountCommands returns the commands that mount a RAM disk, unless
+// something is already mounted at mountDir, e.g. by an earlier Start. This
+// keeps the contents of the RAM disk across restarts of cockroach.
+func genRAMDiskMountCommands(sizeGB int, mountDir string) string {
+	return fmt.Sprintf("mountpoint -q %s || (%s)", mountDir, strings.Join([]string{
+		"sudo mkdir -p " + mountDir,
+		fmt.Sprintf("sudo mount -t tmpfs -o size=%dg tmpfs %s", sizeGB, mountDir),
+		"sudo chmod 0777 " + mountDir,
+	}, " && "))
+}
+
 func isWorkloadCollectorVolume(v vm.Volume) bool {
 	if v, ok := v.Labels["roachprod_collector"]; ok && v == "true" {
 		return true
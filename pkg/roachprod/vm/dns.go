@@ -49,6 +49,9 @@ type DNSRecord struct {
 // management services.
 type DNSProvider interface {
 	CreateRecords(ctx context.Context, records ...DNSRecord) error
+	// DeleteRecords removes the given records. Records sharing a name and type
+	// with other data are preserved.
+	DeleteRecords(ctx context.Context, records ...DNSRecord) error
 	LookupSRVRecords(ctx context.Context, service, proto, subdomain string) ([]DNSRecord, error)
 	DeleteRecordsBySubdomain(subdomain string) error
 	Domain() string
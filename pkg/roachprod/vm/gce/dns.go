@@ -62,10 +62,7 @@ func (n dnsProvider) CreateRecords(ctx context.Context, records ...vm.DNSRecord)
 	}
 
 	for name, recordGroup := range recordsByName {
-		// No need to break the name down into components as the lookup command
-		// accepts a fully qualified name as the last parameter if the service and
-		// proto parameters are empty strings.
-		existingRecords, err := n.lookupSRVRecords(ctx, "", "", name)
+		existingRecords, err := n.lookupRecords(ctx, recordGroup[0].Type, name)
 		if err != nil {
 			return err
 		}
@@ -107,6 +104,59 @@ func (n dnsProvider) CreateRecords(ctx context.Context, records ...vm.DNSRecord)
 	return n.waitForRecordsAvailable(ctx, records...)
 }
 
+// DeleteRecords implements the vm.DNSProvider interface.
+func (n dnsProvider) DeleteRecords(ctx context.Context, records ...vm.DNSRecord) error {
+	type recordSetKey struct {
+		name    string
+		dnsType vm.DNSType
+	}
+	recordsBySet := make(map[recordSetKey][]vm.DNSRecord)
+	for _, record := range records {
+		key := recordSetKey{name: record.Name, dnsType: record.Type}
+		recordsBySet[key] = append(recordsBySet[key], record)
+	}
+
+	for key, recordGroup := range recordsBySet {
+		existingRecords, err := n.lookupRecords(ctx, key.dnsType, key.name)
+		if err != nil {
+			return err
+		}
+		if len(existingRecords) == 0 {
+			continue
+		}
+		dataSet := make(map[string]struct{})
+		for _, record := range existingRecords {
+			dataSet[record.Data] = struct{}{}
+		}
+		for _, record := range recordGroup {
+			delete(dataSet, record.Data)
+		}
+
+		// A record set can't be empty, so it is deleted outright if none of its
+		// data remains; otherwise it is updated with the remaining data.
+		args := []string{"--project", dnsProject, "dns", "record-sets", "delete", key.name,
+			"--type", string(key.dnsType),
+			"--zone", dnsManagedZone,
+		}
+		if len(dataSet) > 0 {
+			data := maps.Keys(dataSet)
+			sort.Strings(data)
+			args = []string{"--project", dnsProject, "dns", "record-sets", "update", key.name,
+				"--type", string(key.dnsType),
+				"--ttl", strconv.Itoa(recordGroup[0].TTL),
+				"--zone", dnsManagedZone,
+				"--rrdatas", strings.Join(data, ","),
+			}
+		}
+		cmd := exec.Command("gcloud", args...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return errors.Wrapf(err, "output: %s", out)
+		}
+	}
+	return nil
+}
+
 // LookupSRVRecords implements the vm.DNSProvider interface.
 func (n dnsProvider) LookupSRVRecords(
 	ctx context.Context, service, proto, subdomain string,
@@ -151,6 +201,46 @@ func (n dnsProvider) Domain() string {
 	return dnsDomain
 }
 
+// lookupRecords looks up the records of the given type with the given fully
+// qualified name. Only A and SRV records are supported.
+func (n dnsProvider) lookupRecords(
+	ctx context.Context, dnsType vm.DNSType, name string,
+) ([]vm.DNSRecord, error) {
+	switch dnsType {
+	case vm.SRV:
+		// No need to break the name down into components as the lookup command
+		// accepts a fully qualified name as the last parameter if the service and
+		// proto parameters are empty strings.
+		return n.lookupSRVRecords(ctx, "", "", name)
+	case vm.A:
+		return n.lookupARecords(ctx, name)
+	default:
+		return nil, errors.Errorf("unsupported DNS record type: %s", dnsType)
+	}
+}
+
+// lookupARecords uses standard net tools to look up the A records with the
+// given name.
+func (n dnsProvider) lookupARecords(ctx context.Context, name string) ([]vm.DNSRecord, error) {
+	addrs, err := n.resolver.LookupIPAddr(ctx, name)
+	if dnsError := (*net.DNSError)(nil); errors.As(err, &dnsError) {
+		// See lookupSRVRecords for why these errors are ignored.
+		if dnsError.Err != "server misbehaving" && dnsError.Err != "no such host" && !dnsError.IsNotFound {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	records := make([]vm.DNSRecord, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr.IP.To4() == nil {
+			continue
+		}
+		records = append(records, vm.CreateDNSRecord(name, vm.A, addr.IP.String(), vm.DNSRecordTTL))
+	}
+	return records, nil
+}
+
 // lookupSRVRecords uses standard net tools to perform a DNS lookup. For
 // lookups, we prefer this to using the gcloud command as it is faster, and
 // preferable when service information is being queried regularly.
@@ -223,8 +313,9 @@ func (n dnsProvider) listSRVRecords(filter string, limit int) ([]vm.DNSRecord, e
 // DNS server through a standard net tools lookup.
 func (n dnsProvider) waitForRecordsAvailable(ctx context.Context, records ...vm.DNSRecord) error {
 	type recordKey struct {
-		name string
-		data string
+		name    string
+		dnsType vm.DNSType
+		data    string
 	}
 	trimName := func(name string) string {
 		return strings.TrimSuffix(name, ".")
@@ -232,8 +323,9 @@ func (n dnsProvider) waitForRecordsAvailable(ctx context.Context, records ...vm.
 	notAvailable := make(map[recordKey]struct{})
 	for _, record := range records {
 		notAvailable[recordKey{
-			name: trimName(record.Name),
-			data: record.Data,
+			name:    trimName(record.Name),
+			dnsType: record.Type,
+			data:    record.Data,
 		}] = struct{}{}
 	}
 
@@ -242,14 +334,15 @@ func (n dnsProvider) waitForRecordsAvailable(ctx context.Context, records ...vm.
 		Multiplier:     1,
 	}, 20, func() error {
 		for key := range notAvailable {
-			foundRecords, err := n.lookupSRVRecords(ctx, "", "", key.name)
+			foundRecords, err := n.lookupRecords(ctx, key.dnsType, key.name)
 			if err != nil {
 				return err
 			}
 			for _, foundRecord := range foundRecords {
 				delete(notAvailable, recordKey{
-					name: trimName(foundRecord.Name),
-					data: foundRecord.Data,
+					name:    trimName(foundRecord.Name),
+					dnsType: foundRecord.Type,
+					data:    foundRecord.Data,
 				})
 			}
 		}
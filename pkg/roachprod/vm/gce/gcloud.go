@@ -541,7 +541,7 @@ func (p *Provider) CreateVolume(
 }
 
 func (p *Provider) DeleteVolume(l *logger.Logger, volume vm.Volume, vm *vm.VM) error {
-	{ // Detach disks.
+	if vm != nil { // Detach disks.
 		args := []string{
 			"compute",
 			"--project", p.GetProject(),
@@ -647,6 +647,43 @@ func (p *Provider) ListVolumes(l *logger.Logger, v *vm.VM) ([]vm.Volume, error)
 	return volumes, nil
 }
 
+// ListUnattachedVolumes implements the vm.ListUnattachedVolumes interface.
+func (p *Provider) ListUnattachedVolumes(l *logger.Logger) ([]vm.Volume, error) {
+	// We're running the equivalent of
+	// 		gcloud compute disks list --project cockroach-ephemeral \
+	//			--filter "labels.roachprod=true AND -users:*" --format json
+	var describedVolumes []describeVolumeCommandResponse
+	args := []string{
+		"compute",
+		"disks",
+		"list",
+		"--project", p.GetProject(),
+		"--filter", fmt.Sprintf("labels.%s=true AND -users:*", vm.TagRoachprod),
+		"--format", "json",
+	}
+	if err := runJSONCommand(args, &describedVolumes); err != nil {
+		return nil, err
+	}
+
+	volumes := make([]vm.Volume, 0, len(describedVolumes))
+	for _, describedVolume := range describedVolumes {
+		size, err := strconv.Atoi(describedVolume.SizeGB)
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, vm.Volume{
+			ProviderResourceID: describedVolume.Name,
+			ProviderVolumeType: lastComponent(describedVolume.Type),
+			Zone:               lastComponent(describedVolume.Zone),
+			Encrypted:          false, // only used for aws
+			Name:               describedVolume.Name,
+			Labels:             describedVolume.Labels,
+			Size:               size,
+		})
+	}
+	return volumes, nil
+}
+
 type instanceDisksResponse struct {
 	// Disks that are attached to the instance.
 	// N.B. Unattached disks can be enumerated via,
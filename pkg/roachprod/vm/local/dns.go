@@ -63,6 +63,24 @@ func (n *dnsProvider) CreateRecords(_ context.Context, records ...vm.DNSRecord)
 	return n.saveRecords(entries)
 }
 
+// DeleteRecords is part of the vm.DNSProvider interface.
+func (n *dnsProvider) DeleteRecords(_ context.Context, records ...vm.DNSRecord) error {
+	unlock, err := lock.AcquireFilesystemLock(n.lockFilePath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := n.loadRecords()
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		delete(entries, dnsKey(record))
+	}
+	return n.saveRecords(entries)
+}
+
 // LookupSRVRecords is part of the vm.DNSProvider interface.
 func (n *dnsProvider) LookupSRVRecords(
 	_ context.Context, service, proto, subdomain string,
@@ -186,6 +186,10 @@ func (vm *VM) AttachVolume(l *logger.Logger, v Volume) (deviceName string, _ err
 const vmNameFormat = "user-<clusterid>-<nodeid>"
 
 // ClusterName returns the cluster name a VM belongs to.
+//
+// The cluster name is derived from the VM name, unless the VM's TagCluster
+// label holds a different name. VMs cannot be renamed, so renaming a cluster
+// only updates this label.
 func (vm *VM) ClusterName() (string, error) {
 	if vm.IsLocal() {
 		return vm.LocalClusterName, nil
@@ -195,7 +199,14 @@ func (vm *VM) ClusterName() (string, error) {
 	if len(parts) < 3 {
 		return "", fmt.Errorf("expected VM name in the form %s, got %s", vmNameFormat, name)
 	}
-	return strings.Join(parts[:len(parts)-1], "-"), nil
+	clusterName := strings.Join(parts[:len(parts)-1], "-")
+	// The label is sanitized when it is set, so compare against the sanitized
+	// name to avoid treating every cluster with a non-conforming name as
+	// renamed.
+	if label, ok := vm.Labels[TagCluster]; ok && label != "" && label != SanitizeLabel(clusterName) {
+		return label, nil
+	}
+	return clusterName, nil
 }
 
 // UserName returns the username of a VM.
@@ -390,6 +401,10 @@ type ListOptions struct {
 	IncludeVolumes       bool
 	IncludeEmptyClusters bool
 	ComputeEstimatedCost bool
+	// FailOnProviderError makes cloud.ListCloud return an error if any provider
+	// fails to list its VMs, rather than returning the (possibly incomplete)
+	// list of the others.
+	FailOnProviderError bool
 }
 
 // A Provider is a source of virtual machines running on some hosting platform.
@@ -431,7 +446,8 @@ type Provider interface {
 	CreateVolume(l *logger.Logger, vco VolumeCreateOpts) (Volume, error)
 	// ListVolumes lists all volumes already attached to the given VM.
 	ListVolumes(l *logger.Logger, vm *VM) ([]Volume, error)
-	// DeleteVolume detaches and deletes the given volume from the given VM.
+	// DeleteVolume detaches and deletes the given volume from the given VM. The
+	// VM may be nil if the volume isn't attached to any VM.
 	DeleteVolume(l *logger.Logger, volume Volume, vm *VM) error
 	// AttachVolume attaches the given volume to the given VM.
 	AttachVolume(l *logger.Logger, volume Volume, vm *VM) (string, error)
@@ -445,6 +461,12 @@ type Provider interface {
 	DeleteVolumeSnapshots(l *logger.Logger, snapshot ...VolumeSnapshot) error
 }
 
+// ListUnattachedVolumes is an optional capability for a Provider which can
+// list the volumes created by roachprod that aren't attached to any VM.
+type ListUnattachedVolumes interface {
+	ListUnattachedVolumes(l *logger.Logger) ([]Volume, error)
+}
+
 // DeleteCluster is an optional capability for a Provider which can
 // destroy an entire cluster in a single operation.
 type DeleteCluster interface {
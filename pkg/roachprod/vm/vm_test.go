@@ -156,3 +156,26 @@ func TestSanitizeLabel(t *testing.T) {
 		})
 	}
 }
+
+func TestClusterName(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		labels   map[string]string
+		expected string
+	}{
+		{name: "user-foo-0001", expected: "user-foo"},
+		{name: "user-foo-bar-0001", expected: "user-foo-bar"},
+		{name: "user-foo-0001", labels: map[string]string{TagCluster: "user-foo"}, expected: "user-foo"},
+		// The label is sanitized, so it doesn't indicate a rename.
+		{name: "user-Foo-0001", labels: map[string]string{TagCluster: "user-foo"}, expected: "user-Foo"},
+		// The cluster was renamed.
+		{name: "user-foo-0001", labels: map[string]string{TagCluster: "user-bar"}, expected: "user-bar"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			v := VM{Name: c.name, Labels: c.labels}
+			clusterName, err := v.ClusterName()
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, clusterName)
+		})
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package roachprod
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/roachprod/install"
+	"github.com/cockroachdb/cockroach/pkg/roachprod/logger"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/errors"
+)
+
+// defaultWorkloadPrometheusPort is the port on which `workload run` exposes
+// Prometheus metrics by default. StartGrafana scrapes this port on all nodes.
+const defaultWorkloadPrometheusPort = 2112
+
+// workloadProfileRampUp is how long ProfileDuringWorkload lets the workload
+// run before profiling starts, so that the profiles capture the steady state
+// rather than the workload connecting to the cluster.
+const workloadProfileRampUp = 10 * time.Second
+
+// WorkloadSpec describes a workload started by StartWorkload.
+type WorkloadSpec struct {
+	// Name is the workload generator to run, e.g. "kv" or "tpcc".
+	Name string
+	// Binary is the path, on the workload nodes, of the binary to run. A binary
+	// named "workload", as staged by `roachprod stage <cluster> workload`, is
+	// invoked directly; any other binary is invoked as `<binary> workload`.
+	// Defaults to ./cockroach.
+	Binary string
+	// TargetNodes selects the nodes of the cluster that the workload connects
+	// to, e.g. "1-3". Defaults to all nodes.
+	TargetNodes string
+	// Init, if set, runs `workload init` to completion on the first workload
+	// node before the workload is started.
+	Init bool
+	// InitArgs are passed to `workload init`.
+	InitArgs []string
+	// RunArgs are passed to `workload run`.
+	RunArgs []string
+	// PrometheusPort is the port on which the workload exposes Prometheus
+	// metrics. Defaults to the port StartGrafana scrapes on every node; other
+	// ports must be added to the Prometheus config passed to StartGrafana.
+	PrometheusPort int
+	// Secure is set if the cluster is running in secure mode.
+	Secure bool
+}
+
+// WorkloadHandle is a handle to a workload started by StartWorkload.
+type WorkloadHandle struct {
+	c        *install.SyncedCluster
+	nodes    install.Nodes
+	filename string
+}
+
+// StartWorkload runs the workload described by spec in the background on the
+// nodes selected in clusterName (e.g. "mycluster:4"). The workload binary must
+// have been staged on those nodes beforehand. The returned handle is used to
+// stop the workload and collect its output.
+func StartWorkload(
+	ctx context.Context, l *logger.Logger, clusterName string, spec WorkloadSpec,
+) (*WorkloadHandle, error) {
+	if spec.Name == "" {
+		return nil, errors.New("workload name must be specified")
+	}
+	if err := LoadClusters(); err != nil {
+		return nil, err
+	}
+	c, err := newCluster(l, clusterName, install.SecureOption(spec.Secure))
+	if err != nil {
+		return nil, err
+	}
+	if spec.Binary == "" {
+		spec.Binary = "./cockroach"
+	}
+	if spec.TargetNodes == "" {
+		spec.TargetNodes = "all"
+	}
+	if spec.PrometheusPort == 0 {
+		spec.PrometheusPort = defaultWorkloadPrometheusPort
+	}
+	if c.IsLocal() && len(c.Nodes) > 1 {
+		// Local nodes share a host, so their Prometheus ports would collide.
+		return nil, errors.Newf("workload can only be started on a single node of local cluster %s", c.Name)
+	}
+
+	// The certs dir is only node specific on local clusters, which run the
+	// workload on a single node.
+	urls, err := PgURL(ctx, l, c.Name+":"+spec.TargetNodes, c.CertsDir(c.Nodes[0]), PGURLOptions{
+		Secure: spec.Secure,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pgURLs := strings.Join(urls, " ")
+	workloadCmd := spec.Binary
+	if filepath.Base(spec.Binary) != "workload" {
+		workloadCmd += " workload"
+	}
+
+	if spec.Init {
+		initNode := c.Nodes[0]
+		cmd := fmt.Sprintf("%s init %s %s %s",
+			workloadCmd, spec.Name, strings.Join(spec.InitArgs, " "), pgURLs)
+		l.Printf("initializing workload %s on node %d", spec.Name, initNode)
+		if err := c.Run(ctx, l, l.Stdout, l.Stderr, install.Nodes{initNode},
+			fmt.Sprintf("workload init %s", spec.Name), cmd); err != nil {
+			return nil, errors.Wrapf(err, "initializing workload %s", spec.Name)
+		}
+	}
+
+	h := &WorkloadHandle{
+		c:        c,
+		nodes:    c.Nodes,
+		filename: fmt.Sprintf("workload-%s", spec.Name),
+	}
+	runCmd := fmt.Sprintf("%s run %s --prometheus-port=%d %s %s",
+		workloadCmd, spec.Name, spec.PrometheusPort, strings.Join(spec.RunArgs, " "), pgURLs)
+	// The workload is detached from the session, recording its pid so that it
+	// can be stopped later.
+	cmd := fmt.Sprintf("nohup %s > %s.log 2>&1 < /dev/null & echo $! > %s.pid",
+		runCmd, h.filename, h.filename)
+	if err := c.Run(ctx, l, l.Stdout, l.Stderr, c.Nodes,
+		fmt.Sprintf("workload run %s", spec.Name), cmd); err != nil {
+		return nil, errors.Wrapf(err, "starting workload %s", spec.Name)
+	}
+	return h, nil
+}
+
+// Stop stops the workload on all the nodes it was started on and waits for it
+// to exit. Stopping a workload that has already exited is a no-op.
+func (h *WorkloadHandle) Stop(ctx context.Context, l *logger.Logger) error {
+	cmd := fmt.Sprintf(`if [ -f %[1]s.pid ]; then
+  pid=$(cat %[1]s.pid)
+  kill -TERM $pid 2>/dev/null
+  while kill -0 $pid 2>/dev/null; do sleep 1; done
+  rm -f %[1]s.pid
+fi`, h.filename)
+	return h.c.Run(ctx, l, l.Stdout, l.Stderr, h.nodes, "stopping workload", cmd)
+}
+
+// Output returns the combined stdout and stderr of the workload on each of
+// the nodes it was started on.
+func (h *WorkloadHandle) Output(
+	ctx context.Context, l *logger.Logger,
+) (map[install.Node]string, error) {
+	results, err := h.c.RunWithDetails(ctx, l, h.nodes, "collecting workload output",
+		fmt.Sprintf("cat %s.log", h.filename))
+	if err != nil {
+		return nil, err
+	}
+	output := make(map[install.Node]string, len(results))
+	for _, res := range results {
+		if res.Err != nil {
+			return nil, errors.Wrapf(res.Err, "collecting workload output on node %d", res.Node)
+		}
+		output[res.Node] = res.Stdout
+	}
+	return output, nil
+}
+
+// ProfileDuringWorkload starts the workload described by spec on the nodes
+// selected in clusterName (see StartWorkload), captures a CPU profile of
+// profileDuration on each of the nodes the workload connects to, and then
+// stops the workload. Profiling only starts once the workload has ramped up,
+// and the workload is only stopped once profiling has finished, so that the
+// profiles cover the workload's activity. The profiles and the workload's
+// output on each node are written to destDir.
+func ProfileDuringWorkload(
+	ctx context.Context,
+	l *logger.Logger,
+	clusterName string,
+	spec WorkloadSpec,
+	profileDuration time.Duration,
+	destDir string,
+) (retErr error) {
+	if profileDuration <= 0 {
+		return errors.Newf("profile duration must be positive, got %s", profileDuration)
+	}
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+	h, err := StartWorkload(ctx, l, clusterName, spec)
+	if err != nil {
+		return err
+	}
+	stopped := false
+	defer func() {
+		if stopped {
+			return
+		}
+		if err := h.Stop(ctx, l); err != nil {
+			retErr = errors.CombineErrors(retErr, errors.Wrap(err, "stopping workload"))
+		}
+	}()
+
+	l.Printf("waiting %s for workload %s to ramp up", workloadProfileRampUp, spec.Name)
+	select {
+	case <-time.After(workloadProfileRampUp):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	targetNodes := spec.TargetNodes
+	if targetNodes == "" {
+		targetNodes = "all"
+	}
+	start := timeutil.Now()
+	if err := Pprof(ctx, l, h.c.Name+":"+targetNodes, PprofOpts{
+		Duration: profileDuration,
+		Dir:      destDir,
+	}); err != nil {
+		return errors.Wrapf(err, "profiling during workload %s", spec.Name)
+	}
+	l.Printf("profiled nodes %s from %s to %s while running workload %s",
+		targetNodes, start.Format(time.RFC3339), timeutil.Now().Format(time.RFC3339), spec.Name)
+
+	stopped = true
+	if err := h.Stop(ctx, l); err != nil {
+		return errors.Wrap(err, "stopping workload")
+	}
+	output, err := h.Output(ctx, l)
+	if err != nil {
+		return err
+	}
+	for node, out := range output {
+		dest := filepath.Join(destDir, fmt.Sprintf("%s-n%d.log", h.filename, node))
+		if err := os.WriteFile(dest, []byte(out), 0644); err != nil {
+			return err
+		}
+		l.Printf("Created %s", dest)
+	}
+	return nil
+}
@@ -1090,10 +1090,12 @@ func (n *Node) GetPebbleMetrics() []admission.StoreMetrics {
 			diskStats = s
 		}
 		metrics = append(metrics, admission.StoreMetrics{
-			StoreID:         store.StoreID(),
-			Metrics:         m.Metrics,
-			WriteStallCount: m.WriteStallCount,
-			DiskStats:       diskStats})
+			StoreID:               store.StoreID(),
+			Metrics:               m.Metrics,
+			WriteStallCount:       m.WriteStallCount,
+			DiskStats:             diskStats,
+			IOLoadListenerMetrics: store.Metrics().IOLoadListenerMetrics,
+		})
 		return nil
 	})
 	return metrics
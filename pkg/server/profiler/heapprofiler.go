@@ -16,17 +16,31 @@ import (
 	"runtime/pprof"
 
 	"github.com/cockroachdb/cockroach/pkg/server/dumpstore"
+	"github.com/cockroachdb/cockroach/pkg/server/status"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/errors"
 )
 
+var heapUsageThreshold = settings.RegisterFloatSetting(
+	settings.TenantWritable,
+	"server.mem_profile.heap_usage_threshold",
+	"fraction of the system memory that the Go heap must exceed for a heap "+
+		"profile to be taken; if 0, a profile is taken whenever the heap "+
+		"exceeds its high water mark",
+	0,
+	settings.Fraction,
+)
+
 // HeapProfiler is used to take Go heap profiles.
 //
 // MaybeTakeProfile() is supposed to be called periodically. A profile is taken
 // every time Go heap allocated bytes exceeds the previous high-water mark. The
 // recorded high-water mark is also reset periodically, so that we take some
-// profiles periodically.
+// profiles periodically. If server.mem_profile.heap_usage_threshold is set, the
+// high-water mark is never reset below that fraction of the system memory, so
+// that profiles are only taken when memory usage is high.
 // Profiles are also GCed periodically. The latest is always kept, and a couple
 // of the ones with the largest heap are also kept.
 type HeapProfiler struct {
@@ -48,10 +62,16 @@ func NewHeapProfiler(ctx context.Context, dir string, st *cluster.Settings) (*He
 
 	dumpStore := dumpstore.NewStore(dir, maxCombinedFileSize, st)
 
+	// If the system memory can't be determined, heapUsageThreshold has no
+	// effect.
+	totalMem, _, err := status.GetTotalMemoryWithoutLogging()
+	if err != nil {
+		totalMem = 0
+	}
 	hp := &HeapProfiler{
 		profiler: makeProfiler(
 			newProfileStore(dumpStore, HeapFileNamePrefix, HeapFileNameSuffix, st),
-			zeroFloor,
+			func() int64 { return int64(heapUsageThreshold.Get(&st.SV) * float64(totalMem)) },
 			envMemprofInterval,
 		),
 	}
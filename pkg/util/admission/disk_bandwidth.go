@@ -220,8 +220,13 @@ type intervalLSMInfo struct {
 	// cost of writing a sstable, even though that is done outside Pebble, so
 	// ingestion is similar in cost to flushing. Ingested bytes don't cause WAL
 	// writes, but we ignore that difference for simplicity, and just work with
-	// the sum of flushed and ingested bytes.
+	// the sum of flushed and ingested bytes. Note that this includes the bytes
+	// ingested into all levels, and not just L0.
 	incomingBytes int64
+	// ingestedBytes is the subset of incomingBytes that was ingested, into any
+	// level. Bytes ingested into the levels below L0 don't contribute to the L0
+	// tokens.
+	ingestedBytes int64
 	// regularTokensUsed and elasticTokensUsed are the byte tokens used for
 	// regular and elastic work respectively. Each of these includes both
 	// writes that will get flushed and ingested bytes. The
@@ -663,6 +663,8 @@ type StoreMetrics struct {
 	WriteStallCount int64
 	// Optional.
 	DiskStats DiskStats
+	// Optional. The store's metrics maintained by the ioLoadListener.
+	IOLoadListenerMetrics *IOLoadListenerMetrics
 }
 
 // DiskStats provide low-level stats about the disk resources used for a
@@ -781,6 +783,30 @@ var (
 		Measurement: "Tokens",
 		Unit:        metric.Unit_COUNT,
 	}
+	ioAdmissionRate = metric.Metadata{
+		Name:        "admission.io.admission_rate.kv",
+		Help:        "Effective rate at which write bytes of regular work are admitted by IO admission control in the current adjustment interval (-1 if unlimited)",
+		Measurement: "Bytes/Sec",
+		Unit:        metric.Unit_BYTES,
+	}
+	elasticIOAdmissionRate = metric.Metadata{
+		Name:        "admission.io.elastic_admission_rate.kv",
+		Help:        "Effective rate at which write bytes of elastic work are admitted by IO admission control in the current adjustment interval (-1 if unlimited)",
+		Measurement: "Bytes/Sec",
+		Unit:        metric.Unit_BYTES,
+	}
+	ioIngestBandwidth = metric.Metadata{
+		Name:        "admission.io.ingest_bandwidth.kv",
+		Help:        "Rate at which sstables were ingested into the LSM, across all levels, in the last IO admission control adjustment interval",
+		Measurement: "Bytes/Sec",
+		Unit:        metric.Unit_BYTES,
+	}
+	ioByteTokenGrantCV = metric.Metadata{
+		Name:        "admission.io.byte_token_grant_cv.kv",
+		Help:        "Coefficient of variation of the IO byte tokens granted to work per tick in the last IO admission control adjustment interval (0 if unlimited); values well above 0 indicate bursty token grants",
+		Measurement: "Coefficient of Variation",
+		Unit:        metric.Unit_COUNT,
+	}
 )
 
 // TODO(irfansharif): we are lacking metrics for IO tokens and load, including
@@ -12,6 +12,7 @@ package admission
 
 import (
 	"context"
+	"encoding/json"
 	"math"
 	"time"
 
@@ -109,6 +110,34 @@ var L0MinimumSizePerSubLevel = settings.RegisterIntSetting(
 	"when non-zero, this indicates the minimum size that is needed to count towards one sub-level",
 	5<<20, settings.NonNegativeInt)
 
+// StructuredTokenLoggingEnabled controls whether the ioLoadListener logs, at
+// every adjustment interval, a structured (JSON) record of the inputs and
+// outputs of its token computation. Unlike the free-form "IO overload" log
+// lines, which are only emitted when the store is overloaded, these records
+// are emitted for every interval, and are meant for offline analysis of
+// admission control decisions.
+var StructuredTokenLoggingEnabled = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"admission.io.structured_token_logging.enabled",
+	"when true, a structured record of the inputs and outputs of the IO token computation "+
+		"is logged for every store at every adjustment interval",
+	false)
+
+// ByteTokensOverrideForTesting, when non-zero, pins the number of byte tokens
+// handed out by the ioLoadListener in each adjustment interval to the given
+// value, regardless of the store's health, so that a specific finite admission
+// rate can be induced deterministically when validating the behavior of the
+// system under throttling. Elastic byte tokens are capped at the same value.
+//
+// FOR TESTING ONLY: this setting disables overload protection for the store
+// and must not be used in production.
+var ByteTokensOverrideForTesting = settings.RegisterIntSetting(
+	settings.SystemOnly,
+	"admission.io.testing.byte_tokens_override",
+	"FOR TESTING ONLY, NOT FOR PRODUCTION USE: when non-zero, the number of IO byte tokens "+
+		"given out per store every 15s, overriding the tokens computed from the store's health",
+	0, settings.NonNegativeInt)
+
 // Experimental observations:
 //   - Sub-level count of ~40 caused a node heartbeat latency p90, p99 of 2.5s,
 //     4s. With a setting that limits sub-level count to 10, before the system
@@ -192,6 +221,85 @@ type ioLoadListener struct {
 
 	l0CompactedBytes *metric.Counter
 	l0TokensProduced *metric.Counter
+
+	// byteTokenGrants accumulates the byte tokens granted to work in each tick
+	// of the current adjustment interval. It is used to measure how smoothly
+	// the tokens were given out, see ByteTokenGrantCV.
+	byteTokenGrants tokenGrantStats
+}
+
+// unlimitedAdmissionRate is the value of the admission rate gauges in
+// IOLoadListenerMetrics when the tokens for the adjustment interval are
+// unlimited.
+const unlimitedAdmissionRate = -1
+
+// IOLoadListenerMetrics are per-store metrics maintained by the
+// ioLoadListener. They are registered in the store's metric registry and
+// supplied to admission control via StoreMetrics.
+type IOLoadListenerMetrics struct {
+	// IOAdmissionRate is the effective rate, in bytes/s, at which regular
+	// work is admitted in the current adjustment interval, i.e., the byte
+	// tokens for the interval divided by its duration.
+	IOAdmissionRate *metric.Gauge
+	// ElasticIOAdmissionRate is the elastic equivalent of IOAdmissionRate.
+	ElasticIOAdmissionRate *metric.Gauge
+	// IngestBandwidth is the rate, in bytes/s, at which sstables were ingested
+	// into the LSM, across all levels, in the last adjustment interval. Bytes
+	// ingested below L0 (e.g. by restore or IMPORT) don't consume the tokens
+	// computed for L0, but do consume disk bandwidth tokens.
+	IngestBandwidth *metric.Gauge
+	// ByteTokenGrantCV is the coefficient of variation (the standard deviation
+	// divided by the mean) of the byte tokens granted to work in each tick of
+	// the last adjustment interval. Tokens are meant to be given out
+	// evenly across the ticks of an interval (see the comment above
+	// adjustmentInterval), so this is expected to stay close to 0; a high value
+	// indicates that tokens were handed out in bursts. It is 0 for intervals
+	// with unlimited tokens.
+	ByteTokenGrantCV *metric.GaugeFloat64
+}
+
+// MetricStruct implements the metric.Struct interface.
+func (*IOLoadListenerMetrics) MetricStruct() {}
+
+// MakeIOLoadListenerMetrics constructs the metrics maintained by the
+// ioLoadListener for a store.
+func MakeIOLoadListenerMetrics() *IOLoadListenerMetrics {
+	return &IOLoadListenerMetrics{
+		IOAdmissionRate:        metric.NewGauge(ioAdmissionRate),
+		ElasticIOAdmissionRate: metric.NewGauge(elasticIOAdmissionRate),
+		IngestBandwidth:        metric.NewGauge(ioIngestBandwidth),
+		ByteTokenGrantCV:       metric.NewGaugeFloat64(ioByteTokenGrantCV),
+	}
+}
+
+// tokenGrantStats accumulates the sizes of the token grants made in the ticks
+// of an adjustment interval.
+type tokenGrantStats struct {
+	count        int64
+	sum          float64
+	sumOfSquares float64
+}
+
+func (s *tokenGrantStats) record(tokens int64) {
+	s.count++
+	s.sum += float64(tokens)
+	s.sumOfSquares += float64(tokens) * float64(tokens)
+}
+
+// coefficientOfVariation returns the standard deviation of the recorded grants
+// divided by their mean, or 0 if nothing was recorded or the recorded grants
+// don't add up to a positive number of tokens (tokens can be returned).
+func (s *tokenGrantStats) coefficientOfVariation() float64 {
+	if s.count == 0 || s.sum <= 0 {
+		return 0
+	}
+	mean := s.sum / float64(s.count)
+	variance := s.sumOfSquares/float64(s.count) - mean*mean
+	if variance < 0 {
+		// Floating point error.
+		variance = 0
+	}
+	return math.Sqrt(variance) / mean
 }
 
 type ioLoadListenerState struct {
@@ -207,6 +315,8 @@ type ioLoadListenerState struct {
 		bytesRead        uint64
 		bytesWritten     uint64
 		incomingLSMBytes uint64
+		// The subset of incomingLSMBytes that was ingested, into any level.
+		ingestedLSMBytes uint64
 	}
 
 	// Exponentially smoothed per interval values.
@@ -336,9 +446,13 @@ const loadedDuration = tickDuration(1 * time.Millisecond)
 // easily determine the remaining ticks, but each tick of time.Ticker can have
 // drift, especially for tiny tick rates like 1ms.
 type tokenAllocationTicker struct {
+	// timeSource is used for ticking and for computing the remaining ticks. If
+	// nil, the system clock is used. Tests can inject a timeutil.ManualTime to
+	// control the passage of time.
+	timeSource                  timeutil.TimeSource
 	expectedTickDuration        time.Duration
 	adjustmentIntervalStartTime time.Time
-	ticker                      *time.Ticker
+	ticker                      timeutil.TickerI
 }
 
 // Start a new adjustment interval. adjustmentStart must be called before tick
@@ -355,16 +469,19 @@ func (t *tokenAllocationTicker) adjustmentStart(loaded bool) {
 		tickDuration = loadedDuration
 	}
 	t.expectedTickDuration = time.Duration(tickDuration)
+	if t.timeSource == nil {
+		t.timeSource = timeutil.DefaultTimeSource{}
+	}
 	if t.ticker == nil {
-		t.ticker = time.NewTicker(t.expectedTickDuration)
+		t.ticker = t.timeSource.NewTicker(t.expectedTickDuration)
 	} else {
 		t.ticker.Reset(t.expectedTickDuration)
 	}
-	t.adjustmentIntervalStartTime = timeutil.Now()
+	t.adjustmentIntervalStartTime = t.timeSource.Now()
 }
 
 func (t *tokenAllocationTicker) tick() {
-	<-t.ticker.C
+	<-t.ticker.Ch()
 }
 
 // remainingTicks will return the remaining ticks before the next adjustment
@@ -372,7 +489,7 @@ func (t *tokenAllocationTicker) tick() {
 // expectedTickDuration. A return value of 0 indicates that adjustmentStart must
 // be called, as the previous adjustmentInterval is over.
 func (t *tokenAllocationTicker) remainingTicks() uint64 {
-	timePassed := timeutil.Since(t.adjustmentIntervalStartTime)
+	timePassed := t.timeSource.Since(t.adjustmentIntervalStartTime)
 	if timePassed > adjustmentInterval*time.Second {
 		return 0
 	}
@@ -382,9 +499,13 @@ func (t *tokenAllocationTicker) remainingTicks() uint64 {
 
 func (t *tokenAllocationTicker) stop() {
 	t.ticker.Stop()
-	*t = tokenAllocationTicker{}
+	*t = tokenAllocationTicker{timeSource: t.timeSource}
 }
 
+// cumLSMWriteAndIngestedBytes returns the cumulative bytes flushed or ingested
+// into the LSM, across all levels. Of these, it also returns the bytes that
+// were ingested into any level, since the ingestion of sstables that don't
+// overlap with L0 (e.g. by restore or IMPORT) bypasses L0 altogether.
 func cumLSMWriteAndIngestedBytes(
 	m *pebble.Metrics,
 ) (writeAndIngestedBytes uint64, ingestedBytes uint64) {
@@ -429,19 +550,47 @@ func (io *ioLoadListener) pebbleMetricsTick(ctx context.Context, metrics StoreMe
 		io.diskBW.bytesRead = metrics.DiskStats.BytesRead
 		io.diskBW.bytesWritten = metrics.DiskStats.BytesWritten
 		io.diskBW.incomingLSMBytes = cumLSMIncomingBytes
+		io.diskBW.ingestedLSMBytes = cumLSMIngestedBytes
 		io.cumFlushWriteThroughput = metrics.Flush.WriteThroughput
 		io.copyAuxEtcFromPerWorkEstimator()
+		io.updateAdmissionRateMetrics(metrics.IOLoadListenerMetrics)
 
 		// Assume system starts off unloaded.
 		return false
 	}
+	if m := metrics.IOLoadListenerMetrics; m != nil {
+		m.ByteTokenGrantCV.Update(io.byteTokenGrants.coefficientOfVariation())
+	}
+	io.byteTokenGrants = tokenGrantStats{}
 	io.adjustTokens(ctx, metrics)
 	io.cumFlushWriteThroughput = metrics.Flush.WriteThroughput
+	io.updateAdmissionRateMetrics(metrics.IOLoadListenerMetrics)
 	// We assume that the system is loaded if there is less than unlimited tokens
 	// available.
 	return io.totalNumByteTokens < unlimitedTokens || io.totalNumElasticByteTokens < unlimitedTokens
 }
 
+// updateAdmissionRateMetrics exports the effective admission rates implied by
+// the tokens computed for the current adjustment interval. Unlimited tokens
+// are exported as unlimitedAdmissionRate.
+func (io *ioLoadListener) updateAdmissionRateMetrics(m *IOLoadListenerMetrics) {
+	if m == nil {
+		return
+	}
+	m.IOAdmissionRate.Update(admissionRate(io.totalNumByteTokens))
+	m.ElasticIOAdmissionRate.Update(admissionRate(io.totalNumElasticByteTokens))
+	m.IngestBandwidth.Update(io.aux.diskBW.intervalLSMInfo.ingestedBytes / adjustmentInterval)
+}
+
+// admissionRate returns the rate, in bytes/s, at which the given byte tokens
+// are handed out over an adjustment interval.
+func admissionRate(tokens int64) int64 {
+	if tokens >= unlimitedTokens {
+		return unlimitedAdmissionRate
+	}
+	return tokens / adjustmentInterval
+}
+
 // For both byte and disk bandwidth tokens, allocateTokensTick gives out
 // remainingTokens/remainingTicks tokens in the current tick.
 func (io *ioLoadListener) allocateTokensTick(remainingTicks int64) {
@@ -527,6 +676,12 @@ func (io *ioLoadListener) allocateTokensTick(remainingTicks int64) {
 	)
 	io.byteTokensUsed += tokensUsed
 	io.byteTokensUsedByElasticWork += tokensUsedByElasticWork
+	// NB: tokensUsed are the tokens granted since the previous tick, as opposed
+	// to toAllocateByteTokens, which are the tokens made available for the next
+	// one and are spread evenly by construction.
+	if io.totalNumByteTokens < unlimitedTokens {
+		io.byteTokenGrants.record(tokensUsed)
+	}
 }
 
 func computeIntervalDiskLoadInfo(
@@ -549,6 +704,7 @@ func computeIntervalDiskLoadInfo(
 // memtable counts, which we want to avoid as it can cause latency hiccups of
 // 100+ms for all write traffic.
 func (io *ioLoadListener) adjustTokens(ctx context.Context, metrics StoreMetrics) {
+	tokensOverride := ByteTokensOverrideForTesting.Get(&io.settings.SV)
 	sas := io.kvRequester.getStoreAdmissionStats()
 	// Copy the cumulative disk bandwidth values for later use.
 	cumDiskBW := io.ioLoadListenerState.diskBW
@@ -562,6 +718,16 @@ func (io *ioLoadListener) adjustTokens(ctx context.Context, metrics StoreMetrics
 		L0MinimumSizePerSubLevel.Get(&io.settings.SV),
 		MinFlushUtilizationFraction.Get(&io.settings.SV),
 	)
+	if tokensOverride > 0 {
+		// NB: the tokens are still computed above, so that the cumulative stats
+		// and smoothed values remain up to date if the override is removed.
+		log.Warningf(ctx, "IO byte tokens overridden to %s (computed: %s) by %s; "+
+			"this setting is for testing only",
+			humanizeutil.IBytes(tokensOverride), humanizeutil.IBytes(res.totalNumByteTokens),
+			ByteTokensOverrideForTesting.Name())
+		res.totalNumByteTokens = tokensOverride
+		res.totalNumElasticByteTokens = min(res.totalNumElasticByteTokens, tokensOverride)
+	}
 	io.adjustTokensResult = res
 	cumLSMIncomingBytes, cumLSMIngestedBytes := cumLSMWriteAndIngestedBytes(metrics.Metrics)
 	{
@@ -571,6 +737,7 @@ func (io *ioLoadListener) adjustTokens(ctx context.Context, metrics StoreMetrics
 		diskTokensUsed := io.kvGranter.getDiskTokensUsedAndReset()
 		io.aux.diskBW.intervalLSMInfo = intervalLSMInfo{
 			incomingBytes:     int64(cumLSMIncomingBytes) - int64(cumDiskBW.incomingLSMBytes),
+			ingestedBytes:     int64(cumLSMIngestedBytes) - int64(cumDiskBW.ingestedLSMBytes),
 			regularTokensUsed: diskTokensUsed[admissionpb.RegularWorkClass],
 			elasticTokensUsed: diskTokensUsed[admissionpb.ElasticWorkClass],
 		}
@@ -586,6 +753,7 @@ func (io *ioLoadListener) adjustTokens(ctx context.Context, metrics StoreMetrics
 		io.diskBW.bytesRead = metrics.DiskStats.BytesRead
 		io.diskBW.bytesWritten = metrics.DiskStats.BytesWritten
 		io.diskBW.incomingLSMBytes = cumLSMIncomingBytes
+		io.diskBW.ingestedLSMBytes = cumLSMIngestedBytes
 	}
 	io.perWorkTokenEstimator.updateEstimates(metrics.Levels[0], cumLSMIngestedBytes, sas)
 	io.copyAuxEtcFromPerWorkEstimator()
@@ -596,6 +764,14 @@ func (io *ioLoadListener) adjustTokens(ctx context.Context, metrics StoreMetrics
 	if io.aux.doLogFlush || io.elasticDiskBWTokens != unlimitedTokens || log.V(1) {
 		log.Infof(ctx, "IO overload: %s", io.adjustTokensResult)
 	}
+	if StructuredTokenLoggingEnabled.Get(&io.settings.SV) {
+		decision := io.adjustTokensResult.tokenDecision(io.storeID)
+		if b, err := json.Marshal(decision); err != nil {
+			log.Warningf(ctx, "unable to encode IO token decision: %v", err)
+		} else {
+			log.Infof(ctx, "IO token decision: %s", redact.SafeString(b))
+		}
+	}
 }
 
 // copyAuxEtcFromPerWorkEstimator copies the auxiliary and other numerical
@@ -1011,6 +1187,68 @@ type adjustTokensResult struct {
 	ioThreshold      *admissionpb.IOThreshold // never nil
 }
 
+// ioTokenDecision is the structured record of the inputs and outputs of an
+// adjustment interval's token computation that is logged when
+// StructuredTokenLoggingEnabled is set. Byte quantities are in bytes and token
+// counts of math.MaxInt64 represent unlimited tokens.
+type ioTokenDecision struct {
+	StoreID roachpb.StoreID `json:"store_id"`
+
+	// Inputs.
+	L0NumFiles                  int64   `json:"l0_num_files"`
+	L0NumSubLevels              int64   `json:"l0_num_sub_levels"`
+	L0Bytes                     int64   `json:"l0_bytes"`
+	IntL0AddedBytes             int64   `json:"int_l0_added_bytes"`
+	IntL0CompactedBytes         int64   `json:"int_l0_compacted_bytes"`
+	SmoothedIntL0CompactedBytes int64   `json:"smoothed_int_l0_compacted_bytes"`
+	IntFlushTokens              float64 `json:"int_flush_tokens"`
+	IntFlushUtilization         float64 `json:"int_flush_utilization"`
+	IntWriteStalls              int64   `json:"int_write_stalls"`
+	PrevTokensUsed              int64   `json:"prev_tokens_used"`
+	PrevTokensUsedByElasticWork int64   `json:"prev_tokens_used_by_elastic_work"`
+	IntIngestedBytes            int64   `json:"int_ingested_bytes"`
+
+	// Outputs.
+	TokenKind                    string  `json:"token_kind"`
+	SmoothedCompactionByteTokens float64 `json:"smoothed_compaction_byte_tokens"`
+	SmoothedNumFlushTokens       float64 `json:"smoothed_num_flush_tokens"`
+	FlushUtilTargetFraction      float64 `json:"flush_util_target_fraction"`
+	TotalNumByteTokens           int64   `json:"total_num_byte_tokens"`
+	TotalNumElasticByteTokens    int64   `json:"total_num_elastic_byte_tokens"`
+	ElasticDiskBWTokens          int64   `json:"elastic_disk_bw_tokens"`
+}
+
+// tokenDecision returns the structured record of the token computation that
+// produced res.
+func (res adjustTokensResult) tokenDecision(storeID roachpb.StoreID) ioTokenDecision {
+	kind := "compaction"
+	if res.aux.tokenKind == flushTokenKind {
+		kind = "flush"
+	}
+	return ioTokenDecision{
+		StoreID:                      storeID,
+		L0NumFiles:                   res.ioThreshold.L0NumFiles,
+		L0NumSubLevels:               res.ioThreshold.L0NumSubLevels,
+		L0Bytes:                      res.curL0Bytes,
+		IntL0AddedBytes:              res.aux.intL0AddedBytes,
+		IntL0CompactedBytes:          res.aux.intL0CompactedBytes,
+		IntIngestedBytes:             res.aux.diskBW.intervalLSMInfo.ingestedBytes,
+		SmoothedIntL0CompactedBytes:  res.smoothedIntL0CompactedBytes,
+		IntFlushTokens:               res.aux.intFlushTokens,
+		IntFlushUtilization:          res.aux.intFlushUtilization,
+		IntWriteStalls:               res.aux.intWriteStalls,
+		PrevTokensUsed:               res.aux.prevTokensUsed,
+		PrevTokensUsedByElasticWork:  res.aux.prevTokensUsedByElasticWork,
+		TokenKind:                    kind,
+		SmoothedCompactionByteTokens: res.smoothedCompactionByteTokens,
+		SmoothedNumFlushTokens:       res.smoothedNumFlushTokens,
+		FlushUtilTargetFraction:      res.flushUtilTargetFraction,
+		TotalNumByteTokens:           res.totalNumByteTokens,
+		TotalNumElasticByteTokens:    res.totalNumElasticByteTokens,
+		ElasticDiskBWTokens:          res.elasticDiskBWTokens,
+	}
+}
+
 func (res adjustTokensResult) SafeFormat(p redact.SafePrinter, _ rune) {
 	ib := humanizeutil.IBytes
 	// NB: "≈" indicates smoothed quantities.
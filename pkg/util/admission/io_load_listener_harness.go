@@ -0,0 +1,233 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package admission
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/util/admission/admissionpb"
+	"github.com/cockroachdb/cockroach/pkg/util/buildutil"
+	"github.com/cockroachdb/cockroach/pkg/util/metric"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble"
+)
+
+// SyntheticPebbleMetrics describes the behavior of a store's LSM over one
+// adjustment interval, for use with IOLoadListenerTestHarness. Fields
+// describing activity are deltas over the interval; the harness accumulates
+// them into the cumulative metrics that pebble reports. Fields describing L0
+// are its state at the end of the interval.
+type SyntheticPebbleMetrics struct {
+	// L0AddedWriteBytes and L0AddedIngestedBytes are the bytes added to L0 by
+	// flushes and ingestions, respectively.
+	L0AddedWriteBytes    uint64
+	L0AddedIngestedBytes uint64
+	// L0Bytes, L0Files and L0SubLevels describe L0.
+	L0Bytes     int64
+	L0Files     int64
+	L0SubLevels int32
+	// WriteStalls is the number of write stalls.
+	WriteStalls int64
+	// FlushBytes, FlushWorkDuration and FlushIdleDuration describe the flush
+	// throughput.
+	FlushBytes        int64
+	FlushWorkDuration time.Duration
+	FlushIdleDuration time.Duration
+	// AdmittedWorkCount, AdmittedWriteBytes and AdmittedIngestedBytes describe
+	// the work admitted by the store's WorkQueue.
+	AdmittedWorkCount     uint64
+	AdmittedWriteBytes    uint64
+	AdmittedIngestedBytes uint64
+	// AllTokensUsed, if set, causes all the byte tokens handed out during the
+	// interval to be reported as used.
+	AllTokensUsed bool
+}
+
+// IOLoadListenerTokens describes the tokens computed by the ioLoadListener
+// for an adjustment interval, and how they were handed out.
+type IOLoadListenerTokens struct {
+	// Loaded is true iff the store was considered loaded, which determines the
+	// tick rate over the interval.
+	Loaded bool
+	// ByteTokens and ElasticByteTokens are the byte tokens computed for the
+	// interval. A value of math.MaxInt64 represents unlimited tokens.
+	ByteTokens        int64
+	ElasticByteTokens int64
+	// ElasticDiskBWTokens are the disk bandwidth tokens computed for elastic
+	// work in the interval. A value of math.MaxInt64 represents unlimited
+	// tokens.
+	ElasticDiskBWTokens int64
+	// Ticks is the number of ticks over which tokens were handed out.
+	Ticks int
+	// ByteTokensAllocated and ElasticByteTokensAllocated are the sums of the
+	// byte tokens handed out over all the ticks in the interval.
+	ByteTokensAllocated        int64
+	ElasticByteTokensAllocated int64
+	// Summary is a human readable description of the computation.
+	Summary string
+}
+
+// IOLoadListenerTestHarness drives an ioLoadListener with a scripted sequence
+// of SyntheticPebbleMetrics, one per adjustment interval, and reports the
+// resulting tokens. Time is controlled by the supplied timeutil.ManualTime,
+// which the harness advances tick by tick through each adjustment interval.
+// It can only be used in test builds.
+type IOLoadListenerTestHarness struct {
+	ioll       *ioLoadListener
+	requester  *harnessRequester
+	granter    *harnessGranter
+	ticker     tokenAllocationTicker
+	timeSource *timeutil.ManualTime
+
+	// Cumulative metrics, as reported by pebble.
+	metrics         pebble.Metrics
+	writeStallCount int64
+}
+
+// NewIOLoadListenerTestHarness returns an IOLoadListenerTestHarness using the
+// supplied settings and time source.
+func NewIOLoadListenerTestHarness(
+	st *cluster.Settings, timeSource *timeutil.ManualTime,
+) *IOLoadListenerTestHarness {
+	if !buildutil.CrdbTestBuild {
+		panic(errors.AssertionFailedf("IOLoadListenerTestHarness can only be used in test builds"))
+	}
+	h := &IOLoadListenerTestHarness{
+		requester:  &harnessRequester{},
+		granter:    &harnessGranter{},
+		ticker:     tokenAllocationTicker{timeSource: timeSource},
+		timeSource: timeSource,
+	}
+	h.ioll = &ioLoadListener{
+		settings:              st,
+		kvRequester:           h.requester,
+		kvGranter:             h.granter,
+		perWorkTokenEstimator: makeStorePerWorkTokenEstimator(),
+		diskBandwidthLimiter:  makeDiskBandwidthLimiter(),
+		l0CompactedBytes:      metric.NewCounter(l0CompactedBytes),
+		l0TokensProduced:      metric.NewCounter(l0TokensProduced),
+	}
+	return h
+}
+
+// Step feeds the supplied metrics to the ioLoadListener, as happens at the
+// start of every adjustment interval, and then ticks through the interval,
+// handing out the computed tokens. The first call initializes the
+// ioLoadListener's stats, and always results in unlimited tokens.
+func (h *IOLoadListenerTestHarness) Step(
+	ctx context.Context, m SyntheticPebbleMetrics,
+) IOLoadListenerTokens {
+	l0 := &h.metrics.Levels[0]
+	l0.BytesFlushed += m.L0AddedWriteBytes
+	l0.BytesIngested += m.L0AddedIngestedBytes
+	l0.Size = m.L0Bytes
+	l0.NumFiles = m.L0Files
+	l0.Sublevels = m.L0SubLevels
+	h.writeStallCount += m.WriteStalls
+	wt := &h.metrics.Flush.WriteThroughput
+	wt.Bytes += m.FlushBytes
+	wt.WorkDuration += m.FlushWorkDuration
+	wt.IdleDuration += m.FlushIdleDuration
+	h.requester.stats.workCount += m.AdmittedWorkCount
+	h.requester.stats.writeAccountedBytes += m.AdmittedWriteBytes
+	h.requester.stats.ingestedAccountedBytes += m.AdmittedIngestedBytes
+	h.granter.allTokensUsed = m.AllTokensUsed
+
+	metrics := h.metrics
+	loaded := h.ioll.pebbleMetricsTick(ctx, StoreMetrics{
+		Metrics:         &metrics,
+		WriteStallCount: h.writeStallCount,
+	})
+	res := IOLoadListenerTokens{
+		Loaded:              loaded,
+		ByteTokens:          h.ioll.totalNumByteTokens,
+		ElasticByteTokens:   h.ioll.totalNumElasticByteTokens,
+		ElasticDiskBWTokens: h.ioll.elasticDiskBWTokens,
+		Summary:             h.ioll.adjustTokensResult.String(),
+	}
+	h.granter.ioTokens, h.granter.elasticIOTokens = 0, 0
+	h.ticker.adjustmentStart(loaded)
+	for {
+		remainingTicks := h.ticker.remainingTicks()
+		if remainingTicks == 0 {
+			break
+		}
+		h.ioll.allocateTokensTick(int64(remainingTicks))
+		res.Ticks++
+		h.timeSource.Advance(h.ticker.expectedTickDuration)
+		h.ticker.tick()
+	}
+	res.ByteTokensAllocated = h.granter.ioTokens
+	res.ElasticByteTokensAllocated = h.granter.elasticIOTokens
+	return res
+}
+
+// Close releases the resources held by the harness.
+func (h *IOLoadListenerTestHarness) Close() {
+	if h.ticker.ticker != nil {
+		h.ticker.stop()
+	}
+}
+
+// harnessRequester is the storeRequester used by IOLoadListenerTestHarness.
+type harnessRequester struct {
+	stats storeAdmissionStats
+}
+
+var _ storeRequester = &harnessRequester{}
+
+func (r *harnessRequester) close() {}
+
+func (r *harnessRequester) getRequesters() [admissionpb.NumWorkClasses]requester {
+	panic(errors.AssertionFailedf("unimplemented"))
+}
+
+func (r *harnessRequester) getStoreAdmissionStats() storeAdmissionStats {
+	return r.stats
+}
+
+func (r *harnessRequester) setStoreRequestEstimates(storeRequestEstimates) {}
+
+// harnessGranter is the granterWithIOTokens used by
+// IOLoadListenerTestHarness. It accumulates the tokens handed out.
+type harnessGranter struct {
+	allTokensUsed   bool
+	ioTokens        int64
+	elasticIOTokens int64
+}
+
+var _ granterWithIOTokens = &harnessGranter{}
+
+func (g *harnessGranter) setAvailableTokens(
+	ioTokens int64,
+	elasticIOTokens int64,
+	_ int64,
+	_ int64,
+	_ int64,
+	_ int64,
+	_ bool,
+) (tokensUsed int64, tokensUsedByElasticWork int64) {
+	g.ioTokens += ioTokens
+	g.elasticIOTokens += elasticIOTokens
+	if g.allTokensUsed {
+		return ioTokens, 0
+	}
+	return 0, 0
+}
+
+func (g *harnessGranter) getDiskTokensUsedAndReset() [admissionpb.NumWorkClasses]int64 {
+	return [admissionpb.NumWorkClasses]int64{}
+}
+
+func (g *harnessGranter) setLinearModels(tokensLinearModel, tokensLinearModel, tokensLinearModel) {}
@@ -12,6 +12,7 @@ package admission
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math"
 	"math/rand"
@@ -20,6 +21,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
 	"github.com/cockroachdb/cockroach/pkg/testutils/datapathutils"
 	"github.com/cockroachdb/cockroach/pkg/testutils/echotest"
@@ -243,6 +245,39 @@ func TestIOLoadListenerOverflow(t *testing.T) {
 	ioll.allocateTokensTick(unloadedDuration.ticksInAdjustmentInterval())
 }
 
+// TestIOLoadListenerByteTokensOverride tests that ByteTokensOverrideForTesting
+// pins the byte tokens given out in an adjustment interval, and that the
+// computed tokens are used again once the override is removed.
+func TestIOLoadListenerByteTokensOverride(t *testing.T) {
+	req := &testRequesterForIOLL{}
+	kvGranter := &testGranterWithIOTokens{}
+	ctx := context.Background()
+	st := cluster.MakeTestingClusterSettings()
+	ioll := ioLoadListener{
+		settings:         st,
+		kvRequester:      req,
+		l0CompactedBytes: metric.NewCounter(l0CompactedBytes),
+		l0TokensProduced: metric.NewCounter(l0TokensProduced),
+	}
+	ioll.kvGranter = kvGranter
+	m := pebble.Metrics{}
+	m.Levels[0] = pebble.LevelMetrics{Sublevels: 1, NumFiles: 1}
+	ioll.pebbleMetricsTick(ctx, StoreMetrics{Metrics: &m})
+
+	// The store is healthy, so the computed tokens are unlimited.
+	ioll.pebbleMetricsTick(ctx, StoreMetrics{Metrics: &m})
+	require.Equal(t, int64(unlimitedTokens), ioll.totalNumByteTokens)
+
+	ByteTokensOverrideForTesting.Override(ctx, &st.SV, 1000)
+	ioll.pebbleMetricsTick(ctx, StoreMetrics{Metrics: &m})
+	require.Equal(t, int64(1000), ioll.totalNumByteTokens)
+	require.Equal(t, int64(1000), ioll.totalNumElasticByteTokens)
+
+	ByteTokensOverrideForTesting.Override(ctx, &st.SV, 0)
+	ioll.pebbleMetricsTick(ctx, StoreMetrics{Metrics: &m})
+	require.Equal(t, int64(unlimitedTokens), ioll.totalNumByteTokens)
+}
+
 // TODO(sumeer): we now do more work outside adjustTokensInner, so the parts
 // of the adjustTokensResult computed by adjustTokensInner has become a subset
 // of what is logged below, and the rest is logged with 0 values. Expand this
@@ -293,6 +328,51 @@ func TestAdjustTokensInnerAndLogging(t *testing.T) {
 	echotest.Require(t, string(redact.Sprint(buf)), filepath.Join(datapathutils.TestDataPath(t, "format_adjust_tokens_stats.txt")))
 }
 
+// TestIOTokenDecision tests that the structured record of a token computation
+// reflects its inputs and outputs, and can be encoded as JSON.
+func TestIOTokenDecision(t *testing.T) {
+	const mb = 1 << 20
+	ioll := &ioLoadListener{
+		settings:         cluster.MakeTestingClusterSettings(),
+		l0CompactedBytes: metric.NewCounter(l0CompactedBytes),
+		l0TokensProduced: metric.NewCounter(l0TokensProduced),
+	}
+	prev := ioLoadListenerState{
+		cumL0AddedBytes:              1402 * mb,
+		curL0Bytes:                   400 * mb,
+		cumWriteStallCount:           10,
+		smoothedIntL0CompactedBytes:  47 * mb,
+		smoothedCompactionByteTokens: 201 * mb,
+		totalNumByteTokens:           int64(201 * mb),
+	}
+	l0Metrics := pebble.LevelMetrics{
+		Sublevels:     27,
+		NumFiles:      195,
+		Size:          900 * mb,
+		BytesIngested: 1801 * mb,
+		BytesFlushed:  178 * mb,
+	}
+	res := ioll.adjustTokensInner(
+		context.Background(), prev, l0Metrics, 12, pebble.ThroughputMetric{}, 100, 10, 0, 0.50)
+
+	decision := res.tokenDecision(3)
+	require.Equal(t, roachpb.StoreID(3), decision.StoreID)
+	require.Equal(t, int64(195), decision.L0NumFiles)
+	require.Equal(t, int64(27), decision.L0NumSubLevels)
+	require.Equal(t, int64(900*mb), decision.L0Bytes)
+	require.Equal(t, int64(2), decision.IntWriteStalls)
+	require.Equal(t, res.aux.intL0AddedBytes, decision.IntL0AddedBytes)
+	require.Equal(t, res.aux.intL0CompactedBytes, decision.IntL0CompactedBytes)
+	require.Equal(t, res.totalNumByteTokens, decision.TotalNumByteTokens)
+	require.Equal(t, res.totalNumElasticByteTokens, decision.TotalNumElasticByteTokens)
+
+	b, err := json.Marshal(decision)
+	require.NoError(t, err)
+	var decoded ioTokenDecision
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	require.Equal(t, decision, decoded)
+}
+
 // TestBadIOLoadListenerStats tests that bad stats (non-monotonic cumulative
 // stats and negative values) don't cause panics or tokens to be negative.
 func TestBadIOLoadListenerStats(t *testing.T) {
@@ -350,6 +430,155 @@ func TestBadIOLoadListenerStats(t *testing.T) {
 	}
 }
 
+func TestIOLoadListenerAdmissionRateMetrics(t *testing.T) {
+	var m pebble.Metrics
+	st := cluster.MakeTestingClusterSettings()
+	ioll := ioLoadListener{
+		settings:              st,
+		kvRequester:           &testRequesterForIOLL{},
+		perWorkTokenEstimator: makeStorePerWorkTokenEstimator(),
+		diskBandwidthLimiter:  makeDiskBandwidthLimiter(),
+		l0CompactedBytes:      metric.NewCounter(l0CompactedBytes),
+		l0TokensProduced:      metric.NewCounter(l0TokensProduced),
+	}
+	metrics := MakeIOLoadListenerMetrics()
+	// The first interval has unlimited tokens, which is reported as such rather
+	// than as a huge rate.
+	ioll.pebbleMetricsTick(context.Background(), StoreMetrics{
+		Metrics:               &m,
+		IOLoadListenerMetrics: metrics,
+	})
+	require.Equal(t, int64(unlimitedAdmissionRate), metrics.IOAdmissionRate.Value())
+	require.Equal(t, int64(unlimitedAdmissionRate), metrics.ElasticIOAdmissionRate.Value())
+
+	ioll.totalNumByteTokens = 150 << 20
+	ioll.totalNumElasticByteTokens = 30 << 20
+	ioll.updateAdmissionRateMetrics(metrics)
+	require.Equal(t, int64(10<<20), metrics.IOAdmissionRate.Value())
+	require.Equal(t, int64(2<<20), metrics.ElasticIOAdmissionRate.Value())
+
+	ioll.totalNumElasticByteTokens = unlimitedTokens
+	ioll.updateAdmissionRateMetrics(metrics)
+	require.Equal(t, int64(10<<20), metrics.IOAdmissionRate.Value())
+	require.Equal(t, int64(unlimitedAdmissionRate), metrics.ElasticIOAdmissionRate.Value())
+}
+
+// TestIOLoadListenerIngestedBytes tests that the bytes ingested into all levels
+// of the LSM, including those below L0, are accounted for in the interval
+// stats and exported as the ingest bandwidth.
+func TestIOLoadListenerIngestedBytes(t *testing.T) {
+	const mb = 1 << 20
+	var m pebble.Metrics
+	ioll := ioLoadListener{
+		settings:              cluster.MakeTestingClusterSettings(),
+		kvRequester:           &testRequesterForIOLL{},
+		kvGranter:             &testGranterWithIOTokens{},
+		perWorkTokenEstimator: makeStorePerWorkTokenEstimator(),
+		diskBandwidthLimiter:  makeDiskBandwidthLimiter(),
+		l0CompactedBytes:      metric.NewCounter(l0CompactedBytes),
+		l0TokensProduced:      metric.NewCounter(l0TokensProduced),
+	}
+	metrics := MakeIOLoadListenerMetrics()
+	ioll.pebbleMetricsTick(context.Background(), StoreMetrics{
+		Metrics:               &m,
+		IOLoadListenerMetrics: metrics,
+	})
+	require.Equal(t, int64(0), metrics.IngestBandwidth.Value())
+
+	m.Levels[0].BytesFlushed = 60 * mb
+	m.Levels[0].BytesIngested = 15 * mb
+	m.Levels[3].BytesIngested = 30 * mb
+	ioll.pebbleMetricsTick(context.Background(), StoreMetrics{
+		Metrics:               &m,
+		IOLoadListenerMetrics: metrics,
+	})
+	lsmInfo := ioll.aux.diskBW.intervalLSMInfo
+	require.Equal(t, int64(105*mb), lsmInfo.incomingBytes)
+	require.Equal(t, int64(45*mb), lsmInfo.ingestedBytes)
+	require.Equal(t, int64(3*mb), metrics.IngestBandwidth.Value())
+}
+
+// TestIOLoadListenerByteTokenGrantCV tests that the smoothness of the byte
+// tokens actually granted in each tick of an adjustment interval is exported
+// when the next interval starts.
+func TestIOLoadListenerByteTokenGrantCV(t *testing.T) {
+	var m pebble.Metrics
+	granter := &testGranterWithTokensUsed{}
+	ioll := ioLoadListener{
+		settings:              cluster.MakeTestingClusterSettings(),
+		kvRequester:           &testRequesterForIOLL{},
+		kvGranter:             granter,
+		perWorkTokenEstimator: makeStorePerWorkTokenEstimator(),
+		diskBandwidthLimiter:  makeDiskBandwidthLimiter(),
+		l0CompactedBytes:      metric.NewCounter(l0CompactedBytes),
+		l0TokensProduced:      metric.NewCounter(l0TokensProduced),
+	}
+	metrics := MakeIOLoadListenerMetrics()
+	tick := func() {
+		ioll.pebbleMetricsTick(context.Background(), StoreMetrics{
+			Metrics:               &m,
+			IOLoadListenerMetrics: metrics,
+		})
+	}
+	ticks := unloadedDuration.ticksInAdjustmentInterval()
+	allocate := func() {
+		ioll.totalNumByteTokens = 15000
+		ioll.byteTokensAllocated = 0
+		for i := int64(0); i < ticks; i++ {
+			ioll.allocateTokensTick(ticks - i)
+		}
+	}
+
+	// Grants of unlimited tokens are not measured.
+	granter.tokensUsed = func() int64 { return 1000 }
+	tick()
+	for i := int64(0); i < ticks; i++ {
+		ioll.allocateTokensTick(ticks - i)
+	}
+	tick()
+	require.Zero(t, metrics.ByteTokenGrantCV.Value())
+
+	// Tokens that are used evenly across the ticks have no variation.
+	granter.tokensUsed = func() int64 { return 15000 / ticks }
+	allocate()
+	tick()
+	require.Zero(t, metrics.ByteTokenGrantCV.Value())
+
+	// The tokens made available are spread evenly across the ticks, but if
+	// they're all granted in a single tick, the mean grant is 15000/ticks and
+	// the standard deviation is sqrt(ticks-1) times that.
+	var calls int64
+	granter.tokensUsed = func() int64 {
+		calls++
+		if calls == ticks {
+			return 15000
+		}
+		return 0
+	}
+	allocate()
+	tick()
+	require.InDelta(t, math.Sqrt(float64(ticks-1)), metrics.ByteTokenGrantCV.Value(), 1e-9)
+}
+
+// testGranterWithTokensUsed is a testGranterWithIOTokens that reports the
+// tokens returned by tokensUsed as used in each tick.
+type testGranterWithTokensUsed struct {
+	testGranterWithIOTokens
+	tokensUsed func() int64
+}
+
+func (g *testGranterWithTokensUsed) setAvailableTokens(
+	ioTokens int64,
+	elasticIOTokens int64,
+	elasticDiskBandwidthTokens int64,
+	maxIOTokens int64,
+	maxElasticIOTokens int64,
+	maxElasticDiskBandwidthTokens int64,
+	lastTick bool,
+) (tokensUsed int64, tokensUsedByElasticWork int64) {
+	return g.tokensUsed(), 0
+}
+
 type testRequesterForIOLL struct {
 	stats storeAdmissionStats
 	buf   strings.Builder
@@ -505,34 +734,77 @@ func TestTokenAllocationTickerAdjustmentCalculation(t *testing.T) {
 }
 
 func TestTokenAllocationTicker(t *testing.T) {
-	// TODO(bananabrick): This might be flaky, in which case we should use a
-	// timeutil.TimeSource and ManualTime in the tokenAllocationTicker for these
-	// tests.
-	ticker := tokenAllocationTicker{}
+	mt := timeutil.NewManualTime(timeutil.Unix(0, 0))
+	ticker := tokenAllocationTicker{timeSource: mt}
 	defer ticker.stop()
 
 	// Test remainingTicks calculations.
 	ticker.adjustmentStart(false /* loaded */)
 	require.Equal(t, 60, int(ticker.remainingTicks()))
-	time.Sleep(1 * time.Second)
-	// At least one second has passed, we assume that 2 seconds could've passed.
-	// So, we have 13-14 seconds remaining.
-	remaining := ticker.remainingTicks()
-	if remaining < 52 || remaining > 56 {
-		t.FailNow()
-	}
+	mt.Advance(1 * time.Second)
+	ticker.tick()
+	require.Equal(t, 56, int(ticker.remainingTicks()))
 
-	ticker.adjustmentStart(true /* unloaded */)
+	ticker.adjustmentStart(true /* loaded */)
 	require.Equal(t, 15000, int(ticker.remainingTicks()))
-	time.Sleep(1 * time.Second)
-	// At least one second has passed. Assume an error of at most one seconds, so
-	// at most 2 seconds have passed. So, we have 13-14 seconds remaining.
-	remaining = ticker.remainingTicks()
-	if remaining > 14000 || remaining < 13000 {
-		t.FailNow()
-	}
+	mt.Advance(1 * time.Second)
+	ticker.tick()
+	require.Equal(t, 14000, int(ticker.remainingTicks()))
 
 	// Skip to the future in which case remainingTicks must be exhausted.
-	ticker.adjustmentIntervalStartTime = timeutil.Now().Add(-17 * time.Second)
+	ticker.adjustmentIntervalStartTime = mt.Now().Add(-17 * time.Second)
 	require.Equal(t, 0, int(ticker.remainingTicks()))
 }
+
+// TestIOLoadListenerTestHarness uses IOLoadListenerTestHarness to drive an
+// ioLoadListener through a store whose L0 goes from healthy to overloaded, as
+// in the experiment described alongside adjustmentInterval.
+func TestIOLoadListenerTestHarness(t *testing.T) {
+	const mb = 1 << 20
+	ctx := context.Background()
+	st := cluster.MakeTestingClusterSettings()
+	L0MinimumSizePerSubLevel.Override(ctx, &st.SV, 0)
+	h := NewIOLoadListenerTestHarness(st, timeutil.NewManualTime(timeutil.Unix(0, 0)))
+	defer h.Close()
+
+	// The first interval initializes the stats, and has unlimited tokens.
+	res := h.Step(ctx, SyntheticPebbleMetrics{})
+	require.False(t, res.Loaded)
+	require.Equal(t, int64(unlimitedTokens), res.ByteTokens)
+	require.Equal(t, int64(unlimitedTokens), res.ElasticByteTokens)
+	require.Equal(t, 60, res.Ticks)
+
+	// 900MB is compacted out of L0, which has 2 sub-levels. Regular work is
+	// not limited, but elastic work is, so the store is loaded and tokens are
+	// handed out every 1ms.
+	res = h.Step(ctx, SyntheticPebbleMetrics{
+		L0AddedWriteBytes: 1000 * mb,
+		L0Bytes:           100 * mb,
+		L0Files:           10,
+		L0SubLevels:       2,
+	})
+	require.True(t, res.Loaded)
+	require.Equal(t, int64(unlimitedTokens), res.ByteTokens)
+	require.Less(t, res.ElasticByteTokens, int64(unlimitedTokens))
+	require.Less(t, int64(0), res.ElasticByteTokens)
+	require.Equal(t, 15000, res.Ticks)
+
+	// Another 900MB is compacted out of L0, but it now has 40 sub-levels, i.e.,
+	// twice the overload threshold. Regular work is limited to half the
+	// smoothed compacted bytes (675MB), which is then smoothed with the
+	// previous compaction tokens (450MB): (675MB/2+450MB)/2. Elastic work gets
+	// a single token.
+	res = h.Step(ctx, SyntheticPebbleMetrics{
+		L0AddedWriteBytes: 1000 * mb,
+		L0Bytes:           200 * mb,
+		L0Files:           100,
+		L0SubLevels:       40,
+	})
+	require.True(t, res.Loaded)
+	require.Equal(t, int64(412876800), res.ByteTokens)
+	require.Equal(t, int64(1), res.ElasticByteTokens)
+	require.Equal(t, 15000, res.Ticks)
+	// All the computed tokens are handed out over the interval.
+	require.Equal(t, res.ByteTokens, res.ByteTokensAllocated)
+	require.Equal(t, res.ElasticByteTokens, res.ElasticByteTokensAllocated)
+}
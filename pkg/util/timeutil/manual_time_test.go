@@ -165,4 +165,28 @@ func TestManualTime(t *testing.T) {
 		ensureNoSend(t, t1.Ch())
 		ensureNoSend(t, t2.Ch())
 	})
+
+	t.Run("Ticker reset", func(t *testing.T) {
+		mt := timeutil.NewManualTime(t0)
+		advanceTo := func(d time.Duration) {
+			mt.AdvanceTo(t0.Add(d))
+		}
+		t1 := mt.NewTicker(1 * time.Second)
+
+		advanceTo(1 * time.Second)
+		ensureSend(t, t1.Ch(), 1*time.Second)
+
+		// The next tick is a full period after the reset.
+		advanceTo(1500 * time.Millisecond)
+		t1.Reset(2 * time.Second)
+		advanceTo(3 * time.Second)
+		ensureNoSend(t, t1.Ch())
+
+		advanceTo(3500 * time.Millisecond)
+		ensureSend(t, t1.Ch(), 3500*time.Millisecond)
+
+		advanceTo(5500 * time.Millisecond)
+		ensureSend(t, t1.Ch(), 5500*time.Millisecond)
+		t1.Stop()
+	})
 }